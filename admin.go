@@ -0,0 +1,1324 @@
+package main;
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/logging"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/zishang520/socket.io/v2/socket"
+
+	"github.com/samott/crash-backend/auth"
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/game"
+	"github.com/samott/crash-backend/indexer"
+	"github.com/samott/crash-backend/payouts"
+	"github.com/samott/crash-backend/signer"
+	"github.com/samott/crash-backend/solvency"
+	"github.com/samott/crash-backend/velocity"
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+const REVOKED_BY_ROLES = "roles";
+
+type adminKey struct{};
+
+/**
+ * What admin endpoints need to check callers and record their calls.
+ */
+type AdminAccess struct {
+	tokens *auth.Tokens;
+	sessions *auth.SessionStore;
+	db *sql.DB;
+	logger *logging.Logger;
+}
+
+func NewAdminAccess(
+	tokens *auth.Tokens,
+	sessions *auth.SessionStore,
+	db *sql.DB,
+	logger *logging.Logger,
+) *AdminAccess {
+	return &AdminAccess{
+		tokens: tokens,
+		sessions: sessions,
+		db: db,
+		logger: logger,
+	};
+}
+
+/**
+ * Remembers the status a handler answered with, for the audit log.
+ */
+type statusRecorder struct {
+	http.ResponseWriter;
+	status int;
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status;
+	recorder.ResponseWriter.WriteHeader(status);
+}
+
+/**
+ * The wallet of the staff member making an admin call.
+ */
+func adminOf(r *http.Request) string {
+	session, _ := r.Context().Value(adminKey{}).(Session);
+	return session.wallet;
+}
+
+/**
+ * Whether the caller may act against wallet, which takes a role that
+ * ranks above every role wallet has.
+ */
+func outranks(db *sql.DB, r *http.Request, wallet string) (bool, error) {
+	roles, err := auth.GetRoles(db, wallet);
+
+	if err != nil {
+		return false, err;
+	}
+
+	session, _ := r.Context().Value(adminKey{}).(Session);
+
+	return auth.Outranks(session.roles, roles), nil;
+}
+
+/**
+ * Admin endpoints take an access token from a session whose roles grant
+ * permission, as a bearer token. Every call is audited, including ones
+ * turned away.
+ */
+func adminWrapper(handler http.HandlerFunc, permission auth.Permission, access *AdminAccess) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		recorder := &statusRecorder{ ResponseWriter: res, status: http.StatusOK };
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ");
+
+		var session Session;
+
+		switch {
+		case !ok || validateToken(access.tokens, access.sessions, token, &session) != nil:
+			recorder.WriteHeader(http.StatusUnauthorized);
+		case !auth.Allowed(session.roles, permission):
+			recorder.WriteHeader(http.StatusForbidden);
+		default:
+			ctx := context.WithValue(req.Context(), adminKey{}, session);
+			handler(recorder, req.WithContext(ctx));
+		}
+
+		access.audit(req, session, string(permission), recorder.status);
+	};
+}
+
+/**
+ * For the admin endpoints used to sign in, which need no token but are
+ * audited all the same.
+ */
+func adminSignInWrapper(handler http.HandlerFunc, access *AdminAccess) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		recorder := &statusRecorder{ ResponseWriter: res, status: http.StatusOK };
+		handler(recorder, req);
+		access.audit(req, Session{}, "", recorder.status);
+	};
+}
+
+func (access *AdminAccess) audit(r *http.Request, session Session, permission string, status int) {
+	entry := auth.AuditEntry{
+		Wallet: session.wallet,
+		Permission: permission,
+		Method: r.Method,
+		Path: r.URL.Path,
+		Query: r.URL.RawQuery,
+		Status: status,
+		RemoteAddr: r.RemoteAddr,
+	};
+
+	if session.id != uuid.Nil {
+		entry.Session = session.id.String();
+	}
+
+	access.logger.Log(logging.Entry{
+		Payload: Log{
+			"msg"       : "Admin API call",
+			"wallet"    : entry.Wallet,
+			"session"   : entry.Session,
+			"permission": entry.Permission,
+			"method"    : entry.Method,
+			"path"      : entry.Path,
+			"query"     : entry.Query,
+			"status"    : entry.Status,
+			"remoteAddr": entry.RemoteAddr,
+		},
+		Severity: logging.Notice,
+	});
+
+	if err := auth.RecordAudit(access.db, &entry); err != nil {
+		access.logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"  : "Failed to record admin call",
+				"path" : entry.Path,
+				"error": err,
+			},
+			Severity: logging.Error,
+		});
+	}
+}
+
+func writeJson(w http.ResponseWriter, data any) {
+	result, err := json.Marshal(data);
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError);
+		return;
+	}
+
+	w.Header().Set("Content-Type", "application/json");
+	w.Write(result);
+}
+
+func bankrollHttpHandler(bankObj *bank.Bank, gameObj *game.Game) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bankrolls, err := bankObj.GetBankrolls();
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		exposure := gameObj.GetExposure();
+		result := make(map[string]map[string]string);
+
+		for currency, bankroll := range bankrolls {
+			result[currency] = map[string]string{
+				"bankroll": bankroll.String(),
+				"exposure": exposure[currency].String(),
+			};
+		}
+
+		writeJson(w, map[string]any{
+			"currencies": result,
+		});
+	};
+}
+
+func fundBankrollHttpHandler(bankObj *bank.Bank, logger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		query := r.URL.Query();
+		currency := query.Get("currency");
+		amount, err := decimal.NewFromString(query.Get("amount"));
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		bankroll, err := bankObj.FundBankroll(currency, amount);
+
+		switch {
+		case err == bank.ErrInvalidAmount || err == bank.ErrUnknownCurrency:
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"     : "Bankroll funded",
+				"currency": currency,
+				"amount"  : amount,
+				"bankroll": bankroll,
+				"admin"   : adminOf(r),
+			},
+			Severity: logging.Notice,
+		});
+
+		writeJson(w, map[string]any{
+			"currency": currency,
+			"bankroll": bankroll.String(),
+		});
+	};
+}
+
+func deadPayoutsHttpHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dead, err := payouts.ListDead(db);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"payouts": dead,
+		});
+	};
+}
+
+/**
+ * The id query parameter of a dead payout action; writes the error
+ * response and returns nil if the payout cannot be acted on.
+ */
+func deadPayout(w http.ResponseWriter, r *http.Request, db *sql.DB) *payouts.Payout {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed);
+		return nil;
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64);
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest);
+		return nil;
+	}
+
+	payout, err := payouts.GetById(db, id);
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError);
+		return nil;
+	}
+
+	if payout == nil {
+		w.WriteHeader(http.StatusNotFound);
+		return nil;
+	}
+
+	if payout.Status != payouts.STATUS_DEAD {
+		w.WriteHeader(http.StatusConflict);
+		return nil;
+	}
+
+	return payout;
+}
+
+/**
+ * Moves a dead payout back to the queue, or with resolve set closes it
+ * without crediting it, e.g. once the player has been paid by hand.
+ */
+func deadPayoutActionHttpHandler(db *sql.DB, resolve bool, logger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payout := deadPayout(w, r, db);
+
+		if payout == nil {
+			return;
+		}
+
+		msg := "Dead payout retried";
+		action := payouts.Retry;
+
+		if resolve {
+			msg = "Dead payout resolved";
+			action = payouts.Resolve;
+		}
+
+		err := action(db, payout.Id);
+
+		if err == payouts.ErrPayoutNotDead {
+			w.WriteHeader(http.StatusConflict);
+			return;
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"     : msg,
+				"payoutId": payout.Id,
+				"wallet"  : payout.Wallet,
+				"currency": payout.Currency,
+				"amount"  : payout.Amount,
+				"admin"   : adminOf(r),
+			},
+			Severity: logging.Notice,
+		});
+
+		payout, err = payouts.GetById(db, payout.Id);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"payout": payout,
+		});
+	};
+}
+
+func solvencyHttpHandler(solvencyMonitor *solvency.Monitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := solvencyMonitor.Report();
+
+		if report == nil {
+			w.WriteHeader(http.StatusServiceUnavailable);
+			return;
+		}
+
+		writeJson(w, report);
+	};
+}
+
+/**
+ * The id query parameter of a review action; writes the error response
+ * and returns nil if the withdrawal cannot be acted on.
+ */
+func heldWithdrawal(w http.ResponseWriter, r *http.Request, db *sql.DB) *withdrawals.Withdrawal {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed);
+		return nil;
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64);
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest);
+		return nil;
+	}
+
+	withdrawal, err := withdrawals.GetById(db, id);
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError);
+		return nil;
+	}
+
+	if withdrawal == nil {
+		w.WriteHeader(http.StatusNotFound);
+		return nil;
+	}
+
+	if withdrawal.Status != withdrawals.STATUS_REVIEW {
+		w.WriteHeader(http.StatusConflict);
+		return nil;
+	}
+
+	return withdrawal;
+}
+
+func reviewWithdrawalsHttpHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		held, err := withdrawals.ListForReview(db);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"withdrawals": held,
+		});
+	};
+}
+
+/**
+ * Signs a voucher for a held withdrawal and hands it to the player.
+ */
+func approveWithdrawalHttpHandler(
+	db *sql.DB,
+	chains map[string]*Chain,
+	solvencyMonitor *solvency.Monitor,
+	gameObj *game.Game,
+	cfg *config.CrashConfig,
+	logger *logging.Logger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		withdrawal := heldWithdrawal(w, r, db);
+
+		if withdrawal == nil {
+			return;
+		}
+
+		chain, ok := chains[withdrawal.Chain];
+
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable);
+			return;
+		}
+
+		for _, amount := range withdrawal.Amounts() {
+			if solvencyMonitor.Paused(amount.Currency) {
+				w.WriteHeader(http.StatusServiceUnavailable);
+				return;
+			}
+		}
+
+		sign := func(tx *sql.Tx) (int64, []byte, string, error) {
+			nonce, err := nextNonce(tx, withdrawal.Wallet, withdrawal.Chain);
+
+			if err != nil {
+				return 0, nil, "", err;
+			}
+
+			req, sig, err := createWithdrawalRequest(
+				chain.agent,
+				withdrawal.Wallet,
+				heldWithdrawalItems(withdrawal),
+				withdrawal.Chain,
+				nonce,
+				cfg,
+			);
+
+			if err != nil {
+				return 0, nil, "", err;
+			}
+
+			reqStr, err := json.Marshal(req);
+
+			return nonce, reqStr, sig, err;
+		};
+
+		nonce, err := withdrawals.Approve(db, withdrawal, cfg.Withdrawals.VoucherTtlSecs, sign);
+
+		if err == signer.ErrAgentKeyMismatch || err == signer.ErrAgentUnknown {
+			w.WriteHeader(http.StatusServiceUnavailable);
+			return;
+		}
+
+		if err == withdrawals.ErrNotInReview {
+			w.WriteHeader(http.StatusConflict);
+			return;
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"         : "Withdrawal approved",
+				"withdrawalId": withdrawal.Id,
+				"wallet"      : withdrawal.Wallet,
+				"chain"       : withdrawal.Chain,
+				"nonce"       : nonce,
+			},
+			Severity: logging.Notice,
+		});
+
+		approved, err := withdrawals.GetById(db, withdrawal.Id);
+
+		if err == nil && approved != nil {
+			gameObj.WithdrawalStatusChanged(approved);
+			withdrawal = approved;
+		}
+
+		writeJson(w, map[string]any{
+			"withdrawal": withdrawal,
+		});
+	};
+}
+
+/**
+ * Refunds a held withdrawal.
+ */
+func rejectWithdrawalHttpHandler(
+	db *sql.DB,
+	bankObj *bank.Bank,
+	gameObj *game.Game,
+	logger *logging.Logger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		withdrawal := heldWithdrawal(w, r, db);
+
+		if withdrawal == nil {
+			return;
+		}
+
+		balances, err := withdrawals.Reject(bankObj, withdrawal);
+
+		if err == withdrawals.ErrNotInReview {
+			w.WriteHeader(http.StatusConflict);
+			return;
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"         : "Withdrawal rejected",
+				"withdrawalId": withdrawal.Id,
+				"wallet"      : withdrawal.Wallet,
+				"chain"       : withdrawal.Chain,
+			},
+			Severity: logging.Notice,
+		});
+
+		withdrawal.Status = withdrawals.STATUS_REJECTED;
+		gameObj.WithdrawalRefunded(withdrawal, balances);
+
+		writeJson(w, map[string]any{
+			"withdrawal": withdrawal,
+		});
+	};
+}
+
+/**
+ * GET shows the limits applying to a wallet, PUT replaces its override
+ * with the JSON body and DELETE removes it.
+ */
+func withdrawalLimitsHttpHandler(limits *velocity.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet := r.URL.Query().Get("wallet");
+
+		if !common.IsHexAddress(wallet) {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		wallet = common.HexToAddress(wallet).Hex();
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			override, err := io.ReadAll(r.Body);
+
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			if err = limits.SetOverride(wallet, override); err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+		case http.MethodDelete:
+			if err := limits.ClearOverride(wallet); err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		applied, err := limits.Limits(wallet);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"wallet": wallet,
+			"limits": applied,
+		});
+	};
+}
+
+/**
+ * Indexed contract events, oldest first. Query parameters narrow the
+ * results as in indexer.Filter; pass the id of the last event returned
+ * as after to fetch the next page.
+ */
+func eventsHttpHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query();
+
+		filter := indexer.Filter{
+			Chain: query.Get("chain"),
+			Event: query.Get("event"),
+			TxHash: query.Get("txHash"),
+		};
+
+		if wallet := query.Get("wallet"); wallet != "" {
+			if !common.IsHexAddress(wallet) {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			filter.Wallet = common.HexToAddress(wallet).Hex();
+		}
+
+		numbers := []struct {
+			name string;
+			value any;
+		}{
+			{ "fromBlock", &filter.FromBlock },
+			{ "toBlock", &filter.ToBlock },
+			{ "after", &filter.After },
+			{ "limit", &filter.Limit },
+		};
+
+		for _, number := range numbers {
+			param := query.Get(number.name);
+
+			if param == "" {
+				continue;
+			}
+
+			if _, err := fmt.Sscan(param, number.value); err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+		}
+
+		events, err := indexer.Query(db, filter);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"events": events,
+		});
+	};
+}
+
+func reconcileEventsHttpHandler(db *sql.DB, chains map[string]*Chain) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chain := r.URL.Query().Get("chain");
+
+		if _, ok := chains[chain]; !ok {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		result, err := indexer.Reconcile(db, chain);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, result);
+	};
+}
+
+func sessionsHttpHandler(sessions *auth.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet := r.URL.Query().Get("wallet");
+
+		if !common.IsHexAddress(wallet) {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		list, err := sessions.List(common.HexToAddress(wallet).Hex());
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"sessions": list,
+		});
+	};
+}
+
+/**
+ * Revokes the session given as id, or every session of wallet, and
+ * disconnects the clients using them. The wallet must rank below the
+ * caller.
+ */
+func revokeSessionsHttpHandler(
+	db *sql.DB,
+	sessions *auth.SessionStore,
+	io *socket.Server,
+	logger *logging.Logger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		query := r.URL.Query();
+		ids := make([]uuid.UUID, 0);
+
+		var id uuid.UUID;
+		var wallet string;
+		var err error;
+
+		switch {
+		case query.Get("id") != "":
+			if id, err = uuid.Parse(query.Get("id")); err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			wallet, err = sessions.WalletOf(id);
+
+			if err == auth.ErrSessionUnknown {
+				w.WriteHeader(http.StatusNotFound);
+				return;
+			}
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+		case common.IsHexAddress(query.Get("wallet")):
+			wallet = common.HexToAddress(query.Get("wallet")).Hex();
+		default:
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		allowed, err := outranks(db, r, wallet);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden);
+			return;
+		}
+
+		if id != uuid.Nil {
+			if err := sessions.Revoke(id, adminOf(r)); err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+
+			ids = append(ids, id);
+		} else {
+			ids, err = sessions.RevokeWallet(wallet, adminOf(r));
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"     : "Sessions revoked by admin",
+				"admin"   : adminOf(r),
+				"sessions": ids,
+			},
+			Severity: logging.Notice,
+		});
+
+		disconnectSessions(io, ids...);
+
+		writeJson(w, map[string]any{
+			"revoked": ids,
+		});
+	};
+}
+
+/**
+ * Signs a staff member in with a Sign-In with Ethereum message, whose
+ * nonce comes from /admin/nonce, returning the same tokens as the
+ * authenticate event. Wallets without a staff role are turned away.
+ */
+func adminLoginHttpHandler(
+	verifier *auth.Verifier,
+	sessions *auth.SessionStore,
+	tokens *auth.Tokens,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		var params struct {
+			Message string `json:"message"`;
+			Signature string `json:"signature"`;
+		};
+
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		wallet, err := verifier.Verify(params.Message, params.Signature, "");
+
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized);
+			writeJson(w, map[string]any{
+				"errorCode": auth.ErrorCode(err),
+			});
+			return;
+		}
+
+		session, refreshToken, err := sessions.Create(wallet);
+
+		if err == auth.ErrBanned {
+			w.WriteHeader(http.StatusForbidden);
+			return;
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		if !auth.IsStaff(session.Roles) {
+			sessions.Revoke(session.Id, auth.REVOKED_BY_LOGOUT);
+			w.WriteHeader(http.StatusForbidden);
+			return;
+		}
+
+		token, err := tokens.Issue(session);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"token": token,
+			"refreshToken": refreshToken,
+			"roles": session.Roles,
+		});
+	};
+}
+
+func adminRefreshHttpHandler(sessions *auth.SessionStore, tokens *auth.Tokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		var params struct {
+			RefreshToken string `json:"refreshToken"`;
+		};
+
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		session, refreshToken, err := sessions.Refresh(params.RefreshToken);
+
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized);
+			writeJson(w, map[string]any{
+				"errorCode": auth.ErrorCode(err),
+			});
+			return;
+		}
+
+		// Staff who lost their roles are done.
+		if !auth.IsStaff(session.Roles) {
+			sessions.Revoke(session.Id, auth.REVOKED_BY_LOGOUT);
+			w.WriteHeader(http.StatusForbidden);
+			return;
+		}
+
+		token, err := tokens.Issue(session);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"token": token,
+			"refreshToken": refreshToken,
+			"roles": session.Roles,
+		});
+	};
+}
+
+func gameStatusHttpHandler(gameObj *game.Game) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, map[string]any{
+			"game": gameObj.GetStatus(),
+			"exposure": gameObj.GetExposure(),
+		});
+	};
+}
+
+/**
+ * POST pauses the game after the current round, or resumes it.
+ */
+func gameControlHttpHandler(gameObj *game.Game, pause bool, logger *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		msg := "Game resumed by admin";
+
+		if pause {
+			msg = "Game paused by admin";
+			gameObj.Pause();
+		} else {
+			gameObj.Resume();
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"  : msg,
+				"admin": adminOf(r),
+			},
+			Severity: logging.Notice,
+		});
+
+		writeJson(w, map[string]any{
+			"game": gameObj.GetStatus(),
+		});
+	};
+}
+
+func balancesHttpHandler(bankObj *bank.Bank) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet := r.URL.Query().Get("wallet");
+
+		if !common.IsHexAddress(wallet) {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		wallet = common.HexToAddress(wallet).Hex();
+		balances, err := bankObj.GetBalances(wallet);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"wallet": wallet,
+			"balances": balances,
+		});
+	};
+}
+
+/**
+ * Searches the ledger by wallet, currency, reason, gameId and chain;
+ * pages as /admin/events does.
+ */
+func ledgerHttpHandler(bankObj *bank.Bank) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query();
+
+		filter := bank.LedgerFilter{
+			Currency: query.Get("currency"),
+			Reason: query.Get("reason"),
+			Chain: query.Get("chain"),
+		};
+
+		if wallet := query.Get("wallet"); wallet != "" {
+			if !common.IsHexAddress(wallet) {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			filter.Wallet = common.HexToAddress(wallet).Hex();
+		}
+
+		if gameId := query.Get("gameId"); gameId != "" {
+			id, err := uuid.Parse(gameId);
+
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			filter.GameId = id;
+		}
+
+		numbers := []struct {
+			name string;
+			value any;
+		}{
+			{ "after", &filter.After },
+			{ "limit", &filter.Limit },
+		};
+
+		for _, number := range numbers {
+			param := query.Get(number.name);
+
+			if param == "" {
+				continue;
+			}
+
+			if _, err := fmt.Sscan(param, number.value); err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+		}
+
+		entries, err := bankObj.SearchLedger(filter);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"entries": entries,
+		});
+	};
+}
+
+/**
+ * GET lists bans; POST bans wallet for reason, revoking its sessions
+ * and disconnecting it; DELETE lifts the ban on wallet. Both need a
+ * role ranking above the wallet's.
+ */
+func bansHttpHandler(
+	db *sql.DB,
+	sessions *auth.SessionStore,
+	io *socket.Server,
+	logger *logging.Logger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			bans, err := auth.ListBans(db);
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+
+			writeJson(w, map[string]any{
+				"bans": bans,
+			});
+			return;
+		}
+
+		query := r.URL.Query();
+		wallet := query.Get("wallet");
+
+		if !common.IsHexAddress(wallet) {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		wallet = common.HexToAddress(wallet).Hex();
+
+		allowed, err := outranks(db, r, wallet);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden);
+			return;
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			reason := query.Get("reason");
+
+			if reason == "" {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			if err := auth.BanWallet(db, wallet, reason, adminOf(r)); err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+
+			ids, err := sessions.RevokeWallet(wallet, auth.REVOKED_BY_BAN);
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+
+			disconnectSessions(io, ids...);
+
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"   : "Wallet banned",
+					"wallet": wallet,
+					"reason": reason,
+					"admin" : adminOf(r),
+				},
+				Severity: logging.Notice,
+			});
+		case http.MethodDelete:
+			if err := auth.UnbanWallet(db, wallet); err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"   : "Wallet unbanned",
+					"wallet": wallet,
+					"admin" : adminOf(r),
+				},
+				Severity: logging.Notice,
+			});
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"wallet": wallet,
+			"banned": r.Method == http.MethodPost,
+		});
+	};
+}
+
+/**
+ * GET shows the roles of wallet; PUT replaces them with the JSON body's
+ * roles and revokes the wallet's sessions, so that the change applies
+ * at once. Admins cannot take the admin role from themselves.
+ */
+func rolesHttpHandler(
+	db *sql.DB,
+	sessions *auth.SessionStore,
+	io *socket.Server,
+	logger *logging.Logger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet := r.URL.Query().Get("wallet");
+
+		if !common.IsHexAddress(wallet) {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		wallet = common.HexToAddress(wallet).Hex();
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var params struct {
+				Roles []string `json:"roles"`;
+			};
+
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			if wallet == adminOf(r) && !slices.Contains(params.Roles, auth.ROLE_ADMIN) {
+				w.WriteHeader(http.StatusConflict);
+				return;
+			}
+
+			err := auth.SetRoles(db, wallet, params.Roles, adminOf(r));
+
+			if err == auth.ErrUnknownRole {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+
+			ids, err := sessions.RevokeWallet(wallet, REVOKED_BY_ROLES);
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError);
+				return;
+			}
+
+			disconnectSessions(io, ids...);
+
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"   : "Roles changed",
+					"wallet": wallet,
+					"roles" : params.Roles,
+					"admin" : adminOf(r),
+				},
+				Severity: logging.Notice,
+			});
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		roles, err := auth.GetRoles(db, wallet);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"wallet": wallet,
+			"roles": roles,
+		});
+	};
+}
+
+/**
+ * The audit log of admin calls, filtered by wallet and path; pages as
+ * /admin/events does.
+ */
+func auditHttpHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query();
+
+		filter := auth.AuditFilter{
+			Path: query.Get("path"),
+		};
+
+		if wallet := query.Get("wallet"); wallet != "" {
+			if !common.IsHexAddress(wallet) {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+
+			filter.Wallet = common.HexToAddress(wallet).Hex();
+		}
+
+		numbers := []struct {
+			name string;
+			value any;
+		}{
+			{ "after", &filter.After },
+			{ "limit", &filter.Limit },
+		};
+
+		for _, number := range numbers {
+			param := query.Get(number.name);
+
+			if param == "" {
+				continue;
+			}
+
+			if _, err := fmt.Sscan(param, number.value); err != nil {
+				w.WriteHeader(http.StatusBadRequest);
+				return;
+			}
+		}
+
+		entries, err := auth.QueryAudit(db, filter);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, map[string]any{
+			"entries": entries,
+		});
+	};
+}
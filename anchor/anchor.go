@@ -0,0 +1,227 @@
+package anchor;
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+);
+
+/**
+ * An anchor is pending until its transaction is accepted by the node,
+ * sent until that transaction is mined and then confirmed.
+ */
+const (
+	STATUS_PENDING   = "pending";
+	STATUS_SENT      = "sent";
+	STATUS_CONFIRMED = "confirmed";
+);
+
+/**
+ * Nodes refuse to replace a pending transaction for less than this.
+ */
+const BUMP_PERCENT = 10;
+
+/**
+ * What the anchorer needs from a node; both ethclient.Client and the
+ * simulated backend's client provide it.
+ */
+type Backend interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error);
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error);
+	SuggestGasPrice(ctx context.Context) (*big.Int, error);
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error);
+	SendTransaction(ctx context.Context, tx *types.Transaction) error;
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error);
+}
+
+/**
+ * The account publishing roots; signer.Agent, so that roots come from
+ * whichever key the contract currently trusts.
+ */
+type TxSigner interface {
+	Address() common.Address;
+	SignTx(*types.Transaction, *big.Int) (*types.Transaction, error);
+}
+
+type Config struct {
+	MaxRounds int;
+	ResendAfterSecs int;
+}
+
+/**
+ * Publishes Merkle roots over crashed rounds on one chain. Each root is
+ * the calldata of a transaction the agent account sends to itself, so
+ * anyone can read it back from the chain and check who sent it. Only
+ * one anchor is in flight at a time; rounds crashed meanwhile go into
+ * the next.
+ */
+type Anchorer struct {
+	db *sql.DB;
+	chain string;
+	backend Backend;
+	signer TxSigner;
+	chainId *big.Int;
+	cfg Config;
+}
+
+func NewAnchorer(
+	db *sql.DB,
+	chain string,
+	backend Backend,
+	signer TxSigner,
+	chainId *big.Int,
+	cfg Config,
+) *Anchorer {
+	return &Anchorer{
+		db: db,
+		chain: chain,
+		backend: backend,
+		signer: signer,
+		chainId: chainId,
+		cfg: cfg,
+	};
+}
+
+func (anchorer *Anchorer) Poll(ctx context.Context) error {
+	anchor, err := outstanding(anchorer.db, anchorer.chain, anchorer.cfg.ResendAfterSecs);
+
+	if err != nil {
+		return err;
+	}
+
+	if anchor == nil {
+		anchor, err = create(anchorer.db, anchorer.chain, anchorer.cfg.MaxRounds);
+
+		if err != nil || anchor == nil {
+			return err;
+		}
+	}
+
+	if anchor.Status == STATUS_SENT {
+		done, err := anchorer.follow(ctx, anchor);
+
+		if err != nil || done {
+			return err;
+		}
+
+		if !anchor.ResendDue {
+			return nil;
+		}
+	}
+
+	return anchorer.send(ctx, anchor);
+}
+
+/**
+ * Checks whether the anchor's transaction has been mined. If the
+ * account nonce was used by another transaction, e.g. an earlier one
+ * for this anchor, the root is sent again under a new nonce so that the
+ * stored transaction hash is one that actually carries it.
+ */
+func (anchorer *Anchorer) follow(ctx context.Context, anchor *Anchor) (bool, error) {
+	receipt, err := anchorer.backend.TransactionReceipt(ctx, anchor.TxHash);
+
+	if err == nil && receipt.Status == types.ReceiptStatusSuccessful {
+		return true, markConfirmed(anchorer.db, anchor, receipt.BlockNumber.Uint64(), receipt.BlockHash);
+	}
+
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return false, err;
+	}
+
+	if err == nil {
+		slog.Warn("Anchor transaction failed; resending", "chain", anchorer.chain, "anchor", anchor.Id, "txHash", anchor.TxHash);
+		anchor.Status = STATUS_PENDING;
+		anchor.ResendDue = true;
+		return false, nil;
+	}
+
+	used, err := anchorer.backend.NonceAt(ctx, anchor.Sender, nil);
+
+	if err != nil {
+		return false, err;
+	}
+
+	if used > anchor.AccountNonce {
+		slog.Warn("Anchor nonce used by another transaction; resending", "chain", anchorer.chain, "anchor", anchor.Id);
+		anchor.Status = STATUS_PENDING;
+		anchor.ResendDue = true;
+	}
+
+	return false, nil;
+}
+
+/**
+ * Sends the anchor's root. A sent anchor is replaced at the same nonce
+ * for more gas, unless the agent key has changed since.
+ */
+func (anchorer *Anchorer) send(ctx context.Context, anchor *Anchor) error {
+	sender := anchorer.signer.Address();
+
+	gasPrice, err := anchorer.backend.SuggestGasPrice(ctx);
+
+	if err != nil {
+		return err;
+	}
+
+	var nonce uint64;
+
+	if anchor.Status == STATUS_SENT && anchor.Sender == sender {
+		nonce = anchor.AccountNonce;
+
+		bumped := new(big.Int).Mul(anchor.GasPrice, big.NewInt(100 + BUMP_PERCENT));
+		bumped.Div(bumped, big.NewInt(100));
+
+		if bumped.Cmp(gasPrice) > 0 {
+			gasPrice = bumped;
+		}
+	} else if nonce, err = anchorer.backend.PendingNonceAt(ctx, sender); err != nil {
+		return err;
+	}
+
+	data := anchor.Root.Bytes();
+
+	gas, err := anchorer.backend.EstimateGas(ctx, ethereum.CallMsg{
+		From: sender,
+		To: &sender,
+		Data: data,
+	});
+
+	if err != nil {
+		return err;
+	}
+
+	tx, err := anchorer.signer.SignTx(types.NewTx(&types.LegacyTx{
+		Nonce: nonce,
+		GasPrice: gasPrice,
+		Gas: gas,
+		To: &sender,
+		Value: new(big.Int),
+		Data: data,
+	}), anchorer.chainId);
+
+	if err != nil {
+		return err;
+	}
+
+	if err = anchorer.backend.SendTransaction(ctx, tx); err != nil {
+		return err;
+	}
+
+	slog.Info(
+		"Sent round anchor",
+		"chain", anchorer.chain,
+		"anchor", anchor.Id,
+		"rounds", anchor.RoundCount,
+		"root", anchor.Root,
+		"txHash", tx.Hash(),
+	);
+
+	return markSent(anchorer.db, anchor, sender, nonce, gasPrice, tx.Hash());
+}
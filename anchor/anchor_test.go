@@ -0,0 +1,269 @@
+package anchor;
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/chaintest"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/signer"
+);
+
+var db *sql.DB;
+
+func init() {
+	cfg, err := config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+
+	dbConfig := mysql.Config{
+		User: cfg.Database.User,
+		DBName: cfg.Database.DBName,
+		Addr: cfg.Database.Addr,
+		AllowNativePasswords: true,
+	};
+
+	db, err = sql.Open("mysql", dbConfig.FormatDSN());
+
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err);
+	}
+}
+
+func randomHash() common.Hash {
+	var hash common.Hash;
+	rand.Read(hash[:]);
+	return hash;
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		leaves := make([]common.Hash, size);
+
+		for i := range leaves {
+			leaves[i] = randomHash();
+		}
+
+		root := Root(leaves);
+
+		for i, leaf := range leaves {
+			proof := Proof(leaves, i);
+
+			if !Verify(root, leaf, proof) {
+				t.Fatal("Proof for leaf ", i, " of ", size, " does not verify");
+			}
+
+			if Verify(root, randomHash(), proof) {
+				t.Fatal("Proof verifies for the wrong leaf");
+			}
+		}
+	}
+}
+
+func TestLeafEncoding(t *testing.T) {
+	seed := sha256.Sum256([]byte("seed"));
+
+	round := Round{
+		Id: uuid.MustParse("0191d1a2-3b4c-7d5e-8f60-718293a4b5c6"),
+		Hash: hex.EncodeToString(seed[:]),
+		Multiplier: decimal.RequireFromString("2.5"),
+	};
+
+	leaf, err := Leaf(round);
+
+	if err != nil {
+		t.Fatal("Leaf() failed: ", err);
+	}
+
+	bytes16, _ := abi.NewType("bytes16", "", nil);
+	bytes32, _ := abi.NewType("bytes32", "", nil);
+	uint256, _ := abi.NewType("uint256", "", nil);
+
+	encoded, err := abi.Arguments{
+		{ Type: bytes16 },
+		{ Type: bytes32 },
+		{ Type: uint256 },
+	}.Pack([16]byte(round.Id), seed, big.NewInt(250));
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	if leaf != crypto.Keccak256Hash(crypto.Keccak256(encoded)) {
+		t.Fatal("Leaf does not match the ABI encoding");
+	}
+
+	round.Hash = "abc";
+
+	if _, err := Leaf(round); err != ErrInvalidRoundHash {
+		t.Fatal("Expected ErrInvalidRoundHash, got: ", err);
+	}
+}
+
+/**
+ * Leaves only rounds added by the test unanchored, so that the
+ * anchorer picks up exactly those.
+ */
+func resetRounds(t *testing.T, chain string) {
+	_, err := db.Exec(`
+		DELETE FROM games
+		WHERE anchorId IS NULL
+		OR anchorId IN (SELECT id FROM anchors WHERE chain = ?)
+	`, chain);
+
+	if err != nil {
+		t.Fatal("Failed to reset rounds: ", err);
+	}
+
+	if _, err = db.Exec("DELETE FROM anchors WHERE chain = ?", chain); err != nil {
+		t.Fatal("Failed to reset anchors: ", err);
+	}
+}
+
+func addRound(t *testing.T, multiplier string) uuid.UUID {
+	id, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	hash := randomHash();
+	start := time.Now();
+
+	_, err = db.Exec(`
+		INSERT INTO games
+		(id, startTime, endTime, multiplier, hash)
+		VALUES
+		(?, ?, ?, ?, ?)
+	`, id, start, start.Add(time.Second), multiplier, hex.EncodeToString(hash[:]));
+
+	if err != nil {
+		t.Fatal("Failed to add round: ", err);
+	}
+
+	return id;
+}
+
+func TestAnchorerPublishesRoot(t *testing.T) {
+	const chainName = "anchor-test";
+	resetRounds(t, chainName);
+
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	defer chain.Close();
+
+	anchorer := NewAnchorer(
+		db,
+		chainName,
+		chain.Client,
+		signer.NewKeySigner(chain.Key),
+		chain.ChainId,
+		Config{ MaxRounds: 100, ResendAfterSecs: 300 },
+	);
+
+	rounds := make([]uuid.UUID, 0);
+
+	for _, multiplier := range []string{ "1.00", "2.50", "13.37", "1.01", "100.00" } {
+		rounds = append(rounds, addRound(t, multiplier));
+	}
+
+	ctx := context.Background();
+
+	if err := anchorer.Poll(ctx); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	if _, err := GetProof(db, rounds[2]); err != ErrRoundNotAnchored {
+		t.Fatal("Expected ErrRoundNotAnchored before mining, got: ", err);
+	}
+
+	chain.Commit();
+
+	if err := anchorer.Poll(ctx); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	proof, err := GetProof(db, rounds[2]);
+
+	if err != nil {
+		t.Fatal("GetProof() failed: ", err);
+	}
+
+	if proof.Multiplier != "13.37" || proof.Sender != chain.From {
+		t.Fatal("Proof has wrong round or sender: ", proof.Multiplier, " ", proof.Sender);
+	}
+
+	if !Verify(proof.Root, proof.Leaf, proof.Proof) {
+		t.Fatal("Proof does not verify");
+	}
+
+	// Check against the chain, not the database.
+	tx, _, err := chain.Client.TransactionByHash(ctx, proof.TxHash);
+
+	if err != nil {
+		t.Fatal("Anchor transaction not found: ", err);
+	}
+
+	sender, err := types.Sender(types.LatestSignerForChainID(chain.ChainId), tx);
+
+	if err != nil || sender != chain.From || common.BytesToHash(tx.Data()) != proof.Root {
+		t.Fatal("Anchor transaction does not carry the root from the agent");
+	}
+
+	// Rounds crashed later go into the next anchor.
+	later := addRound(t, "3.00");
+
+	if err := anchorer.Poll(ctx); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	chain.Commit();
+
+	if err := anchorer.Poll(ctx); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	next, err := GetProof(db, later);
+
+	if err != nil {
+		t.Fatal("GetProof() failed for later round: ", err);
+	}
+
+	if next.Root == proof.Root || len(next.Proof) != 0 || next.Leaf != next.Root {
+		t.Fatal("Later round not anchored on its own");
+	}
+
+	// A round changed after anchoring no longer matches the root.
+	if _, err = db.Exec("UPDATE games SET multiplier = 99 WHERE id = ?", rounds[0]); err != nil {
+		t.Fatal(err);
+	}
+
+	if _, err := GetProof(db, rounds[2]); err != ErrRootMismatch {
+		t.Fatal("Expected ErrRootMismatch, got: ", err);
+	}
+
+	if _, err := GetProof(db, uuid.New()); err != ErrRoundNotFound {
+		t.Fatal("Expected ErrRoundNotFound, got: ", err);
+	}
+}
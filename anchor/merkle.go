@@ -0,0 +1,133 @@
+package anchor;
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+);
+
+var (
+	ErrInvalidRoundHash = errors.New("invalid round hash")
+	ErrInvalidMultiplier = errors.New("invalid multiplier")
+)
+
+/**
+ * A crashed round as committed to in an anchor. Hash is the hex
+ * SHA-256 the round's crash point was derived from.
+ */
+type Round struct {
+	Id uuid.UUID;
+	Hash string;
+	Multiplier decimal.Decimal;
+}
+
+/**
+ * The leaf for a round, in the form OpenZeppelin's StandardMerkleTree
+ * uses, so that proofs can be checked with MerkleProof.verify:
+ *
+ *   keccak256(keccak256(abi.encode(bytes16 id, bytes32 hash, uint256 multiplier)))
+ *
+ * where multiplier is in hundredths, e.g. 250 for 2.50x.
+ */
+func Leaf(round Round) (common.Hash, error) {
+	hash, err := hex.DecodeString(round.Hash);
+
+	if err != nil || len(hash) != 32 {
+		return common.Hash{}, ErrInvalidRoundHash;
+	}
+
+	hundredths := round.Multiplier.Shift(2);
+
+	if !hundredths.IsInteger() || hundredths.IsNegative() {
+		return common.Hash{}, ErrInvalidMultiplier;
+	}
+
+	encoded := make([]byte, 0, 96);
+	encoded = append(encoded, common.RightPadBytes(round.Id[:], 32)...);
+	encoded = append(encoded, hash...);
+	encoded = append(encoded, common.LeftPadBytes(hundredths.BigInt().Bytes(), 32)...);
+
+	return crypto.Keccak256Hash(crypto.Keccak256(encoded)), nil;
+}
+
+/**
+ * Parent of two nodes, hashed in sorted order so that proofs need not
+ * say which side each sibling is on.
+ */
+func hashPair(a common.Hash, b common.Hash) common.Hash {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a;
+	}
+
+	return crypto.Keccak256Hash(a[:], b[:]);
+}
+
+/**
+ * The levels of the tree over leaves, from the leaves up to the root.
+ * A node without a sibling moves up a level unchanged.
+ */
+func levels(leaves []common.Hash) [][]common.Hash {
+	tree := [][]common.Hash{ leaves };
+
+	for level := leaves; len(level) > 1; {
+		next := make([]common.Hash, 0, (len(level) + 1) / 2);
+
+		for i := 0; i < len(level); i += 2 {
+			if i + 1 < len(level) {
+				next = append(next, hashPair(level[i], level[i + 1]));
+			} else {
+				next = append(next, level[i]);
+			}
+		}
+
+		tree = append(tree, next);
+		level = next;
+	}
+
+	return tree;
+}
+
+func Root(leaves []common.Hash) common.Hash {
+	if len(leaves) == 0 {
+		return common.Hash{};
+	}
+
+	tree := levels(leaves);
+
+	return tree[len(tree) - 1][0];
+}
+
+/**
+ * The siblings on the path from leaves[index] to the root.
+ */
+func Proof(leaves []common.Hash, index int) []common.Hash {
+	proof := make([]common.Hash, 0);
+	tree := levels(leaves);
+
+	for _, level := range tree[:len(tree) - 1] {
+		sibling := index ^ 1;
+
+		if sibling < len(level) {
+			proof = append(proof, level[sibling]);
+		}
+
+		index /= 2;
+	}
+
+	return proof;
+}
+
+func Verify(root common.Hash, leaf common.Hash, proof []common.Hash) bool {
+	node := leaf;
+
+	for _, sibling := range proof {
+		node = hashPair(node, sibling);
+	}
+
+	return node == root;
+}
@@ -0,0 +1,352 @@
+package anchor;
+
+import (
+	"database/sql"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+);
+
+var (
+	ErrRoundNotFound = errors.New("round not found")
+	ErrRoundNotAnchored = errors.New("round not anchored yet")
+	ErrRootMismatch = errors.New("stored rounds do not match anchored root")
+)
+
+type Anchor struct {
+	Id int64;
+	Root common.Hash;
+	RoundCount int;
+	Status string;
+	Sender common.Address;
+	AccountNonce uint64;
+	GasPrice *big.Int;
+	TxHash common.Hash;
+	ResendDue bool;
+}
+
+/**
+ * Everything a player needs to check that a round was committed to
+ * on-chain: the leaf for the round, the proof from it to the root and
+ * the transaction, sent by Sender, whose calldata is the root.
+ */
+type RoundProof struct {
+	RoundId uuid.UUID `json:"roundId"`;
+	Hash string `json:"hash"`;
+	Multiplier string `json:"multiplier"`;
+	Leaf common.Hash `json:"leaf"`;
+	Proof []common.Hash `json:"proof"`;
+	Root common.Hash `json:"root"`;
+	Chain string `json:"chain"`;
+	Sender common.Address `json:"sender"`;
+	TxHash common.Hash `json:"txHash"`;
+	BlockNumber uint64 `json:"blockNumber"`;
+}
+
+/**
+ * The chain's anchor still waiting to be mined, if any, with ResendDue
+ * set if it was last sent at least resendAfterSecs ago.
+ */
+func outstanding(db *sql.DB, chain string, resendAfterSecs int) (*Anchor, error) {
+	var anchor Anchor;
+	var root string;
+	var sender string;
+	var txHash string;
+	var gasPriceStr string;
+
+	err := db.QueryRow(`
+		SELECT id, root, roundCount, status, COALESCE(sender, ''),
+		COALESCE(accountNonce, 0), COALESCE(gasPrice, 0), COALESCE(txHash, ''),
+		COALESCE(sent <= NOW(3) - INTERVAL ? SECOND, FALSE) AS resendDue
+		FROM anchors
+		WHERE chain = ?
+		AND status IN (?, ?)
+		ORDER BY id
+		LIMIT 1
+	`, resendAfterSecs, chain, STATUS_PENDING, STATUS_SENT).Scan(
+		&anchor.Id,
+		&root,
+		&anchor.RoundCount,
+		&anchor.Status,
+		&sender,
+		&anchor.AccountNonce,
+		&gasPriceStr,
+		&txHash,
+		&anchor.ResendDue,
+	);
+
+	if err == sql.ErrNoRows {
+		return nil, nil;
+	}
+
+	if err != nil {
+		return nil, err;
+	}
+
+	gasPrice, err := decimal.NewFromString(gasPriceStr);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	anchor.Root = common.HexToHash(root);
+	anchor.Sender = common.HexToAddress(sender);
+	anchor.GasPrice = gasPrice.BigInt();
+	anchor.TxHash = common.HexToHash(txHash);
+
+	return &anchor, nil;
+}
+
+/**
+ * Commits the oldest crashed rounds not yet anchored, up to maxRounds,
+ * to a new anchor. Returns nil if there are none.
+ */
+func create(db *sql.DB, chain string, maxRounds int) (*Anchor, error) {
+	tx, err := db.Begin();
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer tx.Rollback();
+
+	rows, err := tx.Query(`
+		SELECT id, hash, multiplier
+		FROM games
+		WHERE anchorId IS NULL
+		AND hash IS NOT NULL
+		ORDER BY startTime, id
+		LIMIT ?
+		FOR UPDATE
+	`, maxRounds);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	rounds, err := scanRounds(rows);
+
+	if err != nil || len(rounds) == 0 {
+		return nil, err;
+	}
+
+	leaves, err := leavesOf(rounds);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	anchor := &Anchor{
+		Root: Root(leaves),
+		RoundCount: len(rounds),
+		Status: STATUS_PENDING,
+	};
+
+	result, err := tx.Exec(`
+		INSERT INTO anchors
+		(chain, root, roundCount)
+		VALUES
+		(?, ?, ?)
+	`, chain, anchor.Root.Hex(), anchor.RoundCount);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	if anchor.Id, err = result.LastInsertId(); err != nil {
+		return nil, err;
+	}
+
+	for index, round := range rounds {
+		_, err := tx.Exec(`
+			UPDATE games
+			SET anchorId = ?, leafIndex = ?
+			WHERE id = ?
+		`, anchor.Id, index, round.Id);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err;
+	}
+
+	return anchor, nil;
+}
+
+func markSent(
+	db *sql.DB,
+	anchor *Anchor,
+	sender common.Address,
+	accountNonce uint64,
+	gasPrice *big.Int,
+	txHash common.Hash,
+) error {
+	_, err := db.Exec(`
+		UPDATE anchors
+		SET status = ?, sender = ?, accountNonce = ?, gasPrice = CAST(? AS Decimal(65, 0)),
+		txHash = ?, sent = NOW(3), updated = NOW(3)
+		WHERE id = ?
+	`,
+		STATUS_SENT,
+		sender.Hex(),
+		accountNonce,
+		gasPrice.String(),
+		txHash.Hex(),
+		anchor.Id,
+	);
+
+	return err;
+}
+
+func markConfirmed(db *sql.DB, anchor *Anchor, blockNumber uint64, blockHash common.Hash) error {
+	_, err := db.Exec(`
+		UPDATE anchors
+		SET status = ?, blockNumber = ?, blockHash = ?, updated = NOW(3)
+		WHERE id = ?
+	`, STATUS_CONFIRMED, blockNumber, blockHash.Hex(), anchor.Id);
+
+	return err;
+}
+
+/**
+ * The proof for one round. The tree is rebuilt from the stored rounds
+ * and checked against the anchored root, so that a round altered after
+ * anchoring is reported rather than given a proof that cannot verify.
+ */
+func GetProof(db *sql.DB, roundId uuid.UUID) (*RoundProof, error) {
+	var anchorId sql.NullInt64;
+	var leafIndex sql.NullInt64;
+
+	err := db.QueryRow(`
+		SELECT anchorId, leafIndex
+		FROM games
+		WHERE id = ?
+	`, roundId).Scan(&anchorId, &leafIndex);
+
+	if err == sql.ErrNoRows {
+		return nil, ErrRoundNotFound;
+	}
+
+	if err != nil {
+		return nil, err;
+	}
+
+	if !anchorId.Valid {
+		return nil, ErrRoundNotAnchored;
+	}
+
+	var proof RoundProof;
+	var root string;
+	var sender string;
+	var txHash string;
+
+	err = db.QueryRow(`
+		SELECT chain, root, sender, txHash, blockNumber
+		FROM anchors
+		WHERE id = ?
+		AND status = ?
+	`, anchorId.Int64, STATUS_CONFIRMED).Scan(
+		&proof.Chain,
+		&root,
+		&sender,
+		&txHash,
+		&proof.BlockNumber,
+	);
+
+	if err == sql.ErrNoRows {
+		return nil, ErrRoundNotAnchored;
+	}
+
+	if err != nil {
+		return nil, err;
+	}
+
+	rows, err := db.Query(`
+		SELECT id, hash, multiplier
+		FROM games
+		WHERE anchorId = ?
+		ORDER BY leafIndex
+	`, anchorId.Int64);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	rounds, err := scanRounds(rows);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	leaves, err := leavesOf(rounds);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	proof.Root = common.HexToHash(root);
+
+	if Root(leaves) != proof.Root || int(leafIndex.Int64) >= len(rounds) {
+		return nil, ErrRootMismatch;
+	}
+
+	round := rounds[leafIndex.Int64];
+
+	proof.RoundId = round.Id;
+	proof.Hash = round.Hash;
+	proof.Multiplier = round.Multiplier.StringFixed(2);
+	proof.Leaf = leaves[leafIndex.Int64];
+	proof.Proof = Proof(leaves, int(leafIndex.Int64));
+	proof.Sender = common.HexToAddress(sender);
+	proof.TxHash = common.HexToHash(txHash);
+
+	return &proof, nil;
+}
+
+func scanRounds(rows *sql.Rows) ([]Round, error) {
+	defer rows.Close();
+
+	rounds := make([]Round, 0);
+
+	for rows.Next() {
+		var round Round;
+		var multiplier string;
+
+		if err := rows.Scan(&round.Id, &round.Hash, &multiplier); err != nil {
+			return nil, err;
+		}
+
+		value, err := decimal.NewFromString(multiplier);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		round.Multiplier = value;
+		rounds = append(rounds, round);
+	}
+
+	return rounds, rows.Err();
+}
+
+func leavesOf(rounds []Round) ([]common.Hash, error) {
+	leaves := make([]common.Hash, len(rounds));
+
+	for i, round := range rounds {
+		leaf, err := Leaf(round);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		leaves[i] = leaf;
+	}
+
+	return leaves, nil;
+}
@@ -0,0 +1,144 @@
+package auth;
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+);
+
+const MAX_AUDIT_LIMIT = 1000;
+
+/**
+ * A call to the admin API. Wallet is empty if the caller could not be
+ * identified; Status is the HTTP status it was answered with.
+ */
+type AuditEntry struct {
+	Id int64 `json:"id"`;
+	Wallet string `json:"wallet"`;
+	Session string `json:"session"`;
+	Permission string `json:"permission"`;
+	Method string `json:"method"`;
+	Path string `json:"path"`;
+	Query string `json:"query"`;
+	Status int `json:"status"`;
+	RemoteAddr string `json:"remoteAddr"`;
+	Created time.Time `json:"created"`;
+}
+
+/**
+ * Records entry. The method and path come from the caller and are cut
+ * to fit their columns; the path is kept short so it can be indexed.
+ */
+func RecordAudit(db *sql.DB, entry *AuditEntry) error {
+	_, err := db.Exec(`
+		INSERT INTO admin_audit
+		(wallet, session, permission, method, path, query, status, remoteAddr)
+		VALUES
+		(NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+	`,
+		entry.Wallet,
+		entry.Session,
+		entry.Permission,
+		truncate(entry.Method, 8),
+		truncate(entry.Path, 255),
+		entry.Query,
+		entry.Status,
+		entry.RemoteAddr,
+	);
+
+	return err;
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value);
+
+	if len(runes) <= length {
+		return value;
+	}
+
+	return string(runes[:length]);
+}
+
+/**
+ * Narrows QueryAudit; zero values match everything. Entries come in
+ * the order they were recorded, starting after the one with id After.
+ */
+type AuditFilter struct {
+	Wallet string;
+	Path string;
+	After int64;
+	Limit int;
+}
+
+func QueryAudit(db *sql.DB, filter AuditFilter) ([]AuditEntry, error) {
+	where := "WHERE id > ?";
+	args := []any{ filter.After };
+
+	if filter.Wallet != "" {
+		where += " AND wallet = ?";
+		args = append(args, filter.Wallet);
+	}
+
+	if filter.Path != "" {
+		where += " AND path = ?";
+		args = append(args, filter.Path);
+	}
+
+	limit := filter.Limit;
+
+	if limit <= 0 || limit > MAX_AUDIT_LIMIT {
+		limit = MAX_AUDIT_LIMIT;
+	}
+
+	rows, err := db.Query(`
+		SELECT
+		id,
+		COALESCE(wallet, ''),
+		COALESCE(session, ''),
+		permission,
+		method,
+		path,
+		query,
+		status,
+		remoteAddr,
+		FLOOR(1000 * UNIX_TIMESTAMP(created)) AS created
+		FROM admin_audit
+		` + where + `
+		ORDER BY id
+		LIMIT ` + strconv.Itoa(limit), args...);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	entries := make([]AuditEntry, 0);
+
+	for rows.Next() {
+		var entry AuditEntry;
+		var created int64;
+
+		err := rows.Scan(
+			&entry.Id,
+			&entry.Wallet,
+			&entry.Session,
+			&entry.Permission,
+			&entry.Method,
+			&entry.Path,
+			&entry.Query,
+			&entry.Status,
+			&entry.RemoteAddr,
+			&created,
+		);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		entry.Created = time.UnixMilli(created);
+		entries = append(entries, entry);
+	}
+
+	return entries, rows.Err();
+}
@@ -0,0 +1,766 @@
+package auth;
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/spruceid/siwe-go"
+
+	"github.com/samott/crash-backend/config"
+);
+
+var cfg *config.CrashConfig;
+var db *sql.DB;
+
+func init() {
+	var err error;
+
+	cfg, err = config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+
+	dbConfig := mysql.Config{
+		User: cfg.Database.User,
+		DBName: cfg.Database.DBName,
+		Addr: cfg.Database.Addr,
+		AllowNativePasswords: true,
+	};
+
+	db, err = sql.Open("mysql", dbConfig.FormatDSN());
+
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err);
+	}
+}
+
+type signIn struct {
+	domain string;
+	uri string;
+	nonce string;
+	options map[string]any;
+}
+
+/**
+ * A message as the test config expects it, unless changed by edit,
+ * signed by key.
+ */
+func signMessage(t *testing.T, key *ecdsa.PrivateKey, nonce string, edit func(*signIn)) (string, string) {
+	fields := signIn{
+		domain: cfg.Auth.Domain,
+		uri: cfg.Auth.Uri + "/login",
+		nonce: nonce,
+		options: map[string]any{
+			"chainId": cfg.Auth.ChainIds[0],
+			"issuedAt": time.Now().UTC().Format(time.RFC3339),
+		},
+	};
+
+	if edit != nil {
+		edit(&fields);
+	}
+
+	address := crypto.PubkeyToAddress(key.PublicKey);
+	message, err := siwe.InitMessage(fields.domain, address.Hex(), fields.uri, fields.nonce, fields.options);
+
+	if err != nil {
+		t.Fatal("Failed to build message: ", err);
+	}
+
+	payload := message.String();
+	signature, err := crypto.Sign(accounts.TextHash([]byte(payload)), key);
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	signature[64] += 27;
+
+	return payload, hexutil.Encode(signature);
+}
+
+func newTestVerifier(t *testing.T, ttl time.Duration) (*Verifier, *NonceStore) {
+	nonces := NewNonceStore(db, ttl);
+	verifier, err := NewVerifier(nonces, cfg);
+
+	if err != nil {
+		t.Fatal("Failed to create verifier: ", err);
+	}
+
+	return verifier, nonces;
+}
+
+func issue(t *testing.T, nonces *NonceStore, socketId string) string {
+	nonce, err := nonces.Issue(socketId);
+
+	if err != nil {
+		t.Fatal("Issue() failed: ", err);
+	}
+
+	return nonce;
+}
+
+func TestVerifySignIn(t *testing.T) {
+	verifier, nonces := newTestVerifier(t, time.Minute);
+	key, _ := crypto.GenerateKey();
+
+	nonce := issue(t, nonces, "socket-1");
+	message, signature := signMessage(t, key, nonce, nil);
+
+	if _, err := verifier.Verify(message, signature, "socket-2"); err != ErrNonceWrongSocket {
+		t.Fatal("Expected ErrNonceWrongSocket, got: ", err);
+	}
+
+	wallet, err := verifier.Verify(message, signature, "socket-1");
+
+	if err != nil {
+		t.Fatal("Verify() failed: ", err);
+	}
+
+	if wallet != crypto.PubkeyToAddress(key.PublicKey).Hex() {
+		t.Fatal("Wrong wallet: ", wallet);
+	}
+
+	if _, err := verifier.Verify(message, signature, "socket-1"); err != ErrNonceUsed {
+		t.Fatal("Expected ErrNonceUsed on replay, got: ", err);
+	}
+
+	// Nonces issued without a socket can be used from any.
+	message, signature = signMessage(t, key, issue(t, nonces, ""), nil);
+
+	if _, err := verifier.Verify(message, signature, "socket-3"); err != nil {
+		t.Fatal("Verify() failed for unbound nonce: ", err);
+	}
+
+	message, signature = signMessage(t, key, "notIssuedByUs123", nil);
+
+	if _, err := verifier.Verify(message, signature, "socket-1"); err != ErrNonceUnknown {
+		t.Fatal("Expected ErrNonceUnknown, got: ", err);
+	}
+
+	expired, expiredNonces := newTestVerifier(t, -time.Second);
+	message, signature = signMessage(t, key, issue(t, expiredNonces, "socket-1"), nil);
+
+	if _, err := expired.Verify(message, signature, "socket-1"); err != ErrNonceExpired {
+		t.Fatal("Expected ErrNonceExpired, got: ", err);
+	}
+}
+
+func TestVerifyRejectsFields(t *testing.T) {
+	verifier, nonces := newTestVerifier(t, time.Minute);
+	key, _ := crypto.GenerateKey();
+	now := time.Now().UTC();
+
+	tests := []struct {
+		name string;
+		edit func(*signIn);
+		want error;
+	}{
+		{ "domain", func(f *signIn) { f.domain = "evil.example.com" }, ErrWrongDomain },
+		{ "uri", func(f *signIn) { f.uri = "https://evil.example.com/login" }, ErrWrongUri },
+		{ "chain", func(f *signIn) { f.options["chainId"] = 999 }, ErrWrongChain },
+		{ "future", func(f *signIn) { f.options["issuedAt"] = now.Add(time.Hour).Format(time.RFC3339) }, ErrIssuedInFuture },
+		{ "old", func(f *signIn) { f.options["issuedAt"] = now.Add(-time.Hour).Format(time.RFC3339) }, ErrMessageTooOld },
+		{ "expired", func(f *signIn) { f.options["expirationTime"] = now.Add(-time.Second).Format(time.RFC3339) }, ErrMessageExpired },
+		{ "notBefore", func(f *signIn) { f.options["notBefore"] = now.Add(time.Hour).Format(time.RFC3339) }, ErrNotYetValid },
+	};
+
+	for _, test := range tests {
+		nonce := issue(t, nonces, "socket-1");
+		message, signature := signMessage(t, key, nonce, test.edit);
+
+		if _, err := verifier.Verify(message, signature, "socket-1"); err != test.want {
+			t.Fatal("Expected ", test.want, " for ", test.name, ", got: ", err);
+		}
+
+		// A rejected message does not use up the nonce.
+		message, signature = signMessage(t, key, nonce, nil);
+
+		if _, err := verifier.Verify(message, signature, "socket-1"); err != nil {
+			t.Fatal("Nonce unusable after rejected ", test.name, " message: ", err);
+		}
+	}
+
+	message, _ := signMessage(t, key, issue(t, nonces, "socket-1"), nil);
+	other, _ := crypto.GenerateKey();
+	_, otherSignature := signMessage(t, other, "anything12345678", nil);
+
+	if _, err := verifier.Verify(message, otherSignature, "socket-1"); err != ErrInvalidSignature {
+		t.Fatal("Expected ErrInvalidSignature for another signer, got: ", err);
+	}
+
+	if _, err := verifier.Verify(message, "0x1234", "socket-1"); err != ErrInvalidSignature {
+		t.Fatal("Expected ErrInvalidSignature for short signature, got: ", err);
+	}
+
+	if _, err := verifier.Verify("hello", "0x", "socket-1"); err != ErrMalformedMessage {
+		t.Fatal("Expected ErrMalformedMessage, got: ", err);
+	}
+
+	if code := ErrorCode(ErrNonceUsed); code != "NONCE_USED" {
+		t.Fatal("Wrong error code: ", code);
+	}
+}
+
+func writePem(t *testing.T, kind string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem");
+	data := pem.EncodeToMemory(&pem.Block{ Type: kind, Bytes: der });
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err);
+	}
+
+	return path;
+}
+
+func tokenConfig(signingKey string, keys ...config.TokenKeyDef) *config.CrashConfig {
+	tokenCfg := *cfg;
+	tokenCfg.Tokens.SigningKey = signingKey;
+	tokenCfg.Tokens.Keys = keys;
+	return &tokenCfg;
+}
+
+func newTestTokens(t *testing.T, tokenCfg *config.CrashConfig) *Tokens {
+	tokens, err := NewTokens(tokenCfg);
+
+	if err != nil {
+		t.Fatal("NewTokens() failed: ", err);
+	}
+
+	return tokens;
+}
+
+func TestTokensRoundTrip(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader);
+	ecDer, _ := x509.MarshalPKCS8PrivateKey(ecKey);
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader);
+	edDer, _ := x509.MarshalPKCS8PrivateKey(edKey);
+
+	keys := []config.TokenKeyDef{
+		{ Id: "hs", Algorithm: ALG_HS256, Key: "0123456789abcdef0123456789abcdef" },
+		{ Id: "es", Algorithm: ALG_ES256, File: writePem(t, "PRIVATE KEY", ecDer) },
+		{ Id: "ed", Algorithm: ALG_EDDSA, File: writePem(t, "PRIVATE KEY", edDer) },
+	};
+
+	wallet := "0x52908400098527886e0f7030069857d2e4169ee7";
+
+	for _, key := range keys {
+		tokens := newTestTokens(t, tokenConfig(key.Id, keys...));
+		session := &Session{
+			Id: uuid.New(),
+			Wallet: wallet,
+			Roles: []string{ ROLE_PLAYER, ROLE_SUPPORT },
+		};
+		token, err := tokens.Issue(session);
+
+		if err != nil {
+			t.Fatal("Issue() failed for ", key.Id, ": ", err);
+		}
+
+		claims, err := tokens.Validate(token);
+
+		if err != nil {
+			t.Fatal("Validate() failed for ", key.Id, ": ", err);
+		}
+
+		if claims.Wallet != common.HexToAddress(wallet).Hex() || claims.Subject != wallet ||
+			claims.Session != session.Id || !slices.Equal(claims.Roles, session.Roles) {
+			t.Fatal("Wrong claims for ", key.Id, ": ", claims.Wallet);
+		}
+	}
+}
+
+func TestTokensRotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader);
+	oldDer, _ := x509.MarshalPKCS8PrivateKey(oldKey);
+	oldPublic, _ := x509.MarshalPKIXPublicKey(&oldKey.PublicKey);
+
+	oldDef := config.TokenKeyDef{ Id: "old", Algorithm: ALG_ES256, File: writePem(t, "PRIVATE KEY", oldDer) };
+	newDef := config.TokenKeyDef{ Id: "new", Algorithm: ALG_HS256, Key: "fedcba9876543210fedcba9876543210" };
+
+	wallet := "0x52908400098527886e0F7030069857D2E4169EE7";
+	token, err := newTestTokens(t, tokenConfig("old", oldDef)).Issue(&Session{ Id: uuid.New(), Wallet: wallet });
+
+	if err != nil {
+		t.Fatal("Issue() failed: ", err);
+	}
+
+	// The old key stays configured, now only able to verify.
+	verifyOnly := config.TokenKeyDef{ Id: "old", Algorithm: ALG_ES256, File: writePem(t, "PUBLIC KEY", oldPublic) };
+	rotated := newTestTokens(t, tokenConfig("new", newDef, verifyOnly));
+
+	if _, err := rotated.Validate(token); err != nil {
+		t.Fatal("Token from rotated-out key rejected: ", err);
+	}
+
+	if _, err := NewTokens(tokenConfig("old", newDef, verifyOnly)); err != ErrNoSigningKey {
+		t.Fatal("Expected ErrNoSigningKey for a public key, got: ", err);
+	}
+
+	if _, err := NewTokens(tokenConfig("new", newDef, newDef)); err != ErrDuplicateKey {
+		t.Fatal("Expected ErrDuplicateKey, got: ", err);
+	}
+
+	// Once removed, its tokens are no longer accepted.
+	if _, err := newTestTokens(t, tokenConfig("new", newDef)).Validate(token); err == nil {
+		t.Fatal("Token from removed key accepted");
+	}
+}
+
+func TestTokensRejected(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef";
+	def := config.TokenKeyDef{ Id: "hs", Algorithm: ALG_HS256, Key: secret };
+	tokens := newTestTokens(t, tokenConfig("hs", def));
+	wallet := "0x52908400098527886e0f7030069857d2e4169ee7";
+	now := time.Now();
+
+	sign := func(method jwt.SigningMethod, kid any, claims Claims) string {
+		token := jwt.NewWithClaims(method, claims);
+		token.Header["kid"] = kid;
+		signed, err := token.SignedString([]byte(secret));
+
+		if err != nil {
+			t.Fatal(err);
+		}
+
+		return signed;
+	};
+
+	valid := func() Claims {
+		return Claims{
+			Wallet: wallet,
+			Session: uuid.New(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer: cfg.Tokens.Issuer,
+				Audience: jwt.ClaimStrings{ cfg.Tokens.Audience },
+				IssuedAt: jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		};
+	};
+
+	if _, err := tokens.Validate(sign(jwt.SigningMethodHS256, "hs", valid())); err != nil {
+		t.Fatal("Valid token rejected: ", err);
+	}
+
+	tests := []struct {
+		name string;
+		method jwt.SigningMethod;
+		kid any;
+		edit func(*Claims);
+	}{
+		{ "unknown kid", jwt.SigningMethodHS256, "other", nil },
+		{ "missing kid", jwt.SigningMethodHS256, nil, nil },
+		{ "algorithm", jwt.SigningMethodHS384, "hs", nil },
+		{ "issuer", jwt.SigningMethodHS256, "hs", func(c *Claims) { c.Issuer = "someone-else" } },
+		{ "audience", jwt.SigningMethodHS256, "hs", func(c *Claims) { c.Audience = jwt.ClaimStrings{ "other-app" } } },
+		{ "expired", jwt.SigningMethodHS256, "hs", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) } },
+		{ "no expiry", jwt.SigningMethodHS256, "hs", func(c *Claims) { c.ExpiresAt = nil } },
+		{ "future", jwt.SigningMethodHS256, "hs", func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Hour)) } },
+		{ "wallet", jwt.SigningMethodHS256, "hs", func(c *Claims) { c.Wallet = "not-a-wallet" } },
+		{ "session", jwt.SigningMethodHS256, "hs", func(c *Claims) { c.Session = uuid.Nil } },
+	};
+
+	for _, test := range tests {
+		claims := valid();
+
+		if test.edit != nil {
+			test.edit(&claims);
+		}
+
+		if _, err := tokens.Validate(sign(test.method, test.kid, claims)); err == nil {
+			t.Fatal("Token with bad ", test.name, " accepted");
+		}
+	}
+
+	short := config.TokenKeyDef{ Id: "short", Algorithm: ALG_HS256, Key: "too-short" };
+
+	if _, err := NewTokens(tokenConfig("short", short)); err != ErrInvalidKey {
+		t.Fatal("Expected ErrInvalidKey for a short secret, got: ", err);
+	}
+
+	if _, err := NewTokens(tokenConfig("x", config.TokenKeyDef{ Id: "x", Algorithm: "none", Key: secret })); err != ErrUnknownAlgorithm {
+		t.Fatal("Expected ErrUnknownAlgorithm, got: ", err);
+	}
+}
+
+func TestSessionRefresh(t *testing.T) {
+	store := NewSessionStore(db, time.Hour);
+	wallet := "0x52908400098527886E0F7030069857D2E4169EE7";
+
+	created, first, err := store.Create(wallet);
+
+	if err != nil {
+		t.Fatal("Create() failed: ", err);
+	}
+
+	id := created.Id;
+	session, second, err := store.Refresh(first);
+
+	if err != nil {
+		t.Fatal("Refresh() failed: ", err);
+	}
+
+	if session.Id != id || session.Wallet != wallet || second == first {
+		t.Fatal("Refresh() returned the wrong session or the same token");
+	}
+
+	_, third, err := store.Refresh(second);
+
+	if err != nil {
+		t.Fatal("Refresh() of the rotated token failed: ", err);
+	}
+
+	// Replaying a replaced token revokes the session, so that the newest
+	// token stops working too.
+	if _, _, err := store.Refresh(first); err != ErrRefreshReused {
+		t.Fatal("Expected ErrRefreshReused, got: ", err);
+	}
+
+	if _, _, err := store.Refresh(third); err != ErrSessionRevoked {
+		t.Fatal("Expected ErrSessionRevoked after reuse, got: ", err);
+	}
+
+	if err := store.Check(id); err != ErrSessionRevoked {
+		t.Fatal("Expected ErrSessionRevoked from Check(), got: ", err);
+	}
+
+	if _, _, err := store.Refresh(uuid.New().String() + ".00"); err != ErrSessionUnknown {
+		t.Fatal("Expected ErrSessionUnknown, got: ", err);
+	}
+
+	if _, _, err := store.Refresh("garbage"); err != ErrSessionUnknown {
+		t.Fatal("Expected ErrSessionUnknown for a malformed token, got: ", err);
+	}
+
+	expired := NewSessionStore(db, -time.Second);
+	created, token, err := expired.Create(wallet);
+
+	if err != nil {
+		t.Fatal("Create() failed: ", err);
+	}
+
+	if _, _, err := expired.Refresh(token); err != ErrSessionExpired {
+		t.Fatal("Expected ErrSessionExpired, got: ", err);
+	}
+
+	if err := expired.Check(created.Id); err != ErrSessionExpired {
+		t.Fatal("Expected ErrSessionExpired from Check(), got: ", err);
+	}
+}
+
+func TestSessionRevocation(t *testing.T) {
+	store := NewSessionStore(db, time.Hour);
+	wallet := "0x0000000000000000000000000000000000C0FFEE";
+	other := "0x000000000000000000000000000000000000BEEF";
+
+	if _, err := db.Exec("DELETE FROM sessions WHERE wallet IN (?, ?)", wallet, other); err != nil {
+		t.Fatal(err);
+	}
+
+	ids := make([]uuid.UUID, 0);
+	tokens := make([]string, 0);
+
+	for _, owner := range []string{ wallet, wallet, wallet, other } {
+		session, token, err := store.Create(owner);
+
+		if err != nil {
+			t.Fatal("Create() failed: ", err);
+		}
+
+		ids = append(ids, session.Id);
+		tokens = append(tokens, token);
+	}
+
+	first, second, third, kept := ids[0], ids[1], ids[2], ids[3];
+	secondToken := tokens[1];
+
+	if owner, err := store.WalletOf(kept); err != nil || owner != other {
+		t.Fatal("WalletOf() wrong: ", owner, err);
+	}
+
+	if _, err := store.WalletOf(uuid.New()); err != ErrSessionUnknown {
+		t.Fatal("Expected ErrSessionUnknown from WalletOf(), got: ", err);
+	}
+
+	if err := store.Revoke(first, REVOKED_BY_LOGOUT); err != nil {
+		t.Fatal("Revoke() failed: ", err);
+	}
+
+	revoked, err := store.RevokeWallet(wallet, REVOKED_BY_WALLET);
+
+	if err != nil {
+		t.Fatal("RevokeWallet() failed: ", err);
+	}
+
+	if len(revoked) != 2 || !slices.Contains(revoked, second) || !slices.Contains(revoked, third) {
+		t.Fatal("RevokeWallet() revoked the wrong sessions: ", revoked);
+	}
+
+	if _, _, err := store.Refresh(secondToken); err != ErrSessionRevoked {
+		t.Fatal("Expected ErrSessionRevoked, got: ", err);
+	}
+
+	if err := store.Check(kept); err != nil {
+		t.Fatal("Another wallet's session was revoked: ", err);
+	}
+
+	sessions, err := store.List(wallet);
+
+	if err != nil {
+		t.Fatal("List() failed: ", err);
+	}
+
+	if len(sessions) != 3 || sessions[0].Id != third {
+		t.Fatal("List() returned the wrong sessions");
+	}
+
+	for _, session := range sessions {
+		want := REVOKED_BY_WALLET;
+
+		if session.Id == first {
+			want = REVOKED_BY_LOGOUT;
+		}
+
+		if session.Revoked == nil || session.RevokedBy == nil || *session.RevokedBy != want {
+			t.Fatal("Session ", session.Id, " not revoked by ", want);
+		}
+	}
+}
+
+func TestRolesAndBans(t *testing.T) {
+	store := NewSessionStore(db, time.Hour);
+	wallet := "0x00000000000000000000000000000000000000AA";
+
+	if _, err := db.Exec("DELETE FROM bans WHERE wallet = ?", wallet); err != nil {
+		t.Fatal(err);
+	}
+
+	if err := SetRoles(db, wallet, []string{ ROLE_FINANCE, ROLE_SUPPORT }, "test"); err != nil {
+		t.Fatal("SetRoles() failed: ", err);
+	}
+
+	if err := SetRoles(db, wallet, []string{ "superuser" }, "test"); err != ErrUnknownRole {
+		t.Fatal("Expected ErrUnknownRole, got: ", err);
+	}
+
+	session, token, err := store.Create(wallet);
+
+	if err != nil {
+		t.Fatal("Create() failed: ", err);
+	}
+
+	if !slices.Equal(session.Roles, []string{ ROLE_PLAYER, ROLE_FINANCE, ROLE_SUPPORT }) {
+		t.Fatal("Session has the wrong roles: ", session.Roles);
+	}
+
+	checks := []struct {
+		permission Permission;
+		want bool;
+	}{
+		{ PERM_WITHDRAWALS_REVIEW, true },
+		{ PERM_USERS_BAN, true },
+		{ PERM_GAME_CONTROL, false },
+		{ PERM_ROLES_MANAGE, false },
+	};
+
+	for _, check := range checks {
+		if Allowed(session.Roles, check.permission) != check.want {
+			t.Fatal("Allowed() wrong for ", check.permission);
+		}
+	}
+
+	if IsStaff([]string{ ROLE_PLAYER }) || !IsStaff(session.Roles) {
+		t.Fatal("IsStaff() wrong");
+	}
+
+	// Role changes show up at the next refresh.
+	if err := GrantRole(db, wallet, ROLE_ADMIN, "test"); err != nil {
+		t.Fatal("GrantRole() failed: ", err);
+	}
+
+	session, token, err = store.Refresh(token);
+
+	if err != nil {
+		t.Fatal("Refresh() failed: ", err);
+	}
+
+	if !Allowed(session.Roles, PERM_GAME_CONTROL) {
+		t.Fatal("Granted role missing after refresh: ", session.Roles);
+	}
+
+	if err := BanWallet(db, wallet, "testing", "test"); err != nil {
+		t.Fatal("BanWallet() failed: ", err);
+	}
+
+	if _, _, err := store.Create(wallet); err != ErrBanned {
+		t.Fatal("Expected ErrBanned from Create(), got: ", err);
+	}
+
+	if _, _, err := store.Refresh(token); err != ErrBanned {
+		t.Fatal("Expected ErrBanned from Refresh(), got: ", err);
+	}
+
+	if err := store.Check(session.Id); err != ErrSessionRevoked {
+		t.Fatal("Banned wallet's session not revoked: ", err);
+	}
+
+	bans, err := ListBans(db);
+
+	if err != nil || len(bans) == 0 || bans[0].Wallet != wallet || bans[0].Reason != "testing" {
+		t.Fatal("ListBans() wrong: ", bans, err);
+	}
+
+	if err := UnbanWallet(db, wallet); err != nil {
+		t.Fatal("UnbanWallet() failed: ", err);
+	}
+
+	if _, _, err := store.Create(wallet); err != nil {
+		t.Fatal("Create() failed after unban: ", err);
+	}
+
+	if err := SetRoles(db, wallet, []string{}, "test"); err != nil {
+		t.Fatal("SetRoles() failed: ", err);
+	}
+
+	if roles, err := GetRoles(db, wallet); err != nil || !slices.Equal(roles, []string{ ROLE_PLAYER }) {
+		t.Fatal("Roles not cleared: ", roles, err);
+	}
+}
+
+func TestRoleRanks(t *testing.T) {
+	support := []string{ ROLE_PLAYER, ROLE_SUPPORT };
+	admin := []string{ ROLE_PLAYER, ROLE_ADMIN };
+
+	checks := []struct {
+		roles []string;
+		others []string;
+		want bool;
+	}{
+		{ support, []string{ ROLE_PLAYER }, true },
+		{ support, support, false },
+		{ support, []string{ ROLE_PLAYER, ROLE_FINANCE, ROLE_SUPPORT }, false },
+		{ support, admin, false },
+		{ admin, []string{ ROLE_PLAYER, ROLE_FINANCE }, true },
+		{ admin, admin, false },
+	};
+
+	for _, check := range checks {
+		if Outranks(check.roles, check.others) != check.want {
+			t.Fatal("Outranks() wrong for ", check.roles, " over ", check.others);
+		}
+	}
+}
+
+func TestSyncConfigAdmins(t *testing.T) {
+	kept := "0x00000000000000000000000000000000000000A1";
+	dropped := "0x00000000000000000000000000000000000000A2";
+	granted := "0x00000000000000000000000000000000000000A3";
+
+	if _, err := db.Exec("DELETE FROM roles WHERE wallet IN (?, ?, ?)", kept, dropped, granted); err != nil {
+		t.Fatal(err);
+	}
+
+	if _, err := SyncConfigAdmins(db, []string{ kept, dropped }); err != nil {
+		t.Fatal("SyncConfigAdmins() failed: ", err);
+	}
+
+	if err := GrantRole(db, granted, ROLE_ADMIN, kept); err != nil {
+		t.Fatal("GrantRole() failed: ", err);
+	}
+
+	removed, err := SyncConfigAdmins(db, []string{ kept });
+
+	if err != nil {
+		t.Fatal("SyncConfigAdmins() failed: ", err);
+	}
+
+	if !slices.Equal(removed, []string{ dropped }) {
+		t.Fatal("Wrong admins removed: ", removed);
+	}
+
+	for wallet, want := range map[string]bool{ kept: true, dropped: false, granted: true } {
+		roles, err := GetRoles(db, wallet);
+
+		if err != nil {
+			t.Fatal("GetRoles() failed: ", err);
+		}
+
+		if slices.Contains(roles, ROLE_ADMIN) != want {
+			t.Fatal("Wrong roles after sync for ", wallet, ": ", roles);
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	wallet := "0x00000000000000000000000000000000000000BB";
+
+	if _, err := db.Exec("DELETE FROM admin_audit"); err != nil {
+		t.Fatal(err);
+	}
+
+	entries := []AuditEntry{
+		{ Wallet: wallet, Session: uuid.NewString(), Permission: string(PERM_BALANCES_VIEW), Method: "GET", Path: "/admin/balances", Query: "wallet=0x1", Status: 200, RemoteAddr: "127.0.0.1:1" },
+		{ Permission: string(PERM_GAME_CONTROL), Method: "POST", Path: "/admin/game/pause", Status: 401, RemoteAddr: "127.0.0.1:2" },
+	};
+
+	for i := range entries {
+		if err := RecordAudit(db, &entries[i]); err != nil {
+			t.Fatal("RecordAudit() failed: ", err);
+		}
+	}
+
+	all, err := QueryAudit(db, AuditFilter{});
+
+	if err != nil {
+		t.Fatal("QueryAudit() failed: ", err);
+	}
+
+	if len(all) != 2 || all[0].Path != "/admin/balances" || all[1].Wallet != "" || all[1].Status != 401 {
+		t.Fatal("QueryAudit() returned the wrong entries: ", all);
+	}
+
+	mine, err := QueryAudit(db, AuditFilter{ Wallet: wallet, Limit: 1 });
+
+	if err != nil || len(mine) != 1 || mine[0].Session != entries[0].Session {
+		t.Fatal("QueryAudit() by wallet wrong: ", mine, err);
+	}
+
+	// Paths are chosen by the caller and may be longer than the column.
+	long := AuditEntry{
+		Method: "GET",
+		Path: "/admin/" + strings.Repeat("é", 300),
+		Status: 404,
+		RemoteAddr: "127.0.0.1:3",
+	};
+
+	if err := RecordAudit(db, &long); err != nil {
+		t.Fatal("RecordAudit() failed for a long path: ", err);
+	}
+
+	all, err = QueryAudit(db, AuditFilter{});
+
+	if err != nil || len(all) != 3 || len([]rune(all[2].Path)) != 255 {
+		t.Fatal("Long path not truncated: ", len(all), err);
+	}
+}
@@ -0,0 +1,83 @@
+package auth;
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+);
+
+var (
+	ErrBanned = errors.New("wallet is banned")
+)
+
+const REVOKED_BY_BAN = "ban";
+
+type Ban struct {
+	Wallet string `json:"wallet"`;
+	Reason string `json:"reason"`;
+	BannedBy string `json:"bannedBy"`;
+	Created time.Time `json:"created"`;
+}
+
+func IsBanned(db *sql.DB, wallet string) (bool, error) {
+	var banned bool;
+
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM bans WHERE wallet = ?)
+	`, wallet).Scan(&banned);
+
+	return banned, err;
+}
+
+/**
+ * Bans wallet from signing in. Its existing sessions are left to the
+ * caller to revoke.
+ */
+func BanWallet(db *sql.DB, wallet string, reason string, by string) error {
+	_, err := db.Exec(`
+		INSERT INTO bans
+		(wallet, reason, bannedBy)
+		VALUES
+		(?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+		reason = VALUES(reason),
+		bannedBy = VALUES(bannedBy)
+	`, wallet, reason, by);
+
+	return err;
+}
+
+func UnbanWallet(db *sql.DB, wallet string) error {
+	_, err := db.Exec("DELETE FROM bans WHERE wallet = ?", wallet);
+	return err;
+}
+
+func ListBans(db *sql.DB) ([]Ban, error) {
+	rows, err := db.Query(`
+		SELECT wallet, reason, bannedBy, FLOOR(1000 * UNIX_TIMESTAMP(created)) AS created
+		FROM bans
+		ORDER BY created DESC
+	`);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	bans := make([]Ban, 0);
+
+	for rows.Next() {
+		var ban Ban;
+		var created int64;
+
+		if err := rows.Scan(&ban.Wallet, &ban.Reason, &ban.BannedBy, &created); err != nil {
+			return nil, err;
+		}
+
+		ban.Created = time.UnixMilli(created);
+		bans = append(bans, ban);
+	}
+
+	return bans, rows.Err();
+}
@@ -0,0 +1,108 @@
+package auth;
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/spruceid/siwe-go"
+);
+
+var (
+	ErrNonceUnknown = errors.New("nonce was not issued by us")
+	ErrNonceUsed = errors.New("nonce already used")
+	ErrNonceExpired = errors.New("nonce expired")
+	ErrNonceWrongSocket = errors.New("nonce issued to another connection")
+)
+
+/**
+ * Nonces for sign-in messages. Each is valid for ttl and can be used
+ * once; a nonce issued to a socket can only be used from that socket.
+ */
+type NonceStore struct {
+	db *sql.DB;
+	ttl time.Duration;
+}
+
+func NewNonceStore(db *sql.DB, ttl time.Duration) *NonceStore {
+	return &NonceStore{
+		db: db,
+		ttl: ttl,
+	};
+}
+
+/**
+ * Issues a new nonce, bound to socketId unless it is empty. Nonces
+ * that expired a while ago are cleared out at the same time.
+ */
+func (store *NonceStore) Issue(socketId string) (string, error) {
+	nonce := siwe.GenerateNonce();
+
+	_, err := store.db.Exec(`
+		INSERT INTO auth_nonces
+		(nonce, socketId, expires)
+		VALUES
+		(?, NULLIF(?, ''), NOW(3) + INTERVAL ? MICROSECOND)
+	`, nonce, socketId, store.ttl.Microseconds());
+
+	if err != nil {
+		return "", err;
+	}
+
+	_, err = store.db.Exec(`
+		DELETE FROM auth_nonces
+		WHERE expires < NOW(3) - INTERVAL 1 HOUR
+		LIMIT 100
+	`);
+
+	if err != nil {
+		return "", err;
+	}
+
+	return nonce, nil;
+}
+
+/**
+ * Marks the nonce used by socketId, or returns why it cannot be.
+ */
+func (store *NonceStore) Consume(nonce string, socketId string) error {
+	result, err := store.db.Exec(`
+		UPDATE auth_nonces
+		SET used = NOW(3)
+		WHERE nonce = ?
+		AND used IS NULL
+		AND expires > NOW(3)
+		AND (socketId IS NULL OR socketId = ?)
+	`, nonce, socketId);
+
+	if err != nil {
+		return err;
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 1 {
+		return err;
+	}
+
+	var used bool;
+	var expired bool;
+	var boundTo sql.NullString;
+
+	err = store.db.QueryRow(`
+		SELECT used IS NOT NULL, expires <= NOW(3), socketId
+		FROM auth_nonces
+		WHERE nonce = ?
+	`, nonce).Scan(&used, &expired, &boundTo);
+
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrNonceUnknown;
+	case err != nil:
+		return err;
+	case used:
+		return ErrNonceUsed;
+	case expired:
+		return ErrNonceExpired;
+	default:
+		return ErrNonceWrongSocket;
+	}
+}
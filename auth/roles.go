@@ -0,0 +1,309 @@
+package auth;
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+);
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+const (
+	ROLE_PLAYER = "player";
+	ROLE_SUPPORT = "support";
+	ROLE_FINANCE = "finance";
+	ROLE_ADMIN = "admin";
+);
+
+const GRANTED_BY_CONFIG = "config";
+
+type Permission string;
+
+const (
+	PERM_GAME_VIEW Permission = "game:view";
+	PERM_GAME_CONTROL Permission = "game:control";
+	PERM_BALANCES_VIEW Permission = "balances:view";
+	PERM_LEDGER_VIEW Permission = "ledger:view";
+	PERM_TREASURY_VIEW Permission = "treasury:view";
+	PERM_TREASURY_MANAGE Permission = "treasury:manage";
+	PERM_WITHDRAWALS_VIEW Permission = "withdrawals:view";
+	PERM_WITHDRAWALS_REVIEW Permission = "withdrawals:review";
+	PERM_LIMITS_MANAGE Permission = "limits:manage";
+	PERM_USERS_BAN Permission = "users:ban";
+	PERM_SESSIONS_MANAGE Permission = "sessions:manage";
+	PERM_ROLES_MANAGE Permission = "roles:manage";
+	PERM_AUDIT_VIEW Permission = "audit:view";
+);
+
+/**
+ * What each role may do through the admin API. Every wallet is a
+ * player, which grants nothing there; the others are assigned in the
+ * roles table.
+ */
+var rolePermissions = map[string][]Permission{
+	ROLE_PLAYER: {},
+	ROLE_SUPPORT: {
+		PERM_GAME_VIEW,
+		PERM_BALANCES_VIEW,
+		PERM_LEDGER_VIEW,
+		PERM_WITHDRAWALS_VIEW,
+		PERM_USERS_BAN,
+		PERM_SESSIONS_MANAGE,
+	},
+	ROLE_FINANCE: {
+		PERM_GAME_VIEW,
+		PERM_BALANCES_VIEW,
+		PERM_LEDGER_VIEW,
+		PERM_TREASURY_VIEW,
+		PERM_TREASURY_MANAGE,
+		PERM_WITHDRAWALS_VIEW,
+		PERM_WITHDRAWALS_REVIEW,
+		PERM_LIMITS_MANAGE,
+	},
+	ROLE_ADMIN: {
+		PERM_GAME_VIEW,
+		PERM_GAME_CONTROL,
+		PERM_BALANCES_VIEW,
+		PERM_LEDGER_VIEW,
+		PERM_TREASURY_VIEW,
+		PERM_TREASURY_MANAGE,
+		PERM_WITHDRAWALS_VIEW,
+		PERM_WITHDRAWALS_REVIEW,
+		PERM_LIMITS_MANAGE,
+		PERM_USERS_BAN,
+		PERM_SESSIONS_MANAGE,
+		PERM_ROLES_MANAGE,
+		PERM_AUDIT_VIEW,
+	},
+};
+
+/**
+ * Staff may only ban or sign out wallets whose roles rank below their
+ * own, so that support cannot act against finance or admins.
+ */
+var roleRanks = map[string]int{
+	ROLE_PLAYER: 0,
+	ROLE_SUPPORT: 1,
+	ROLE_FINANCE: 2,
+	ROLE_ADMIN: 3,
+};
+
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role];
+	return ok;
+}
+
+/**
+ * Whether any of roles grants permission.
+ */
+func Allowed(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		if slices.Contains(rolePermissions[role], permission) {
+			return true;
+		}
+	}
+
+	return false;
+}
+
+/**
+ * Whether roles grant any admin API permission at all.
+ */
+func IsStaff(roles []string) bool {
+	for _, role := range roles {
+		if len(rolePermissions[role]) > 0 {
+			return true;
+		}
+	}
+
+	return false;
+}
+
+/**
+ * Whether the highest of roles ranks above the highest of others.
+ */
+func Outranks(roles []string, others []string) bool {
+	return rank(roles) > rank(others);
+}
+
+func rank(roles []string) int {
+	highest := 0;
+
+	for _, role := range roles {
+		highest = max(highest, roleRanks[role]);
+	}
+
+	return highest;
+}
+
+/**
+ * The roles of wallet, always including ROLE_PLAYER, in a fixed order.
+ */
+func GetRoles(db *sql.DB, wallet string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT role
+		FROM roles
+		WHERE wallet = ?
+		ORDER BY role
+	`, wallet);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	roles := []string{ ROLE_PLAYER };
+
+	for rows.Next() {
+		var role string;
+
+		if err := rows.Scan(&role); err != nil {
+			return nil, err;
+		}
+
+		if role != ROLE_PLAYER && IsRole(role) {
+			roles = append(roles, role);
+		}
+	}
+
+	return roles, rows.Err();
+}
+
+/**
+ * Replaces the roles of wallet; by records who assigned them.
+ */
+func SetRoles(db *sql.DB, wallet string, roles []string, by string) error {
+	for _, role := range roles {
+		if !IsRole(role) {
+			return ErrUnknownRole;
+		}
+	}
+
+	tx, err := db.Begin();
+
+	if err != nil {
+		return err;
+	}
+
+	defer tx.Rollback();
+
+	if _, err := tx.Exec("DELETE FROM roles WHERE wallet = ?", wallet); err != nil {
+		return err;
+	}
+
+	for _, role := range roles {
+		if role == ROLE_PLAYER {
+			continue;
+		}
+
+		_, err := tx.Exec(`
+			INSERT IGNORE INTO roles
+			(wallet, role, grantedBy)
+			VALUES
+			(?, ?, ?)
+		`, wallet, role, by);
+
+		if err != nil {
+			return err;
+		}
+	}
+
+	return tx.Commit();
+}
+
+/**
+ * Adds role to wallet unless it already has it.
+ */
+func GrantRole(db *sql.DB, wallet string, role string, by string) error {
+	if !IsRole(role) {
+		return ErrUnknownRole;
+	}
+
+	_, err := db.Exec(`
+		INSERT IGNORE INTO roles
+		(wallet, role, grantedBy)
+		VALUES
+		(?, ?, ?)
+	`, wallet, role, by);
+
+	return err;
+}
+
+/**
+ * Makes wallets admins, and takes the admin role from any wallet that
+ * was granted it by the config but is no longer listed, returning
+ * those. Admins granted through the admin API are left alone.
+ */
+func SyncConfigAdmins(db *sql.DB, wallets []string) ([]string, error) {
+	tx, err := db.Begin();
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer tx.Rollback();
+
+	rows, err := tx.Query(`
+		SELECT wallet
+		FROM roles
+		WHERE role = ?
+		AND grantedBy = ?
+		FOR UPDATE
+	`, ROLE_ADMIN, GRANTED_BY_CONFIG);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	removed := make([]string, 0);
+
+	for rows.Next() {
+		var wallet string;
+
+		if err := rows.Scan(&wallet); err != nil {
+			rows.Close();
+			return nil, err;
+		}
+
+		if !slices.Contains(wallets, wallet) {
+			removed = append(removed, wallet);
+		}
+	}
+
+	rows.Close();
+
+	if err := rows.Err(); err != nil {
+		return nil, err;
+	}
+
+	for _, wallet := range removed {
+		_, err := tx.Exec(`
+			DELETE FROM roles
+			WHERE wallet = ?
+			AND role = ?
+			AND grantedBy = ?
+		`, wallet, ROLE_ADMIN, GRANTED_BY_CONFIG);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	for _, wallet := range wallets {
+		_, err := tx.Exec(`
+			INSERT IGNORE INTO roles
+			(wallet, role, grantedBy)
+			VALUES
+			(?, ?, ?)
+		`, wallet, ROLE_ADMIN, GRANTED_BY_CONFIG);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	return removed, tx.Commit();
+}
@@ -0,0 +1,434 @@
+package auth;
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+);
+
+var (
+	ErrSessionUnknown = errors.New("session does not exist")
+	ErrSessionRevoked = errors.New("session revoked")
+	ErrSessionExpired = errors.New("session expired")
+	ErrRefreshReused = errors.New("refresh token already used; session revoked")
+)
+
+const (
+	REVOKED_BY_LOGOUT = "logout";
+	REVOKED_BY_WALLET = "wallet";
+	REVOKED_BY_REUSE = "reuse";
+);
+
+const MAX_SESSIONS = 100;
+
+/**
+ * A sign-in. Access tokens name the session they belong to, and stop
+ * being accepted at login once it is revoked or expired.
+ */
+type Session struct {
+	Id uuid.UUID `json:"id"`;
+	Wallet string `json:"wallet"`;
+	Expires time.Time `json:"expires"`;
+	Refreshed *time.Time `json:"refreshed,omitempty"`;
+	Revoked *time.Time `json:"revoked,omitempty"`;
+	RevokedBy *string `json:"revokedBy,omitempty"`;
+	Created time.Time `json:"created"`;
+	Roles []string `json:"roles,omitempty"`;
+}
+
+/**
+ * Sessions and their refresh tokens. A refresh token is the session id
+ * and a secret, of which only the hash is stored; each refresh replaces
+ * the secret, and presenting a replaced one revokes the session, since
+ * it means the token was copied.
+ */
+type SessionStore struct {
+	db *sql.DB;
+	ttl time.Duration;
+}
+
+func NewSessionStore(db *sql.DB, ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		db: db,
+		ttl: ttl,
+	};
+}
+
+func newSecret() (string, string, error) {
+	secret := make([]byte, 32);
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err;
+	}
+
+	encoded := hex.EncodeToString(secret);
+
+	return encoded, hashSecret(encoded), nil;
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret));
+	return hex.EncodeToString(hash[:]);
+}
+
+/**
+ * Starts a session for wallet, unless it is banned, returning the
+ * session with the wallet's roles and its refresh token.
+ */
+func (store *SessionStore) Create(wallet string) (*Session, string, error) {
+	banned, err := IsBanned(store.db, wallet);
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	if banned {
+		return nil, "", ErrBanned;
+	}
+
+	roles, err := GetRoles(store.db, wallet);
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	id, err := uuid.NewV7();
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	secret, hash, err := newSecret();
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	_, err = store.db.Exec(`
+		INSERT INTO sessions
+		(id, wallet, refreshHash, expires)
+		VALUES
+		(?, ?, ?, NOW(3) + INTERVAL ? MICROSECOND)
+	`, id, wallet, hash, store.ttl.Microseconds());
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	session := &Session{
+		Id: id,
+		Wallet: wallet,
+		Roles: roles,
+	};
+
+	return session, id.String() + "." + secret, nil;
+}
+
+/**
+ * Exchanges a refresh token for a new one, extending the session and
+ * picking up any change to the wallet's roles.
+ */
+func (store *SessionStore) Refresh(token string) (*Session, string, error) {
+	idString, secret, ok := strings.Cut(token, ".");
+	id, err := uuid.Parse(idString);
+
+	if !ok || err != nil {
+		return nil, "", ErrSessionUnknown;
+	}
+
+	tx, err := store.db.Begin();
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	defer tx.Rollback();
+
+	session := Session{ Id: id };
+	var refreshHash string;
+	var revoked bool;
+	var expired bool;
+
+	err = tx.QueryRow(`
+		SELECT wallet, refreshHash, revoked IS NOT NULL, expires <= NOW(3)
+		FROM sessions
+		WHERE id = ?
+		FOR UPDATE
+	`, id).Scan(&session.Wallet, &refreshHash, &revoked, &expired);
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, "", ErrSessionUnknown;
+	case err != nil:
+		return nil, "", err;
+	case revoked:
+		return nil, "", ErrSessionRevoked;
+	case expired:
+		return nil, "", ErrSessionExpired;
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(refreshHash)) != 1 {
+		if err := revoke(tx, id, REVOKED_BY_REUSE); err != nil {
+			return nil, "", err;
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, "", err;
+		}
+
+		return nil, "", ErrRefreshReused;
+	}
+
+	banned, err := IsBanned(store.db, session.Wallet);
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	if banned {
+		if err := revoke(tx, id, REVOKED_BY_BAN); err != nil {
+			return nil, "", err;
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, "", err;
+		}
+
+		return nil, "", ErrBanned;
+	}
+
+	if session.Roles, err = GetRoles(store.db, session.Wallet); err != nil {
+		return nil, "", err;
+	}
+
+	next, hash, err := newSecret();
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sessions
+		SET refreshHash = ?,
+		refreshed = NOW(3),
+		expires = NOW(3) + INTERVAL ? MICROSECOND
+		WHERE id = ?
+	`, hash, store.ttl.Microseconds(), id);
+
+	if err != nil {
+		return nil, "", err;
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err;
+	}
+
+	return &session, id.String() + "." + next, nil;
+}
+
+/**
+ * Returns nil if the session can still be used.
+ */
+func (store *SessionStore) Check(id uuid.UUID) error {
+	var revoked bool;
+	var expired bool;
+
+	err := store.db.QueryRow(`
+		SELECT revoked IS NOT NULL, expires <= NOW(3)
+		FROM sessions
+		WHERE id = ?
+	`, id).Scan(&revoked, &expired);
+
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrSessionUnknown;
+	case err != nil:
+		return err;
+	case revoked:
+		return ErrSessionRevoked;
+	case expired:
+		return ErrSessionExpired;
+	}
+
+	return nil;
+}
+
+/**
+ * The wallet that signed in to session id.
+ */
+func (store *SessionStore) WalletOf(id uuid.UUID) (string, error) {
+	var wallet string;
+
+	err := store.db.QueryRow(`
+		SELECT wallet
+		FROM sessions
+		WHERE id = ?
+	`, id).Scan(&wallet);
+
+	if err == sql.ErrNoRows {
+		return "", ErrSessionUnknown;
+	}
+
+	return wallet, err;
+}
+
+func revoke(tx *sql.Tx, id uuid.UUID, by string) error {
+	_, err := tx.Exec(`
+		UPDATE sessions
+		SET revoked = NOW(3),
+		revokedBy = ?
+		WHERE id = ?
+		AND revoked IS NULL
+	`, by, id);
+
+	return err;
+}
+
+/**
+ * Revokes a session; by records who did, e.g. REVOKED_BY_LOGOUT or an
+ * admin's name.
+ */
+func (store *SessionStore) Revoke(id uuid.UUID, by string) error {
+	tx, err := store.db.Begin();
+
+	if err != nil {
+		return err;
+	}
+
+	defer tx.Rollback();
+
+	if err := revoke(tx, id, by); err != nil {
+		return err;
+	}
+
+	return tx.Commit();
+}
+
+/**
+ * Revokes every live session of wallet and returns their ids, so that
+ * their connections can be closed.
+ */
+func (store *SessionStore) RevokeWallet(wallet string, by string) ([]uuid.UUID, error) {
+	tx, err := store.db.Begin();
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer tx.Rollback();
+
+	rows, err := tx.Query(`
+		SELECT id
+		FROM sessions
+		WHERE wallet = ?
+		AND revoked IS NULL
+		AND expires > NOW(3)
+		FOR UPDATE
+	`, wallet);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	ids := make([]uuid.UUID, 0);
+
+	for rows.Next() {
+		var id uuid.UUID;
+
+		if err := rows.Scan(&id); err != nil {
+			rows.Close();
+			return nil, err;
+		}
+
+		ids = append(ids, id);
+	}
+
+	rows.Close();
+
+	if err := rows.Err(); err != nil {
+		return nil, err;
+	}
+
+	for _, id := range ids {
+		if err := revoke(tx, id, by); err != nil {
+			return nil, err;
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err;
+	}
+
+	return ids, nil;
+}
+
+/**
+ * The most recent sessions of wallet, newest first.
+ */
+func (store *SessionStore) List(wallet string) ([]Session, error) {
+	rows, err := store.db.Query(`
+		SELECT
+		id,
+		wallet,
+		FLOOR(1000 * UNIX_TIMESTAMP(expires)) AS expires,
+		COALESCE(FLOOR(1000 * UNIX_TIMESTAMP(refreshed)), 0) AS refreshed,
+		COALESCE(FLOOR(1000 * UNIX_TIMESTAMP(revoked)), 0) AS revoked,
+		revokedBy,
+		FLOOR(1000 * UNIX_TIMESTAMP(created)) AS created
+		FROM sessions
+		WHERE wallet = ?
+		ORDER BY created DESC
+		LIMIT ?
+	`, wallet, MAX_SESSIONS);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	sessions := make([]Session, 0);
+
+	for rows.Next() {
+		var session Session;
+		var expires, refreshed, revoked, created int64;
+
+		err := rows.Scan(
+			&session.Id,
+			&session.Wallet,
+			&expires,
+			&refreshed,
+			&revoked,
+			&session.RevokedBy,
+			&created,
+		);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if refreshed > 0 {
+			refreshedAt := time.UnixMilli(refreshed);
+			session.Refreshed = &refreshedAt;
+		}
+
+		if revoked > 0 {
+			revokedAt := time.UnixMilli(revoked);
+			session.Revoked = &revokedAt;
+		}
+
+		session.Expires = time.UnixMilli(expires);
+		session.Created = time.UnixMilli(created);
+
+		sessions = append(sessions, session);
+	}
+
+	return sessions, rows.Err();
+}
@@ -0,0 +1,156 @@
+package auth;
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/spruceid/siwe-go"
+
+	"github.com/samott/crash-backend/config"
+);
+
+var (
+	ErrMalformedMessage = errors.New("malformed sign-in message")
+	ErrWrongDomain = errors.New("sign-in message for another domain")
+	ErrWrongUri = errors.New("sign-in message for another URI")
+	ErrWrongChain = errors.New("sign-in message for an unsupported chain")
+	ErrIssuedInFuture = errors.New("sign-in message issued in the future")
+	ErrMessageTooOld = errors.New("sign-in message issued too long ago")
+	ErrMessageExpired = errors.New("sign-in message expired")
+	ErrNotYetValid = errors.New("sign-in message not yet valid")
+	ErrInvalidSignature = errors.New("invalid sign-in signature")
+)
+
+/**
+ * Error codes sent to clients for each reason a sign-in can fail.
+ */
+var errorCodes = map[error]string{
+	ErrMalformedMessage: "MALFORMED_MESSAGE",
+	ErrWrongDomain: "WRONG_DOMAIN",
+	ErrWrongUri: "WRONG_URI",
+	ErrWrongChain: "WRONG_CHAIN",
+	ErrIssuedInFuture: "ISSUED_IN_FUTURE",
+	ErrMessageTooOld: "MESSAGE_TOO_OLD",
+	ErrMessageExpired: "MESSAGE_EXPIRED",
+	ErrNotYetValid: "NOT_YET_VALID",
+	ErrInvalidSignature: "INVALID_SIGNATURE",
+	ErrNonceUnknown: "NONCE_UNKNOWN",
+	ErrNonceUsed: "NONCE_USED",
+	ErrNonceExpired: "NONCE_EXPIRED",
+	ErrNonceWrongSocket: "NONCE_WRONG_SOCKET",
+	ErrSessionUnknown: "SESSION_UNKNOWN",
+	ErrSessionRevoked: "SESSION_REVOKED",
+	ErrSessionExpired: "SESSION_EXPIRED",
+	ErrRefreshReused: "REFRESH_REUSED",
+	ErrBanned: "BANNED",
+};
+
+func ErrorCode(err error) string {
+	for known, code := range errorCodes {
+		if errors.Is(err, known) {
+			return code;
+		}
+	}
+
+	return "AUTHENTICATION_FAILED";
+}
+
+/**
+ * Checks Sign-In with Ethereum messages against what this deployment
+ * expects. The nonce is only consumed once everything else checks out,
+ * so that a rejected attempt does not burn it.
+ */
+type Verifier struct {
+	nonces *NonceStore;
+	domain string;
+	origin url.URL;
+	chainIds []int;
+	maxAge time.Duration;
+	clockSkew time.Duration;
+	now func() time.Time;
+}
+
+func NewVerifier(nonces *NonceStore, cfg *config.CrashConfig) (*Verifier, error) {
+	origin, err := url.Parse(cfg.Auth.Uri);
+
+	if err != nil || origin.Scheme == "" || origin.Host == "" {
+		return nil, ErrWrongUri;
+	}
+
+	return &Verifier{
+		nonces: nonces,
+		domain: cfg.Auth.Domain,
+		origin: *origin,
+		chainIds: cfg.Auth.ChainIds,
+		maxAge: time.Duration(cfg.Auth.MaxMessageAgeSecs) * time.Second,
+		clockSkew: time.Duration(cfg.Auth.ClockSkewSecs) * time.Second,
+		now: time.Now,
+	}, nil;
+}
+
+/**
+ * Returns the wallet that signed the message, which must carry a nonce
+ * we issued to socketId, or to no socket in particular.
+ */
+func (verifier *Verifier) Verify(payload string, signature string, socketId string) (string, error) {
+	message, err := siwe.ParseMessage(payload);
+
+	if err != nil {
+		return "", ErrMalformedMessage;
+	}
+
+	if message.GetDomain() != verifier.domain {
+		return "", ErrWrongDomain;
+	}
+
+	uri := message.GetURI();
+
+	if uri.Scheme != verifier.origin.Scheme || uri.Host != verifier.origin.Host {
+		return "", ErrWrongUri;
+	}
+
+	if !slices.Contains(verifier.chainIds, message.GetChainID()) {
+		return "", ErrWrongChain;
+	}
+
+	now := verifier.now();
+	issuedAt, err := time.Parse(time.RFC3339, message.GetIssuedAt());
+
+	switch {
+	case err != nil:
+		return "", ErrMalformedMessage;
+	case issuedAt.After(now.Add(verifier.clockSkew)):
+		return "", ErrIssuedInFuture;
+	case now.Sub(issuedAt) > verifier.maxAge + verifier.clockSkew:
+		return "", ErrMessageTooOld;
+	}
+
+	if _, err := message.ValidAt(now); err != nil {
+		var expired *siwe.ExpiredMessage;
+
+		if errors.As(err, &expired) {
+			return "", ErrMessageExpired;
+		}
+
+		return "", ErrNotYetValid;
+	}
+
+	// VerifyEIP191 indexes the signature without checking its length.
+	if sig, err := hexutil.Decode(signature); err != nil || len(sig) != 65 {
+		return "", ErrInvalidSignature;
+	}
+
+	if _, err := message.VerifyEIP191(signature); err != nil {
+		return "", ErrInvalidSignature;
+	}
+
+	if err := verifier.nonces.Consume(message.GetNonce(), socketId); err != nil {
+		return "", err;
+	}
+
+	return common.Address(message.GetAddress()).Hex(), nil;
+}
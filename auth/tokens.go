@@ -0,0 +1,239 @@
+package auth;
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/samott/crash-backend/config"
+);
+
+var (
+	ErrUnknownAlgorithm = errors.New("unsupported token algorithm")
+	ErrInvalidKey = errors.New("invalid token key")
+	ErrDuplicateKey = errors.New("token key id used twice")
+	ErrNoSigningKey = errors.New("signing key not configured or cannot sign")
+	ErrUnknownKey = errors.New("token signed with an unknown key")
+	ErrInvalidClaims = errors.New("invalid token claims")
+)
+
+const (
+	ALG_HS256 = "HS256";
+	ALG_ES256 = "ES256";
+	ALG_EDDSA = "EdDSA";
+);
+
+/**
+ * The claims of an access token. Wallet is checked to be an address
+ * when the token is validated; Session is the session it was issued
+ * for, which may since have been revoked, and Roles the wallet's roles
+ * when it was issued.
+ */
+type Claims struct {
+	Wallet string `json:"wallet"`;
+	Session uuid.UUID `json:"sid"`;
+	Roles []string `json:"roles,omitempty"`;
+	jwt.RegisteredClaims;
+}
+
+/**
+ * A key as configured. Keys loaded from a public key file can only
+ * verify; HS256 secrets and private keys can do both.
+ */
+type tokenKey struct {
+	id string;
+	method jwt.SigningMethod;
+	sign crypto.PrivateKey;
+	verify crypto.PublicKey;
+}
+
+/**
+ * Issues and validates session tokens. Tokens are signed with the
+ * signing key and carry its id as kid; any configured key verifies
+ * tokens bearing its id, so a key can be rotated out by signing with
+ * a new one while the old stays configured until its tokens expire.
+ */
+type Tokens struct {
+	issuer string;
+	audience string;
+	ttl time.Duration;
+	signing *tokenKey;
+	keys map[string]*tokenKey;
+	methods []string;
+	now func() time.Time;
+}
+
+func NewTokens(cfg *config.CrashConfig) (*Tokens, error) {
+	tokens := &Tokens{
+		issuer: cfg.Tokens.Issuer,
+		audience: cfg.Tokens.Audience,
+		ttl: time.Duration(cfg.Tokens.TtlSecs) * time.Second,
+		keys: make(map[string]*tokenKey),
+		now: time.Now,
+	};
+
+	for _, def := range cfg.Tokens.Keys {
+		key, err := loadKey(def);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if _, ok := tokens.keys[key.id]; ok {
+			return nil, ErrDuplicateKey;
+		}
+
+		tokens.keys[key.id] = key;
+		tokens.methods = append(tokens.methods, key.method.Alg());
+	}
+
+	signing, ok := tokens.keys[cfg.Tokens.SigningKey];
+
+	if !ok || signing.sign == nil {
+		return nil, ErrNoSigningKey;
+	}
+
+	tokens.signing = signing;
+
+	return tokens, nil;
+}
+
+/**
+ * Reads a key from def.Key or, if that is empty, from def.File. For
+ * HS256 the material is the secret itself; otherwise it is a PEM
+ * private or public key.
+ */
+func loadKey(def config.TokenKeyDef) (*tokenKey, error) {
+	material := []byte(def.Key);
+
+	if len(material) == 0 && def.File != "" {
+		data, err := os.ReadFile(def.File);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		material = data;
+	}
+
+	if def.Id == "" || len(material) == 0 {
+		return nil, ErrInvalidKey;
+	}
+
+	key := &tokenKey{ id: def.Id };
+
+	switch def.Algorithm {
+	case ALG_HS256:
+		secret := []byte(strings.TrimRight(string(material), "\r\n"));
+
+		if len(secret) < 32 {
+			return nil, ErrInvalidKey;
+		}
+
+		key.method = jwt.SigningMethodHS256;
+		key.sign, key.verify = secret, secret;
+	case ALG_ES256:
+		key.method = jwt.SigningMethodES256;
+
+		if private, err := jwt.ParseECPrivateKeyFromPEM(material); err == nil {
+			key.sign, key.verify = private, &private.PublicKey;
+		} else if public, err := jwt.ParseECPublicKeyFromPEM(material); err == nil {
+			key.verify = public;
+		} else {
+			return nil, ErrInvalidKey;
+		}
+	case ALG_EDDSA:
+		key.method = jwt.SigningMethodEdDSA;
+
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(material); err == nil {
+			key.sign, key.verify = private, private.(ed25519.PrivateKey).Public();
+		} else if public, err := jwt.ParseEdPublicKeyFromPEM(material); err == nil {
+			key.verify = public;
+		} else {
+			return nil, ErrInvalidKey;
+		}
+	default:
+		return nil, ErrUnknownAlgorithm;
+	}
+
+	return key, nil;
+}
+
+func (tokens *Tokens) Issue(session *Session) (string, error) {
+	now := tokens.now();
+	wallet := session.Wallet;
+
+	token := jwt.NewWithClaims(tokens.signing.method, Claims{
+		Wallet: wallet,
+		Session: session.Id,
+		Roles: session.Roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: tokens.issuer,
+			Subject: wallet,
+			Audience: jwt.ClaimStrings{ tokens.audience },
+			IssuedAt: jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokens.ttl)),
+		},
+	});
+
+	token.Header["kid"] = tokens.signing.id;
+
+	return token.SignedString(tokens.signing.sign);
+}
+
+func (tokens *Tokens) Validate(tokenString string) (*Claims, error) {
+	var claims Claims;
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		tokens.keyFor,
+		jwt.WithValidMethods(tokens.methods),
+		jwt.WithIssuer(tokens.issuer),
+		jwt.WithAudience(tokens.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(tokens.now),
+	);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	if !common.IsHexAddress(claims.Wallet) || claims.Session == uuid.Nil {
+		return nil, ErrInvalidClaims;
+	}
+
+	claims.Wallet = common.HexToAddress(claims.Wallet).Hex();
+
+	return &claims, nil;
+}
+
+/**
+ * The key named by the token's kid, provided the token uses that key's
+ * algorithm; otherwise an HS256 secret could be used to "verify" a
+ * token claiming some other algorithm.
+ */
+func (tokens *Tokens) keyFor(token *jwt.Token) (any, error) {
+	id, ok := token.Header["kid"].(string);
+
+	if !ok {
+		return nil, ErrUnknownKey;
+	}
+
+	key, ok := tokens.keys[id];
+
+	if !ok || token.Method.Alg() != key.method.Alg() {
+		return nil, ErrUnknownKey;
+	}
+
+	return key.verify, nil;
+}
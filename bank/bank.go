@@ -8,27 +8,121 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/config"
 )
 
 var (
 	ErrUnableToWithdrawBalance = errors.New("Unable to withdraw balance")
 	ErrUnableToDecreaseBalance = errors.New("Unable to decrease balance")
 	ErrUnableToIncreaseBalance = errors.New("Unable to increase balance")
+	ErrUnableToTransferBalance = errors.New("Unable to transfer balance")
+	ErrUnableToRefundWithdrawal = errors.New("Unable to refund withdrawal")
 	ErrBalanceRecordNotFound = errors.New("Balance record not found");
+	ErrUnknownCurrency = errors.New("Unknown currency");
+	ErrInvalidAmount = errors.New("Amount must be positive");
 )
 
 type TxCallback func(*sql.Tx) error;
 
+type Amount struct {
+	Currency string;
+	Amount decimal.Decimal;
+}
+
 type Bank struct {
 	db *sql.DB;
+	currencies map[string]config.CurrencyDef;
 };
 
-func NewBank(db *sql.DB) (*Bank, error) {
+func NewBank(db *sql.DB, config *config.CrashConfig) (*Bank, error) {
 	return &Bank{
 		db: db,
+		currencies: config.Currencies,
 	}, nil;
 }
 
+/**
+ * Creates an empty balance record for the wallet, if one does not
+ * already exist. Balance records are also created lazily on the
+ * first credit, so calling this is optional.
+ */
+func (bank *Bank) OpenAccount(
+	wallet string,
+	currency string,
+) error {
+	if _, ok := bank.currencies[currency]; !ok {
+		return ErrUnknownCurrency;
+	}
+
+	_, err := bank.db.Exec(`
+		INSERT IGNORE INTO balances
+		(wallet, currency)
+		VALUES
+		(?, ?)
+	`, wallet, currency);
+
+	return err;
+}
+
+/**
+ * Adds to the spent column of the balance record, provided that the
+ * available balance covers the amount. Returns false if it does not.
+ */
+func (bank *Bank) debitAccount(
+	tx *sql.Tx,
+	wallet string,
+	currency string,
+	amount decimal.Decimal,
+) (bool, error) {
+	amountStr := amount.String();
+
+	result, err := tx.Exec(`
+		UPDATE balances
+		SET spent = spent + CAST(? AS Decimal(32, 18))
+		WHERE wallet = ?
+		AND currency = ?
+		AND (balance + gained - spent - withdrawn - ?) >= 0
+	`, amountStr, wallet, currency, amountStr);
+
+	if err != nil {
+		return false, err;
+	}
+
+	rows, err := result.RowsAffected();
+
+	if err != nil {
+		return false, err;
+	}
+
+	return rows != 0, nil;
+}
+
+/**
+ * Adds to the gained column of the balance record, creating the
+ * record first if the wallet has never held the currency.
+ */
+func (bank *Bank) creditAccount(
+	tx *sql.Tx,
+	wallet string,
+	currency string,
+	amount decimal.Decimal,
+) error {
+	if _, ok := bank.currencies[currency]; !ok {
+		return ErrUnknownCurrency;
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO balances
+		(wallet, currency, gained)
+		VALUES
+		(?, ?, CAST(? AS Decimal(32, 18)))
+		ON DUPLICATE KEY UPDATE gained = gained + VALUES(gained)
+	`, wallet, currency, amount.String());
+
+	return err;
+}
+
 func (bank *Bank) DecreaseBalance(
 	wallet string,
 	currency string,
@@ -36,7 +130,6 @@ func (bank *Bank) DecreaseBalance(
 	reason string,
 	gameId uuid.UUID,
 ) (decimal.Decimal, error) {
-	amountStr := amount.String();
 	amountNegStr := amount.Neg().String();
 
 	tx, err := bank.db.BeginTx(context.Background(), nil);
@@ -47,31 +140,29 @@ func (bank *Bank) DecreaseBalance(
 
 	defer tx.Rollback();
 
-	result, err := tx.Exec(`
-		UPDATE balances
-		SET spent = spent + CAST(? AS Decimal(32, 18))
-		WHERE wallet = ?
-		AND currency = ?
-		AND (balance - spent - withdrawn - ?) >= 0
-	`, amountStr, wallet, currency, amountStr);
+	ok, err := bank.debitAccount(tx, wallet, currency, amount);
 
 	if err != nil {
 		return decimal.Zero, err;
 	}
 
-	if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+	if !ok {
 		return decimal.Zero, ErrUnableToDecreaseBalance;
 	}
 
-	result, err = tx.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO ledger
 		(wallet, currency, change, reason, gameId)
 		VALUES
 		(?, ?, CAST(? AS Decimal(32, 18)), ?, ?)
 	`, wallet, currency, amountNegStr, reason, gameId.String());
 
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
 	if err := tx.Commit(); err != nil {
-		return decimal.Zero, nil;
+		return decimal.Zero, err;
 	}
 
 	return bank.GetBalance(wallet, currency);
@@ -84,8 +175,6 @@ func (bank *Bank) IncreaseBalance(
 	reason string,
 	gameId uuid.UUID,
 ) (decimal.Decimal, error) {
-	amountStr := amount.String();
-
 	tx, err := bank.db.BeginTx(context.Background(), nil);
 
 	if err != nil {
@@ -94,30 +183,29 @@ func (bank *Bank) IncreaseBalance(
 
 	defer tx.Rollback();
 
-	result, err := tx.Exec(`
-		UPDATE balances
-		SET gained = gained + CAST(? AS Decimal(32, 18))
-		WHERE wallet = ?
-		AND currency = ?
-	`, amountStr, wallet, currency);
+	err = bank.creditAccount(tx, wallet, currency, amount);
 
-	if err != nil {
+	if err == ErrUnknownCurrency {
 		return decimal.Zero, err;
 	}
 
-	if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+	if err != nil {
 		return decimal.Zero, ErrUnableToIncreaseBalance;
 	}
 
-	result, err = tx.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO ledger
 		(wallet, currency, change, reason, gameId)
 		VALUES
 		(?, ?, CAST(? AS Decimal(32, 18)), ?, ?)
-	`, wallet, currency, amountStr, reason, gameId.String());
+	`, wallet, currency, amount.String(), reason, gameId.String());
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
 
 	if err := tx.Commit(); err != nil {
-		return decimal.Zero, nil;
+		return decimal.Zero, err;
 	}
 
 	return bank.GetBalance(wallet, currency);
@@ -127,55 +215,334 @@ func (bank *Bank) WithdrawBalance(
 	wallet string,
 	currency string,
 	amount decimal.Decimal,
+	chain string,
 	txCallback TxCallback,
 ) (decimal.Decimal, error) {
-	amountStr := amount.String();
-	amountNegStr := amount.Neg().String();
+	balances, err := bank.WithdrawBalances(
+		wallet,
+		[]Amount{ { Currency: currency, Amount: amount } },
+		chain,
+		txCallback,
+	);
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	return balances[currency], nil;
+}
 
+/**
+ * Withdraws several amounts from a wallet in one transaction; either
+ * all of them are debited or none are. Returns the new balance of
+ * each currency involved.
+ *
+ * All of the wallet's balance rows are locked first, so withdrawals
+ * from one wallet are serialised and txCallback sees any made before
+ * it. Errors returned by txCallback are passed through unchanged so
+ * that callers can enforce their own limits.
+ */
+func (bank *Bank) WithdrawBalances(
+	wallet string,
+	amounts []Amount,
+	chain string,
+	txCallback TxCallback,
+) (map[string]decimal.Decimal, error) {
 	tx, err := bank.db.BeginTx(context.Background(), nil);
 
 	if err != nil {
-		return decimal.Zero, err;
+		return nil, err;
 	}
 
 	defer tx.Rollback();
 
-	result, err := tx.Exec(`
-		UPDATE balances
-		SET withdrawn = withdrawn + CAST(? AS Decimal(32, 18))
+	rows, err := tx.Query(`
+		SELECT currency
+		FROM balances
 		WHERE wallet = ?
-		AND currency = ?
-		AND (balance - spent - withdrawn - ?) >= 0
-	`, amountStr, wallet, currency, amountStr);
+		FOR UPDATE
+	`, wallet);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	rows.Close();
+
+	for _, amount := range amounts {
+		amountStr := amount.Amount.String();
+
+		result, err := tx.Exec(`
+			UPDATE balances
+			SET withdrawn = withdrawn + CAST(? AS Decimal(32, 18))
+			WHERE wallet = ?
+			AND currency = ?
+			AND (balance + gained - spent - withdrawn - ?) >= 0
+		`, amountStr, wallet, amount.Currency, amountStr);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+			return nil, ErrUnableToWithdrawBalance;
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO ledger
+			(wallet, currency, change, reason, gameId, chain)
+			VALUES
+			(?, ?, CAST(? AS Decimal(32, 18)), ?, NULL, ?)
+		`, wallet, amount.Currency, amount.Amount.Neg().String(), "Withdrawal", chain);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	if (txCallback != nil) {
+		err = txCallback(tx);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err;
+	}
+
+	return bank.balancesOf(wallet, amounts);
+}
+
+/**
+ * Reverses a withdrawal whose voucher can no longer be used on-chain,
+ * returning every amount it debited. Errors returned by txCallback are
+ * passed through unchanged so that callers can detect withdrawals that
+ * were already refunded.
+ */
+func (bank *Bank) RefundWithdrawal(
+	wallet string,
+	amounts []Amount,
+	chain string,
+	txCallback TxCallback,
+) (map[string]decimal.Decimal, error) {
+	tx, err := bank.db.BeginTx(context.Background(), nil);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer tx.Rollback();
+
+	if (txCallback != nil) {
+		err = txCallback(tx);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	for _, amount := range amounts {
+		amountStr := amount.Amount.String();
+
+		result, err := tx.Exec(`
+			UPDATE balances
+			SET withdrawn = withdrawn - CAST(? AS Decimal(32, 18))
+			WHERE wallet = ?
+			AND currency = ?
+			AND withdrawn >= CAST(? AS Decimal(32, 18))
+		`, amountStr, wallet, amount.Currency, amountStr);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+			return nil, ErrUnableToRefundWithdrawal;
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO ledger
+			(wallet, currency, change, reason, gameId, chain)
+			VALUES
+			(?, ?, CAST(? AS Decimal(32, 18)), ?, NULL, ?)
+		`, wallet, amount.Currency, amountStr, "Withdrawal refunded", chain);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err;
+	}
+
+	return bank.balancesOf(wallet, amounts);
+}
+
+func (bank *Bank) balancesOf(
+	wallet string,
+	amounts []Amount,
+) (map[string]decimal.Decimal, error) {
+	balances := make(map[string]decimal.Decimal);
+
+	for _, amount := range amounts {
+		if _, ok := balances[amount.Currency]; ok {
+			continue;
+		}
+
+		balance, err := bank.GetBalance(wallet, amount.Currency);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		balances[amount.Currency] = balance;
+	}
+
+	return balances, nil;
+}
+
+/**
+ * Credits funds that arrived from outside the game, such as on-chain
+ * deposits. Balances are per currency whichever chain the funds came
+ * from; the chain is only recorded in the ledger. Errors returned by
+ * txCallback are passed through unchanged so that callers can detect
+ * deposits that were already recorded.
+ */
+func (bank *Bank) DepositBalance(
+	wallet string,
+	currency string,
+	amount decimal.Decimal,
+	chain string,
+	txCallback TxCallback,
+) (decimal.Decimal, error) {
+	tx, err := bank.db.BeginTx(context.Background(), nil);
 
 	if err != nil {
 		return decimal.Zero, err;
 	}
 
-	if rows, err := result.RowsAffected(); rows == 0 || err != nil {
-		return decimal.Zero, ErrUnableToWithdrawBalance;
+	defer tx.Rollback();
+
+	if (txCallback != nil) {
+		err = txCallback(tx);
+
+		if err != nil {
+			return decimal.Zero, err;
+		}
 	}
 
-	result, err = tx.Exec(`
+	err = bank.creditAccount(tx, wallet, currency, amount);
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	_, err = tx.Exec(`
 		INSERT INTO ledger
-		(wallet, currency, change, reason, gameId)
+		(wallet, currency, change, reason, gameId, chain)
 		VALUES
-		(?, ?, CAST(? AS Decimal(32, 18)), ?, NULL)
-	`, wallet, currency, amountNegStr, "Withdrawal");
+		(?, ?, CAST(? AS Decimal(32, 18)), ?, NULL, ?)
+	`, wallet, currency, amount.String(), "Deposit", chain);
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	if err := tx.Commit(); err != nil {
+		return decimal.Zero, err;
+	}
+
+	return bank.GetBalance(wallet, currency);
+}
+
+/**
+ * Moves funds between two wallets in a single transaction, writing a
+ * ledger entry for each side under the same transferId. The amount
+ * must be positive. Errors returned by txCallback are passed through
+ * unchanged so that callers can enforce their own limits.
+ */
+func (bank *Bank) TransferBalance(
+	from string,
+	to string,
+	currency string,
+	amount decimal.Decimal,
+	reason string,
+	transferId uuid.UUID,
+	txCallback TxCallback,
+) (decimal.Decimal, decimal.Decimal, error) {
+	if !amount.IsPositive() {
+		return decimal.Zero, decimal.Zero, ErrInvalidAmount;
+	}
+
+	amountStr := amount.String();
+
+	tx, err := bank.db.BeginTx(context.Background(), nil);
+
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err;
+	}
+
+	defer tx.Rollback();
+
+	ok, err := bank.debitAccount(tx, from, currency, amount);
+
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err;
+	}
+
+	if !ok {
+		return decimal.Zero, decimal.Zero, ErrUnableToTransferBalance;
+	}
+
+	err = bank.creditAccount(tx, to, currency, amount);
+
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err;
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO ledger
+		(wallet, currency, change, reason, transferId)
+		VALUES
+		(?, ?, CAST(? AS Decimal(32, 18)), ?, ?),
+		(?, ?, CAST(? AS Decimal(32, 18)), ?, ?)
+	`,
+		from, currency, amount.Neg().String(), reason, transferId.String(),
+		to, currency, amountStr, reason, transferId.String(),
+	);
+
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err;
+	}
 
 	if (txCallback != nil) {
 		err = txCallback(tx);
 
 		if err != nil {
-			return decimal.Zero, ErrUnableToWithdrawBalance;
+			return decimal.Zero, decimal.Zero, err;
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		return decimal.Zero, nil;
+		return decimal.Zero, decimal.Zero, err;
 	}
 
-	return bank.GetBalance(wallet, currency);
+	fromBalance, err := bank.GetBalance(from, currency);
+
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err;
+	}
+
+	toBalance, err := bank.GetBalance(to, currency);
+
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err;
+	}
+
+	return fromBalance, toBalance, nil;
 }
 
 func (bank *Bank) GetBalance(
@@ -199,6 +566,10 @@ func (bank *Bank) GetBalance(
 	defer rows.Close();
 
 	if !rows.Next() {
+		if _, ok := bank.currencies[currency]; ok {
+			return decimal.Zero, nil;
+		}
+
 		return decimal.Zero, ErrBalanceRecordNotFound;
 	}
 
@@ -218,6 +589,10 @@ func (bank *Bank) GetBalances(
 ) (map[string]decimal.Decimal, error) {
 	balances := make(map[string]decimal.Decimal);
 
+	for currency := range bank.currencies {
+		balances[currency] = decimal.Zero;
+	}
+
 	rows, err := bank.db.Query(`
 		SELECT currency, balance + gained - spent - withdrawn AS balance
 		FROM balances
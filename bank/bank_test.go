@@ -1,6 +1,7 @@
 package bank;
 
 import (
+	"errors"
 	"testing"
 	"log"
 
@@ -37,7 +38,7 @@ func init() {
 		return;
 	}
 
-	bankObj, err = NewBank(db);
+	bankObj, err = NewBank(db, config);
 
 	if err != nil {
 		log.Fatal("Bank construction failed: ", err);
@@ -151,7 +152,7 @@ func TestWithdrawBalance(t *testing.T) {
 		t.Fatal("Failed to create decimal");
 	}
 
-	balance, err := bankObj.WithdrawBalance(wallet, "eth", amount);
+	balance, err := bankObj.WithdrawBalance(wallet, "eth", amount, "ethereum", nil);
 
 	if err != nil {
 		t.Fatal("Failed to withdraw balance");
@@ -161,3 +162,257 @@ func TestWithdrawBalance(t *testing.T) {
 		t.Fatal("GetBalance() result is incorrect");
 	}
 }
+
+func newWalletWithBalances(t *testing.T, eth string, btc string) string {
+	randomUser, err := crypto.GenerateKey();
+
+	if err != nil {
+		t.Fatal("Failed to generate key: ", err);
+	}
+
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	_, err = bankObj.db.Exec(`
+		INSERT INTO balances
+		(currency, balance, wallet)
+		VALUES
+		(?, ?, ?), (?, ?, ?)
+	`, "eth", eth, wallet, "btc", btc, wallet);
+
+	if err != nil {
+		t.Fatal("Failed to create balances: ", err);
+	}
+
+	return wallet;
+}
+
+func TestWithdrawBalances(t *testing.T) {
+	wallet := newWalletWithBalances(t, "100", "1");
+
+	// The btc amount cannot be covered, so the eth one must not be
+	// debited either.
+	_, err := bankObj.WithdrawBalances(wallet, []Amount{
+		{ Currency: "eth", Amount: decimal.RequireFromString("10") },
+		{ Currency: "btc", Amount: decimal.RequireFromString("2") },
+	}, "ethereum", nil);
+
+	if err != ErrUnableToWithdrawBalance {
+		t.Fatal("Expected withdrawal to fail");
+	}
+
+	balance, err := bankObj.GetBalance(wallet, "eth");
+
+	if err != nil || balance.StringFixed(2) != "100.00" {
+		t.Fatal("Failed withdrawal changed balance: ", balance);
+	}
+
+	wallet = newWalletWithBalances(t, "100", "1");
+
+	balances, err := bankObj.WithdrawBalances(wallet, []Amount{
+		{ Currency: "eth", Amount: decimal.RequireFromString("10") },
+		{ Currency: "btc", Amount: decimal.RequireFromString("0.5") },
+	}, "ethereum", nil);
+
+	if err != nil {
+		t.Fatal("Failed to withdraw balances: ", err);
+	}
+
+	if balances["eth"].StringFixed(2) != "90.00" || balances["btc"].StringFixed(2) != "0.50" {
+		t.Fatal("Balances after withdrawal are incorrect: ", balances);
+	}
+
+	refused := errors.New("refused");
+
+	_, err = bankObj.WithdrawBalances(wallet, []Amount{
+		{ Currency: "eth", Amount: decimal.RequireFromString("10") },
+	}, "ethereum", func(tx *sql.Tx) error {
+		return refused;
+	});
+
+	if err != refused {
+		t.Fatal("WithdrawBalances() did not pass through callback error: ", err);
+	}
+
+	balance, err = bankObj.GetBalance(wallet, "eth");
+
+	if err != nil || balance.StringFixed(2) != "90.00" {
+		t.Fatal("Refused withdrawal changed balance: ", balance);
+	}
+}
+
+func TestRefundWithdrawal(t *testing.T) {
+	randomUser, err := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	_, err = bankObj.db.Exec(`
+		INSERT INTO balances
+		(currency, balance, wallet)
+		VALUES
+		(?, ?, ?)
+	`, "eth", "100", wallet);
+
+	if err != nil {
+		t.Fatal("Failed to create balance: ", err);
+	}
+
+	amount := decimal.RequireFromString("40");
+
+	if _, err = bankObj.WithdrawBalance(wallet, "eth", amount, "ethereum", nil); err != nil {
+		t.Fatal("Failed to withdraw balance: ", err);
+	}
+
+	amounts := []Amount{ { Currency: "eth", Amount: amount } };
+	balances, err := bankObj.RefundWithdrawal(wallet, amounts, "ethereum", nil);
+
+	if err != nil {
+		t.Fatal("Failed to refund withdrawal: ", err);
+	}
+
+	if balances["eth"].StringFixed(2) != "100.00" {
+		t.Fatal("Balance after refund is incorrect: ", balances["eth"]);
+	}
+
+	var chainEntries int;
+
+	err = bankObj.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM ledger
+		WHERE wallet = ?
+		AND chain = ?
+	`, wallet, "ethereum").Scan(&chainEntries);
+
+	if err != nil || chainEntries != 2 {
+		t.Fatal("Ledger entries not recorded against chain: ", chainEntries, err);
+	}
+
+	// Nothing is left withdrawn, so a second refund must fail.
+	_, err = bankObj.RefundWithdrawal(wallet, amounts, "ethereum", nil);
+
+	if err != ErrUnableToRefundWithdrawal {
+		t.Fatal("Refunded more than was withdrawn");
+	}
+}
+
+func TestIncreaseBalanceWithoutAccount(t *testing.T) {
+	randomUser, err := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	amount, err := decimal.NewFromString("5.5");
+
+	if err != nil {
+		t.Fatal("Failed to create decimal");
+	}
+
+	gameId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	balance, err := bankObj.IncreaseBalance(wallet, "eth", amount, "Credit", gameId);
+
+	if err != nil {
+		t.Fatal("Failed to increase balance of new account: ", err);
+	}
+
+	if balance.StringFixed(2) != "5.50" {
+		t.Fatal("IncreaseBalance() result is incorrect");
+	}
+
+	_, err = bankObj.IncreaseBalance(wallet, "doge", amount, "Credit", gameId);
+
+	if err != ErrUnknownCurrency {
+		t.Fatal("IncreaseBalance() accepted unknown currency");
+	}
+}
+
+func TestOpenAccount(t *testing.T) {
+	randomUser, err := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	if err = bankObj.OpenAccount(wallet, "btc"); err != nil {
+		t.Fatal("Failed to open account: ", err);
+	}
+
+	// Opening twice must be harmless
+	if err = bankObj.OpenAccount(wallet, "btc"); err != nil {
+		t.Fatal("Failed to re-open account: ", err);
+	}
+
+	if err = bankObj.OpenAccount(wallet, "doge"); err != ErrUnknownCurrency {
+		t.Fatal("OpenAccount() accepted unknown currency");
+	}
+
+	balances, err := bankObj.GetBalances(wallet);
+
+	if err != nil {
+		t.Fatal("Failed to get balances: ", err);
+	}
+
+	for currency := range bankObj.currencies {
+		balance, ok := balances[currency];
+
+		if !ok {
+			t.Fatal("GetBalances() missing currency: ", currency);
+		}
+
+		if !balance.IsZero() {
+			t.Fatal("GetBalances() result is incorrect for ", currency);
+		}
+	}
+}
+
+func TestTransferBalance(t *testing.T) {
+	sender, err := crypto.GenerateKey();
+	from := crypto.PubkeyToAddress(sender.PublicKey).String();
+
+	recipient, err := crypto.GenerateKey();
+	to := crypto.PubkeyToAddress(recipient.PublicKey).String();
+
+	_, err = bankObj.db.Exec(`
+		INSERT INTO balances
+		(currency, balance, wallet)
+		VALUES
+		(?, ?, ?)
+	`, "eth", "10", from);
+
+	amount, err := decimal.NewFromString("2.5");
+
+	if err != nil {
+		t.Fatal("Failed to create decimal");
+	}
+
+	transferId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	fromBalance, toBalance, err := bankObj.TransferBalance(from, to, "eth", amount, "Tip", transferId, nil);
+
+	if err != nil {
+		t.Fatal("Failed to transfer balance: ", err);
+	}
+
+	if fromBalance.StringFixed(2) != "7.50" || toBalance.StringFixed(2) != "2.50" {
+		t.Fatal("TransferBalance() result is incorrect");
+	}
+
+	tooMuch, err := decimal.NewFromString("8");
+
+	if err != nil {
+		t.Fatal("Failed to create decimal");
+	}
+
+	_, _, err = bankObj.TransferBalance(from, to, "eth", tooMuch, "Tip", transferId, nil);
+
+	if err != ErrUnableToTransferBalance {
+		t.Fatal("TransferBalance() allowed overdraft");
+	}
+
+	_, _, err = bankObj.TransferBalance(to, from, "eth", amount.Neg(), "Tip", transferId, nil);
+
+	if err != ErrInvalidAmount {
+		t.Fatal("TransferBalance() allowed a negative amount");
+	}
+}
@@ -0,0 +1,222 @@
+package bank;
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrUnableToPayWinnings = errors.New("Unable to pay winnings");
+)
+
+/**
+ * The account house funding is recorded against in the ledger.
+ */
+const HOUSE_WALLET = "0x0000000000000000000000000000000000000000";
+
+/**
+ * The bankroll is the house's own balance in each currency. Stakes
+ * are moved into it when a round starts and winnings are paid out of
+ * it, so at any time it reflects the house's net position.
+ */
+func adjustBankroll(
+	tx *sql.Tx,
+	currency string,
+	change decimal.Decimal,
+) error {
+	_, err := tx.Exec(`
+		INSERT INTO bankroll
+		(currency, balance)
+		VALUES
+		(?, CAST(? AS Decimal(32, 18)))
+		ON DUPLICATE KEY UPDATE balance = balance + VALUES(balance)
+	`, currency, change.String());
+
+	return err;
+}
+
+func (bank *Bank) PayWinnings(
+	wallet string,
+	currency string,
+	amount decimal.Decimal,
+	reason string,
+	gameId uuid.UUID,
+	txCallback TxCallback,
+) (decimal.Decimal, error) {
+	tx, err := bank.db.BeginTx(context.Background(), nil);
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	defer tx.Rollback();
+
+	err = bank.creditAccount(tx, wallet, currency, amount);
+
+	if err != nil {
+		return decimal.Zero, ErrUnableToPayWinnings;
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO ledger
+		(wallet, currency, change, reason, gameId)
+		VALUES
+		(?, ?, CAST(? AS Decimal(32, 18)), ?, ?)
+	`, wallet, currency, amount.String(), reason, gameId.String());
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	if err = adjustBankroll(tx, currency, amount.Neg()); err != nil {
+		return decimal.Zero, err;
+	}
+
+	if (txCallback != nil) {
+		err = txCallback(tx);
+
+		if err != nil {
+			return decimal.Zero, err;
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return decimal.Zero, err;
+	}
+
+	return bank.GetBalance(wallet, currency);
+}
+
+/**
+ * Adds house funds to the bankroll of currency, recording them in the
+ * ledger against HOUSE_WALLET.
+ */
+func (bank *Bank) FundBankroll(
+	currency string,
+	amount decimal.Decimal,
+) (decimal.Decimal, error) {
+	if !amount.IsPositive() {
+		return decimal.Zero, ErrInvalidAmount;
+	}
+
+	if _, ok := bank.currencies[currency]; !ok {
+		return decimal.Zero, ErrUnknownCurrency;
+	}
+
+	tx, err := bank.db.BeginTx(context.Background(), nil);
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	defer tx.Rollback();
+
+	_, err = tx.Exec(`
+		INSERT INTO bankroll
+		(currency, balance, funded)
+		VALUES
+		(?, CAST(? AS Decimal(32, 18)), CAST(? AS Decimal(32, 18)))
+		ON DUPLICATE KEY UPDATE
+		balance = balance + VALUES(balance),
+		funded = funded + VALUES(funded)
+	`, currency, amount.String(), amount.String());
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO ledger
+		(wallet, currency, change, reason)
+		VALUES
+		(?, ?, CAST(? AS Decimal(32, 18)), ?)
+	`, HOUSE_WALLET, currency, amount.String(), "Bankroll funded");
+
+	if err != nil {
+		return decimal.Zero, err;
+	}
+
+	if err := tx.Commit(); err != nil {
+		return decimal.Zero, err;
+	}
+
+	balance, _, err := bank.GetBankroll(currency);
+
+	return balance, err;
+}
+
+/**
+ * Returns the bankroll of currency and whether the house has ever
+ * funded it; an unfunded bankroll only holds the net result of play.
+ */
+func (bank *Bank) GetBankroll(currency string) (decimal.Decimal, bool, error) {
+	var balanceStr string;
+	var funded bool;
+
+	err := bank.db.QueryRow(`
+		SELECT balance, funded > 0
+		FROM bankroll
+		WHERE currency = ?
+	`, currency).Scan(&balanceStr, &funded);
+
+	if err == sql.ErrNoRows {
+		return decimal.Zero, false, nil;
+	}
+
+	if err != nil {
+		return decimal.Zero, false, err;
+	}
+
+	balance, err := decimal.NewFromString(balanceStr);
+
+	return balance, funded, err;
+}
+
+func (bank *Bank) GetBankrolls() (map[string]decimal.Decimal, error) {
+	bankrolls := make(map[string]decimal.Decimal);
+
+	for currency := range bank.currencies {
+		bankrolls[currency] = decimal.Zero;
+	}
+
+	rows, err := bank.db.Query(`
+		SELECT currency, balance
+		FROM bankroll
+	`);
+
+	if err != nil {
+		return bankrolls, err;
+	}
+
+	defer rows.Close();
+
+	for rows.Next() {
+		var (
+			currency string
+			balanceStr string
+		);
+
+		rows.Scan(&currency, &balanceStr);
+
+		balance, err := decimal.NewFromString(balanceStr);
+
+		if err != nil {
+			slog.Error(
+				"Unable to load decimal bankroll from database",
+				"currency",
+				currency,
+			);
+
+			balance = decimal.Zero;
+		}
+
+		bankrolls[currency] = balance;
+	}
+
+	return bankrolls, nil;
+}
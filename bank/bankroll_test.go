@@ -0,0 +1,114 @@
+package bank;
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/shopspring/decimal"
+	"github.com/google/uuid"
+)
+
+func TestStakeAndWinningsMoveBankroll(t *testing.T) {
+	randomUser, err := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	_, err = bankObj.db.Exec(`
+		INSERT INTO balances
+		(currency, balance, wallet)
+		VALUES
+		(?, ?, ?)
+	`, "btc", "10", wallet);
+
+	gameId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	before, _, err := bankObj.GetBankroll("btc");
+
+	if err != nil {
+		t.Fatal("Failed to get bankroll: ", err);
+	}
+
+	results, err := bankObj.SettleStakes(
+		[]Stake{ { Wallet: wallet, Currency: "btc", Amount: decimal.NewFromInt(4) } },
+		gameId,
+	);
+
+	if err != nil || results[0].Err != nil {
+		t.Fatal("Failed to take stake: ", err, results[0].Err);
+	}
+
+	if results[0].Balance.StringFixed(2) != "6.00" {
+		t.Fatal("SettleStakes() result is incorrect");
+	}
+
+	balance, err := bankObj.PayWinnings(wallet, "btc", decimal.NewFromInt(6), "Cashout", gameId, nil);
+
+	if err != nil {
+		t.Fatal("Failed to pay winnings: ", err);
+	}
+
+	if balance.StringFixed(2) != "12.00" {
+		t.Fatal("PayWinnings() result is incorrect");
+	}
+
+	after, _, err := bankObj.GetBankroll("btc");
+
+	if err != nil {
+		t.Fatal("Failed to get bankroll: ", err);
+	}
+
+	if !after.Sub(before).Equal(decimal.NewFromInt(-2)) {
+		t.Fatal("Bankroll change is incorrect: ", after.Sub(before));
+	}
+
+	results, err = bankObj.SettleStakes(
+		[]Stake{ { Wallet: wallet, Currency: "btc", Amount: decimal.NewFromInt(13) } },
+		gameId,
+	);
+
+	if err != nil || results[0].Err != ErrUnableToTakeStake {
+		t.Fatal("SettleStakes() allowed overdraft");
+	}
+
+	unchanged, _, err := bankObj.GetBankroll("btc");
+
+	if err != nil || !unchanged.Equal(after) {
+		t.Fatal("Rejected stake changed bankroll: ", unchanged.Sub(after));
+	}
+}
+
+func TestFundBankroll(t *testing.T) {
+	before, _, err := bankObj.GetBankroll("btc");
+
+	if err != nil {
+		t.Fatal("Failed to get bankroll: ", err);
+	}
+
+	bankroll, err := bankObj.FundBankroll("btc", decimal.NewFromInt(5));
+
+	if err != nil {
+		t.Fatal("Failed to fund bankroll: ", err);
+	}
+
+	if !bankroll.Sub(before).Equal(decimal.NewFromInt(5)) {
+		t.Fatal("FundBankroll() result is incorrect: ", bankroll.Sub(before));
+	}
+
+	_, funded, err := bankObj.GetBankroll("btc");
+
+	if err != nil || !funded {
+		t.Fatal("Bankroll not marked as funded: ", err);
+	}
+
+	if _, err := bankObj.FundBankroll("btc", decimal.NewFromInt(-1)); err != ErrInvalidAmount {
+		t.Fatal("FundBankroll() accepted a negative amount");
+	}
+
+	if _, err := bankObj.FundBankroll("doge", decimal.NewFromInt(1)); err != ErrUnknownCurrency {
+		t.Fatal("FundBankroll() accepted an unknown currency");
+	}
+}
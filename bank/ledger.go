@@ -0,0 +1,122 @@
+package bank;
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const MAX_LEDGER_LIMIT = 1000;
+
+type LedgerEntry struct {
+	Id int64 `json:"id"`;
+	Wallet string `json:"wallet"`;
+	Currency string `json:"currency"`;
+	Change decimal.Decimal `json:"change"`;
+	Reason string `json:"reason"`;
+	GameId uuid.NullUUID `json:"gameId"`;
+	TransferId uuid.NullUUID `json:"transferId"`;
+	Chain *string `json:"chain"`;
+	Created time.Time `json:"created"`;
+}
+
+/**
+ * Narrows SearchLedger; zero values match everything. Entries come in
+ * the order they were written, starting after the one with id After.
+ */
+type LedgerFilter struct {
+	Wallet string;
+	Currency string;
+	Reason string;
+	GameId uuid.UUID;
+	Chain string;
+	After int64;
+	Limit int;
+}
+
+func (bank *Bank) SearchLedger(filter LedgerFilter) ([]LedgerEntry, error) {
+	where := "WHERE id > ?";
+	args := []any{ filter.After };
+
+	conditions := []struct {
+		set bool;
+		clause string;
+		value any;
+	}{
+		{ filter.Wallet != "", "wallet = ?", filter.Wallet },
+		{ filter.Currency != "", "currency = ?", filter.Currency },
+		{ filter.Reason != "", "reason = ?", filter.Reason },
+		{ filter.GameId != uuid.Nil, "gameId = ?", filter.GameId },
+		{ filter.Chain != "", "chain = ?", filter.Chain },
+	};
+
+	for _, condition := range conditions {
+		if condition.set {
+			where += " AND " + condition.clause;
+			args = append(args, condition.value);
+		}
+	}
+
+	limit := filter.Limit;
+
+	if limit <= 0 || limit > MAX_LEDGER_LIMIT {
+		limit = MAX_LEDGER_LIMIT;
+	}
+
+	rows, err := bank.db.Query(`
+		SELECT
+		id,
+		wallet,
+		currency,
+		ledger.change,
+		reason,
+		gameId,
+		transferId,
+		chain,
+		FLOOR(1000 * UNIX_TIMESTAMP(created)) AS created
+		FROM ledger
+		` + where + `
+		ORDER BY id
+		LIMIT ` + strconv.Itoa(limit), args...);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	entries := make([]LedgerEntry, 0);
+
+	for rows.Next() {
+		var entry LedgerEntry;
+		var change string;
+		var created int64;
+
+		err := rows.Scan(
+			&entry.Id,
+			&entry.Wallet,
+			&entry.Currency,
+			&change,
+			&entry.Reason,
+			&entry.GameId,
+			&entry.TransferId,
+			&entry.Chain,
+			&created,
+		);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if entry.Change, err = decimal.NewFromString(change); err != nil {
+			return nil, err;
+		}
+
+		entry.Created = time.UnixMilli(created);
+		entries = append(entries, entry);
+	}
+
+	return entries, rows.Err();
+}
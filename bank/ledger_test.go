@@ -0,0 +1,62 @@
+package bank;
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestSearchLedger(t *testing.T) {
+	key, _ := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(key.PublicKey).String();
+	gameId := uuid.New();
+
+	changes := []struct {
+		amount string;
+		reason string;
+	}{
+		{ "10", "deposit" },
+		{ "2.5", "winnings" },
+		{ "1", "winnings" },
+	};
+
+	for _, change := range changes {
+		_, err := bankObj.IncreaseBalance(wallet, "eth", decimal.RequireFromString(change.amount), change.reason, gameId);
+
+		if err != nil {
+			t.Fatal("IncreaseBalance() failed: ", err);
+		}
+	}
+
+	entries, err := bankObj.SearchLedger(LedgerFilter{ Wallet: wallet });
+
+	if err != nil {
+		t.Fatal("SearchLedger() failed: ", err);
+	}
+
+	if len(entries) != 3 || !entries[1].Change.Equal(decimal.RequireFromString("2.5")) {
+		t.Fatal("SearchLedger() returned the wrong entries: ", entries);
+	}
+
+	if !entries[0].GameId.Valid || entries[0].GameId.UUID != gameId || entries[0].Chain != nil {
+		t.Fatal("Entry has the wrong game or chain");
+	}
+
+	winnings, err := bankObj.SearchLedger(LedgerFilter{ Wallet: wallet, Reason: "winnings", Limit: 1 });
+
+	if err != nil || len(winnings) != 1 || winnings[0].Id != entries[1].Id {
+		t.Fatal("SearchLedger() by reason wrong: ", winnings, err);
+	}
+
+	next, err := bankObj.SearchLedger(LedgerFilter{ Wallet: wallet, Reason: "winnings", After: winnings[0].Id });
+
+	if err != nil || len(next) != 1 || next[0].Id != entries[2].Id {
+		t.Fatal("SearchLedger() second page wrong: ", next, err);
+	}
+
+	if none, err := bankObj.SearchLedger(LedgerFilter{ Wallet: wallet, Currency: "usdt" }); err != nil || len(none) != 0 {
+		t.Fatal("SearchLedger() by currency wrong: ", none, err);
+	}
+}
@@ -0,0 +1,261 @@
+package bank;
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrUnableToTakeStake = errors.New("Unable to take stake")
+)
+
+/**
+ * Maximum number of rows read or written per statement when settling
+ * a round, to stay well clear of placeholder and packet size limits.
+ */
+const SETTLEMENT_CHUNK_SIZE = 500;
+
+type Stake struct {
+	Wallet string;
+	Currency string;
+	Amount decimal.Decimal;
+}
+
+type StakeResult struct {
+	Stake;
+	Balance decimal.Decimal;
+	Err error;
+}
+
+type accountKey struct {
+	wallet string;
+	currency string;
+}
+
+/**
+ * Debits every stake of a round in one transaction. The balance rows
+ * of all wallets involved are locked and read up front; stakes are
+ * then accepted or rejected in Go and written back with a handful of
+ * multi-row statements, so the number of round trips depends on the
+ * chunk size rather than the number of players.
+ *
+ * A stake that cannot be covered is reported through its result's Err
+ * field and does not affect the others. The returned error is only
+ * set if the transaction as a whole failed, in which case nothing has
+ * been debited.
+ */
+func (bank *Bank) SettleStakes(
+	stakes []Stake,
+	gameId uuid.UUID,
+) ([]StakeResult, error) {
+	results := make([]StakeResult, len(stakes));
+
+	if len(stakes) == 0 {
+		return results, nil;
+	}
+
+	tx, err := bank.db.BeginTx(context.Background(), nil);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer tx.Rollback();
+
+	available, err := lockBalances(tx, stakes);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	debits := make(map[accountKey]decimal.Decimal);
+	taken := make(map[string]decimal.Decimal);
+	accepted := make([]Stake, 0, len(stakes));
+
+	for i, stake := range stakes {
+		key := accountKey{ stake.Wallet, stake.Currency };
+		results[i].Stake = stake;
+
+		balance, ok := available[key];
+
+		if !ok || !stake.Amount.IsPositive() || balance.LessThan(stake.Amount) {
+			results[i].Err = ErrUnableToTakeStake;
+			results[i].Balance = balance;
+			continue;
+		}
+
+		available[key] = balance.Sub(stake.Amount);
+		debits[key] = debits[key].Add(stake.Amount);
+		taken[stake.Currency] = taken[stake.Currency].Add(stake.Amount);
+		accepted = append(accepted, stake);
+	}
+
+	if err = writeDebits(tx, debits); err != nil {
+		return nil, err;
+	}
+
+	if err = writeStakeLedger(tx, accepted, gameId); err != nil {
+		return nil, err;
+	}
+
+	for currency, amount := range taken {
+		if err = adjustBankroll(tx, currency, amount); err != nil {
+			return nil, err;
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err;
+	}
+
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Balance = available[accountKey{ results[i].Wallet, results[i].Currency }];
+		}
+	}
+
+	return results, nil;
+}
+
+func placeholders(count int, group string) string {
+	return strings.TrimSuffix(strings.Repeat(group + ",", count), ",");
+}
+
+func lockBalances(
+	tx *sql.Tx,
+	stakes []Stake,
+) (map[accountKey]decimal.Decimal, error) {
+	available := make(map[accountKey]decimal.Decimal);
+	wanted := make(map[accountKey]bool);
+	seen := make(map[string]bool);
+	wallets := make([]any, 0, len(stakes));
+
+	for _, stake := range stakes {
+		wanted[accountKey{ stake.Wallet, stake.Currency }] = true;
+
+		if !seen[stake.Wallet] {
+			wallets = append(wallets, stake.Wallet);
+			seen[stake.Wallet] = true;
+		}
+	}
+
+	for start := 0; start < len(wallets); start += SETTLEMENT_CHUNK_SIZE {
+		chunk := wallets[start:min(start + SETTLEMENT_CHUNK_SIZE, len(wallets))];
+
+		rows, err := tx.Query(`
+			SELECT wallet, currency, balance + gained - spent - withdrawn AS balance
+			FROM balances
+			WHERE wallet IN (` + placeholders(len(chunk), "?") + `)
+			FOR UPDATE
+		`, chunk...);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		for rows.Next() {
+			var (
+				key accountKey
+				balanceStr string
+			);
+
+			if err := rows.Scan(&key.wallet, &key.currency, &balanceStr); err != nil {
+				rows.Close();
+				return nil, err;
+			}
+
+			if !wanted[key] {
+				continue;
+			}
+
+			balance, err := decimal.NewFromString(balanceStr);
+
+			if err != nil {
+				rows.Close();
+				return nil, err;
+			}
+
+			available[key] = balance;
+		}
+
+		rows.Close();
+
+		if err := rows.Err(); err != nil {
+			return nil, err;
+		}
+	}
+
+	return available, nil;
+}
+
+func writeDebits(
+	tx *sql.Tx,
+	debits map[accountKey]decimal.Decimal,
+) error {
+	args := make([]any, 0, 3 * len(debits));
+
+	for key, amount := range debits {
+		args = append(args, key.wallet, key.currency, amount.String());
+	}
+
+	// The rows are known to exist, so this only ever takes the
+	// update path; it lets us write many rows in one statement.
+	for start := 0; start < len(args); start += 3 * SETTLEMENT_CHUNK_SIZE {
+		chunk := args[start:min(start + 3 * SETTLEMENT_CHUNK_SIZE, len(args))];
+
+		_, err := tx.Exec(`
+			INSERT INTO balances
+			(wallet, currency, spent)
+			VALUES
+			` + placeholders(len(chunk) / 3, "(?, ?, CAST(? AS Decimal(32, 18)))") + `
+			ON DUPLICATE KEY UPDATE spent = spent + VALUES(spent)
+		`, chunk...);
+
+		if err != nil {
+			return err;
+		}
+	}
+
+	return nil;
+}
+
+func writeStakeLedger(
+	tx *sql.Tx,
+	stakes []Stake,
+	gameId uuid.UUID,
+) error {
+	args := make([]any, 0, 5 * len(stakes));
+
+	for _, stake := range stakes {
+		args = append(
+			args,
+			stake.Wallet,
+			stake.Currency,
+			stake.Amount.Neg().String(),
+			"Bet placed",
+			gameId.String(),
+		);
+	}
+
+	for start := 0; start < len(args); start += 5 * SETTLEMENT_CHUNK_SIZE {
+		chunk := args[start:min(start + 5 * SETTLEMENT_CHUNK_SIZE, len(args))];
+
+		_, err := tx.Exec(`
+			INSERT INTO ledger
+			(wallet, currency, change, reason, gameId)
+			VALUES
+			` + placeholders(len(chunk) / 5, "(?, ?, CAST(? AS Decimal(32, 18)), ?, ?)") + `
+		`, chunk...);
+
+		if err != nil {
+			return err;
+		}
+	}
+
+	return nil;
+}
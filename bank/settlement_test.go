@@ -0,0 +1,200 @@
+package bank;
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/shopspring/decimal"
+	"github.com/google/uuid"
+)
+
+func TestSettleStakes(t *testing.T) {
+	wallets := make([]string, 3);
+
+	for i := range wallets {
+		randomUser, err := crypto.GenerateKey();
+
+		if err != nil {
+			t.Fatal("Failed to generate key");
+		}
+
+		wallets[i] = crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+		_, err = bankObj.db.Exec(`
+			INSERT INTO balances
+			(currency, balance, wallet)
+			VALUES
+			(?, ?, ?), (?, ?, ?)
+		`, "eth", "10", wallets[i], "btc", "1", wallets[i]);
+
+		if err != nil {
+			t.Fatal("Failed to create balances: ", err);
+		}
+	}
+
+	gameId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	stakes := []Stake{
+		{ Wallet: wallets[0], Currency: "eth", Amount: decimal.NewFromInt(4) },
+		{ Wallet: wallets[0], Currency: "btc", Amount: decimal.NewFromFloat(0.5) },
+		{ Wallet: wallets[1], Currency: "eth", Amount: decimal.NewFromInt(11) },
+		{ Wallet: wallets[2], Currency: "eth", Amount: decimal.NewFromInt(10) },
+	};
+
+	results, err := bankObj.SettleStakes(stakes, gameId);
+
+	if err != nil {
+		t.Fatal("Failed to settle stakes: ", err);
+	}
+
+	expected := []string{ "6.00", "0.50", "", "0.00" };
+
+	for i, result := range results {
+		if expected[i] == "" {
+			if result.Err != ErrUnableToTakeStake {
+				t.Fatal("SettleStakes() accepted overdraft for stake ", i);
+			}
+
+			continue;
+		}
+
+		if result.Err != nil {
+			t.Fatal("SettleStakes() rejected stake ", i, ": ", result.Err);
+		}
+
+		if result.Balance.StringFixed(2) != expected[i] {
+			t.Fatal("SettleStakes() balance incorrect for stake ", i, ": ", result.Balance);
+		}
+
+		balance, err := bankObj.GetBalance(result.Wallet, result.Currency);
+
+		if err != nil || balance.StringFixed(2) != expected[i] {
+			t.Fatal("Stored balance incorrect for stake ", i, ": ", balance);
+		}
+	}
+
+	balance, err := bankObj.GetBalance(wallets[1], "eth");
+
+	if err != nil || balance.StringFixed(2) != "10.00" {
+		t.Fatal("Rejected stake changed balance: ", balance);
+	}
+}
+
+func TestSettleStakesAcrossChunks(t *testing.T) {
+	count := 2 * SETTLEMENT_CHUNK_SIZE + 1;
+	wallets := make([]string, count);
+	args := make([]any, 0, 3 * count);
+
+	for i := range wallets {
+		randomUser, err := crypto.GenerateKey();
+
+		if err != nil {
+			t.Fatal("Failed to generate key");
+		}
+
+		wallets[i] = crypto.PubkeyToAddress(randomUser.PublicKey).String();
+		args = append(args, "btc", "2", wallets[i]);
+	}
+
+	_, err := bankObj.db.Exec(`
+		INSERT INTO balances
+		(currency, balance, wallet)
+		VALUES
+	` + strings.TrimSuffix(strings.Repeat("(?, ?, ?),", count), ","), args...);
+
+	if err != nil {
+		t.Fatal("Failed to create balances: ", err);
+	}
+
+	gameId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	before, _, err := bankObj.GetBankroll("btc");
+
+	if err != nil {
+		t.Fatal("Failed to get bankroll: ", err);
+	}
+
+	// Every wallet stakes twice; the second stake of the last wallet
+	// cannot be covered.
+	stakes := make([]Stake, 0, 2 * count);
+
+	for _, wallet := range wallets {
+		stakes = append(stakes, Stake{ Wallet: wallet, Currency: "btc", Amount: decimal.NewFromInt(1) });
+	}
+
+	for i, wallet := range wallets {
+		amount := decimal.NewFromInt(1);
+
+		if i == count - 1 {
+			amount = decimal.NewFromInt(2);
+		}
+
+		stakes = append(stakes, Stake{ Wallet: wallet, Currency: "btc", Amount: amount });
+	}
+
+	results, err := bankObj.SettleStakes(stakes, gameId);
+
+	if err != nil {
+		t.Fatal("Failed to settle stakes: ", err);
+	}
+
+	for i, result := range results {
+		if i == len(results) - 1 {
+			if result.Err != ErrUnableToTakeStake {
+				t.Fatal("SettleStakes() accepted overdraft");
+			}
+
+			continue;
+		}
+
+		if result.Err != nil {
+			t.Fatal("SettleStakes() rejected stake ", i, ": ", result.Err);
+		}
+	}
+
+	for i, wallet := range wallets {
+		expected := "0.00";
+
+		if i == count - 1 {
+			expected = "1.00";
+		}
+
+		balance, err := bankObj.GetBalance(wallet, "btc");
+
+		if err != nil || balance.StringFixed(2) != expected {
+			t.Fatal("Stored balance incorrect for wallet ", i, ": ", balance);
+		}
+	}
+
+	var entries int;
+
+	err = bankObj.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM ledger
+		WHERE gameId = ?
+	`, gameId.String()).Scan(&entries);
+
+	if err != nil || entries != 2 * count - 1 {
+		t.Fatal("Ledger entry count incorrect: ", entries, err);
+	}
+
+	after, _, err := bankObj.GetBankroll("btc");
+
+	if err != nil {
+		t.Fatal("Failed to get bankroll: ", err);
+	}
+
+	if !after.Sub(before).Equal(decimal.NewFromInt(int64(2 * count - 1))) {
+		t.Fatal("Bankroll change is incorrect: ", after.Sub(before));
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/samott/crash-backend/anchor"
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/coins"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+	"github.com/samott/crash-backend/deposits"
+	"github.com/samott/crash-backend/game"
+	"github.com/samott/crash-backend/indexer"
+	"github.com/samott/crash-backend/signer"
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+/**
+ * Everything the backend runs against one configured chain: its RPC
+ * connection, the agent signing its vouchers, the coins its contract
+ * supports, the anchorer publishing round roots if this is the
+ * anchoring chain, and the pollers for its deposits, withdrawals and
+ * contract events.
+ */
+type Chain struct {
+	name string;
+	client *ethclient.Client;
+	agent *signer.Agent;
+	coins *coins.Registry;
+	anchorer *anchor.Anchorer;
+	depositWatcher *deposits.Watcher;
+	withdrawalTracker *withdrawals.Tracker;
+	eventIndexer *indexer.Indexer;
+	tickers []*time.Ticker;
+}
+
+func openChain(
+	name string,
+	cfg *config.CrashConfig,
+	db *sql.DB,
+	bankObj *bank.Bank,
+	gameObj *game.Game,
+	logger *logging.Logger,
+	signers []signer.Signer,
+) (*Chain, error) {
+	chainDef := cfg.Chains[name];
+
+	client, err := ethclient.Dial(chainDef.RpcUrl);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	chain := &Chain{
+		name: name,
+		client: client,
+	};
+
+	chain.agent, err = signer.NewAgent(
+		client,
+		common.HexToAddress(chainDef.Contract),
+		signers,
+		func(previous common.Address, current common.Address, usable bool) {
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"     : "Agent address changed on-chain",
+					"chain"   : name,
+					"previous": previous,
+					"current" : current,
+					"usable"  : usable,
+				},
+				Severity: logging.Alert,
+			});
+		},
+	);
+
+	if err != nil {
+		client.Close();
+		return nil, err;
+	}
+
+	err = chain.agent.Refresh(context.Background());
+
+	if err == signer.ErrAgentKeyMismatch {
+		slog.Error(
+			"No configured signer matches the contract's agent address; withdrawals disabled",
+			"chain", name,
+			"agentAddress", chain.agent.Address(),
+			"signers", chain.agent.Addresses(),
+		);
+	} else if err != nil {
+		client.Close();
+		return nil, err;
+	} else {
+		slog.Info("Withdrawal signer ready", "chain", name, "agentAddress", chain.agent.Address());
+	}
+
+	crash, err := contract.NewClient(common.HexToAddress(chainDef.Contract), client);
+
+	if err != nil {
+		client.Close();
+		return nil, err;
+	}
+
+	chain.coins = coins.NewRegistry(
+		crash,
+		chainDef,
+		cfg.Currencies,
+		func(coin coins.Coin) {
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"     : "Coin added on-chain",
+					"chain"   : name,
+					"currency": coin.Currency,
+					"coinId"  : coin.CoinId,
+					"token"   : coin.Token,
+				},
+				Severity: logging.Notice,
+			});
+		},
+	);
+
+	// A currency configured with the wrong decimals would credit and
+	// pay out the wrong amounts, so this is fatal.
+	if err = chain.coins.Refresh(context.Background()); err != nil {
+		client.Close();
+		return nil, err;
+	}
+
+	if disabled := chain.coins.Disabled(); len(disabled) > 0 {
+		slog.Warn("Currencies not supported by the contract yet", "chain", name, "currencies", disabled);
+	}
+
+	chain.depositWatcher, err = deposits.NewWatcher(
+		client,
+		cfg,
+		name,
+		deposits.NewSqlStore(db, bankObj, name),
+		gameObj,
+	);
+
+	if err != nil {
+		client.Close();
+		return nil, err;
+	}
+
+	chain.withdrawalTracker, err = withdrawals.NewTracker(
+		client,
+		cfg,
+		name,
+		withdrawals.NewSqlStore(db, bankObj, name),
+		gameObj,
+	);
+
+	if err != nil {
+		client.Close();
+		return nil, err;
+	}
+
+	chain.eventIndexer, err = indexer.NewIndexer(
+		client,
+		cfg,
+		name,
+		indexer.NewSqlStore(db, name),
+	);
+
+	if err != nil {
+		client.Close();
+		return nil, err;
+	}
+
+	if cfg.Anchoring.Chain == name {
+		chain.anchorer = anchor.NewAnchorer(
+			db,
+			name,
+			client,
+			chain.agent,
+			big.NewInt(chainDef.ChainId),
+			anchor.Config{
+				MaxRounds: cfg.Anchoring.MaxRounds,
+				ResendAfterSecs: cfg.Anchoring.ResendAfterSecs,
+			},
+		);
+	}
+
+	return chain, nil;
+}
+
+/**
+ * Starts polling the chain at the configured intervals. A zero
+ * interval disables that poller.
+ */
+func (chain *Chain) Start(cfg *config.CrashConfig, logger *logging.Logger) {
+	chain.every(cfg.Timers.AgentCheckFrequencySecs, "Failed to check agent address", logger, func(ctx context.Context) error {
+		if err := chain.agent.Refresh(ctx); err != signer.ErrAgentKeyMismatch {
+			return err;
+		}
+
+		return nil;
+	});
+
+	chain.every(cfg.Timers.CoinCheckFrequencySecs, "Failed to check supported coins", logger, chain.coins.Refresh);
+	chain.every(cfg.Timers.DepositCheckFrequencySecs, "Failed to check for deposits", logger, chain.depositWatcher.Poll);
+	chain.every(cfg.Timers.WithdrawalCheckFrequencySecs, "Failed to check for withdrawals", logger, chain.withdrawalTracker.Poll);
+	chain.every(cfg.Timers.EventIndexFrequencySecs, "Failed to index contract events", logger, chain.eventIndexer.Poll);
+
+	if chain.anchorer != nil {
+		chain.every(cfg.Timers.AnchorFrequencySecs, "Failed to anchor rounds", logger, chain.anchorer.Poll);
+	}
+}
+
+func (chain *Chain) every(
+	secs int,
+	failure string,
+	logger *logging.Logger,
+	poll func(context.Context) error,
+) {
+	if secs <= 0 {
+		return;
+	}
+
+	ticker := time.NewTicker(time.Duration(secs) * time.Second);
+	chain.tickers = append(chain.tickers, ticker);
+
+	go func() {
+		for range ticker.C {
+			if err := poll(context.Background()); err != nil {
+				logger.Log(logging.Entry{
+					Payload: Log{
+						"msg"  : failure,
+						"chain": chain.name,
+						"error": err,
+					},
+					Severity: logging.Error,
+				});
+			}
+		}
+	}();
+}
+
+func (chain *Chain) Close() {
+	for _, ticker := range chain.tickers {
+		ticker.Stop();
+	}
+
+	chain.client.Close();
+}
@@ -0,0 +1,208 @@
+package chainscan;
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+);
+
+/**
+ * Maximum number of blocks requested in a single eth_getLogs call;
+ * most public RPC endpoints reject larger ranges.
+ */
+const MAX_BLOCK_RANGE = 1000;
+
+type Client interface {
+	BlockNumber(context.Context) (uint64, error);
+	HeaderByNumber(context.Context, *big.Int) (*types.Header, error);
+	FilterLogs(context.Context, ethereum.FilterQuery) ([]types.Log, error);
+}
+
+/**
+ * Where a scanner has got to: the last block processed and its hash.
+ */
+type Cursor interface {
+	LastBlock() (uint64, common.Hash, bool, error);
+	SetLastBlock(uint64, common.Hash) error;
+}
+
+type LogHandler func(*types.Log) error;
+
+type Scanner struct {
+	client Client;
+	cursor Cursor;
+	addresses []common.Address;
+	topics [][]common.Hash;
+	startBlock uint64;
+	rewind uint64;
+}
+
+/**
+ * Creates a scanner for logs from the given addresses matching topics.
+ * Scanning begins at startBlock the first time; after a reorg it goes
+ * back rewind blocks from the cursor, which should be at least the
+ * deepest confirmation depth that anything relying on it uses.
+ */
+func NewScanner(
+	client Client,
+	cursor Cursor,
+	addresses []common.Address,
+	topics [][]common.Hash,
+	startBlock uint64,
+	rewind uint64,
+) *Scanner {
+	return &Scanner{
+		client: client,
+		cursor: cursor,
+		addresses: addresses,
+		topics: topics,
+		startBlock: startBlock,
+		rewind: max(rewind, 1),
+	};
+}
+
+/**
+ * Passes every matching log between the cursor and the current head to
+ * handle, and returns the head. Logs may be handled more than once, so
+ * handle must be idempotent.
+ *
+ * The cursor is saved after each range together with the hash of its
+ * last block. If that block has since been replaced, the scanner
+ * rewinds and scans again, so that logs in the replacement blocks are
+ * picked up.
+ */
+func (scanner *Scanner) Scan(ctx context.Context, handle LogHandler) (uint64, error) {
+	head, err := scanner.client.BlockNumber(ctx);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	from, err := scanner.resumeFrom(ctx, head);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	for from <= head {
+		to := min(from + MAX_BLOCK_RANGE - 1, head);
+
+		// Read the hash before the logs: if a reorg happens in between,
+		// the saved hash is stale and the next scan covers the range
+		// again.
+		header, err := scanner.client.HeaderByNumber(ctx, new(big.Int).SetUint64(to));
+
+		if err != nil {
+			return 0, err;
+		}
+
+		logs, err := scanner.client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock: new(big.Int).SetUint64(to),
+			Addresses: scanner.addresses,
+			Topics: scanner.topics,
+		});
+
+		if err != nil {
+			return 0, err;
+		}
+
+		for i := range logs {
+			if logs[i].Removed {
+				continue;
+			}
+
+			if err := handle(&logs[i]); err != nil {
+				return 0, err;
+			}
+		}
+
+		if err := scanner.cursor.SetLastBlock(to, header.Hash()); err != nil {
+			return 0, err;
+		}
+
+		from = to + 1;
+	}
+
+	return head, nil;
+}
+
+func (scanner *Scanner) resumeFrom(ctx context.Context, head uint64) (uint64, error) {
+	last, hash, ok, err := scanner.cursor.LastBlock();
+
+	if err != nil {
+		return 0, err;
+	}
+
+	if !ok {
+		return scanner.startBlock, nil;
+	}
+
+	if last <= head {
+		header, err := scanner.client.HeaderByNumber(ctx, new(big.Int).SetUint64(last));
+
+		if err != nil {
+			return 0, err;
+		}
+
+		if header.Hash() == hash {
+			return last + 1, nil;
+		}
+	}
+
+	from := scanner.startBlock;
+
+	if last + 1 > scanner.rewind {
+		from = max(from, last + 1 - scanner.rewind);
+	}
+
+	slog.Warn(
+		"Chain reorganisation detected; rescanning",
+		"lastBlock", last,
+		"head", head,
+		"from", from,
+	);
+
+	return from, nil;
+}
+
+/**
+ * Tracks which pending items are still in the canonical chain, fetching
+ * each block header at most once per check.
+ */
+type Canonical struct {
+	client Client;
+	hashes map[uint64]common.Hash;
+}
+
+func NewCanonical(client Client) *Canonical {
+	return &Canonical{
+		client: client,
+		hashes: make(map[uint64]common.Hash),
+	};
+}
+
+func (canonical *Canonical) Contains(
+	ctx context.Context,
+	block uint64,
+	hash common.Hash,
+) (bool, error) {
+	known, ok := canonical.hashes[block];
+
+	if !ok {
+		header, err := canonical.client.HeaderByNumber(ctx, new(big.Int).SetUint64(block));
+
+		if err != nil {
+			return false, err;
+		}
+
+		known = header.Hash();
+		canonical.hashes[block] = known;
+	}
+
+	return known == hash, nil;
+}
@@ -0,0 +1,56 @@
+package chainscan;
+
+import (
+	"database/sql"
+
+	"github.com/ethereum/go-ethereum/common"
+);
+
+/**
+ * Cursor stored as a named row in chain_cursors, so that several
+ * scanners can share the table.
+ */
+type SqlCursor struct {
+	db *sql.DB;
+	name string;
+}
+
+func NewSqlCursor(db *sql.DB, name string) *SqlCursor {
+	return &SqlCursor{
+		db: db,
+		name: name,
+	};
+}
+
+func (cursor *SqlCursor) LastBlock() (uint64, common.Hash, bool, error) {
+	var block uint64;
+	var hash string;
+
+	err := cursor.db.QueryRow(`
+		SELECT block, blockHash
+		FROM chain_cursors
+		WHERE name = ?
+	`, cursor.name).Scan(&block, &hash);
+
+	if err == sql.ErrNoRows {
+		return 0, common.Hash{}, false, nil;
+	}
+
+	if err != nil {
+		return 0, common.Hash{}, false, err;
+	}
+
+	return block, common.HexToHash(hash), true, nil;
+}
+
+func (cursor *SqlCursor) SetLastBlock(block uint64, hash common.Hash) error {
+	_, err := cursor.db.Exec(`
+		INSERT INTO chain_cursors
+		(name, block, blockHash)
+		VALUES
+		(?, ?, ?)
+		ON DUPLICATE KEY UPDATE block = VALUES(block), blockHash = VALUES(blockHash)
+	`, cursor.name, block, hash.Hex());
+
+	return err;
+}
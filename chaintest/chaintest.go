@@ -0,0 +1,236 @@
+package chaintest;
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+);
+
+/**
+ * Runtime code of a contract that emits a LOG1 for every call. The
+ * first 32 bytes of calldata are used as the topic and the remainder
+ * as the log data, which lets tests produce arbitrary contract events
+ * without a compiled copy of the real contract.
+ */
+var emitterCode = []byte{
+	0x60, 0x20, 0x36, 0x03, // size = calldatasize - 32
+	0x60, 0x20,             // offset = 32
+	0x60, 0x00,             // dest = 0
+	0x37,                   // calldatacopy
+	0x60, 0x00, 0x35,       // topic = calldataload(0)
+	0x60, 0x20, 0x36, 0x03, // size = calldatasize - 32
+	0x60, 0x00,             // offset = 0
+	0xa1,                   // log1
+	0x00,                   // stop
+};
+
+type Chain struct {
+	Backend *simulated.Backend;
+	Client simulated.Client;
+	Key *ecdsa.PrivateKey;
+	From common.Address;
+	ChainId *big.Int;
+}
+
+/**
+ * Starts a simulated chain with a single well-funded account.
+ */
+func NewChain() (*Chain, error) {
+	key, err := crypto.GenerateKey();
+
+	if err != nil {
+		return nil, err;
+	}
+
+	from := crypto.PubkeyToAddress(key.PublicKey);
+	funds := new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether));
+
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		from: { Balance: funds },
+	});
+
+	client := backend.Client();
+	chainId, err := client.ChainID(context.Background());
+
+	if err != nil {
+		backend.Close();
+		return nil, err;
+	}
+
+	return &Chain{
+		Backend: backend,
+		Client: client,
+		Key: key,
+		From: from,
+		ChainId: chainId,
+	}, nil;
+}
+
+func (chain *Chain) Close() {
+	chain.Backend.Close();
+}
+
+/**
+ * Signs and sends a transaction from the funded account. The
+ * transaction is not mined until Commit() is called.
+ */
+func (chain *Chain) SendTx(to *common.Address, data []byte) (*types.Transaction, error) {
+	ctx := context.Background();
+
+	nonce, err := chain.Client.PendingNonceAt(ctx, chain.From);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	gasPrice, err := chain.Client.SuggestGasPrice(ctx);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce: nonce,
+		To: to,
+		Gas: 1000000,
+		GasPrice: gasPrice,
+		Data: data,
+	});
+
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(chain.ChainId), chain.Key);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	if err = chain.Client.SendTransaction(ctx, signed); err != nil {
+		return nil, err;
+	}
+
+	return signed, nil;
+}
+
+func (chain *Chain) Commit() common.Hash {
+	return chain.Backend.Commit();
+}
+
+/**
+ * Deploys the given runtime code and mines it.
+ */
+func (chain *Chain) Deploy(runtime []byte) (common.Address, error) {
+	// PUSH2 len, DUP1, PUSH2 13, PUSH1 0, CODECOPY, PUSH1 0, RETURN
+	init := []byte{ 0x61, 0x00, 0x00, 0x80, 0x61, 0x00, 0x0d, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3 };
+	binary.BigEndian.PutUint16(init[1:3], uint16(len(runtime)));
+
+	tx, err := chain.SendTx(nil, append(init, runtime...));
+
+	if err != nil {
+		return common.Address{}, err;
+	}
+
+	chain.Commit();
+
+	return crypto.CreateAddress(chain.From, tx.Nonce()), nil;
+}
+
+func (chain *Chain) DeployEmitter() (common.Address, error) {
+	return chain.Deploy(emitterCode);
+}
+
+/**
+ * Makes the emitter at address log an event with the given topic and
+ * ABI-encoded data.
+ */
+func (chain *Chain) Emit(
+	address common.Address,
+	topic common.Hash,
+	data []byte,
+) (*types.Transaction, error) {
+	return chain.SendTx(&address, append(topic.Bytes(), data...));
+}
+
+/**
+ * Deploys a contract that, on every call, logs size bytes of calldata
+ * starting at offset under a fixed topic. Pointed at the arguments of
+ * a real contract call, this mimics the event the real contract would
+ * emit for it.
+ */
+func (chain *Chain) DeployLogger(
+	topic common.Hash,
+	offset byte,
+	size byte,
+) (common.Address, error) {
+	runtime := []byte{ 0x60, size, 0x60, offset, 0x60, 0x00, 0x37, 0x7f };
+	runtime = append(runtime, topic.Bytes()...);
+	runtime = append(runtime, 0x60, size, 0x60, 0x00, 0xa1, 0x00);
+
+	return chain.Deploy(runtime);
+}
+
+/**
+ * Runtime code of a contract holding a single storage word. A call
+ * with arguments stores the first one; a call with only a selector
+ * returns the stored word. This stands in for simple setter/getter
+ * pairs such as setAgentAddress and agentAddress.
+ */
+var registerCode = []byte{
+	0x60, 0x04, 0x36, 0x11, // calldatasize > 4
+	0x60, 0x12, 0x57,       // jumpi set
+	0x60, 0x00, 0x54,       // value = sload(0)
+	0x60, 0x00, 0x52,       // mstore(0, value)
+	0x60, 0x20, 0x60, 0x00, // size = 32, offset = 0
+	0xf3,                   // return
+	0x5b,                   // set:
+	0x60, 0x04, 0x35,       // value = calldataload(4)
+	0x60, 0x00, 0x55,       // sstore(0, value)
+	0x00,                   // stop
+};
+
+func (chain *Chain) DeployRegister() (common.Address, error) {
+	return chain.Deploy(registerCode);
+}
+
+/**
+ * Deploys a contract that answers every call with the given bytes,
+ * which lets a view function return an ABI-encoded result of the
+ * test's choosing.
+ */
+func (chain *Chain) DeployResponder(output []byte) (common.Address, error) {
+	// PUSH2 len, DUP1, PUSH2 13, PUSH1 0, CODECOPY, PUSH1 0, RETURN
+	runtime := []byte{ 0x61, 0x00, 0x00, 0x80, 0x61, 0x00, 0x0d, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3 };
+	binary.BigEndian.PutUint16(runtime[1:3], uint16(len(output)));
+
+	return chain.Deploy(append(runtime, output...));
+}
+
+/**
+ * Runtime code of a contract holding a single mapping. A call with two
+ * arguments stores the second under the first; a call with one returns
+ * the word stored under it. This stands in for mappings with a setter,
+ * such as supportedCoins and addCoin.
+ */
+var mappingCode = []byte{
+	0x60, 0x24, 0x36, 0x11, // calldatasize > 36
+	0x60, 0x13, 0x57,       // jumpi set
+	0x60, 0x04, 0x35,       // key = calldataload(4)
+	0x54,                   // value = sload(key)
+	0x60, 0x00, 0x52,       // mstore(0, value)
+	0x60, 0x20, 0x60, 0x00, // size = 32, offset = 0
+	0xf3,                   // return
+	0x5b,                   // set:
+	0x60, 0x24, 0x35,       // value = calldataload(36)
+	0x60, 0x04, 0x35,       // key = calldataload(4)
+	0x55,                   // sstore(key, value)
+	0x00,                   // stop
+};
+
+func (chain *Chain) DeployMapping() (common.Address, error) {
+	return chain.Deploy(mappingCode);
+}
@@ -0,0 +1,220 @@
+package coins;
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+);
+
+var (
+	ErrDecimalsMismatch = errors.New("token decimals differ from configured decimals")
+)
+
+/**
+ * A configured currency that the contract supports.
+ */
+type Coin struct {
+	Currency string;
+	CoinId uint32;
+	Token common.Address;
+	Decimals uint8;
+}
+
+/**
+ * Called when a configured currency becomes supported by the contract
+ * after the first check, i.e. once addCoin has been mined for it.
+ */
+type AddedHandler func(coin Coin);
+
+/**
+ * Tracks which of a chain's configured currencies the contract actually
+ * supports. A currency is enabled once supportedCoins returns a token
+ * for its coin id and the token's decimals match the configuration.
+ *
+ * Currencies may be configured before addCoin is called for them; they
+ * stay disabled until a later Refresh finds them. The contract has no
+ * event for addCoin, so, as with the agent address, changes are found
+ * by polling.
+ */
+type Registry struct {
+	client *contract.Client;
+	coins map[string]config.CoinDef;
+	currencies map[string]config.CurrencyDef;
+	onAdded AddedHandler;
+	lock sync.RWMutex;
+	enabled map[string]Coin;
+	checked bool;
+}
+
+func NewRegistry(
+	client *contract.Client,
+	chainDef config.ChainDef,
+	currencies map[string]config.CurrencyDef,
+	onAdded AddedHandler,
+) *Registry {
+	return &Registry{
+		client: client,
+		coins: chainDef.Coins,
+		currencies: currencies,
+		onAdded: onAdded,
+		enabled: make(map[string]Coin),
+	};
+}
+
+/**
+ * Reads supportedCoins for every configured currency, and decimals()
+ * for any token not seen before. A currency whose token disagrees with
+ * the configuration is disabled and ErrDecimalsMismatch returned; the
+ * remaining currencies are still checked.
+ */
+func (registry *Registry) Refresh(ctx context.Context) error {
+	enabled := make(map[string]Coin);
+	var mismatch error;
+
+	for currency, coinDef := range registry.coins {
+		token, supported, err := registry.client.SupportedCoin(ctx, coinDef.CoinId);
+
+		if err != nil {
+			return err;
+		}
+
+		if !supported {
+			continue;
+		}
+
+		registry.lock.RLock();
+		previous, wasEnabled := registry.enabled[currency];
+		registry.lock.RUnlock();
+
+		if wasEnabled && previous.Token == token {
+			enabled[currency] = previous;
+			continue;
+		}
+
+		if wasEnabled {
+			slog.Warn(
+				"Token for coin changed on-chain",
+				"currency", currency,
+				"coinId", coinDef.CoinId,
+				"previous", previous.Token,
+				"current", token,
+			);
+		}
+
+		decimals, err := registry.client.TokenDecimals(ctx, token);
+
+		if err != nil {
+			return err;
+		}
+
+		if uint(decimals) != registry.currencies[currency].Decimals {
+			slog.Error(
+				"Token decimals differ from configuration",
+				"currency", currency,
+				"coinId", coinDef.CoinId,
+				"token", token,
+				"decimals", decimals,
+				"configured", registry.currencies[currency].Decimals,
+			);
+
+			if mismatch == nil {
+				mismatch = ErrDecimalsMismatch;
+			}
+
+			continue;
+		}
+
+		enabled[currency] = Coin{
+			Currency: currency,
+			CoinId: coinDef.CoinId,
+			Token: token,
+			Decimals: decimals,
+		};
+	}
+
+	registry.lock.Lock();
+	previous, checked := registry.enabled, registry.checked;
+	registry.enabled, registry.checked = enabled, true;
+	registry.lock.Unlock();
+
+	for currency, coin := range enabled {
+		if _, ok := previous[currency]; ok {
+			continue;
+		}
+
+		slog.Info("Coin enabled", "currency", currency, "coinId", coin.CoinId, "token", coin.Token);
+
+		if checked && registry.onAdded != nil {
+			registry.onAdded(coin);
+		}
+	}
+
+	return mismatch;
+}
+
+/**
+ * Whether the contract pays out currency, as of the last Refresh.
+ */
+func (registry *Registry) Enabled(currency string) bool {
+	registry.lock.RLock();
+	defer registry.lock.RUnlock();
+
+	_, ok := registry.enabled[currency];
+
+	return ok;
+}
+
+/**
+ * The contract's balance of each enabled currency's token, converted
+ * from the token's units.
+ */
+func (registry *Registry) Holdings(ctx context.Context) (map[string]decimal.Decimal, error) {
+	registry.lock.RLock();
+	enabled := make([]Coin, 0, len(registry.enabled));
+
+	for _, coin := range registry.enabled {
+		enabled = append(enabled, coin);
+	}
+
+	registry.lock.RUnlock();
+
+	holdings := make(map[string]decimal.Decimal);
+
+	for _, coin := range enabled {
+		balance, err := registry.client.TokenBalance(ctx, coin.Token);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		holdings[coin.Currency] = decimal.NewFromBigInt(balance, -int32(coin.Decimals));
+	}
+
+	return holdings, nil;
+}
+
+/**
+ * Configured currencies the contract does not support yet, for logging
+ * at startup.
+ */
+func (registry *Registry) Disabled() []string {
+	registry.lock.RLock();
+	defer registry.lock.RUnlock();
+
+	disabled := make([]string, 0);
+
+	for currency := range registry.coins {
+		if _, ok := registry.enabled[currency]; !ok {
+			disabled = append(disabled, currency);
+		}
+	}
+
+	return disabled;
+}
@@ -0,0 +1,214 @@
+package coins;
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/samott/crash-backend/chaintest"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+);
+
+var currencies = map[string]config.CurrencyDef{
+	"eth": { Name: "Ethereum", Units: "ETH", Decimals: 18 },
+	"btc": { Name: "Bitcoin", Units: "BTC", Decimals: 8 },
+};
+
+var chainDef = config.ChainDef{
+	Coins: map[string]config.CoinDef{
+		"eth": { CoinId: 1 },
+		"btc": { CoinId: 2 },
+	},
+};
+
+/**
+ * Starts a chain with a stand-in for the contract's supportedCoins
+ * mapping and a client for it.
+ */
+func newTestClient(t *testing.T) (*chaintest.Chain, *contract.Client, *bind.TransactOpts) {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	t.Cleanup(chain.Close);
+
+	mapping, err := chain.DeployMapping();
+
+	if err != nil {
+		t.Fatal("Failed to deploy mapping: ", err);
+	}
+
+	client, err := contract.NewClient(mapping, chain.Client);
+
+	if err != nil {
+		t.Fatal("Failed to create contract client: ", err);
+	}
+
+	opts, err := bind.NewKeyedTransactorWithChainID(chain.Key, chain.ChainId);
+
+	if err != nil {
+		t.Fatal("Failed to create transactor: ", err);
+	}
+
+	return chain, client, opts;
+}
+
+func deployToken(t *testing.T, chain *chaintest.Chain, decimals int64) common.Address {
+	token, err := chain.DeployResponder(common.LeftPadBytes(big.NewInt(decimals).Bytes(), 32));
+
+	if err != nil {
+		t.Fatal("Failed to deploy token: ", err);
+	}
+
+	return token;
+}
+
+/**
+ * Deploys a token whose decimals() and balanceOf(holder) answer with the
+ * given values. A mapping serves, since decimals() reads the word under
+ * key zero and balanceOf the word under the holder's address.
+ */
+func deployHeldToken(
+	t *testing.T,
+	chain *chaintest.Chain,
+	decimals int64,
+	holder common.Address,
+	balance *big.Int,
+) common.Address {
+	token, err := chain.DeployMapping();
+
+	if err != nil {
+		t.Fatal("Failed to deploy token: ", err);
+	}
+
+	set := func(key []byte, value *big.Int) {
+		data := append([]byte{ 0, 0, 0, 0 }, common.LeftPadBytes(key, 32)...);
+		data = append(data, common.LeftPadBytes(value.Bytes(), 32)...);
+
+		if _, err := chain.SendTx(&token, data); err != nil {
+			t.Fatal("Failed to set token storage: ", err);
+		}
+	};
+
+	set(nil, big.NewInt(decimals));
+	set(holder.Bytes(), balance);
+	chain.Commit();
+
+	return token;
+}
+
+func addCoin(
+	t *testing.T,
+	chain *chaintest.Chain,
+	client *contract.Client,
+	opts *bind.TransactOpts,
+	coinId uint32,
+	token common.Address,
+) {
+	if _, err := client.AddCoin(opts, coinId, token); err != nil {
+		t.Fatal("Failed to add coin: ", err);
+	}
+
+	chain.Commit();
+}
+
+func TestRegistryPicksUpAddedCoins(t *testing.T) {
+	chain, client, opts := newTestClient(t);
+
+	addCoin(t, chain, client, opts, 1, deployToken(t, chain, 18));
+
+	added := make([]Coin, 0);
+
+	registry := NewRegistry(client, chainDef, currencies, func(coin Coin) {
+		added = append(added, coin);
+	});
+
+	if registry.Enabled("eth") {
+		t.Fatal("Coin enabled before first refresh");
+	}
+
+	if err := registry.Refresh(context.Background()); err != nil {
+		t.Fatal("Failed to refresh: ", err);
+	}
+
+	if !registry.Enabled("eth") || registry.Enabled("btc") {
+		t.Fatal("Wrong coins enabled: ", registry.Disabled());
+	}
+
+	if len(added) != 0 {
+		t.Fatal("Coins found at startup reported as added: ", added);
+	}
+
+	addCoin(t, chain, client, opts, 2, deployToken(t, chain, 8));
+
+	if err := registry.Refresh(context.Background()); err != nil {
+		t.Fatal("Failed to refresh: ", err);
+	}
+
+	if !registry.Enabled("btc") || len(registry.Disabled()) != 0 {
+		t.Fatal("Added coin not enabled: ", registry.Disabled());
+	}
+
+	if len(added) != 1 || added[0].Currency != "btc" || added[0].CoinId != 2 || added[0].Decimals != 8 {
+		t.Fatal("Added coin not reported: ", added);
+	}
+}
+
+func TestRegistryRejectsDecimalsMismatch(t *testing.T) {
+	chain, client, opts := newTestClient(t);
+
+	addCoin(t, chain, client, opts, 1, deployToken(t, chain, 18));
+	addCoin(t, chain, client, opts, 2, deployToken(t, chain, 18));
+
+	registry := NewRegistry(client, chainDef, currencies, nil);
+
+	if err := registry.Refresh(context.Background()); err != ErrDecimalsMismatch {
+		t.Fatal("Decimals mismatch not reported: ", err);
+	}
+
+	if !registry.Enabled("eth") || registry.Enabled("btc") {
+		t.Fatal("Mismatched coin enabled: ", registry.Disabled());
+	}
+
+	// Pointing the coin at a token with the right decimals fixes it
+	// without a restart.
+	addCoin(t, chain, client, opts, 2, deployToken(t, chain, 8));
+
+	if err := registry.Refresh(context.Background()); err != nil {
+		t.Fatal("Failed to refresh: ", err);
+	}
+
+	if !registry.Enabled("btc") {
+		t.Fatal("Corrected coin not enabled");
+	}
+}
+
+func TestRegistryHoldings(t *testing.T) {
+	chain, client, opts := newTestClient(t);
+
+	ethBalance, _ := new(big.Int).SetString("12500000000000000000", 10);
+
+	addCoin(t, chain, client, opts, 1, deployHeldToken(t, chain, 18, client.Address(), ethBalance));
+
+	registry := NewRegistry(client, chainDef, currencies, nil);
+
+	if err := registry.Refresh(context.Background()); err != nil {
+		t.Fatal("Failed to refresh: ", err);
+	}
+
+	holdings, err := registry.Holdings(context.Background());
+
+	if err != nil {
+		t.Fatal("Failed to read holdings: ", err);
+	}
+
+	if len(holdings) != 1 || holdings["eth"].String() != "12.5" {
+		t.Fatal("Wrong holdings: ", holdings);
+	}
+}
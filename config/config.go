@@ -3,15 +3,78 @@ package config;
 import (
 	"os"
 	"gopkg.in/yaml.v3"
+	"github.com/shopspring/decimal"
 );
 
 type CurrencyDef struct {
 	Name string `yaml:"name"`;
 	Units string `yaml:"units"`;
-	CoinId uint32 `yaml:"coinId"`;
 	Decimals uint `yaml:"decimals"`;
 }
 
+/**
+ * How a currency is known to one chain's contract.
+ */
+type CoinDef struct {
+	CoinId uint32 `yaml:"coinId"`;
+	Confirmations uint64 `yaml:"confirmations"`;
+}
+
+type ChainDef struct {
+	RpcUrl string `yaml:"rpcUrl"`;
+	ChainId int64 `yaml:"chainId"`;
+	Contract string `yaml:"contract"`;
+	StartBlock uint64 `yaml:"startBlock"`;
+	DomainName string `yaml:"domainName"`;
+	DomainVersion string `yaml:"domainVersion"`;
+	Coins map[string]CoinDef `yaml:"coins"`;
+}
+
+type SignerDef struct {
+	Type string `yaml:"type"`;
+	KeystoreFile string `yaml:"keystoreFile"`;
+	PasswordFile string `yaml:"passwordFile"`;
+	Socket string `yaml:"socket"`;
+	Address string `yaml:"address"`;
+}
+
+type TokenKeyDef struct {
+	Id string `yaml:"id"`;
+	Algorithm string `yaml:"algorithm"`;
+	Key string `yaml:"key"`;
+	File string `yaml:"file"`;
+}
+
+type TipLimits struct {
+	Min decimal.Decimal `yaml:"min"`;
+	DailyCap decimal.Decimal `yaml:"dailyCap"`;
+}
+
+/**
+ * Withdrawals above either amount are held for review; a zero amount
+ * sets no limit.
+ */
+type ReviewThreshold struct {
+	Amount decimal.Decimal `yaml:"amount"`;
+	Usd decimal.Decimal `yaml:"usd"`;
+}
+
+/**
+ * Per-wallet withdrawal rules. Caps cover the trailing day or week and
+ * a zero value disables a rule. Wallets may have overrides stored in
+ * the database as JSON, hence the json tags; see the velocity package.
+ */
+type WithdrawalLimits struct {
+	DailyCaps map[string]decimal.Decimal `yaml:"dailyCaps" json:"dailyCaps"`;
+	WeeklyCaps map[string]decimal.Decimal `yaml:"weeklyCaps" json:"weeklyCaps"`;
+	DailyUsdCap decimal.Decimal `yaml:"dailyUsdCap" json:"dailyUsdCap"`;
+	WeeklyUsdCap decimal.Decimal `yaml:"weeklyUsdCap" json:"weeklyUsdCap"`;
+	MinIntervalSecs int `yaml:"minIntervalSecs" json:"minIntervalSecs"`;
+	LargeWins map[string]decimal.Decimal `yaml:"largeWins" json:"largeWins"`;
+	LargeWinCooldownSecs int `yaml:"largeWinCooldownSecs" json:"largeWinCooldownSecs"`;
+	NewDeviceCooldownSecs int `yaml:"newDeviceCooldownSecs" json:"newDeviceCooldownSecs"`;
+}
+
 type CrashConfig struct {
 	Database struct {
 		User string `yaml:"username"`;
@@ -31,20 +94,83 @@ type CrashConfig struct {
 		Fiats []string `yaml:"fiats"`;
 	}
 
+	Bankroll struct {
+		MaxWinFraction decimal.Decimal `yaml:"maxWinFraction"`;
+		MaxExposureFraction decimal.Decimal `yaml:"maxExposureFraction"`;
+	}
+
+	Admin struct {
+		Listen string `yaml:"listen"`;
+		Wallets []string `yaml:"wallets"`;
+	}
+
+	Tips struct {
+		Enabled bool `yaml:"enabled"`;
+		Announce bool `yaml:"announce"`;
+		Limits map[string]TipLimits `yaml:"limits"`;
+	}
+
 	Logging struct {
 		LocalOnly bool `yaml:"localOnly"`;
 		ProjectId string `yaml:"projectId"`;
 		LogId string `yaml:"logId"`;
 	}
 
-	OnChain struct {
-		RpcUrl string `yaml:"rpcUrl"`;
-		ChainId int64 `yaml:"chainId"`;
-		Contract string `yaml:"contract"`;
-	} `yaml:"onChain"`
+	Chains map[string]ChainDef `yaml:"chains"`;
+
+	Signers []SignerDef `yaml:"signers"`;
+
+	Withdrawals struct {
+		VoucherTtlSecs int `yaml:"voucherTtlSecs"`;
+		MaxTasks int `yaml:"maxTasks"`;
+		ReviewThresholds map[string]ReviewThreshold `yaml:"reviewThresholds"`;
+		Limits WithdrawalLimits `yaml:"limits"`;
+	}
+
+	Tokens struct {
+		Issuer string `yaml:"issuer"`;
+		Audience string `yaml:"audience"`;
+		TtlSecs int `yaml:"ttlSecs"`;
+		RefreshTtlSecs int `yaml:"refreshTtlSecs"`;
+		SigningKey string `yaml:"signingKey"`;
+		Keys []TokenKeyDef `yaml:"keys"`;
+	}
+
+	Auth struct {
+		Domain string `yaml:"domain"`;
+		Uri string `yaml:"uri"`;
+		ChainIds []int `yaml:"chainIds"`;
+		NonceTtlSecs int `yaml:"nonceTtlSecs"`;
+		MaxMessageAgeSecs int `yaml:"maxMessageAgeSecs"`;
+		ClockSkewSecs int `yaml:"clockSkewSecs"`;
+	}
+
+	Anchoring struct {
+		Chain string `yaml:"chain"`;
+		MaxRounds int `yaml:"maxRounds"`;
+		ResendAfterSecs int `yaml:"resendAfterSecs"`;
+	}
+
+	Solvency struct {
+		MinCoverage decimal.Decimal `yaml:"minCoverage"`;
+	}
+
+	Payouts struct {
+		MaxAttempts int `yaml:"maxAttempts"`;
+		BaseDelaySecs int `yaml:"baseDelaySecs"`;
+		MaxDelaySecs int `yaml:"maxDelaySecs"`;
+	}
 
 	Timers struct {
 		RatesCheckFrequencyMins int `yaml:"ratesCheckFrequencyMins"`;
+		PayoutRetryFrequencySecs int `yaml:"payoutRetryFrequencySecs"`;
+		DepositCheckFrequencySecs int `yaml:"depositCheckFrequencySecs"`;
+		WithdrawalCheckFrequencySecs int `yaml:"withdrawalCheckFrequencySecs"`;
+		AgentCheckFrequencySecs int `yaml:"agentCheckFrequencySecs"`;
+		CoinCheckFrequencySecs int `yaml:"coinCheckFrequencySecs"`;
+		SolvencyCheckFrequencySecs int `yaml:"solvencyCheckFrequencySecs"`;
+		EventIndexFrequencySecs int `yaml:"eventIndexFrequencySecs"`;
+		AnchorFrequencySecs int `yaml:"anchorFrequencySecs"`;
 	}
 };
 
@@ -0,0 +1,307 @@
+package contract;
+
+//go:generate go run github.com/ethereum/go-ethereum/cmd/abigen --abi ../abis/crash.json --pkg contract --type Crash --out crash.go
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+);
+
+var (
+	ErrNotWithdrawCall = errors.New("transaction is not a withdraw call")
+	ErrUnexpectedEvent = errors.New("log is not the expected event")
+)
+
+/**
+ * The part of the ERC-20 interface the backend reads from the tokens
+ * the contract pays out.
+ */
+const erc20Json = `[{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"account","type":"address"}],"name":"balanceOf","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`;
+
+var crashAbi *abi.ABI;
+var erc20Abi abi.ABI;
+var filterer *CrashFilterer;
+
+func init() {
+	parsed, err := CrashMetaData.GetAbi();
+
+	if err != nil {
+		panic("invalid Crash contract ABI: " + err.Error());
+	}
+
+	crashAbi = parsed;
+
+	erc20Abi, err = abi.JSON(strings.NewReader(erc20Json));
+
+	if err != nil {
+		panic("invalid ERC-20 ABI: " + err.Error());
+	}
+
+	// Parsing logs needs only the ABI, not a backend.
+	filterer, err = NewCrashFilterer(common.Address{}, nil);
+
+	if err != nil {
+		panic("failed to bind Crash contract: " + err.Error());
+	}
+}
+
+/**
+ * Wraps the generated bindings for one deployment of the contract,
+ * with the context handling and result shaping the rest of the backend
+ * wants.
+ */
+type Client struct {
+	address common.Address;
+	backend bind.ContractBackend;
+	crash *Crash;
+}
+
+func NewClient(address common.Address, backend bind.ContractBackend) (*Client, error) {
+	crash, err := NewCrash(address, backend);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return &Client{
+		address: address,
+		backend: backend,
+		crash: crash,
+	}, nil;
+}
+
+func (client *Client) Address() common.Address {
+	return client.address;
+}
+
+func (client *Client) AgentAddress(ctx context.Context) (common.Address, error) {
+	return client.crash.AgentAddress(&bind.CallOpts{ Context: ctx });
+}
+
+/**
+ * The token paid out for a coin id, and whether the coin is supported
+ * at all; unsupported ids map to the zero address.
+ */
+func (client *Client) SupportedCoin(ctx context.Context, coinId uint32) (common.Address, bool, error) {
+	token, err := client.crash.SupportedCoins(&bind.CallOpts{ Context: ctx }, coinId);
+
+	if err != nil {
+		return common.Address{}, false, err;
+	}
+
+	return token, token != (common.Address{}), nil;
+}
+
+/**
+ * The decimals() of an ERC-20 token, such as one returned by
+ * SupportedCoin.
+ */
+func (client *Client) TokenDecimals(ctx context.Context, token common.Address) (uint8, error) {
+	erc20 := bind.NewBoundContract(token, erc20Abi, client.backend, nil, nil);
+
+	var out []any;
+
+	if err := erc20.Call(&bind.CallOpts{ Context: ctx }, &out, "decimals"); err != nil {
+		return 0, err;
+	}
+
+	return *abi.ConvertType(out[0], new(uint8)).(*uint8), nil;
+}
+
+/**
+ * How much of an ERC-20 token the contract holds, in the token's
+ * smallest units.
+ */
+func (client *Client) TokenBalance(ctx context.Context, token common.Address) (*big.Int, error) {
+	erc20 := bind.NewBoundContract(token, erc20Abi, client.backend, nil, nil);
+
+	var out []any;
+
+	if err := erc20.Call(&bind.CallOpts{ Context: ctx }, &out, "balanceOf", client.address); err != nil {
+		return nil, err;
+	}
+
+	return abi.ConvertType(out[0], new(big.Int)).(*big.Int), nil;
+}
+
+/**
+ * The EIP-712 domain the contract verifies signatures against, in the
+ * form used for signing typed data.
+ */
+func (client *Client) Domain(ctx context.Context) (apitypes.TypedDataDomain, error) {
+	domain, err := client.crash.Eip712Domain(&bind.CallOpts{ Context: ctx });
+
+	if err != nil {
+		return apitypes.TypedDataDomain{}, err;
+	}
+
+	return apitypes.TypedDataDomain{
+		Name: domain.Name,
+		Version: domain.Version,
+		ChainId: (*math.HexOrDecimal256)(domain.ChainId),
+		VerifyingContract: domain.VerifyingContract.Hex(),
+	}, nil;
+}
+
+func (client *Client) AddCoin(
+	opts *bind.TransactOpts,
+	coinId uint32,
+	token common.Address,
+) (*types.Transaction, error) {
+	return client.crash.AddCoin(opts, coinId, token);
+}
+
+func (client *Client) Deposit(
+	opts *bind.TransactOpts,
+	coinId uint32,
+	amount *big.Int,
+) (*types.Transaction, error) {
+	return client.crash.Deposit(opts, coinId, amount);
+}
+
+func (client *Client) Withdraw(
+	opts *bind.TransactOpts,
+	req CrashWithdrawalRequest,
+	signature []byte,
+) (*types.Transaction, error) {
+	return client.crash.Withdraw(opts, req, signature);
+}
+
+func (client *Client) SetAgentAddress(
+	opts *bind.TransactOpts,
+	agent common.Address,
+) (*types.Transaction, error) {
+	return client.crash.SetAgentAddress(opts, agent);
+}
+
+func (client *Client) FilterBalanceIncreased(
+	ctx context.Context,
+	from uint64,
+	to uint64,
+) ([]*CrashBalanceIncreased, error) {
+	iterator, err := client.crash.FilterBalanceIncreased(&bind.FilterOpts{
+		Context: ctx,
+		Start: from,
+		End: &to,
+	});
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer iterator.Close();
+
+	events := make([]*CrashBalanceIncreased, 0);
+
+	for iterator.Next() {
+		events = append(events, iterator.Event);
+	}
+
+	return events, iterator.Error();
+}
+
+func eventId(name string) common.Hash {
+	return crashAbi.Events[name].ID;
+}
+
+func BalanceIncreasedTopic() common.Hash {
+	return eventId("BalanceIncreased");
+}
+
+func BalanceDecreasedTopic() common.Hash {
+	return eventId("BalanceDecreased");
+}
+
+/**
+ * Decodes a log of any of the contract's events into the event's name
+ * and its arguments, indexed or not, keyed by their ABI names.
+ */
+func ParseEvent(log *types.Log) (string, map[string]any, error) {
+	if len(log.Topics) == 0 {
+		return "", nil, ErrUnexpectedEvent;
+	}
+
+	event, err := crashAbi.EventByID(log.Topics[0]);
+
+	if err != nil {
+		return "", nil, ErrUnexpectedEvent;
+	}
+
+	args := make(map[string]any);
+
+	if err := event.Inputs.UnpackIntoMap(args, log.Data); err != nil {
+		return "", nil, err;
+	}
+
+	indexed := make(abi.Arguments, 0);
+
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input);
+		}
+	}
+
+	if err := abi.ParseTopicsIntoMap(args, indexed, log.Topics[1:]); err != nil {
+		return "", nil, err;
+	}
+
+	return event.Name, args, nil;
+}
+
+/**
+ * Decodes a BalanceIncreased log from any deployment of the contract.
+ */
+func ParseBalanceIncreased(log *types.Log) (*CrashBalanceIncreased, error) {
+	if len(log.Topics) == 0 || log.Topics[0] != BalanceIncreasedTopic() {
+		return nil, ErrUnexpectedEvent;
+	}
+
+	return filterer.ParseBalanceIncreased(*log);
+}
+
+func ParseBalanceDecreased(log *types.Log) (*CrashBalanceDecreased, error) {
+	if len(log.Topics) == 0 || log.Topics[0] != BalanceDecreasedTopic() {
+		return nil, ErrUnexpectedEvent;
+	}
+
+	return filterer.ParseBalanceDecreased(*log);
+}
+
+/**
+ * Decodes the calldata of a direct withdraw call.
+ */
+func DecodeWithdraw(data []byte) (*CrashWithdrawalRequest, []byte, error) {
+	method := crashAbi.Methods["withdraw"];
+
+	if len(data) < 4 || string(data[:4]) != string(method.ID) {
+		return nil, nil, ErrNotWithdrawCall;
+	}
+
+	values, err := method.Inputs.Unpack(data[4:]);
+
+	if err != nil {
+		return nil, nil, err;
+	}
+
+	if len(values) != 2 {
+		return nil, nil, ErrNotWithdrawCall;
+	}
+
+	req, ok1 := abi.ConvertType(values[0], new(CrashWithdrawalRequest)).(*CrashWithdrawalRequest);
+	signature, ok2 := values[1].([]byte);
+
+	if !ok1 || !ok2 {
+		return nil, nil, ErrNotWithdrawCall;
+	}
+
+	return req, signature, nil;
+}
@@ -0,0 +1,298 @@
+package contract;
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/samott/crash-backend/chaintest"
+);
+
+func newTestChain(t *testing.T) *chaintest.Chain {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	t.Cleanup(chain.Close);
+
+	return chain;
+}
+
+func newTestClient(t *testing.T, chain *chaintest.Chain, address common.Address) *Client {
+	client, err := NewClient(address, chain.Client);
+
+	if err != nil {
+		t.Fatal("Failed to create contract client: ", err);
+	}
+
+	return client;
+}
+
+func TestSupportedCoin(t *testing.T) {
+	chain := newTestChain(t);
+	token := common.HexToAddress("0x1111111111111111111111111111111111111111");
+
+	supported, err := chain.DeployResponder(common.LeftPadBytes(token.Bytes(), 32));
+
+	if err != nil {
+		t.Fatal("Failed to deploy responder: ", err);
+	}
+
+	unsupported, err := chain.DeployResponder(make([]byte, 32));
+
+	if err != nil {
+		t.Fatal("Failed to deploy responder: ", err);
+	}
+
+	address, ok, err := newTestClient(t, chain, supported).SupportedCoin(context.Background(), 1);
+
+	if err != nil || !ok || address != token {
+		t.Fatal("Supported coin not reported: ", address, ok, err);
+	}
+
+	_, ok, err = newTestClient(t, chain, unsupported).SupportedCoin(context.Background(), 2);
+
+	if err != nil || ok {
+		t.Fatal("Unsupported coin reported as supported: ", err);
+	}
+}
+
+func TestDomain(t *testing.T) {
+	chain := newTestChain(t);
+	verifyingContract := common.HexToAddress("0x2222222222222222222222222222222222222222");
+
+	output, err := crashAbi.Methods["eip712Domain"].Outputs.Pack(
+		[1]byte{ 0x0f },
+		"Crash",
+		"1",
+		big.NewInt(137),
+		verifyingContract,
+		[32]byte{},
+		[]*big.Int{},
+	);
+
+	if err != nil {
+		t.Fatal("Failed to pack domain: ", err);
+	}
+
+	responder, err := chain.DeployResponder(output);
+
+	if err != nil {
+		t.Fatal("Failed to deploy responder: ", err);
+	}
+
+	domain, err := newTestClient(t, chain, responder).Domain(context.Background());
+
+	if err != nil {
+		t.Fatal("Failed to read domain: ", err);
+	}
+
+	if domain.Name != "Crash" || domain.Version != "1" {
+		t.Fatal("Domain name or version is incorrect: ", domain);
+	}
+
+	if (*big.Int)(domain.ChainId).Int64() != 137 {
+		t.Fatal("Domain chain id is incorrect: ", domain.ChainId);
+	}
+
+	if domain.VerifyingContract != verifyingContract.Hex() {
+		t.Fatal("Domain verifying contract is incorrect: ", domain.VerifyingContract);
+	}
+}
+
+func TestWithdrawCalldata(t *testing.T) {
+	chain := newTestChain(t);
+
+	// Accepts any call, so the transaction is mined with the calldata
+	// exactly as the bindings produced it.
+	target, err := chain.DeployRegister();
+
+	if err != nil {
+		t.Fatal("Failed to deploy register: ", err);
+	}
+
+	opts, err := bind.NewKeyedTransactorWithChainID(chain.Key, chain.ChainId);
+
+	if err != nil {
+		t.Fatal("Failed to create transactor: ", err);
+	}
+
+	req := CrashWithdrawalRequest{
+		User: common.HexToAddress("0x3333333333333333333333333333333333333333"),
+		CoinId: 2,
+		Amount: big.NewInt(1000),
+		Nonce: big.NewInt(5),
+		Tasks: []CrashTask{
+			{
+				TaskType: 1,
+				User: common.HexToAddress("0x5555555555555555555555555555555555555555"),
+				CoinId: 1,
+				Amount: big.NewInt(250),
+				Nonce: big.NewInt(3),
+			},
+		},
+	};
+
+	signature := []byte{ 1, 2, 3 };
+
+	tx, err := newTestClient(t, chain, target).Withdraw(opts, req, signature);
+
+	if err != nil {
+		t.Fatal("Failed to send withdraw: ", err);
+	}
+
+	chain.Commit();
+
+	mined, _, err := chain.Client.TransactionByHash(context.Background(), tx.Hash());
+
+	if err != nil {
+		t.Fatal("Failed to fetch withdraw transaction: ", err);
+	}
+
+	decoded, decodedSignature, err := DecodeWithdraw(mined.Data());
+
+	if err != nil {
+		t.Fatal("Failed to decode withdraw: ", err);
+	}
+
+	if decoded.User != req.User || decoded.CoinId != req.CoinId ||
+		decoded.Amount.Cmp(req.Amount) != 0 || decoded.Nonce.Cmp(req.Nonce) != 0 {
+		t.Fatal("Decoded request is incorrect: ", decoded);
+	}
+
+	if len(decoded.Tasks) != 1 || decoded.Tasks[0].User != req.Tasks[0].User ||
+		decoded.Tasks[0].Amount.Int64() != 250 {
+		t.Fatal("Decoded tasks are incorrect: ", decoded.Tasks);
+	}
+
+	if !bytes.Equal(decodedSignature, signature) {
+		t.Fatal("Decoded signature is incorrect: ", decodedSignature);
+	}
+
+	deposit, err := crashAbi.Pack("deposit", uint32(1), big.NewInt(1));
+
+	if err != nil {
+		t.Fatal("Failed to pack deposit: ", err);
+	}
+
+	if _, _, err = DecodeWithdraw(deposit); err != ErrNotWithdrawCall {
+		t.Fatal("Decoded a deposit as a withdrawal: ", err);
+	}
+}
+
+func TestBalanceIncreased(t *testing.T) {
+	chain := newTestChain(t);
+	user := common.HexToAddress("0x4444444444444444444444444444444444444444");
+
+	emitter, err := chain.DeployEmitter();
+
+	if err != nil {
+		t.Fatal("Failed to deploy emitter: ", err);
+	}
+
+	data, err := crashAbi.Events["BalanceIncreased"].Inputs.Pack(
+		user, uint32(7), big.NewInt(300), big.NewInt(900),
+	);
+
+	if err != nil {
+		t.Fatal("Failed to pack event: ", err);
+	}
+
+	if _, err = chain.Emit(emitter, BalanceIncreasedTopic(), data); err != nil {
+		t.Fatal("Failed to emit event: ", err);
+	}
+
+	if _, err = chain.Emit(emitter, BalanceDecreasedTopic(), data); err != nil {
+		t.Fatal("Failed to emit event: ", err);
+	}
+
+	chain.Commit();
+
+	head, err := chain.Client.BlockNumber(context.Background());
+
+	if err != nil {
+		t.Fatal("Failed to get block number: ", err);
+	}
+
+	events, err := newTestClient(t, chain, emitter).FilterBalanceIncreased(context.Background(), 0, head);
+
+	if err != nil {
+		t.Fatal("Failed to filter events: ", err);
+	}
+
+	if len(events) != 1 {
+		t.Fatal("Expected one BalanceIncreased event, got ", len(events));
+	}
+
+	event := events[0];
+
+	if event.User != user || event.CoinId != 7 ||
+		event.Amount.Int64() != 300 || event.NewBalance.Int64() != 900 {
+		t.Fatal("Event is incorrect: ", event);
+	}
+
+	parsed, err := ParseBalanceIncreased(&event.Raw);
+
+	if err != nil || parsed.Amount.Int64() != 300 {
+		t.Fatal("Failed to parse log: ", err);
+	}
+
+	if _, err = ParseBalanceDecreased(&event.Raw); err != ErrUnexpectedEvent {
+		t.Fatal("Parsed log as the wrong event: ", err);
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	user := common.HexToAddress("0x4444444444444444444444444444444444444444");
+	owner := common.HexToAddress("0x5555555555555555555555555555555555555555");
+
+	data, err := crashAbi.Events["BalanceDecreased"].Inputs.Pack(
+		user, uint32(7), big.NewInt(300), big.NewInt(600),
+	);
+
+	if err != nil {
+		t.Fatal("Failed to pack event: ", err);
+	}
+
+	name, args, err := ParseEvent(&types.Log{
+		Topics: []common.Hash{ BalanceDecreasedTopic() },
+		Data: data,
+	});
+
+	if err != nil || name != "BalanceDecreased" || args["user"] != user ||
+		args["coinId"] != uint32(7) || args["amount"].(*big.Int).Int64() != 300 {
+		t.Fatal("Balance event parsed incorrectly: ", name, args, err);
+	}
+
+	// Both arguments of OwnershipTransferred are indexed.
+	name, args, err = ParseEvent(&types.Log{
+		Topics: []common.Hash{
+			eventId("OwnershipTransferred"),
+			common.BytesToHash(common.Address{}.Bytes()),
+			common.BytesToHash(owner.Bytes()),
+		},
+	});
+
+	if err != nil || name != "OwnershipTransferred" || args["newOwner"] != owner {
+		t.Fatal("Indexed arguments parsed incorrectly: ", name, args, err);
+	}
+
+	name, args, err = ParseEvent(&types.Log{
+		Topics: []common.Hash{ eventId("EIP712DomainChanged") },
+	});
+
+	if err != nil || name != "EIP712DomainChanged" || len(args) != 0 {
+		t.Fatal("Event without arguments parsed incorrectly: ", name, args, err);
+	}
+
+	if _, _, err = ParseEvent(&types.Log{ Topics: []common.Hash{ { 1 } } }); err != ErrUnexpectedEvent {
+		t.Fatal("Parsed a foreign event: ", err);
+	}
+}
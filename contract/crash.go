@@ -0,0 +1,1048 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package contract
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = errors.New
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+	_ = abi.ConvertType
+)
+
+// CrashTask is an auto generated low-level Go binding around an user-defined struct.
+type CrashTask struct {
+	TaskType uint8
+	User     common.Address
+	CoinId   uint32
+	Amount   *big.Int
+	Nonce    *big.Int
+}
+
+// CrashWithdrawalRequest is an auto generated low-level Go binding around an user-defined struct.
+type CrashWithdrawalRequest struct {
+	User   common.Address
+	CoinId uint32
+	Amount *big.Int
+	Nonce  *big.Int
+	Tasks  []CrashTask
+}
+
+// CrashMetaData contains all meta data concerning the Crash contract.
+var CrashMetaData = &bind.MetaData{
+	ABI: "[{\"inputs\":[{\"internalType\":\"address\",\"name\":\"initialAgentAddress\",\"type\":\"address\"}],\"stateMutability\":\"nonpayable\",\"type\":\"constructor\"},{\"inputs\":[],\"name\":\"ECDSAInvalidSignature\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"length\",\"type\":\"uint256\"}],\"name\":\"ECDSAInvalidSignatureLength\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"s\",\"type\":\"bytes32\"}],\"name\":\"ECDSAInvalidSignatureS\",\"type\":\"error\"},{\"inputs\":[],\"name\":\"InvalidShortString\",\"type\":\"error\"},{\"inputs\":[],\"name\":\"InvalidSignatureError\",\"type\":\"error\"},{\"inputs\":[],\"name\":\"InvalidTaskTypeError\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"owner\",\"type\":\"address\"}],\"name\":\"OwnableInvalidOwner\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"OwnableUnauthorizedAccount\",\"type\":\"error\"},{\"inputs\":[],\"name\":\"RequestNotFromUserError\",\"type\":\"error\"},{\"inputs\":[{\"internalType\":\"string\",\"name\":\"str\",\"type\":\"string\"}],\"name\":\"StringTooLong\",\"type\":\"error\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"address\",\"name\":\"user\",\"type\":\"address\"},{\"indexed\":false,\"internalType\":\"uint32\",\"name\":\"coinId\",\"type\":\"uint32\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"newBalance\",\"type\":\"uint256\"}],\"name\":\"BalanceDecreased\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"address\",\"name\":\"user\",\"type\":\"address\"},{\"indexed\":false,\"internalType\":\"uint32\",\"name\":\"coinId\",\"type\":\"uint32\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"newBalance\",\"type\":\"uint256\"}],\"name\":\"BalanceIncreased\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[],\"name\":\"EIP712DomainChanged\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"address\",\"name\":\"previousOwner\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"newOwner\",\"type\":\"address\"}],\"name\":\"OwnershipTransferred\",\"type\":\"event\"},{\"inputs\":[{\"internalType\":\"uint32\",\"name\":\"coinId\",\"type\":\"uint32\"},{\"internalType\":\"contractIERC20\",\"name\":\"token\",\"type\":\"address\"}],\"name\":\"addCoin\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"agentAddress\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint32\",\"name\":\"coinId\",\"type\":\"uint32\"},{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"}],\"name\":\"deposit\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"eip712Domain\",\"outputs\":[{\"internalType\":\"bytes1\",\"name\":\"fields\",\"type\":\"bytes1\"},{\"internalType\":\"string\",\"name\":\"name\",\"type\":\"string\"},{\"internalType\":\"string\",\"name\":\"version\",\"type\":\"string\"},{\"internalType\":\"uint256\",\"name\":\"chainId\",\"type\":\"uint256\"},{\"internalType\":\"address\",\"name\":\"verifyingContract\",\"type\":\"address\"},{\"internalType\":\"bytes32\",\"name\":\"salt\",\"type\":\"bytes32\"},{\"internalType\":\"uint256[]\",\"name\":\"extensions\",\"type\":\"uint256[]\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"owner\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"renounceOwnership\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"newAgentAddress\",\"type\":\"address\"}],\"name\":\"setAgentAddress\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint32\",\"name\":\"\",\"type\":\"uint32\"}],\"name\":\"supportedCoins\",\"outputs\":[{\"internalType\":\"contractIERC20\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"newOwner\",\"type\":\"address\"}],\"name\":\"transferOwnership\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"components\":[{\"internalType\":\"address\",\"name\":\"user\",\"type\":\"address\"},{\"internalType\":\"uint32\",\"name\":\"coinId\",\"type\":\"uint32\"},{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"nonce\",\"type\":\"uint256\"},{\"components\":[{\"internalType\":\"enumCrash.TaskType\",\"name\":\"taskType\",\"type\":\"uint8\"},{\"internalType\":\"address\",\"name\":\"user\",\"type\":\"address\"},{\"internalType\":\"uint32\",\"name\":\"coinId\",\"type\":\"uint32\"},{\"internalType\":\"uint256\",\"name\":\"amount\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"nonce\",\"type\":\"uint256\"}],\"internalType\":\"structCrash.Task[]\",\"name\":\"tasks\",\"type\":\"tuple[]\"}],\"internalType\":\"structCrash.WithdrawalRequest\",\"name\":\"req\",\"type\":\"tuple\"},{\"internalType\":\"bytes\",\"name\":\"signature\",\"type\":\"bytes\"}],\"name\":\"withdraw\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]",
+}
+
+// CrashABI is the input ABI used to generate the binding from.
+// Deprecated: Use CrashMetaData.ABI instead.
+var CrashABI = CrashMetaData.ABI
+
+// Crash is an auto generated Go binding around an Ethereum contract.
+type Crash struct {
+	CrashCaller     // Read-only binding to the contract
+	CrashTransactor // Write-only binding to the contract
+	CrashFilterer   // Log filterer for contract events
+}
+
+// CrashCaller is an auto generated read-only Go binding around an Ethereum contract.
+type CrashCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// CrashTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type CrashTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// CrashFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type CrashFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// CrashSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type CrashSession struct {
+	Contract     *Crash            // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// CrashCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type CrashCallerSession struct {
+	Contract *CrashCaller  // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts // Call options to use throughout this session
+}
+
+// CrashTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type CrashTransactorSession struct {
+	Contract     *CrashTransactor  // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// CrashRaw is an auto generated low-level Go binding around an Ethereum contract.
+type CrashRaw struct {
+	Contract *Crash // Generic contract binding to access the raw methods on
+}
+
+// CrashCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type CrashCallerRaw struct {
+	Contract *CrashCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// CrashTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type CrashTransactorRaw struct {
+	Contract *CrashTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewCrash creates a new instance of Crash, bound to a specific deployed contract.
+func NewCrash(address common.Address, backend bind.ContractBackend) (*Crash, error) {
+	contract, err := bindCrash(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Crash{CrashCaller: CrashCaller{contract: contract}, CrashTransactor: CrashTransactor{contract: contract}, CrashFilterer: CrashFilterer{contract: contract}}, nil
+}
+
+// NewCrashCaller creates a new read-only instance of Crash, bound to a specific deployed contract.
+func NewCrashCaller(address common.Address, caller bind.ContractCaller) (*CrashCaller, error) {
+	contract, err := bindCrash(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CrashCaller{contract: contract}, nil
+}
+
+// NewCrashTransactor creates a new write-only instance of Crash, bound to a specific deployed contract.
+func NewCrashTransactor(address common.Address, transactor bind.ContractTransactor) (*CrashTransactor, error) {
+	contract, err := bindCrash(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CrashTransactor{contract: contract}, nil
+}
+
+// NewCrashFilterer creates a new log filterer instance of Crash, bound to a specific deployed contract.
+func NewCrashFilterer(address common.Address, filterer bind.ContractFilterer) (*CrashFilterer, error) {
+	contract, err := bindCrash(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &CrashFilterer{contract: contract}, nil
+}
+
+// bindCrash binds a generic wrapper to an already deployed contract.
+func bindCrash(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := CrashMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Crash *CrashRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _Crash.Contract.CrashCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Crash *CrashRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Crash.Contract.CrashTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Crash *CrashRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Crash.Contract.CrashTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Crash *CrashCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _Crash.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Crash *CrashTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Crash.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Crash *CrashTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Crash.Contract.contract.Transact(opts, method, params...)
+}
+
+// AgentAddress is a free data retrieval call binding the contract method 0x38613690.
+//
+// Solidity: function agentAddress() view returns(address)
+func (_Crash *CrashCaller) AgentAddress(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _Crash.contract.Call(opts, &out, "agentAddress")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// AgentAddress is a free data retrieval call binding the contract method 0x38613690.
+//
+// Solidity: function agentAddress() view returns(address)
+func (_Crash *CrashSession) AgentAddress() (common.Address, error) {
+	return _Crash.Contract.AgentAddress(&_Crash.CallOpts)
+}
+
+// AgentAddress is a free data retrieval call binding the contract method 0x38613690.
+//
+// Solidity: function agentAddress() view returns(address)
+func (_Crash *CrashCallerSession) AgentAddress() (common.Address, error) {
+	return _Crash.Contract.AgentAddress(&_Crash.CallOpts)
+}
+
+// Eip712Domain is a free data retrieval call binding the contract method 0x84b0196e.
+//
+// Solidity: function eip712Domain() view returns(bytes1 fields, string name, string version, uint256 chainId, address verifyingContract, bytes32 salt, uint256[] extensions)
+func (_Crash *CrashCaller) Eip712Domain(opts *bind.CallOpts) (struct {
+	Fields            [1]byte
+	Name              string
+	Version           string
+	ChainId           *big.Int
+	VerifyingContract common.Address
+	Salt              [32]byte
+	Extensions        []*big.Int
+}, error) {
+	var out []interface{}
+	err := _Crash.contract.Call(opts, &out, "eip712Domain")
+
+	outstruct := new(struct {
+		Fields            [1]byte
+		Name              string
+		Version           string
+		ChainId           *big.Int
+		VerifyingContract common.Address
+		Salt              [32]byte
+		Extensions        []*big.Int
+	})
+	if err != nil {
+		return *outstruct, err
+	}
+
+	outstruct.Fields = *abi.ConvertType(out[0], new([1]byte)).(*[1]byte)
+	outstruct.Name = *abi.ConvertType(out[1], new(string)).(*string)
+	outstruct.Version = *abi.ConvertType(out[2], new(string)).(*string)
+	outstruct.ChainId = *abi.ConvertType(out[3], new(*big.Int)).(**big.Int)
+	outstruct.VerifyingContract = *abi.ConvertType(out[4], new(common.Address)).(*common.Address)
+	outstruct.Salt = *abi.ConvertType(out[5], new([32]byte)).(*[32]byte)
+	outstruct.Extensions = *abi.ConvertType(out[6], new([]*big.Int)).(*[]*big.Int)
+
+	return *outstruct, err
+
+}
+
+// Eip712Domain is a free data retrieval call binding the contract method 0x84b0196e.
+//
+// Solidity: function eip712Domain() view returns(bytes1 fields, string name, string version, uint256 chainId, address verifyingContract, bytes32 salt, uint256[] extensions)
+func (_Crash *CrashSession) Eip712Domain() (struct {
+	Fields            [1]byte
+	Name              string
+	Version           string
+	ChainId           *big.Int
+	VerifyingContract common.Address
+	Salt              [32]byte
+	Extensions        []*big.Int
+}, error) {
+	return _Crash.Contract.Eip712Domain(&_Crash.CallOpts)
+}
+
+// Eip712Domain is a free data retrieval call binding the contract method 0x84b0196e.
+//
+// Solidity: function eip712Domain() view returns(bytes1 fields, string name, string version, uint256 chainId, address verifyingContract, bytes32 salt, uint256[] extensions)
+func (_Crash *CrashCallerSession) Eip712Domain() (struct {
+	Fields            [1]byte
+	Name              string
+	Version           string
+	ChainId           *big.Int
+	VerifyingContract common.Address
+	Salt              [32]byte
+	Extensions        []*big.Int
+}, error) {
+	return _Crash.Contract.Eip712Domain(&_Crash.CallOpts)
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Crash *CrashCaller) Owner(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _Crash.contract.Call(opts, &out, "owner")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Crash *CrashSession) Owner() (common.Address, error) {
+	return _Crash.Contract.Owner(&_Crash.CallOpts)
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Crash *CrashCallerSession) Owner() (common.Address, error) {
+	return _Crash.Contract.Owner(&_Crash.CallOpts)
+}
+
+// SupportedCoins is a free data retrieval call binding the contract method 0x4cfd7433.
+//
+// Solidity: function supportedCoins(uint32 ) view returns(address)
+func (_Crash *CrashCaller) SupportedCoins(opts *bind.CallOpts, arg0 uint32) (common.Address, error) {
+	var out []interface{}
+	err := _Crash.contract.Call(opts, &out, "supportedCoins", arg0)
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// SupportedCoins is a free data retrieval call binding the contract method 0x4cfd7433.
+//
+// Solidity: function supportedCoins(uint32 ) view returns(address)
+func (_Crash *CrashSession) SupportedCoins(arg0 uint32) (common.Address, error) {
+	return _Crash.Contract.SupportedCoins(&_Crash.CallOpts, arg0)
+}
+
+// SupportedCoins is a free data retrieval call binding the contract method 0x4cfd7433.
+//
+// Solidity: function supportedCoins(uint32 ) view returns(address)
+func (_Crash *CrashCallerSession) SupportedCoins(arg0 uint32) (common.Address, error) {
+	return _Crash.Contract.SupportedCoins(&_Crash.CallOpts, arg0)
+}
+
+// AddCoin is a paid mutator transaction binding the contract method 0x8da9cb50.
+//
+// Solidity: function addCoin(uint32 coinId, address token) returns()
+func (_Crash *CrashTransactor) AddCoin(opts *bind.TransactOpts, coinId uint32, token common.Address) (*types.Transaction, error) {
+	return _Crash.contract.Transact(opts, "addCoin", coinId, token)
+}
+
+// AddCoin is a paid mutator transaction binding the contract method 0x8da9cb50.
+//
+// Solidity: function addCoin(uint32 coinId, address token) returns()
+func (_Crash *CrashSession) AddCoin(coinId uint32, token common.Address) (*types.Transaction, error) {
+	return _Crash.Contract.AddCoin(&_Crash.TransactOpts, coinId, token)
+}
+
+// AddCoin is a paid mutator transaction binding the contract method 0x8da9cb50.
+//
+// Solidity: function addCoin(uint32 coinId, address token) returns()
+func (_Crash *CrashTransactorSession) AddCoin(coinId uint32, token common.Address) (*types.Transaction, error) {
+	return _Crash.Contract.AddCoin(&_Crash.TransactOpts, coinId, token)
+}
+
+// Deposit is a paid mutator transaction binding the contract method 0xaaf10398.
+//
+// Solidity: function deposit(uint32 coinId, uint256 amount) returns()
+func (_Crash *CrashTransactor) Deposit(opts *bind.TransactOpts, coinId uint32, amount *big.Int) (*types.Transaction, error) {
+	return _Crash.contract.Transact(opts, "deposit", coinId, amount)
+}
+
+// Deposit is a paid mutator transaction binding the contract method 0xaaf10398.
+//
+// Solidity: function deposit(uint32 coinId, uint256 amount) returns()
+func (_Crash *CrashSession) Deposit(coinId uint32, amount *big.Int) (*types.Transaction, error) {
+	return _Crash.Contract.Deposit(&_Crash.TransactOpts, coinId, amount)
+}
+
+// Deposit is a paid mutator transaction binding the contract method 0xaaf10398.
+//
+// Solidity: function deposit(uint32 coinId, uint256 amount) returns()
+func (_Crash *CrashTransactorSession) Deposit(coinId uint32, amount *big.Int) (*types.Transaction, error) {
+	return _Crash.Contract.Deposit(&_Crash.TransactOpts, coinId, amount)
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Crash *CrashTransactor) RenounceOwnership(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Crash.contract.Transact(opts, "renounceOwnership")
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Crash *CrashSession) RenounceOwnership() (*types.Transaction, error) {
+	return _Crash.Contract.RenounceOwnership(&_Crash.TransactOpts)
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Crash *CrashTransactorSession) RenounceOwnership() (*types.Transaction, error) {
+	return _Crash.Contract.RenounceOwnership(&_Crash.TransactOpts)
+}
+
+// SetAgentAddress is a paid mutator transaction binding the contract method 0x895ce185.
+//
+// Solidity: function setAgentAddress(address newAgentAddress) returns()
+func (_Crash *CrashTransactor) SetAgentAddress(opts *bind.TransactOpts, newAgentAddress common.Address) (*types.Transaction, error) {
+	return _Crash.contract.Transact(opts, "setAgentAddress", newAgentAddress)
+}
+
+// SetAgentAddress is a paid mutator transaction binding the contract method 0x895ce185.
+//
+// Solidity: function setAgentAddress(address newAgentAddress) returns()
+func (_Crash *CrashSession) SetAgentAddress(newAgentAddress common.Address) (*types.Transaction, error) {
+	return _Crash.Contract.SetAgentAddress(&_Crash.TransactOpts, newAgentAddress)
+}
+
+// SetAgentAddress is a paid mutator transaction binding the contract method 0x895ce185.
+//
+// Solidity: function setAgentAddress(address newAgentAddress) returns()
+func (_Crash *CrashTransactorSession) SetAgentAddress(newAgentAddress common.Address) (*types.Transaction, error) {
+	return _Crash.Contract.SetAgentAddress(&_Crash.TransactOpts, newAgentAddress)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Crash *CrashTransactor) TransferOwnership(opts *bind.TransactOpts, newOwner common.Address) (*types.Transaction, error) {
+	return _Crash.contract.Transact(opts, "transferOwnership", newOwner)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Crash *CrashSession) TransferOwnership(newOwner common.Address) (*types.Transaction, error) {
+	return _Crash.Contract.TransferOwnership(&_Crash.TransactOpts, newOwner)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Crash *CrashTransactorSession) TransferOwnership(newOwner common.Address) (*types.Transaction, error) {
+	return _Crash.Contract.TransferOwnership(&_Crash.TransactOpts, newOwner)
+}
+
+// Withdraw is a paid mutator transaction binding the contract method 0x6a365cd0.
+//
+// Solidity: function withdraw((address,uint32,uint256,uint256,(uint8,address,uint32,uint256,uint256)[]) req, bytes signature) returns()
+func (_Crash *CrashTransactor) Withdraw(opts *bind.TransactOpts, req CrashWithdrawalRequest, signature []byte) (*types.Transaction, error) {
+	return _Crash.contract.Transact(opts, "withdraw", req, signature)
+}
+
+// Withdraw is a paid mutator transaction binding the contract method 0x6a365cd0.
+//
+// Solidity: function withdraw((address,uint32,uint256,uint256,(uint8,address,uint32,uint256,uint256)[]) req, bytes signature) returns()
+func (_Crash *CrashSession) Withdraw(req CrashWithdrawalRequest, signature []byte) (*types.Transaction, error) {
+	return _Crash.Contract.Withdraw(&_Crash.TransactOpts, req, signature)
+}
+
+// Withdraw is a paid mutator transaction binding the contract method 0x6a365cd0.
+//
+// Solidity: function withdraw((address,uint32,uint256,uint256,(uint8,address,uint32,uint256,uint256)[]) req, bytes signature) returns()
+func (_Crash *CrashTransactorSession) Withdraw(req CrashWithdrawalRequest, signature []byte) (*types.Transaction, error) {
+	return _Crash.Contract.Withdraw(&_Crash.TransactOpts, req, signature)
+}
+
+// CrashBalanceDecreasedIterator is returned from FilterBalanceDecreased and is used to iterate over the raw logs and unpacked data for BalanceDecreased events raised by the Crash contract.
+type CrashBalanceDecreasedIterator struct {
+	Event *CrashBalanceDecreased // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *CrashBalanceDecreasedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(CrashBalanceDecreased)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(CrashBalanceDecreased)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *CrashBalanceDecreasedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *CrashBalanceDecreasedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// CrashBalanceDecreased represents a BalanceDecreased event raised by the Crash contract.
+type CrashBalanceDecreased struct {
+	User       common.Address
+	CoinId     uint32
+	Amount     *big.Int
+	NewBalance *big.Int
+	Raw        types.Log // Blockchain specific contextual infos
+}
+
+// FilterBalanceDecreased is a free log retrieval operation binding the contract event 0x5e5704a089dc1fcea2a0129df5542e1db0ad2c69a1002f285dcc36616e1611f4.
+//
+// Solidity: event BalanceDecreased(address user, uint32 coinId, uint256 amount, uint256 newBalance)
+func (_Crash *CrashFilterer) FilterBalanceDecreased(opts *bind.FilterOpts) (*CrashBalanceDecreasedIterator, error) {
+
+	logs, sub, err := _Crash.contract.FilterLogs(opts, "BalanceDecreased")
+	if err != nil {
+		return nil, err
+	}
+	return &CrashBalanceDecreasedIterator{contract: _Crash.contract, event: "BalanceDecreased", logs: logs, sub: sub}, nil
+}
+
+// WatchBalanceDecreased is a free log subscription operation binding the contract event 0x5e5704a089dc1fcea2a0129df5542e1db0ad2c69a1002f285dcc36616e1611f4.
+//
+// Solidity: event BalanceDecreased(address user, uint32 coinId, uint256 amount, uint256 newBalance)
+func (_Crash *CrashFilterer) WatchBalanceDecreased(opts *bind.WatchOpts, sink chan<- *CrashBalanceDecreased) (event.Subscription, error) {
+
+	logs, sub, err := _Crash.contract.WatchLogs(opts, "BalanceDecreased")
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(CrashBalanceDecreased)
+				if err := _Crash.contract.UnpackLog(event, "BalanceDecreased", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseBalanceDecreased is a log parse operation binding the contract event 0x5e5704a089dc1fcea2a0129df5542e1db0ad2c69a1002f285dcc36616e1611f4.
+//
+// Solidity: event BalanceDecreased(address user, uint32 coinId, uint256 amount, uint256 newBalance)
+func (_Crash *CrashFilterer) ParseBalanceDecreased(log types.Log) (*CrashBalanceDecreased, error) {
+	event := new(CrashBalanceDecreased)
+	if err := _Crash.contract.UnpackLog(event, "BalanceDecreased", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// CrashBalanceIncreasedIterator is returned from FilterBalanceIncreased and is used to iterate over the raw logs and unpacked data for BalanceIncreased events raised by the Crash contract.
+type CrashBalanceIncreasedIterator struct {
+	Event *CrashBalanceIncreased // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *CrashBalanceIncreasedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(CrashBalanceIncreased)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(CrashBalanceIncreased)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *CrashBalanceIncreasedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *CrashBalanceIncreasedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// CrashBalanceIncreased represents a BalanceIncreased event raised by the Crash contract.
+type CrashBalanceIncreased struct {
+	User       common.Address
+	CoinId     uint32
+	Amount     *big.Int
+	NewBalance *big.Int
+	Raw        types.Log // Blockchain specific contextual infos
+}
+
+// FilterBalanceIncreased is a free log retrieval operation binding the contract event 0xd7dbb471307064793c28105c2621f0e75795f4d4962d994bafd954bba05f4957.
+//
+// Solidity: event BalanceIncreased(address user, uint32 coinId, uint256 amount, uint256 newBalance)
+func (_Crash *CrashFilterer) FilterBalanceIncreased(opts *bind.FilterOpts) (*CrashBalanceIncreasedIterator, error) {
+
+	logs, sub, err := _Crash.contract.FilterLogs(opts, "BalanceIncreased")
+	if err != nil {
+		return nil, err
+	}
+	return &CrashBalanceIncreasedIterator{contract: _Crash.contract, event: "BalanceIncreased", logs: logs, sub: sub}, nil
+}
+
+// WatchBalanceIncreased is a free log subscription operation binding the contract event 0xd7dbb471307064793c28105c2621f0e75795f4d4962d994bafd954bba05f4957.
+//
+// Solidity: event BalanceIncreased(address user, uint32 coinId, uint256 amount, uint256 newBalance)
+func (_Crash *CrashFilterer) WatchBalanceIncreased(opts *bind.WatchOpts, sink chan<- *CrashBalanceIncreased) (event.Subscription, error) {
+
+	logs, sub, err := _Crash.contract.WatchLogs(opts, "BalanceIncreased")
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(CrashBalanceIncreased)
+				if err := _Crash.contract.UnpackLog(event, "BalanceIncreased", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseBalanceIncreased is a log parse operation binding the contract event 0xd7dbb471307064793c28105c2621f0e75795f4d4962d994bafd954bba05f4957.
+//
+// Solidity: event BalanceIncreased(address user, uint32 coinId, uint256 amount, uint256 newBalance)
+func (_Crash *CrashFilterer) ParseBalanceIncreased(log types.Log) (*CrashBalanceIncreased, error) {
+	event := new(CrashBalanceIncreased)
+	if err := _Crash.contract.UnpackLog(event, "BalanceIncreased", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// CrashEIP712DomainChangedIterator is returned from FilterEIP712DomainChanged and is used to iterate over the raw logs and unpacked data for EIP712DomainChanged events raised by the Crash contract.
+type CrashEIP712DomainChangedIterator struct {
+	Event *CrashEIP712DomainChanged // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *CrashEIP712DomainChangedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(CrashEIP712DomainChanged)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(CrashEIP712DomainChanged)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *CrashEIP712DomainChangedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *CrashEIP712DomainChangedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// CrashEIP712DomainChanged represents a EIP712DomainChanged event raised by the Crash contract.
+type CrashEIP712DomainChanged struct {
+	Raw types.Log // Blockchain specific contextual infos
+}
+
+// FilterEIP712DomainChanged is a free log retrieval operation binding the contract event 0x0a6387c9ea3628b88a633bb4f3b151770f70085117a15f9bf3787cda53f13d31.
+//
+// Solidity: event EIP712DomainChanged()
+func (_Crash *CrashFilterer) FilterEIP712DomainChanged(opts *bind.FilterOpts) (*CrashEIP712DomainChangedIterator, error) {
+
+	logs, sub, err := _Crash.contract.FilterLogs(opts, "EIP712DomainChanged")
+	if err != nil {
+		return nil, err
+	}
+	return &CrashEIP712DomainChangedIterator{contract: _Crash.contract, event: "EIP712DomainChanged", logs: logs, sub: sub}, nil
+}
+
+// WatchEIP712DomainChanged is a free log subscription operation binding the contract event 0x0a6387c9ea3628b88a633bb4f3b151770f70085117a15f9bf3787cda53f13d31.
+//
+// Solidity: event EIP712DomainChanged()
+func (_Crash *CrashFilterer) WatchEIP712DomainChanged(opts *bind.WatchOpts, sink chan<- *CrashEIP712DomainChanged) (event.Subscription, error) {
+
+	logs, sub, err := _Crash.contract.WatchLogs(opts, "EIP712DomainChanged")
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(CrashEIP712DomainChanged)
+				if err := _Crash.contract.UnpackLog(event, "EIP712DomainChanged", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseEIP712DomainChanged is a log parse operation binding the contract event 0x0a6387c9ea3628b88a633bb4f3b151770f70085117a15f9bf3787cda53f13d31.
+//
+// Solidity: event EIP712DomainChanged()
+func (_Crash *CrashFilterer) ParseEIP712DomainChanged(log types.Log) (*CrashEIP712DomainChanged, error) {
+	event := new(CrashEIP712DomainChanged)
+	if err := _Crash.contract.UnpackLog(event, "EIP712DomainChanged", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// CrashOwnershipTransferredIterator is returned from FilterOwnershipTransferred and is used to iterate over the raw logs and unpacked data for OwnershipTransferred events raised by the Crash contract.
+type CrashOwnershipTransferredIterator struct {
+	Event *CrashOwnershipTransferred // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *CrashOwnershipTransferredIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(CrashOwnershipTransferred)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(CrashOwnershipTransferred)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *CrashOwnershipTransferredIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *CrashOwnershipTransferredIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// CrashOwnershipTransferred represents a OwnershipTransferred event raised by the Crash contract.
+type CrashOwnershipTransferred struct {
+	PreviousOwner common.Address
+	NewOwner      common.Address
+	Raw           types.Log // Blockchain specific contextual infos
+}
+
+// FilterOwnershipTransferred is a free log retrieval operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Crash *CrashFilterer) FilterOwnershipTransferred(opts *bind.FilterOpts, previousOwner []common.Address, newOwner []common.Address) (*CrashOwnershipTransferredIterator, error) {
+
+	var previousOwnerRule []interface{}
+	for _, previousOwnerItem := range previousOwner {
+		previousOwnerRule = append(previousOwnerRule, previousOwnerItem)
+	}
+	var newOwnerRule []interface{}
+	for _, newOwnerItem := range newOwner {
+		newOwnerRule = append(newOwnerRule, newOwnerItem)
+	}
+
+	logs, sub, err := _Crash.contract.FilterLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
+	if err != nil {
+		return nil, err
+	}
+	return &CrashOwnershipTransferredIterator{contract: _Crash.contract, event: "OwnershipTransferred", logs: logs, sub: sub}, nil
+}
+
+// WatchOwnershipTransferred is a free log subscription operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Crash *CrashFilterer) WatchOwnershipTransferred(opts *bind.WatchOpts, sink chan<- *CrashOwnershipTransferred, previousOwner []common.Address, newOwner []common.Address) (event.Subscription, error) {
+
+	var previousOwnerRule []interface{}
+	for _, previousOwnerItem := range previousOwner {
+		previousOwnerRule = append(previousOwnerRule, previousOwnerItem)
+	}
+	var newOwnerRule []interface{}
+	for _, newOwnerItem := range newOwner {
+		newOwnerRule = append(newOwnerRule, newOwnerItem)
+	}
+
+	logs, sub, err := _Crash.contract.WatchLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(CrashOwnershipTransferred)
+				if err := _Crash.contract.UnpackLog(event, "OwnershipTransferred", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseOwnershipTransferred is a log parse operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Crash *CrashFilterer) ParseOwnershipTransferred(log types.Log) (*CrashOwnershipTransferred, error) {
+	event := new(CrashOwnershipTransferred)
+	if err := _Crash.contract.UnpackLog(event, "OwnershipTransferred", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
@@ -0,0 +1,330 @@
+package deposits;
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/chainscan"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+);
+
+var (
+	ErrInvalidContract = errors.New("invalid contract address")
+	ErrUnknownChain = errors.New("unknown chain")
+	ErrUnknownCoin = errors.New("unknown coin id")
+)
+
+const (
+	STATUS_PENDING  = "pending";
+	STATUS_CREDITED = "credited";
+	STATUS_REVERTED = "reverted";
+);
+
+type Deposit struct {
+	Chain string;
+	Wallet string;
+	Currency string;
+	CoinId uint32;
+	Amount decimal.Decimal;
+	TxHash common.Hash;
+	LogIndex uint;
+	BlockNumber uint64;
+	BlockHash common.Hash;
+	Confirmations uint64;
+	Required uint64;
+}
+
+/**
+ * Persistence for the watcher. Deposits are identified by BlockHash
+ * and LogIndex, so the same transaction mined again in a different
+ * block after a reorg is a separate deposit.
+ *
+ * AddPending returns false if the deposit is already known, unless it
+ * had been reverted, in which case it is made pending again. Confirm
+ * and Revert only act on pending deposits and return false otherwise;
+ * Confirm credits the balance in the same transaction.
+ */
+type Store interface {
+	chainscan.Cursor;
+	AddPending(*Deposit) (bool, error);
+	Pending() ([]*Deposit, error);
+	Confirm(*Deposit) (bool, decimal.Decimal, error);
+	Revert(*Deposit) (bool, error);
+}
+
+type Listener interface {
+	DepositPending(*Deposit);
+	DepositConfirmed(*Deposit, decimal.Decimal);
+	DepositReverted(*Deposit);
+}
+
+type coin struct {
+	currency string;
+	decimals uint;
+	confirmations uint64;
+}
+
+type Watcher struct {
+	chain string;
+	client chainscan.Client;
+	scanner *chainscan.Scanner;
+	coins map[uint32]coin;
+	store Store;
+	listener Listener;
+	maxConfirmations uint64;
+}
+
+/**
+ * Watches the contract on one of the configured chains. Each chain
+ * needs its own watcher and store; only the currencies the chain maps
+ * to a coin id are recognised.
+ */
+func NewWatcher(
+	client chainscan.Client,
+	cfg *config.CrashConfig,
+	chain string,
+	store Store,
+	listener Listener,
+) (*Watcher, error) {
+	chainDef, ok := cfg.Chains[chain];
+
+	if !ok {
+		return nil, ErrUnknownChain;
+	}
+
+	if !common.IsHexAddress(chainDef.Contract) {
+		return nil, ErrInvalidContract;
+	}
+
+	coins := make(map[uint32]coin);
+	maxConfirmations := uint64(1);
+
+	for currency, def := range chainDef.Coins {
+		currencyDef, ok := cfg.Currencies[currency];
+
+		if !ok {
+			continue;
+		}
+
+		confirmations := max(def.Confirmations, 1);
+
+		coins[def.CoinId] = coin{
+			currency: currency,
+			decimals: currencyDef.Decimals,
+			confirmations: confirmations,
+		};
+
+		maxConfirmations = max(maxConfirmations, confirmations);
+	}
+
+	scanner := chainscan.NewScanner(
+		client,
+		store,
+		[]common.Address{ common.HexToAddress(chainDef.Contract) },
+		[][]common.Hash{ { contract.BalanceIncreasedTopic() } },
+		chainDef.StartBlock,
+		maxConfirmations,
+	);
+
+	return &Watcher{
+		chain: chain,
+		client: client,
+		scanner: scanner,
+		coins: coins,
+		store: store,
+		listener: listener,
+		maxConfirmations: maxConfirmations,
+	}, nil;
+}
+
+/**
+ * Records deposits in all blocks since the last poll as pending, then
+ * credits those that are deep enough and reverts those whose block is
+ * no longer on the chain.
+ */
+func (watcher *Watcher) Poll(ctx context.Context) error {
+	head, err := watcher.scanner.Scan(ctx, watcher.handleLog);
+
+	if err != nil {
+		return err;
+	}
+
+	return watcher.settle(ctx, head);
+}
+
+func (watcher *Watcher) handleLog(log *types.Log) error {
+	deposit, err := watcher.decode(log);
+
+	if err != nil {
+		slog.Warn(
+			"Skipping deposit log",
+			"chain", watcher.chain,
+			"txHash", log.TxHash,
+			"logIndex", log.Index,
+			"error", err,
+		);
+		return nil;
+	}
+
+	added, err := watcher.store.AddPending(deposit);
+
+	if err != nil || !added {
+		return err;
+	}
+
+	slog.Info(
+		"Deposit pending",
+		"chain", deposit.Chain,
+		"wallet", deposit.Wallet,
+		"currency", deposit.Currency,
+		"amount", deposit.Amount,
+		"txHash", deposit.TxHash,
+		"block", deposit.BlockNumber,
+	);
+
+	if watcher.listener != nil {
+		watcher.listener.DepositPending(deposit);
+	}
+
+	return nil;
+}
+
+/**
+ * Checks every pending deposit against the canonical chain. Deposits
+ * in blocks that have been replaced are reverted; the rest are
+ * credited once they have the confirmations their currency requires.
+ */
+func (watcher *Watcher) settle(ctx context.Context, head uint64) error {
+	pending, err := watcher.store.Pending();
+
+	if err != nil {
+		return err;
+	}
+
+	canonical := chainscan.NewCanonical(watcher.client);
+
+	for _, deposit := range pending {
+		// The chain may have become shorter; wait until it is long
+		// enough again to tell whether the block survived.
+		if deposit.BlockNumber > head {
+			continue;
+		}
+
+		ok, err := canonical.Contains(ctx, deposit.BlockNumber, deposit.BlockHash);
+
+		if err != nil {
+			return err;
+		}
+
+		if !ok {
+			if err := watcher.revert(deposit); err != nil {
+				return err;
+			}
+
+			continue;
+		}
+
+		deposit.Confirmations = head - deposit.BlockNumber + 1;
+		deposit.Required = watcher.maxConfirmations;
+
+		if coin, ok := watcher.coins[deposit.CoinId]; ok {
+			deposit.Required = coin.confirmations;
+		}
+
+		if deposit.Confirmations < deposit.Required {
+			continue;
+		}
+
+		if err := watcher.confirm(deposit); err != nil {
+			return err;
+		}
+	}
+
+	return nil;
+}
+
+func (watcher *Watcher) confirm(deposit *Deposit) error {
+	credited, balance, err := watcher.store.Confirm(deposit);
+
+	if err != nil || !credited {
+		return err;
+	}
+
+	slog.Info(
+		"Deposit credited",
+		"chain", deposit.Chain,
+		"wallet", deposit.Wallet,
+		"currency", deposit.Currency,
+		"amount", deposit.Amount,
+		"txHash", deposit.TxHash,
+		"confirmations", deposit.Confirmations,
+	);
+
+	if watcher.listener != nil {
+		watcher.listener.DepositConfirmed(deposit, balance);
+	}
+
+	return nil;
+}
+
+func (watcher *Watcher) revert(deposit *Deposit) error {
+	reverted, err := watcher.store.Revert(deposit);
+
+	if err != nil || !reverted {
+		return err;
+	}
+
+	slog.Warn(
+		"Deposit block orphaned; deposit reverted",
+		"chain", deposit.Chain,
+		"wallet", deposit.Wallet,
+		"currency", deposit.Currency,
+		"amount", deposit.Amount,
+		"txHash", deposit.TxHash,
+		"blockHash", deposit.BlockHash,
+	);
+
+	if watcher.listener != nil {
+		watcher.listener.DepositReverted(deposit);
+	}
+
+	return nil;
+}
+
+/**
+ * Turns a BalanceIncreased log into a deposit, mapping the chain's
+ * coin id back to a configured currency and scaling the amount by its
+ * decimals.
+ */
+func (watcher *Watcher) decode(log *types.Log) (*Deposit, error) {
+	event, err := contract.ParseBalanceIncreased(log);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	coin, ok := watcher.coins[event.CoinId];
+
+	if !ok {
+		return nil, ErrUnknownCoin;
+	}
+
+	return &Deposit{
+		Chain: watcher.chain,
+		Wallet: event.User.String(),
+		Currency: coin.currency,
+		CoinId: event.CoinId,
+		Amount: decimal.NewFromBigInt(event.Amount, -int32(coin.decimals)),
+		TxHash: log.TxHash,
+		LogIndex: log.Index,
+		BlockNumber: log.BlockNumber,
+		BlockHash: log.BlockHash,
+		Required: coin.confirmations,
+	}, nil;
+}
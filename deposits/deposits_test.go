@@ -0,0 +1,377 @@
+package deposits;
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/chaintest"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+);
+
+var cfg *config.CrashConfig;
+
+type memStore struct {
+	lastBlock uint64;
+	lastHash common.Hash;
+	hasLastBlock bool;
+	deposits map[string]*Deposit;
+	status map[string]string;
+	balances map[string]decimal.Decimal;
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		deposits: make(map[string]*Deposit),
+		status: make(map[string]string),
+		balances: make(map[string]decimal.Decimal),
+	};
+}
+
+func depositKey(deposit *Deposit) string {
+	return fmt.Sprintf("%s:%d", deposit.BlockHash.Hex(), deposit.LogIndex);
+}
+
+func (store *memStore) LastBlock() (uint64, common.Hash, bool, error) {
+	return store.lastBlock, store.lastHash, store.hasLastBlock, nil;
+}
+
+func (store *memStore) SetLastBlock(block uint64, hash common.Hash) error {
+	store.lastBlock = block;
+	store.lastHash = hash;
+	store.hasLastBlock = true;
+	return nil;
+}
+
+func (store *memStore) AddPending(deposit *Deposit) (bool, error) {
+	key := depositKey(deposit);
+
+	if status, ok := store.status[key]; ok && status != STATUS_REVERTED {
+		return false, nil;
+	}
+
+	store.deposits[key] = deposit;
+	store.status[key] = STATUS_PENDING;
+
+	return true, nil;
+}
+
+func (store *memStore) Pending() ([]*Deposit, error) {
+	pending := make([]*Deposit, 0);
+
+	for key, deposit := range store.deposits {
+		if store.status[key] == STATUS_PENDING {
+			pending = append(pending, deposit);
+		}
+	}
+
+	return pending, nil;
+}
+
+func (store *memStore) Confirm(deposit *Deposit) (bool, decimal.Decimal, error) {
+	key := depositKey(deposit);
+
+	if store.status[key] != STATUS_PENDING {
+		return false, decimal.Zero, nil;
+	}
+
+	store.status[key] = STATUS_CREDITED;
+
+	account := deposit.Wallet + ":" + deposit.Currency;
+	store.balances[account] = store.balances[account].Add(deposit.Amount);
+
+	return true, store.balances[account], nil;
+}
+
+func (store *memStore) Revert(deposit *Deposit) (bool, error) {
+	key := depositKey(deposit);
+
+	if store.status[key] != STATUS_PENDING {
+		return false, nil;
+	}
+
+	store.status[key] = STATUS_REVERTED;
+
+	return true, nil;
+}
+
+type recordingListener struct {
+	pending []*Deposit;
+	confirmed []*Deposit;
+	reverted []*Deposit;
+}
+
+func (listener *recordingListener) DepositPending(deposit *Deposit) {
+	listener.pending = append(listener.pending, deposit);
+}
+
+func (listener *recordingListener) DepositConfirmed(deposit *Deposit, _ decimal.Decimal) {
+	listener.confirmed = append(listener.confirmed, deposit);
+}
+
+func (listener *recordingListener) DepositReverted(deposit *Deposit) {
+	listener.reverted = append(listener.reverted, deposit);
+}
+
+func init() {
+	var err error;
+
+	cfg, err = config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+}
+
+func emitBalanceIncreased(
+	t *testing.T,
+	chain *chaintest.Chain,
+	emitter common.Address,
+	user common.Address,
+	coinId uint32,
+	amount *big.Int,
+) {
+	crashAbi, err := contract.CrashMetaData.GetAbi();
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	data, err := crashAbi.Events["BalanceIncreased"].Inputs.Pack(user, coinId, amount, amount);
+
+	if err != nil {
+		t.Fatal("Failed to pack event: ", err);
+	}
+
+	if _, err = chain.Emit(emitter, contract.BalanceIncreasedTopic(), data); err != nil {
+		t.Fatal("Failed to emit event: ", err);
+	}
+}
+
+func coinId(chainName string, currency string) uint32 {
+	return cfg.Chains[chainName].Coins[currency].CoinId;
+}
+
+func newTestWatcher(
+	t *testing.T,
+	chain *chaintest.Chain,
+	chainName string,
+	emitter common.Address,
+) (*Watcher, *memStore, *recordingListener) {
+	chainDef := cfg.Chains[chainName];
+	chainDef.Contract = emitter.Hex();
+
+	watcherCfg := *cfg;
+	watcherCfg.Chains = map[string]config.ChainDef{ chainName: chainDef };
+
+	store := newMemStore();
+	listener := &recordingListener{};
+
+	watcher, err := NewWatcher(chain.Client, &watcherCfg, chainName, store, listener);
+
+	if err != nil {
+		t.Fatal("Failed to create watcher: ", err);
+	}
+
+	return watcher, store, listener;
+}
+
+func poll(t *testing.T, watcher *Watcher) {
+	if err := watcher.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+}
+
+func TestWatcherCreditsDeposits(t *testing.T) {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	defer chain.Close();
+
+	emitter, err := chain.DeployEmitter();
+
+	if err != nil {
+		t.Fatal("Failed to deploy emitter: ", err);
+	}
+
+	watcher, store, listener := newTestWatcher(t, chain, "ethereum", emitter);
+
+	user := common.HexToAddress("0x1111111111111111111111111111111111111111");
+	ethAmount, _ := new(big.Int).SetString("1500000000000000000", 10);
+
+	emitBalanceIncreased(t, chain, emitter, user, coinId("ethereum", "eth"), ethAmount);
+	emitBalanceIncreased(t, chain, emitter, user, coinId("ethereum", "btc"), big.NewInt(12345678));
+	emitBalanceIncreased(t, chain, emitter, user, 99, big.NewInt(1));
+
+	chain.Commit();
+	poll(t, watcher);
+
+	if len(listener.pending) != 2 || len(listener.confirmed) != 0 {
+		t.Fatal("Expected 2 pending deposits, got ", len(listener.pending));
+	}
+
+	// The test config requires three confirmations.
+	chain.Commit();
+	poll(t, watcher);
+
+	if len(listener.confirmed) != 0 {
+		t.Fatal("Deposit credited before reaching confirmation depth");
+	}
+
+	chain.Commit();
+	poll(t, watcher);
+
+	if len(listener.confirmed) != 2 {
+		t.Fatal("Expected 2 deposits, got ", len(listener.confirmed));
+	}
+
+	expected := map[string]string{
+		"eth": "1.5",
+		"btc": "0.12345678",
+	};
+
+	for _, deposit := range listener.confirmed {
+		if deposit.Wallet != user.String() {
+			t.Fatal("Deposit credited to wrong wallet: ", deposit.Wallet);
+		}
+
+		if deposit.Amount.String() != expected[deposit.Currency] {
+			t.Fatal("Deposit amount incorrect for ", deposit.Currency, ": ", deposit.Amount);
+		}
+	}
+
+	// Rewind the cursor as if we had crashed before saving it; the
+	// same logs must not be credited again.
+	store.hasLastBlock = false;
+	poll(t, watcher);
+
+	if len(listener.pending) != 2 || len(listener.confirmed) != 2 {
+		t.Fatal("Deposits credited more than once");
+	}
+
+	if balance := store.balances[user.String() + ":eth"]; balance.String() != "1.5" {
+		t.Fatal("Balance incorrect after re-scan: ", balance);
+	}
+}
+
+func TestWatcherRevertsOrphanedDeposits(t *testing.T) {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	defer chain.Close();
+
+	emitter, err := chain.DeployEmitter();
+
+	if err != nil {
+		t.Fatal("Failed to deploy emitter: ", err);
+	}
+
+	watcher, store, listener := newTestWatcher(t, chain, "ethereum", emitter);
+
+	parent, err := chain.Client.HeaderByNumber(context.Background(), nil);
+
+	if err != nil {
+		t.Fatal("Failed to get head: ", err);
+	}
+
+	user := common.HexToAddress("0x2222222222222222222222222222222222222222");
+
+	emitBalanceIncreased(t, chain, emitter, user, coinId("ethereum", "eth"), big.NewInt(1000));
+	chain.Commit();
+	chain.Commit();
+	poll(t, watcher);
+
+	if len(listener.pending) != 1 {
+		t.Fatal("Expected 1 pending deposit, got ", len(listener.pending));
+	}
+
+	// Replace the deposit's block with a longer fork in which a
+	// different deposit lands at a height the watcher has already
+	// scanned, so it must rewind to find it.
+	if err := chain.Backend.Fork(parent.Hash()); err != nil {
+		t.Fatal("Failed to fork chain: ", err);
+	}
+
+	chain.Commit();
+
+	emitBalanceIncreased(t, chain, emitter, user, coinId("ethereum", "eth"), big.NewInt(2000));
+
+	for i := 0; i < 3; i++ {
+		chain.Commit();
+	}
+
+	poll(t, watcher);
+
+	if len(listener.reverted) != 1 || listener.reverted[0].Amount.String() != "0.000000000000001" {
+		t.Fatal("Expected the orphaned deposit to be reverted, got ", len(listener.reverted));
+	}
+
+	if len(listener.pending) != 2 {
+		t.Fatal("Deposit in replacement block not found");
+	}
+
+	if len(listener.confirmed) != 1 || listener.confirmed[0].Amount.String() != "0.000000000000002" {
+		t.Fatal("Expected only the replacement deposit to be credited");
+	}
+
+	if balance := store.balances[user.String() + ":eth"]; balance.String() != "0.000000000000002" {
+		t.Fatal("Balance incorrect after reorg: ", balance);
+	}
+
+	head, err := chain.Client.HeaderByNumber(context.Background(), nil);
+
+	if err != nil {
+		t.Fatal("Failed to get head: ", err);
+	}
+
+	if store.lastHash != head.Hash() {
+		t.Fatal("Cursor not moved to the new chain");
+	}
+}
+
+func TestWatcherUsesChainCoinIds(t *testing.T) {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	defer chain.Close();
+
+	emitter, err := chain.DeployEmitter();
+
+	if err != nil {
+		t.Fatal("Failed to deploy emitter: ", err);
+	}
+
+	watcher, _, listener := newTestWatcher(t, chain, "polygon", emitter);
+
+	user := common.HexToAddress("0x3333333333333333333333333333333333333333");
+
+	// btc is only configured on the other chain, so its coin id means
+	// nothing here.
+	emitBalanceIncreased(t, chain, emitter, user, coinId("polygon", "eth"), big.NewInt(1000));
+	emitBalanceIncreased(t, chain, emitter, user, coinId("ethereum", "btc"), big.NewInt(1000));
+	chain.Commit();
+	poll(t, watcher);
+
+	if len(listener.pending) != 1 {
+		t.Fatal("Expected 1 pending deposit, got ", len(listener.pending));
+	}
+
+	if deposit := listener.pending[0]; deposit.Chain != "polygon" || deposit.Currency != "eth" {
+		t.Fatal("Deposit attributed to wrong chain or currency: ", deposit.Chain, deposit.Currency);
+	}
+}
@@ -0,0 +1,197 @@
+package deposits;
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/chainscan"
+);
+
+var (
+	errAlreadyCredited = errors.New("deposit already credited")
+)
+
+const CURSOR_NAME = "deposits";
+
+type Depositor interface {
+	DepositBalance(string, string, decimal.Decimal, string, bank.TxCallback) (decimal.Decimal, error);
+}
+
+/**
+ * Deposits of a single chain; each chain's watcher has its own store
+ * and cursor.
+ */
+type SqlStore struct {
+	*chainscan.SqlCursor;
+	db *sql.DB;
+	bank Depositor;
+	chain string;
+}
+
+func NewSqlStore(db *sql.DB, bank Depositor, chain string) *SqlStore {
+	return &SqlStore{
+		SqlCursor: chainscan.NewSqlCursor(db, CURSOR_NAME + ":" + chain),
+		db: db,
+		bank: bank,
+		chain: chain,
+	};
+}
+
+/**
+ * A deposit seen again in the same block is ignored. One that had been
+ * reverted is made pending again, which happens if the chain switches
+ * back to a fork we had already seen.
+ */
+func (store *SqlStore) AddPending(deposit *Deposit) (bool, error) {
+	result, err := store.db.Exec(`
+		INSERT INTO deposits
+		(chain, txHash, logIndex, wallet, currency, amount, blockNumber, blockHash, coinId, status)
+		VALUES
+		(?, ?, ?, ?, ?, CAST(? AS Decimal(32, 18)), ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+		updated = IF(status = ?, NOW(3), updated),
+		status = IF(status = ?, VALUES(status), status)
+	`,
+		store.chain,
+		deposit.TxHash.Hex(),
+		deposit.LogIndex,
+		deposit.Wallet,
+		deposit.Currency,
+		deposit.Amount.String(),
+		deposit.BlockNumber,
+		deposit.BlockHash.Hex(),
+		deposit.CoinId,
+		STATUS_PENDING,
+		STATUS_REVERTED,
+		STATUS_REVERTED,
+	);
+
+	if err != nil {
+		return false, err;
+	}
+
+	rows, err := result.RowsAffected();
+
+	return rows > 0, err;
+}
+
+func (store *SqlStore) Pending() ([]*Deposit, error) {
+	rows, err := store.db.Query(`
+		SELECT txHash, logIndex, wallet, currency, amount, blockNumber, blockHash, coinId
+		FROM deposits
+		WHERE chain = ?
+		AND status = ?
+		ORDER BY blockNumber, logIndex
+	`, store.chain, STATUS_PENDING);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	deposits := make([]*Deposit, 0);
+
+	for rows.Next() {
+		deposit := Deposit{ Chain: store.chain };
+		var txHash string;
+		var blockHash string;
+		var amountStr string;
+
+		err := rows.Scan(
+			&txHash,
+			&deposit.LogIndex,
+			&deposit.Wallet,
+			&deposit.Currency,
+			&amountStr,
+			&deposit.BlockNumber,
+			&blockHash,
+			&deposit.CoinId,
+		);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if deposit.Amount, err = decimal.NewFromString(amountStr); err != nil {
+			return nil, err;
+		}
+
+		deposit.TxHash = common.HexToHash(txHash);
+		deposit.BlockHash = common.HexToHash(blockHash);
+
+		deposits = append(deposits, &deposit);
+	}
+
+	return deposits, rows.Err();
+}
+
+func (store *SqlStore) setStatus(
+	exec func(string, ...any) (sql.Result, error),
+	deposit *Deposit,
+	status string,
+) (bool, error) {
+	result, err := exec(`
+		UPDATE deposits
+		SET status = ?, updated = NOW(3)
+		WHERE chain = ?
+		AND blockHash = ?
+		AND logIndex = ?
+		AND status = ?
+	`, status, store.chain, deposit.BlockHash.Hex(), deposit.LogIndex, STATUS_PENDING);
+
+	if err != nil {
+		return false, err;
+	}
+
+	rows, err := result.RowsAffected();
+
+	return rows > 0, err;
+}
+
+/**
+ * The status change is made in the same transaction as the balance
+ * credit, so a deposit can only be credited once even if two watchers
+ * race or the process dies part way through.
+ */
+func (store *SqlStore) Confirm(deposit *Deposit) (bool, decimal.Decimal, error) {
+	markCredited := func(tx *sql.Tx) error {
+		updated, err := store.setStatus(tx.Exec, deposit, STATUS_CREDITED);
+
+		if err != nil {
+			return err;
+		}
+
+		if !updated {
+			return errAlreadyCredited;
+		}
+
+		return nil;
+	};
+
+	balance, err := store.bank.DepositBalance(
+		deposit.Wallet,
+		deposit.Currency,
+		deposit.Amount,
+		store.chain,
+		markCredited,
+	);
+
+	if err == errAlreadyCredited {
+		return false, decimal.Zero, nil;
+	}
+
+	if err != nil {
+		return false, decimal.Zero, err;
+	}
+
+	return true, balance, nil;
+}
+
+func (store *SqlStore) Revert(deposit *Deposit) (bool, error) {
+	return store.setStatus(store.db.Exec, deposit, STATUS_REVERTED);
+}
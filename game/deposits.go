@@ -0,0 +1,54 @@
+package game
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/deposits"
+);
+
+const (
+	EVENT_DEPOSIT_PENDING   = "DepositPending";
+	EVENT_DEPOSIT_CONFIRMED = "DepositConfirmed";
+	EVENT_DEPOSIT_REVERTED  = "DepositReverted";
+);
+
+func depositPayload(deposit *deposits.Deposit) map[string]any {
+	return map[string]any{
+		"chain"        : deposit.Chain,
+		"currency"     : deposit.Currency,
+		"amount"       : deposit.Amount.String(),
+		"txHash"       : deposit.TxHash.Hex(),
+		"block"        : deposit.BlockNumber,
+		"confirmations": deposit.Confirmations,
+		"required"     : deposit.Required,
+	};
+}
+
+/**
+ * Implements deposits.Listener.
+ */
+func (game *Game) DepositPending(deposit *deposits.Deposit) {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.emitToWallet(deposit.Wallet, EVENT_DEPOSIT_PENDING, depositPayload(deposit));
+}
+
+func (game *Game) DepositConfirmed(deposit *deposits.Deposit, newBalance decimal.Decimal) {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.emitWalletBalance(deposit.Wallet, deposit.Currency, newBalance);
+	game.emitToWallet(deposit.Wallet, EVENT_DEPOSIT_CONFIRMED, depositPayload(deposit));
+}
+
+/**
+ * The deposit was never credited, so there is no balance to restore;
+ * the client only needs to drop it from its pending list.
+ */
+func (game *Game) DepositReverted(deposit *deposits.Deposit) {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.emitToWallet(deposit.Wallet, EVENT_DEPOSIT_REVERTED, depositPayload(deposit));
+}
@@ -0,0 +1,222 @@
+package game
+
+import (
+	"errors"
+
+	"cloud.google.com/go/logging"
+	"github.com/shopspring/decimal"
+);
+
+var (
+	ErrBetTooLarge = errors.New("bet exceeds maximum for current bankroll")
+	ErrExposureLimitReached = errors.New("house exposure limit reached")
+)
+
+/**
+ * Returns the largest payout allowed for a single bet, derived from
+ * the current bankroll. A zero MaxWinFraction disables the cap, as
+ * does a bankroll the house has never funded, which is signalled by
+ * returning false.
+ */
+func (game *Game) getMaxWin(currency string) (decimal.Decimal, bool, error) {
+	fraction := game.config.Bankroll.MaxWinFraction;
+
+	if fraction.IsZero() {
+		return decimal.Zero, false, nil;
+	}
+
+	bankroll, funded, err := game.bank.GetBankroll(currency);
+
+	if err != nil || !funded {
+		return decimal.Zero, false, err;
+	}
+
+	return decimal.Max(bankroll, decimal.Zero).Mul(fraction), true, nil;
+}
+
+/**
+ * Caps payout at the max win, though never below the stake, so that a
+ * bankroll that shrank after the bet was placed cannot turn a win into
+ * a loss. Returns whether the cap applied.
+ */
+func capPayout(
+	payout decimal.Decimal,
+	betAmount decimal.Decimal,
+	maxWin decimal.Decimal,
+	hasMaxWin bool,
+) (decimal.Decimal, bool) {
+	if !hasMaxWin {
+		return payout, false;
+	}
+
+	limit := decimal.Max(maxWin, betAmount);
+
+	if payout.GreaterThan(limit) {
+		return limit, true;
+	}
+
+	return payout, false;
+}
+
+/**
+ * The most the house could have to pay for this bet. Bets without an
+ * auto cash-out are only bounded by the max win, so when that is
+ * disabled they count for their stake alone.
+ */
+func potentialPayout(
+	player *Player,
+	maxWin decimal.Decimal,
+	hasMaxWin bool,
+) decimal.Decimal {
+	if player.autoCashOut.IsZero() {
+		if hasMaxWin {
+			return decimal.Max(maxWin, player.betAmount);
+		}
+
+		return player.betAmount;
+	}
+
+	payout, _ := capPayout(
+		player.betAmount.Mul(player.autoCashOut),
+		player.betAmount,
+		maxWin,
+		hasMaxWin,
+	);
+
+	return payout;
+}
+
+/**
+ * Recalculates the potential payout of every open bet: those waiting
+ * for the next round and, while a round is running, those not yet
+ * cashed out. Both use the max win snapshotted for the current round,
+ * so that this does not go to the database on every bet.
+ */
+func (game *Game) updateExposure() {
+	exposure := make(map[string]decimal.Decimal);
+
+	for currency := range game.config.Currencies {
+		exposure[currency] = decimal.Zero;
+	}
+
+	for _, player := range game.waiting {
+		maxWin, hasMaxWin := game.maxWin[player.currency];
+
+		exposure[player.currency] = exposure[player.currency].Add(
+			potentialPayout(player, maxWin, hasMaxWin),
+		);
+	}
+
+	if game.state == GAMESTATE_RUNNING {
+		for _, player := range game.players {
+			if player.cashOut.cashedOut {
+				continue;
+			}
+
+			maxWin, hasMaxWin := game.maxWin[player.currency];
+
+			exposure[player.currency] = exposure[player.currency].Add(
+				potentialPayout(player, maxWin, hasMaxWin),
+			);
+		}
+	}
+
+	game.exposure = exposure;
+
+	game.logger.Log(logging.Entry{
+		Payload: Log{
+			"msg"     : "Updated exposure",
+			"game"    : game.id,
+			"exposure": exposure,
+		},
+		Severity: logging.Debug,
+	});
+}
+
+/**
+ * Snapshots the max win for each currency at the start of a round so
+ * that the cap does not move while players are in the game. A currency
+ * whose bankroll cannot be read is left uncapped for the round rather
+ * than capped at nothing.
+ */
+func (game *Game) snapshotMaxWin() {
+	game.maxWin = make(map[string]decimal.Decimal);
+
+	for currency := range game.config.Currencies {
+		maxWin, hasMaxWin, err := game.getMaxWin(currency);
+
+		if err != nil {
+			game.logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"     : "Failed to get bankroll",
+					"game"    : game.id,
+					"currency": currency,
+					"error"   : err,
+				},
+				Severity: logging.Error,
+			});
+
+			continue;
+		}
+
+		if hasMaxWin {
+			game.maxWin[currency] = maxWin;
+		}
+	}
+}
+
+func (game *Game) checkBetLimits(player *Player) error {
+	maxWin, hasMaxWin, err := game.getMaxWin(player.currency);
+
+	if err != nil {
+		return err;
+	}
+
+	if hasMaxWin && player.betAmount.GreaterThan(maxWin) {
+		return ErrBetTooLarge;
+	}
+
+	fraction := game.config.Bankroll.MaxExposureFraction;
+
+	if fraction.IsZero() {
+		return nil;
+	}
+
+	bankroll, funded, err := game.bank.GetBankroll(player.currency);
+
+	if err != nil || !funded {
+		return err;
+	}
+
+	limit := bankroll.Mul(fraction);
+	exposure := game.exposure[player.currency].Add(
+		potentialPayout(player, maxWin, hasMaxWin),
+	);
+
+	if exposure.GreaterThan(limit) {
+		return ErrExposureLimitReached;
+	}
+
+	return nil;
+}
+
+/**
+ * The largest payout a bet in currency can currently win, or false if
+ * payouts are not capped.
+ */
+func (game *Game) GetMaxWin(currency string) (decimal.Decimal, bool, error) {
+	return game.getMaxWin(currency);
+}
+
+func (game *Game) GetExposure() map[string]decimal.Decimal {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	exposure := make(map[string]decimal.Decimal);
+
+	for currency, amount := range game.exposure {
+		exposure[currency] = amount;
+	}
+
+	return exposure;
+}
@@ -22,7 +22,9 @@ import (
 	"github.com/shopspring/decimal"
 	"github.com/zishang520/socket.io/v2/socket"
 
+	"github.com/samott/crash-backend/bank"
 	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/payouts"
 );
 
 var (
@@ -49,8 +51,21 @@ const (
 	EVENT_GAME_CRASHED = "GameCrashed";
 	EVENT_PLAYER_WON   = "PlayerWon";
 	EVENT_PLAYER_LOST  = "PlayerLost";
+	EVENT_TIP_RECEIVED = "TipReceived";
+	EVENT_PLAYER_TIPPED = "PlayerTipped";
+	EVENT_PAYOUT_PENDING = "PayoutPending";
+	EVENT_PAYOUT_COMPLETED = "PayoutCompleted";
+	EVENT_GAME_PAUSED = "GamePaused";
+	EVENT_PAYOUT_CAPPED = "PayoutCapped";
 );
 
+var stateNames = map[uint]string{
+	GAMESTATE_STOPPED: "stopped",
+	GAMESTATE_WAITING: "waiting",
+	GAMESTATE_RUNNING: "running",
+	GAMESTATE_CRASHED: "crashed",
+};
+
 type Log = map[string]any;
 
 type Bank interface {
@@ -70,6 +85,29 @@ type Bank interface {
 		uuid.UUID,
 	) (decimal.Decimal, error);
 
+	TransferBalance(
+		string,
+		string,
+		string,
+		decimal.Decimal,
+		string,
+		uuid.UUID,
+		bank.TxCallback,
+	) (decimal.Decimal, decimal.Decimal, error);
+
+	SettleStakes([]bank.Stake, uuid.UUID) ([]bank.StakeResult, error);
+
+	PayWinnings(
+		string,
+		string,
+		decimal.Decimal,
+		string,
+		uuid.UUID,
+		bank.TxCallback,
+	) (decimal.Decimal, error);
+
+	GetBankroll(string) (decimal.Decimal, bool, error);
+
 	GetBalance(string, string) (decimal.Decimal, error);
 
 	GetBalances(wallet string) (map[string]decimal.Decimal, error);
@@ -111,12 +149,25 @@ type Game struct {
 	logger *logging.Logger;
 	config *config.CrashConfig;
 	bank Bank;
+	exposure map[string]decimal.Decimal;
+	maxWin map[string]decimal.Decimal;
 	startTime time.Time;
 	endTime time.Time;
 	duration time.Duration;
+	paused bool;
 	lock *sync.Mutex;
 };
 
+type Status struct {
+	Id uuid.UUID `json:"id"`;
+	State string `json:"state"`;
+	Paused bool `json:"paused"`;
+	Players int `json:"players"`;
+	Waiting int `json:"waiting"`;
+	Observers int `json:"observers"`;
+	StartTime time.Time `json:"startTime"`;
+};
+
 type CrashedGame struct {
 	id uuid.UUID;
 	startTime time.Time;
@@ -161,7 +212,7 @@ func NewGame(
 		return nil, err;
 	}
 
-	return &Game{
+	game := &Game{
 		id: gameId,
 		io: io,
 		db: db,
@@ -169,10 +220,16 @@ func NewGame(
 		logger: logger,
 		bank: bank,
 		observers: make(map[socket.SocketId]*Observer),
+		exposure: make(map[string]decimal.Decimal),
+		maxWin: make(map[string]decimal.Decimal),
 		players: make([]*Player, 0),
 		waiting: make([]*Player, 0),
 		lock: &sync.Mutex{},
-	}, nil;
+	};
+
+	game.snapshotMaxWin();
+
+	return game, nil;
 }
 
 func (game *Game) GetConfig() (*config.CrashConfig) {
@@ -272,9 +329,63 @@ func (game *Game) handleCreateNewGame() {
 	game.lock.Lock();
 	defer game.lock.Unlock();
 
+	if game.paused {
+		game.logger.Log(logging.Entry{
+			Payload: Log{
+				"msg": "Game paused; not creating a new round",
+			},
+			Severity: logging.Notice,
+		});
+
+		game.state = GAMESTATE_STOPPED;
+		game.Emit(EVENT_GAME_PAUSED, map[string]any{});
+		return;
+	}
+
 	game.createNewGame();
 }
 
+/**
+ * Stops new rounds from being created. A round already waiting or
+ * running plays out as normal.
+ */
+func (game *Game) Pause() {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.paused = true;
+}
+
+/**
+ * Lets rounds be created again, starting one straight away if anyone
+ * is watching.
+ */
+func (game *Game) Resume() {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.paused = false;
+
+	if game.state == GAMESTATE_STOPPED && len(game.observers) > 0 {
+		game.createNewGame();
+	}
+}
+
+func (game *Game) GetStatus() Status {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	return Status{
+		Id: game.id,
+		State: stateNames[game.state],
+		Paused: game.paused,
+		Players: len(game.players),
+		Waiting: len(game.waiting),
+		Observers: len(game.observers),
+		StartTime: game.startTime,
+	};
+}
+
 func (game *Game) handleGameStart() {
 	game.lock.Lock();
 	defer game.lock.Unlock();
@@ -357,6 +468,8 @@ func (game *Game) handleGameCrash() {
 
 	game.state = GAMESTATE_CRASHED;
 
+	game.updateExposure();
+
 	for i := range(game.players) {
 		game.Emit(EVENT_PLAYER_LOST, map[string]any{
 			"wallet": game.players[i].wallet,
@@ -396,7 +509,7 @@ func (game *Game) handleGameCrash() {
 }
 
 func (game *Game) HandlePlaceBet(
-	client *socket.Socket,
+	clientId socket.SocketId,
 	wallet string,
 	currency string,
 	betAmount decimal.Decimal,
@@ -410,7 +523,7 @@ func (game *Game) HandlePlaceBet(
 		betAmount: betAmount,
 		currency: currency,
 		autoCashOut: autoCashOut,
-		clientId: client.Id(),
+		clientId: clientId,
 	};
 
 	for i := range(game.waiting) {
@@ -461,8 +574,25 @@ func (game *Game) HandlePlaceBet(
 		return err;
 	}
 
+	if err := game.checkBetLimits(&player); err != nil {
+		game.logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"      : "Bet rejected by bankroll limits",
+				"wallet"   : wallet,
+				"betAmount": betAmount,
+				"currency" : currency,
+				"error"    : err,
+			},
+			Severity: logging.Warning,
+		});
+
+		return err;
+	}
+
 	game.waiting = append(game.waiting, &player);
 
+	game.updateExposure();
+
 	game.emitBetList();
 
 	return nil;
@@ -482,6 +612,8 @@ func (game *Game) HandleCancelBet(wallet string) error {
 
 	game.waiting = slices.Delete(game.waiting, playerIndex, playerIndex + 1);
 
+	game.updateExposure();
+
 	game.emitBetList();
 
 	return nil;
@@ -521,6 +653,10 @@ func (game *Game) handleCashOut(wallet string, auto bool) error {
 		player.betAmount,
 	);
 
+	uncapped := payout;
+	maxWin, hasMaxWin := game.maxWin[player.currency];
+	payout, capped := capPayout(payout, player.betAmount, maxWin, hasMaxWin);
+
 	game.logger.Log(logging.Entry{
 		Payload: Log{
 			"msg"      : "Player cashed out",
@@ -549,37 +685,117 @@ func (game *Game) handleCashOut(wallet string, auto bool) error {
 		reason = "Cashout";
 	}
 
-	newBalance, err := game.bank.IncreaseBalance(
+	newBalance, err := game.bank.PayWinnings(
 		player.wallet,
 		player.currency,
 		payout,
 		reason,
 		game.id,
+		nil,
+	);
+
+	game.updateExposure();
+
+	if err == nil {
+		game.emitBalanceUpdate(player, newBalance);
+	} else {
+		err = game.queuePayout(player, payout, reason, err);
+	}
+
+	if capped {
+		game.emitToWallet(player.wallet, EVENT_PAYOUT_CAPPED, map[string]any{
+			"game"    : game.id.String(),
+			"currency": player.currency,
+			"payout"  : uncapped.String(),
+			"maxWin"  : payout.String(),
+		});
+	}
+
+	game.Emit(EVENT_PLAYER_WON, map[string]any{
+		"wallet"    : player.wallet,
+		"multiplier": multiplier,
+		"capped"    : capped,
+	});
+
+	return err;
+}
+
+/**
+ * Records a win that could not be credited so that it is retried in
+ * the background, and lets the player know it is on its way. If even
+ * that fails the win is recorded nowhere, and the error is returned.
+ */
+func (game *Game) queuePayout(
+	player *Player,
+	payout decimal.Decimal,
+	reason string,
+	cause error,
+) error {
+	game.logger.Log(logging.Entry{
+		Payload: Log{
+			"msg"     : "Failed to credit win; queueing for retry",
+			"game"    : game.id,
+			"wallet"  : player.wallet,
+			"payout"  : payout,
+			"currency": player.currency,
+			"error"   : cause,
+		},
+		Severity: logging.Error,
+	});
+
+	payoutId, err := payouts.Enqueue(
+		game.db,
+		player.wallet,
+		player.currency,
+		payout,
+		reason,
+		game.id,
+		cause,
 	);
 
 	if err != nil {
 		game.logger.Log(logging.Entry{
 			Payload: Log{
-				"msg"     : "Failed to credit win",
+				"msg"     : "Failed to queue payout",
 				"game"    : game.id,
 				"wallet"  : player.wallet,
 				"payout"  : payout,
 				"currency": player.currency,
+				"error"   : err,
 			},
-			Severity: logging.Error,
+			Severity: logging.Critical,
 		});
-	}
 
-	game.emitBalanceUpdate(player, newBalance);
+		return err;
+	}
 
-	game.Emit(EVENT_PLAYER_WON, map[string]any{
-		"wallet"    : player.wallet,
-		"multiplier": multiplier,
+	game.emitToWallet(player.wallet, EVENT_PAYOUT_PENDING, map[string]any{
+		"id"      : payoutId,
+		"game"    : game.id.String(),
+		"currency": player.currency,
+		"amount"  : payout.String(),
 	});
 
 	return nil;
 }
 
+/**
+ * Called by the payout worker once a queued payout has been credited.
+ */
+func (game *Game) HandlePayoutCompleted(payout *payouts.Payout, newBalance decimal.Decimal) {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.emitWalletBalance(payout.Wallet, payout.Currency, newBalance);
+
+	game.emitToWallet(payout.Wallet, EVENT_PAYOUT_COMPLETED, map[string]any{
+		"id"      : payout.Id,
+		"game"    : payout.GameId.String(),
+		"currency": payout.Currency,
+		"amount"  : payout.Amount.String(),
+	});
+}
+
 func (game *Game) HandleConnect(client *socket.Socket) {
 	game.lock.Lock();
 	defer game.lock.Unlock();
@@ -603,6 +819,11 @@ func (game *Game) HandleConnect(client *socket.Socket) {
 		});
 	}
 
+	if game.state == GAMESTATE_STOPPED && game.paused {
+		observer.socket.Emit(EVENT_GAME_PAUSED, map[string]any{});
+		return;
+	}
+
 	if game.state == GAMESTATE_STOPPED {
 		game.logger.Log(logging.Entry{
 			Payload: Log{
@@ -646,6 +867,21 @@ func (game *Game) HandleLogin(client *socket.Socket, wallet string) {
 	observer.socket.Emit("InitBalances", map[string]map[string]decimal.Decimal{
 		"balances" : balances,
 	});
+
+	pending, err := payouts.ListPending(game.db, wallet);
+
+	if err != nil || len(pending) == 0 {
+		return;
+	}
+
+	for _, payout := range pending {
+		observer.socket.Emit(EVENT_PAYOUT_PENDING, map[string]any{
+			"id"      : payout.Id,
+			"game"    : payout.GameId.String(),
+			"currency": payout.Currency,
+			"amount"  : payout.Amount.String(),
+		});
+	}
 }
 
 func (game *Game) HandleDisconnect(client *socket.Socket) {
@@ -673,16 +909,34 @@ func (game *Game) clearTimers() {
 func (game *Game) commitWaiting() {
 	game.players = []*Player{};
 
+	game.snapshotMaxWin();
+
+	stakes := make([]bank.Stake, len(game.waiting));
+
 	for i := range(game.waiting) {
-		newBalance, err := game.bank.DecreaseBalance(
-			game.waiting[i].wallet,
-			game.waiting[i].currency,
-			game.waiting[i].betAmount,
-			"Bet placed",
-			game.id,
-		);
+		stakes[i] = bank.Stake{
+			Wallet: game.waiting[i].wallet,
+			Currency: game.waiting[i].currency,
+			Amount: game.waiting[i].betAmount,
+		};
+	}
 
-		if err != nil {
+	results, err := game.bank.SettleStakes(stakes, game.id);
+
+	if err != nil {
+		game.logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"    : "Unable to settle stakes; starting without players...",
+				"game"   : game.id,
+				"waiting": len(game.waiting),
+				"error"  : err,
+			},
+			Severity: logging.Error,
+		});
+	}
+
+	for i := range(results) {
+		if results[i].Err != nil {
 			game.logger.Log(logging.Entry{
 				Payload: Log{
 					"msg"   : "Unable to take balance for user; removing from game...",
@@ -695,13 +949,15 @@ func (game *Game) commitWaiting() {
 			continue;
 		}
 
-		game.emitBalanceUpdate(game.waiting[i], newBalance);
+		game.emitBalanceUpdate(game.waiting[i], results[i].Balance);
 
 		game.players = append(game.players, game.waiting[i]);
 	}
 
 	game.waiting = []*Player{};
 
+	game.updateExposure();
+
 	game.emitBetList();
 }
 
@@ -794,11 +1050,11 @@ func (game *Game) saveRecord() (*CrashedGame, error) {
 
 	_, err := game.db.Exec(`
 		INSERT INTO games
-		(id, startTime, endTime, multiplier, playerCount, winnerCount)
+		(id, startTime, endTime, multiplier, playerCount, winnerCount, hash)
 		VALUES
-		(?, ?, ?, ?, ?, ?)
+		(?, ?, ?, ?, ?, ?, ?)
 	`, game.id, game.startTime, game.endTime, multiplier,
-		players, winners);
+		players, winners, game.hash);
 
 	if err != nil {
 		return nil, err;
@@ -827,6 +1083,21 @@ func (game *Game) emitBalanceUpdate(player *Player, newBalance decimal.Decimal)
 	}
 }
 
+func (game *Game) emitToWallet(wallet string, ev string, params ...any) {
+	for _, observer := range game.observers {
+		if observer.wallet == wallet && observer.socket.Connected() {
+			observer.socket.Emit(ev, params...);
+		}
+	}
+}
+
+func (game *Game) emitWalletBalance(wallet string, currency string, newBalance decimal.Decimal) {
+	game.emitToWallet(wallet, "UpdateBalance", map[string]string{
+		"currency": currency,
+		"balance" : newBalance.String(),
+	});
+}
+
 func (game *Game) emitBetList() {
 	game.Emit("BetList", map[string]any{
 		"players": game.players,
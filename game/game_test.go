@@ -1,7 +1,11 @@
 package game
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log"
+	"strings"
 	"testing"
 
 	"github.com/samott/crash-backend/bank"
@@ -9,11 +13,41 @@ import (
 
 	"database/sql"
 
+	"cloud.google.com/go/logging"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/go-sql-driver/mysql"
 	"github.com/shopspring/decimal"
+	"github.com/zishang520/socket.io/v2/socket"
+	"google.golang.org/api/option"
 )
 
 var gameObj *Game;
+var testConfig *config.CrashConfig;
+var testLogger *logging.Logger;
+var testDb *sql.DB;
+var testBank *bank.Bank;
+
+/**
+ * Only answers what placing a bet asks of the bank.
+ */
+type stubBank struct {
+	Bank;
+	balance decimal.Decimal;
+	bankroll decimal.Decimal;
+	funded bool;
+	err error;
+	bankrollReads int;
+}
+
+func (stub *stubBank) GetBalance(string, string) (decimal.Decimal, error) {
+	return stub.balance, nil;
+}
+
+func (stub *stubBank) GetBankroll(string) (decimal.Decimal, bool, error) {
+	stub.bankrollReads++;
+
+	return stub.bankroll, stub.funded, stub.err;
+}
 
 func init() {
 	config, err := config.LoadConfig("../crash_test.yaml");
@@ -36,13 +70,29 @@ func init() {
 		return;
 	}
 
-	bankObj, err := bank.NewBank(db);
+	client, err := logging.NewClient(
+		context.Background(),
+		"projects/test",
+		option.WithoutAuthentication(),
+	);
+
+	if err != nil {
+		log.Fatal("failed to create logging client: ", err);
+	}
+
+	testConfig = config;
+	testLogger = client.Logger("test", logging.RedirectAsJSON(io.Discard));
+
+	bankObj, err := bank.NewBank(db, config);
 
 	if err != nil {
 		log.Fatal("bank construction failed: ", err);
 	}
 
-	gameObj, err = NewGame(nil, db, config, nil, Bank(bankObj));
+	testDb = db;
+	testBank = bankObj;
+
+	gameObj, err = NewGame(nil, db, config, testLogger, Bank(bankObj));
 
 	if err != nil {
 		log.Fatal("game construction failed: ", err);
@@ -79,3 +129,262 @@ func TestHashCalculations(t *testing.T) {
 		t.Fatalf("multiplierToDuration() result is incorrect: %d", duration);
 	}
 }
+
+func TestPotentialPayout(t *testing.T) {
+	player := Player{
+		betAmount: decimal.NewFromInt(2),
+		autoCashOut: decimal.NewFromFloat(1.5),
+	};
+
+	if payout := potentialPayout(&player, decimal.Zero, false); !payout.Equal(decimal.NewFromInt(3)) {
+		t.Fatalf("potentialPayout() result is incorrect: %s", payout);
+	}
+
+	if payout := potentialPayout(&player, decimal.NewFromFloat(2.5), true); !payout.Equal(decimal.NewFromFloat(2.5)) {
+		t.Fatalf("potentialPayout() ignored max win: %s", payout);
+	}
+
+	player.autoCashOut = decimal.Zero;
+
+	if payout := potentialPayout(&player, decimal.NewFromInt(5), true); !payout.Equal(decimal.NewFromInt(5)) {
+		t.Fatalf("potentialPayout() result is incorrect without auto cash-out: %s", payout);
+	}
+
+	if payout := potentialPayout(&player, decimal.NewFromInt(1), true); !payout.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("potentialPayout() went below the stake: %s", payout);
+	}
+}
+
+func TestCapPayout(t *testing.T) {
+	bet := decimal.NewFromInt(2);
+
+	if payout, capped := capPayout(decimal.NewFromInt(10), bet, decimal.NewFromInt(5), true); !capped || !payout.Equal(decimal.NewFromInt(5)) {
+		t.Fatalf("capPayout() did not cap at max win: %s", payout);
+	}
+
+	if payout, capped := capPayout(decimal.NewFromInt(10), bet, decimal.Zero, true); !capped || !payout.Equal(bet) {
+		t.Fatalf("capPayout() capped below the stake: %s", payout);
+	}
+
+	if payout, capped := capPayout(decimal.NewFromInt(10), bet, decimal.Zero, false); capped || !payout.Equal(decimal.NewFromInt(10)) {
+		t.Fatalf("capPayout() capped without a max win: %s", payout);
+	}
+}
+
+func TestSnapshotMaxWin(t *testing.T) {
+	stub := &stubBank{ balance: decimal.NewFromInt(10), bankroll: decimal.NewFromInt(500), funded: true };
+	game, err := NewGame(nil, nil, testConfig, testLogger, stub);
+
+	if err != nil {
+		t.Fatal("Failed to create game: ", err);
+	}
+
+	if maxWin, ok := game.maxWin["eth"]; !ok || !maxWin.Equal(decimal.NewFromInt(5)) {
+		t.Fatal("Unexpected max win snapshot: ", maxWin);
+	}
+
+	reads := stub.bankrollReads;
+
+	err = game.HandlePlaceBet(
+		socket.SocketId("a"),
+		"0x0000000000000000000000000000000000000001",
+		"eth",
+		decimal.NewFromInt(1),
+		decimal.Zero,
+	);
+
+	if err != nil {
+		t.Fatal("Bet rejected: ", err);
+	}
+
+	if !game.GetExposure()["eth"].Equal(decimal.NewFromInt(5)) {
+		t.Fatal("Unexpected exposure: ", game.GetExposure()["eth"]);
+	}
+
+	// Only the bet's own limit check reads the bankroll.
+	if stub.bankrollReads - reads != 2 {
+		t.Fatal("Unexpected bankroll reads placing a bet: ", stub.bankrollReads - reads);
+	}
+
+	reads = stub.bankrollReads;
+
+	if err := game.HandleCancelBet("0x0000000000000000000000000000000000000001"); err != nil {
+		t.Fatal("Failed to cancel bet: ", err);
+	}
+
+	if stub.bankrollReads != reads {
+		t.Fatal("Bankroll read while updating exposure");
+	}
+
+	// A bankroll that cannot be read leaves the round uncapped.
+	stub.err = errors.New("unavailable");
+	game.snapshotMaxWin();
+
+	if _, ok := game.maxWin["eth"]; ok {
+		t.Fatal("Max win applied despite bankroll error");
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	if status := gameObj.GetStatus(); status.State != "stopped" || status.Paused {
+		t.Fatal("Unexpected initial status: ", status);
+	}
+
+	gameObj.Pause();
+
+	if !gameObj.GetStatus().Paused {
+		t.Fatal("Game not paused");
+	}
+
+	// Nobody is watching, so resuming does not start a round.
+	gameObj.Resume();
+
+	if status := gameObj.GetStatus(); status.Paused || status.State != "stopped" {
+		t.Fatal("Unexpected status after resume: ", status);
+	}
+}
+
+func TestBetOnUnfundedBankroll(t *testing.T) {
+	stub := &stubBank{ balance: decimal.NewFromInt(10) };
+	game, err := NewGame(nil, nil, testConfig, testLogger, stub);
+
+	if err != nil {
+		t.Fatal("Failed to create game: ", err);
+	}
+
+	// A fresh deployment: nothing in the bankroll and never funded.
+	err = game.HandlePlaceBet(
+		socket.SocketId("a"),
+		"0x0000000000000000000000000000000000000001",
+		"eth",
+		decimal.NewFromInt(1),
+		decimal.NewFromInt(2),
+	);
+
+	if err != nil {
+		t.Fatal("Bet on unfunded bankroll rejected: ", err);
+	}
+
+	if _, hasMaxWin, _ := game.GetMaxWin("eth"); hasMaxWin {
+		t.Fatal("Max win applied to unfunded bankroll");
+	}
+
+	// Once funded, the limits apply.
+	stub.bankroll, stub.funded = decimal.NewFromInt(50), true;
+
+	err = game.HandlePlaceBet(
+		socket.SocketId("b"),
+		"0x0000000000000000000000000000000000000002",
+		"eth",
+		decimal.NewFromInt(1),
+		decimal.NewFromInt(2),
+	);
+
+	if err != ErrBetTooLarge {
+		t.Fatal("Bet above max win accepted: ", err);
+	}
+}
+
+func newTipWallets(t *testing.T, balance string) (string, string) {
+	sender, err := crypto.GenerateKey();
+
+	if err != nil {
+		t.Fatal("Failed to generate key: ", err);
+	}
+
+	recipient, err := crypto.GenerateKey();
+
+	if err != nil {
+		t.Fatal("Failed to generate key: ", err);
+	}
+
+	from := crypto.PubkeyToAddress(sender.PublicKey).String();
+	to := crypto.PubkeyToAddress(recipient.PublicKey).String();
+
+	_, err = testDb.Exec(`
+		INSERT INTO balances
+		(currency, balance, wallet)
+		VALUES
+		(?, ?, ?)
+	`, "eth", balance, from);
+
+	if err != nil {
+		t.Fatal("Failed to insert balance: ", err);
+	}
+
+	return from, to;
+}
+
+func TestTipRules(t *testing.T) {
+	from, to := newTipWallets(t, "5");
+
+	err := gameObj.HandleTip(from, strings.ToLower(from), "eth", decimal.RequireFromString("0.01"));
+
+	if err != ErrTipToSelf {
+		t.Fatal("Tip to self allowed: ", err);
+	}
+
+	err = gameObj.HandleTip(from, to, "eth", decimal.RequireFromString("0.0005"));
+
+	if err != ErrTipBelowMinimum {
+		t.Fatal("Tip below minimum allowed: ", err);
+	}
+
+	err = gameObj.HandleTip(from, to, "eth", decimal.RequireFromString("-1"));
+
+	if err != ErrTipBelowMinimum {
+		t.Fatal("Negative tip allowed: ", err);
+	}
+
+	disabled := *testConfig;
+	disabled.Tips.Enabled = false;
+
+	game, err := NewGame(nil, testDb, &disabled, testLogger, Bank(testBank));
+
+	if err != nil {
+		t.Fatal("Failed to create game: ", err);
+	}
+
+	err = game.HandleTip(from, to, "eth", decimal.RequireFromString("0.01"));
+
+	if err != ErrTipsDisabled {
+		t.Fatal("Tip allowed while disabled: ", err);
+	}
+
+	balance, err := testBank.GetBalance(from, "eth");
+
+	if err != nil || !balance.Equal(decimal.NewFromInt(5)) {
+		t.Fatal("Refused tips changed the balance: ", balance, err);
+	}
+}
+
+func TestTipDailyCap(t *testing.T) {
+	from, to := newTipWallets(t, "5");
+
+	if err := gameObj.HandleTip(from, to, "eth", decimal.RequireFromString("0.6")); err != nil {
+		t.Fatal("Tip failed: ", err);
+	}
+
+	// The cap is 1 eth a day.
+	err := gameObj.HandleTip(from, to, "eth", decimal.RequireFromString("0.6"));
+
+	if err != ErrTipDailyCapExceeded {
+		t.Fatal("Tip above daily cap allowed: ", err);
+	}
+
+	if err := gameObj.HandleTip(from, to, "eth", decimal.RequireFromString("0.4")); err != nil {
+		t.Fatal("Tip up to the daily cap failed: ", err);
+	}
+
+	sent, err := testBank.GetBalance(from, "eth");
+
+	if err != nil || !sent.Equal(decimal.NewFromInt(4)) {
+		t.Fatal("Sender balance is incorrect: ", sent, err);
+	}
+
+	received, err := testBank.GetBalance(to, "eth");
+
+	if err != nil || !received.Equal(decimal.NewFromInt(1)) {
+		t.Fatal("Recipient balance is incorrect: ", received, err);
+	}
+}
@@ -0,0 +1,157 @@
+package game
+
+import (
+	"errors"
+	"strings"
+
+	"database/sql"
+
+	"cloud.google.com/go/logging"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+);
+
+var (
+	ErrTipsDisabled = errors.New("tipping is disabled")
+	ErrTipToSelf = errors.New("cannot tip own wallet")
+	ErrTipBelowMinimum = errors.New("tip below minimum amount")
+	ErrTipDailyCapExceeded = errors.New("tip exceeds daily cap")
+)
+
+/**
+ * Moves amount from wallet to recipient. The daily cap is checked
+ * inside the bank transaction, after the sender's balance row has been
+ * locked, so concurrent tips from the same wallet cannot exceed it.
+ * The game lock is only taken to notify players, so that tips do not
+ * hold up the game loop.
+ */
+func (game *Game) HandleTip(
+	wallet string,
+	recipient string,
+	currency string,
+	amount decimal.Decimal,
+) error {
+	if !game.config.Tips.Enabled {
+		return ErrTipsDisabled;
+	}
+
+	if strings.EqualFold(wallet, recipient) {
+		return ErrTipToSelf;
+	}
+
+	limits, hasLimits := game.config.Tips.Limits[currency];
+
+	if !amount.IsPositive() || (hasLimits && amount.LessThan(limits.Min)) {
+		return ErrTipBelowMinimum;
+	}
+
+	tipId, err := uuid.NewV7();
+
+	if err != nil {
+		return err;
+	}
+
+	recordTip := func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO tips
+			(id, sender, recipient, currency, amount)
+			VALUES
+			(?, ?, ?, ?, CAST(? AS Decimal(32, 18)))
+		`, tipId.String(), wallet, recipient, currency, amount.String());
+
+		if err != nil {
+			return err;
+		}
+
+		if !hasLimits || limits.DailyCap.IsZero() {
+			return nil;
+		}
+
+		var totalStr string;
+
+		err = tx.QueryRow(`
+			SELECT COALESCE(SUM(amount), 0)
+			FROM tips
+			WHERE sender = ?
+			AND currency = ?
+			AND created > NOW(3) - INTERVAL 1 DAY
+		`, wallet, currency).Scan(&totalStr);
+
+		if err != nil {
+			return err;
+		}
+
+		total, err := decimal.NewFromString(totalStr);
+
+		if err != nil {
+			return err;
+		}
+
+		if total.GreaterThan(limits.DailyCap) {
+			return ErrTipDailyCapExceeded;
+		}
+
+		return nil;
+	};
+
+	senderBalance, recipientBalance, err := game.bank.TransferBalance(
+		wallet,
+		recipient,
+		currency,
+		amount,
+		"Tip",
+		tipId,
+		recordTip,
+	);
+
+	if err != nil {
+		game.logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"      : "Failed to transfer tip",
+				"wallet"   : wallet,
+				"recipient": recipient,
+				"amount"   : amount,
+				"currency" : currency,
+				"error"    : err,
+			},
+			Severity: logging.Warning,
+		});
+
+		return err;
+	}
+
+	game.logger.Log(logging.Entry{
+		Payload: Log{
+			"msg"      : "Player tipped",
+			"tip"      : tipId,
+			"wallet"   : wallet,
+			"recipient": recipient,
+			"amount"   : amount,
+			"currency" : currency,
+		},
+		Severity: logging.Info,
+	});
+
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.emitWalletBalance(wallet, currency, senderBalance);
+	game.emitWalletBalance(recipient, currency, recipientBalance);
+
+	game.emitToWallet(recipient, EVENT_TIP_RECEIVED, map[string]any{
+		"from"    : wallet,
+		"currency": currency,
+		"amount"  : amount.String(),
+	});
+
+	if game.config.Tips.Announce {
+		game.Emit(EVENT_PLAYER_TIPPED, map[string]any{
+			"from"    : wallet,
+			"to"      : recipient,
+			"currency": currency,
+			"amount"  : amount.String(),
+		});
+	}
+
+	return nil;
+}
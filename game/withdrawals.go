@@ -0,0 +1,57 @@
+package game
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+const (
+	EVENT_WITHDRAWAL_STATUS = "WithdrawalStatus";
+);
+
+/**
+ * Implements withdrawals.Listener.
+ */
+func (game *Game) WithdrawalStatusChanged(withdrawal *withdrawals.Withdrawal) {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	game.emitWithdrawalStatus(withdrawal);
+}
+
+func (game *Game) WithdrawalRefunded(
+	withdrawal *withdrawals.Withdrawal,
+	newBalances map[string]decimal.Decimal,
+) {
+	game.lock.Lock();
+	defer game.lock.Unlock();
+
+	for currency, balance := range newBalances {
+		game.emitWalletBalance(withdrawal.Wallet, currency, balance);
+	}
+
+	game.emitWithdrawalStatus(withdrawal);
+}
+
+func (game *Game) emitWithdrawalStatus(withdrawal *withdrawals.Withdrawal) {
+	payload := map[string]any{
+		"id"         : withdrawal.Id,
+		"chain"      : withdrawal.Chain,
+		"nonce"      : withdrawal.Nonce,
+		"currency"   : withdrawal.Currency,
+		"amount"     : withdrawal.Amount.String(),
+		"tasks"      : withdrawal.Tasks,
+		"status"     : withdrawal.Status,
+		"txHash"     : withdrawal.TxHash,
+		"blockNumber": withdrawal.BlockNumber,
+	};
+
+	// An approved withdrawal is the player's first sight of the voucher.
+	if withdrawal.Status == withdrawals.STATUS_ISSUED && withdrawal.Signature != "" {
+		payload["request"] = withdrawal.Request;
+		payload["signature"] = withdrawal.Signature;
+	}
+
+	game.emitToWallet(withdrawal.Wallet, EVENT_WITHDRAWAL_STATUS, payload);
+}
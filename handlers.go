@@ -4,33 +4,119 @@ import (
 	"net/http"
 	"encoding/json"
 	"database/sql"
+	"errors"
+	"strings"
 
+	"github.com/samott/crash-backend/anchor"
+	"github.com/samott/crash-backend/auth"
 	"github.com/samott/crash-backend/game"
 	"github.com/samott/crash-backend/bank"
 	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/rates"
+	"github.com/samott/crash-backend/signer"
+	"github.com/samott/crash-backend/solvency"
+	"github.com/samott/crash-backend/velocity"
+	"github.com/samott/crash-backend/withdrawals"
 	"github.com/zishang520/socket.io/v2/socket"
 	"cloud.google.com/go/logging"
-
-	"github.com/spruceid/siwe-go"
+	"github.com/google/uuid"
 );
 
-func nonceHttpHandler(w http.ResponseWriter, r *http.Request) {
-	var nonce = siwe.GenerateNonce();
-	var result, err = json.Marshal(map[string]string{
-		"nonce": nonce,
-	});
+/**
+ * Issues a nonce for a sign-in message. Passing the id of the client's
+ * socket as socket ties the nonce to that connection.
+ */
+func nonceHttpHandler(nonces *auth.NonceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := nonces.Issue(r.URL.Query().Get("socket"));
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return;
+		}
+
+		var result, _ = json.Marshal(map[string]string{
+			"nonce": nonce,
+		});
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(result);
+	};
+}
+
+/**
+ * Issues a nonce that can only be used to authenticate this socket.
+ */
+func nonceHandler(
+	client *socket.Socket,
+	nonces *auth.NonceStore,
+	logger *logging.Logger,
+	data ...any,
+) {
+	callback := extractCallback(0, data...);
+
+	if callback == nil {
+		return;
+	}
+
+	nonce, err := nonces.Issue(string(client.Id()));
 
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Error issuing nonce",
+				"client": client.Id(),
+				"error" : err,
+			},
+			Severity: logging.Error,
+		});
+
+		callback([]any{ map[string]any{ "success": false } }, nil);
 		return;
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(result);
+	callback([]any{ map[string]any{
+		"success": true,
+		"nonce": nonce,
+	} }, nil);
+}
+
+/**
+ * The Merkle proof tying a crashed round to a root published on-chain.
+ * Rounds not yet in a mined anchor get 503; try again later.
+ */
+func roundProofHttpHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roundId, err := uuid.Parse(r.URL.Query().Get("id"));
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest);
+			return;
+		}
+
+		proof, err := anchor.GetProof(db, roundId);
+
+		switch {
+		case errors.Is(err, anchor.ErrRoundNotFound):
+			w.WriteHeader(http.StatusNotFound);
+			return;
+		case errors.Is(err, anchor.ErrRoundNotAnchored):
+			w.WriteHeader(http.StatusServiceUnavailable);
+			return;
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		writeJson(w, proof);
+	};
 }
 
 func authenticateHandler(
 	client *socket.Socket,
+	verifier *auth.Verifier,
+	tokens *auth.Tokens,
+	sessions *auth.SessionStore,
 	logger *logging.Logger,
 	_ *game.Game,
 	data ...any,
@@ -59,24 +145,61 @@ func authenticateHandler(
 		return;
 	}
 
-	wallet, err := authenticateUser(params.message, params.signature);
+	wallet, err := verifier.Verify(params.message, params.signature, string(client.Id()));
 
 	if err != nil {
 		logger.Log(logging.Entry{
 			Payload: Log{
-				"msg"   : "Invalid signature",
+				"msg"   : "Sign-in rejected",
 				"client": client.Id(),
+				"error" : err,
 			},
 			Severity: logging.Warning,
 		});
 
 		client.Emit("authenticate", map[string]any{
 			"success": false,
+			"errorCode": auth.ErrorCode(err),
 		});
 		return;
 	}
 
-	token, err := generateToken(wallet);
+	session, refreshToken, err := sessions.Create(wallet);
+
+	if err == auth.ErrBanned {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Banned wallet tried to sign in",
+				"client": client.Id(),
+				"wallet": wallet,
+			},
+			Severity: logging.Warning,
+		});
+
+		client.Emit("authenticate", map[string]any{
+			"success": false,
+			"errorCode": auth.ErrorCode(err),
+		});
+		return;
+	}
+
+	if err != nil {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Error creating session",
+				"client": client.Id(),
+				"error" : err,
+			},
+			Severity: logging.Error,
+		});
+
+		client.Emit("authenticate", map[string]any{
+			"success": false,
+		});
+		return;
+	}
+
+	token, err := tokens.Issue(session);
 
 	if err != nil {
 		logger.Log(logging.Entry{
@@ -96,8 +219,9 @@ func authenticateHandler(
 
 	logger.Log(logging.Entry{
 		Payload: Log{
-			"msg"   : "Authentication successful",
-			"client": client.Id(),
+			"msg"    : "Authentication successful",
+			"client" : client.Id(),
+			"session": session.Id,
 		},
 		Severity: logging.Info,
 	});
@@ -106,6 +230,7 @@ func authenticateHandler(
 		callback(
 			[]any{ map[string]any{
 				"token": token,
+				"refreshToken": refreshToken,
 				"success": true,
 			} },
 			nil,
@@ -130,23 +255,62 @@ func disconnectedHandler(
 	gameObj.HandleDisconnect(client);
 };
 
+/**
+ * Swaps a refresh token for a new access token and refresh token. This
+ * does not need a login, since the access token may have expired.
+ */
 func refreshTokenHandler(
 	client *socket.Socket,
-	session Session,
+	sessions *auth.SessionStore,
+	tokens *auth.Tokens,
 	logger *logging.Logger,
-	_ *game.Game,
 	data ...any,
 ) {
-	logger.Log(logging.Entry{
-		Payload: Log{
-			"msg"   : "Refreshing JWT token",
-			"client": client.Id(),
-			"wallet": session.wallet,
-		},
-		Severity: logging.Info,
-	});
+	var params RefreshTokenParams;
+
+	callback, err := validateRefreshTokenParams(&params, data...);
+
+	if err != nil || callback == nil {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Invalid parameters",
+				"client": client.Id(),
+			},
+			Severity: logging.Warning,
+		});
+		return;
+	}
+
+	session, refreshToken, err := sessions.Refresh(params.refreshToken);
+
+	if err != nil {
+		severity := logging.Info;
+
+		// Someone else holds a copy of the token.
+		if err == auth.ErrRefreshReused {
+			severity = logging.Warning;
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Token refresh rejected",
+				"client": client.Id(),
+				"error" : err,
+			},
+			Severity: severity,
+		});
 
-	token, err := generateToken(session.wallet);
+		callback(
+			[]any{ map[string]any{
+				"success": false,
+				"errorCode": auth.ErrorCode(err),
+			} },
+			nil,
+		);
+		return;
+	}
+
+	token, err := tokens.Issue(session);
 
 	if err != nil {
 		logger.Log(logging.Entry{
@@ -158,24 +322,146 @@ func refreshTokenHandler(
 			Severity: logging.Error,
 		});
 
-		client.Emit("authenticate", map[string]any{
-			"success": false,
+		callback(
+			[]any{ map[string]any{
+				"success": false,
+			} },
+			nil,
+		);
+		return;
+	}
+
+	logger.Log(logging.Entry{
+		Payload: Log{
+			"msg"    : "Token refreshed",
+			"client" : client.Id(),
+			"wallet" : session.Wallet,
+			"session": session.Id,
+		},
+		Severity: logging.Info,
+	});
+
+	callback(
+		[]any{ map[string]any{
+			"token": token,
+			"refreshToken": refreshToken,
+			"success": true,
+		} },
+		nil,
+	);
+}
+
+/**
+ * Revokes the session the client logged in with and closes every
+ * connection using it.
+ */
+func logoutHandler(
+	client *socket.Socket,
+	session Session,
+	sessions *auth.SessionStore,
+	io *socket.Server,
+	logger *logging.Logger,
+	data ...any,
+) {
+	callback := extractCallback(0, data...);
+
+	if err := sessions.Revoke(session.id, auth.REVOKED_BY_LOGOUT); err != nil {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"    : "Failed to revoke session",
+				"client" : client.Id(),
+				"session": session.id,
+				"error"  : err,
+			},
+			Severity: logging.Error,
 		});
 
+		if callback != nil {
+			callback(
+				[]any{ map[string]any{
+					"success": false,
+				} },
+				nil,
+			);
+		}
 		return;
 	}
 
-	callback := extractCallback(0, data...);
+	logger.Log(logging.Entry{
+		Payload: Log{
+			"msg"    : "User logged out",
+			"wallet" : session.wallet,
+			"session": session.id,
+		},
+		Severity: logging.Info,
+	});
 
 	if callback != nil {
 		callback(
 			[]any{ map[string]any{
-				"token": token,
 				"success": true,
 			} },
 			nil,
 		);
 	}
+
+	disconnectSessions(io, session.id);
+}
+
+/**
+ * Revokes every session of the wallet whose access token is passed as
+ * a bearer token, closing their connections.
+ */
+func logoutEverywhereHttpHandler(
+	tokens *auth.Tokens,
+	sessions *auth.SessionStore,
+	io *socket.Server,
+	logger *logging.Logger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "POST");
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization");
+			w.WriteHeader(http.StatusNoContent);
+			return;
+		}
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed);
+			return;
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ");
+
+		var session Session;
+
+		if err := validateToken(tokens, sessions, token, &session); err != nil {
+			w.WriteHeader(http.StatusUnauthorized);
+			return;
+		}
+
+		ids, err := sessions.RevokeWallet(session.wallet, auth.REVOKED_BY_WALLET);
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError);
+			return;
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"     : "User logged out everywhere",
+				"wallet"  : session.wallet,
+				"sessions": len(ids),
+			},
+			Severity: logging.Notice,
+		});
+
+		disconnectSessions(io, ids...);
+
+		writeJson(w, map[string]any{
+			"revoked": len(ids),
+		});
+	};
 }
 
 func placeBetHandler(
@@ -212,13 +498,49 @@ func placeBetHandler(
 	}
 
 	err = gameObj.HandlePlaceBet(
-		client,
+		client.Id(),
 		session.wallet,
 		params.currency,
 		params.betAmount,
 		params.autoCashOut,
 	);
 
+	if callback == nil {
+		return;
+	}
+
+	result := map[string]any{
+		"success": err == nil,
+	};
+
+	if maxWin, hasMaxWin, err := gameObj.GetMaxWin(params.currency); err == nil && hasMaxWin {
+		result["maxWin"] = maxWin.String();
+	}
+
+	callback([]any{ result }, nil);
+}
+
+func cancelBetHandler(
+	client *socket.Socket,
+	session Session,
+	logger *logging.Logger,
+	gameObj *game.Game,
+	data ...any,
+) {
+	logger.Log(logging.Entry{
+		Payload: Log{
+			"msg"   : "CancelBet for user",
+			"client": client.Id(),
+			"wallet": session.wallet,
+			"params": data,
+		},
+		Severity: logging.Info,
+	});
+
+	err := gameObj.HandleCancelBet(session.wallet);
+
+	callback := extractCallback(0, data...);
+
 	if callback != nil {
 		callback(
 			[]any{ map[string]any{
@@ -229,7 +551,7 @@ func placeBetHandler(
 	}
 }
 
-func cancelBetHandler(
+func cashOutHandler(
 	client *socket.Socket,
 	session Session,
 	logger *logging.Logger,
@@ -238,7 +560,7 @@ func cancelBetHandler(
 ) {
 	logger.Log(logging.Entry{
 		Payload: Log{
-			"msg"   : "CancelBet for user",
+			"msg"   : "CashOut for user",
 			"client": client.Id(),
 			"wallet": session.wallet,
 			"params": data,
@@ -246,7 +568,7 @@ func cancelBetHandler(
 		Severity: logging.Info,
 	});
 
-	err := gameObj.HandleCancelBet(session.wallet);
+	err := gameObj.HandleCashOut(session.wallet);
 
 	callback := extractCallback(0, data...);
 
@@ -260,7 +582,7 @@ func cancelBetHandler(
 	}
 }
 
-func cashOutHandler(
+func tipHandler(
 	client *socket.Socket,
 	session Session,
 	logger *logging.Logger,
@@ -269,7 +591,7 @@ func cashOutHandler(
 ) {
 	logger.Log(logging.Entry{
 		Payload: Log{
-			"msg"   : "CashOut for user",
+			"msg"   : "Tip for user",
 			"client": client.Id(),
 			"wallet": session.wallet,
 			"params": data,
@@ -277,7 +599,68 @@ func cashOutHandler(
 		Severity: logging.Info,
 	});
 
-	gameObj.HandleCashOut(session.wallet);
+	var params TipParams;
+
+	callback, err := validateTipParams(&params, gameObj.GetConfig(), data...);
+
+	if err != nil {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Invalid parameters",
+				"client": client.Id(),
+			},
+			Severity: logging.Warning,
+		});
+
+		client.Disconnect(true);
+		return;
+	}
+
+	err = gameObj.HandleTip(
+		session.wallet,
+		params.recipient,
+		params.currency,
+		params.amount,
+	);
+
+	if callback == nil {
+		return;
+	}
+
+	if err != nil {
+		var errorCode string;
+
+		switch err {
+		case game.ErrTipsDisabled:
+			errorCode = "TIPS_DISABLED";
+		case game.ErrTipToSelf:
+			errorCode = "INVALID_RECIPIENT";
+		case game.ErrTipBelowMinimum:
+			errorCode = "BELOW_MINIMUM";
+		case game.ErrTipDailyCapExceeded:
+			errorCode = "DAILY_CAP_EXCEEDED";
+		case bank.ErrUnableToTransferBalance:
+			errorCode = "INSUFFICIENT_BALANCE";
+		default:
+			errorCode = "INTERNAL_ERROR";
+		}
+
+		callback(
+			[]any{ map[string]any{
+				"success": false,
+				"errorCode": errorCode,
+			} },
+			nil,
+		);
+		return;
+	}
+
+	callback(
+		[]any{ map[string]any{
+			"success": true,
+		} },
+		nil,
+	);
 }
 
 func withdrawHandler(
@@ -285,6 +668,9 @@ func withdrawHandler(
 	session Session,
 	logger *logging.Logger,
 	bankObj *bank.Bank,
+	chains map[string]*Chain,
+	limits *velocity.Checker,
+	solvencyMonitor *solvency.Monitor,
 	cfg *config.CrashConfig,
 	db *sql.DB,
 	data ...any,
@@ -315,10 +701,40 @@ func withdrawHandler(
 		return;
 	}
 
-	balance, err := bankObj.GetBalance(
-		session.wallet,
-		params.currency,
-	);
+	// Configured currencies stay unavailable until addCoin is mined
+	// for them, since the contract would reject the voucher.
+	for _, item := range params.items {
+		if !chains[params.chain].coins.Enabled(item.currency) {
+			if callback != nil {
+				callback(
+					[]any{ map[string]any{
+						"success": false,
+						"errorCode": "CURRENCY_UNAVAILABLE",
+					} },
+					nil,
+				);
+			}
+			return;
+		}
+	}
+
+	// Nothing is debited while the contract may not be able to pay.
+	for _, item := range params.items {
+		if solvencyMonitor.Paused(item.currency) {
+			if callback != nil {
+				callback(
+					[]any{ map[string]any{
+						"success": false,
+						"errorCode": "WITHDRAWALS_PAUSED",
+					} },
+					nil,
+				);
+			}
+			return;
+		}
+	}
+
+	balances, err := bankObj.GetBalances(session.wallet);
 
 	if err != nil {
 		if callback != nil {
@@ -333,12 +749,36 @@ func withdrawHandler(
 		return;
 	}
 
-	if balance.LessThan(params.amount) {
+	amounts := make([]bank.Amount, 0, len(params.items));
+
+	for _, item := range params.items {
+		if balances[item.currency].LessThan(item.amount) {
+			if callback != nil {
+				callback(
+					[]any{ map[string]any{
+						"success": false,
+						"errorCode": "INSUFFICIENT_BALANCE",
+					} },
+					nil,
+				);
+			}
+			return;
+		}
+
+		amounts = append(amounts, bank.Amount{
+			Currency: item.currency,
+			Amount: item.amount,
+		});
+	}
+
+	usdRates, err := rates.LoadRates(db, "usd");
+
+	if err != nil {
 		if callback != nil {
 			callback(
 				[]any{ map[string]any{
 					"success": false,
-					"errorCode": "INSUFFICIENT_BALANCE",
+					"errorCode": "INTERNAL_ERROR",
 				} },
 				nil,
 			);
@@ -346,14 +786,95 @@ func withdrawHandler(
 		return;
 	}
 
-	nonce, err := getNextNonce(db, session.wallet);
+	// The limits are checked and the nonce is chosen in the transaction
+	// debiting the funds, before the withdrawal itself is recorded.
+	var signErr error;
+
+	withdrawalFailed := func(err error) {
+		result := map[string]any{
+			"success": false,
+		};
+
+		if err == signErr {
+			result["errorCode"] = "INTERNAL_ERROR";
+
+			if err == signer.ErrAgentKeyMismatch || err == signer.ErrAgentUnknown {
+				result["errorCode"] = "WITHDRAWALS_UNAVAILABLE";
+			}
+		} else if errorCode := limitErrorCode(err); errorCode != "" {
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"   : "Withdrawal refused by limits",
+					"client": client.Id(),
+					"wallet": session.wallet,
+					"error" : err,
+				},
+				Severity: logging.Info,
+			});
+
+			result["errorCode"] = errorCode;
+		}
+
+		if callback != nil {
+			callback([]any{ result }, nil);
+		}
+	}
+
+	if needsReview(params.items, usdRates, cfg) {
+		var withdrawalId int64;
+
+		holdWithdrawal := func (tx *sql.Tx) error {
+			if err := limits.Check(tx, session.wallet, amounts, usdRates); err != nil {
+				return err;
+			}
+
+			nonce, err := nextNonce(tx, session.wallet, params.chain);
+
+			if err != nil {
+				return err;
+			}
+
+			withdrawalId, err = holdWithdrawalRequest(
+				session.wallet,
+				params.chain,
+				params.items,
+				nonce,
+				tx,
+			);
+			return err;
+		}
+
+		newBalances, err := bankObj.WithdrawBalances(
+			session.wallet,
+			amounts,
+			params.chain,
+			holdWithdrawal,
+		);
+
+		if err != nil {
+			withdrawalFailed(err);
+			return;
+		}
+
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"         : "Withdrawal held for review",
+				"client"      : client.Id(),
+				"wallet"      : session.wallet,
+				"withdrawalId": withdrawalId,
+			},
+			Severity: logging.Notice,
+		});
 
-	if err != nil {
 		if callback != nil {
 			callback(
 				[]any{ map[string]any{
-					"success": false,
-					"errorCode": "INTERNAL_ERROR",
+					"success": true,
+					"newBalance": newBalances[params.items[0].currency].String(),
+					"newBalances": newBalances,
+					"chain": params.chain,
+					"id": withdrawalId,
+					"status": withdrawals.STATUS_REVIEW,
 				} },
 				nil,
 			);
@@ -361,35 +882,64 @@ func withdrawHandler(
 		return;
 	}
 
-	req, sig, err := createWithdrawalRequest(
-		session.wallet,
-		params.amount,
-		params.currency,
-		cfg.OnChain.ChainId,
-		nonce,
-		cfg,
-	);
+	var nonce int64;
+	var req *WithdrawalRequest;
+	var sig string;
 
 	saveWithdrawal := func (tx *sql.Tx) error {
-		return saveWithdrawalRequest(req, sig, tx);
+		if err := limits.Check(tx, session.wallet, amounts, usdRates); err != nil {
+			return err;
+		}
+
+		var err error;
+		nonce, err = nextNonce(tx, session.wallet, params.chain);
+
+		if err != nil {
+			return err;
+		}
+
+		req, sig, err = createWithdrawalRequest(
+			chains[params.chain].agent,
+			session.wallet,
+			params.items,
+			params.chain,
+			nonce,
+			cfg,
+		);
+
+		if err != nil {
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"   : "Failed to sign withdrawal request",
+					"client": client.Id(),
+					"error" : err,
+				},
+				Severity: logging.Error,
+			});
+
+			signErr = err;
+			return err;
+		}
+
+		return saveWithdrawalRequest(
+			req,
+			params.chain,
+			params.items,
+			sig,
+			cfg.Withdrawals.VoucherTtlSecs,
+			tx,
+		);
 	}
 
-	newBalance, err := bankObj.WithdrawBalance(
+	newBalances, err := bankObj.WithdrawBalances(
 		session.wallet,
-		params.currency,
-		params.amount,
+		amounts,
+		params.chain,
 		saveWithdrawal,
 	);
 
 	if err != nil {
-		if callback != nil {
-			callback(
-				[]any{ map[string]any{
-					"success": false,
-				} },
-				nil,
-			);
-		}
+		withdrawalFailed(err);
 		return;
 	}
 
@@ -397,7 +947,11 @@ func withdrawHandler(
 		callback(
 			[]any{ map[string]any{
 				"success": true,
-				"newBalance": newBalance.String(),
+				"newBalance": newBalances[params.items[0].currency].String(),
+				"newBalances": newBalances,
+				"chain": params.chain,
+				"nonce": nonce,
+				"status": withdrawals.STATUS_ISSUED,
 				"request": req,
 				"signature": sig,
 			} },
@@ -405,3 +959,116 @@ func withdrawHandler(
 		);
 	}
 }
+
+/**
+ * The error code telling the player which withdrawal limit refused
+ * them, or "" if err is not one of the limits.
+ */
+func limitErrorCode(err error) string {
+	switch err {
+	case velocity.ErrDailyCapExceeded:
+		return "DAILY_LIMIT_EXCEEDED";
+	case velocity.ErrWeeklyCapExceeded:
+		return "WEEKLY_LIMIT_EXCEEDED";
+	case velocity.ErrTooSoon:
+		return "WITHDRAWAL_TOO_SOON";
+	case velocity.ErrLargeWinCooldown:
+		return "LARGE_WIN_COOLDOWN";
+	case velocity.ErrNewDeviceCooldown:
+		return "NEW_DEVICE_COOLDOWN";
+	}
+
+	return "";
+}
+
+func submitWithdrawalHandler(
+	client *socket.Socket,
+	session Session,
+	logger *logging.Logger,
+	chains map[string]*Chain,
+	cfg *config.CrashConfig,
+	data ...any,
+) {
+	var params SubmitWithdrawalParams;
+
+	callback, err := validateSubmitWithdrawalParams(&params, cfg, data...);
+
+	if err != nil {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Invalid parameters",
+				"client": client.Id(),
+			},
+			Severity: logging.Warning,
+		});
+
+		client.Disconnect(true);
+		return;
+	}
+
+	_, err = chains[params.chain].withdrawalTracker.Submit(session.wallet, params.nonce, params.txHash);
+
+	if err != nil {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Failed to record withdrawal submission",
+				"client": client.Id(),
+				"error" : err,
+			},
+			Severity: logging.Error,
+		});
+	}
+
+	if callback != nil {
+		callback(
+			[]any{ map[string]any{
+				"success": err == nil,
+			} },
+			nil,
+		);
+	}
+}
+
+func listWithdrawalsHandler(
+	client *socket.Socket,
+	session Session,
+	logger *logging.Logger,
+	db *sql.DB,
+	data ...any,
+) {
+	callback := extractCallback(0, data...);
+
+	if callback == nil {
+		return;
+	}
+
+	list, err := withdrawals.List(db, session.wallet);
+
+	if err != nil {
+		logger.Log(logging.Entry{
+			Payload: Log{
+				"msg"   : "Failed to list withdrawals",
+				"client": client.Id(),
+				"error" : err,
+			},
+			Severity: logging.Error,
+		});
+
+		callback(
+			[]any{ map[string]any{
+				"success": false,
+				"errorCode": "INTERNAL_ERROR",
+			} },
+			nil,
+		);
+		return;
+	}
+
+	callback(
+		[]any{ map[string]any{
+			"success": true,
+			"withdrawals": list,
+		} },
+		nil,
+	);
+}
@@ -0,0 +1,236 @@
+package indexer;
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/chainscan"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+);
+
+var (
+	ErrInvalidContract = errors.New("invalid contract address")
+	ErrUnknownChain = errors.New("unknown chain")
+)
+
+/**
+ * A log emitted by the contract. Wallet, CoinId and Amount repeat the
+ * arguments of the balance events so that they can be queried; Amount
+ * is in the coin's base units. Args holds every argument, with
+ * integers as decimal strings.
+ */
+type Event struct {
+	Id int64 `json:"id"`;
+	Chain string `json:"chain"`;
+	BlockNumber uint64 `json:"blockNumber"`;
+	BlockHash string `json:"blockHash"`;
+	TxHash string `json:"txHash"`;
+	LogIndex uint `json:"logIndex"`;
+	Name string `json:"event"`;
+	Wallet string `json:"wallet,omitempty"`;
+	CoinId *uint32 `json:"coinId,omitempty"`;
+	Amount *decimal.Decimal `json:"amount,omitempty"`;
+	Args json.RawMessage `json:"args"`;
+}
+
+/**
+ * Persistence for the indexer. Add must ignore an event already stored
+ * for the same block hash and log index; RemoveBlock drops the events
+ * of a block that is no longer canonical.
+ */
+type Store interface {
+	chainscan.Cursor;
+	Add(*Event) error;
+	Blocks(from uint64) (map[uint64][]common.Hash, error);
+	RemoveBlock(uint64, common.Hash) (int64, error);
+}
+
+/**
+ * Copies every event of one chain's contract into the store. Events are
+ * stored as soon as they are seen; events in blocks that are later
+ * replaced are removed, down to the deepest confirmation depth
+ * configured for the chain.
+ */
+type Indexer struct {
+	chain string;
+	client chainscan.Client;
+	scanner *chainscan.Scanner;
+	store Store;
+	rewind uint64;
+}
+
+func NewIndexer(
+	client chainscan.Client,
+	cfg *config.CrashConfig,
+	chain string,
+	store Store,
+) (*Indexer, error) {
+	chainDef, ok := cfg.Chains[chain];
+
+	if !ok {
+		return nil, ErrUnknownChain;
+	}
+
+	if !common.IsHexAddress(chainDef.Contract) {
+		return nil, ErrInvalidContract;
+	}
+
+	rewind := uint64(1);
+
+	for _, def := range chainDef.Coins {
+		rewind = max(rewind, def.Confirmations);
+	}
+
+	scanner := chainscan.NewScanner(
+		client,
+		store,
+		[]common.Address{ common.HexToAddress(chainDef.Contract) },
+		nil,
+		chainDef.StartBlock,
+		rewind,
+	);
+
+	return &Indexer{
+		chain: chain,
+		client: client,
+		scanner: scanner,
+		store: store,
+		rewind: rewind,
+	}, nil;
+}
+
+func (indexer *Indexer) Poll(ctx context.Context) error {
+	head, err := indexer.scanner.Scan(ctx, indexer.handleLog);
+
+	if err != nil {
+		return err;
+	}
+
+	return indexer.prune(ctx, head);
+}
+
+func (indexer *Indexer) handleLog(log *types.Log) error {
+	event, err := NewEvent(indexer.chain, log);
+
+	if err != nil {
+		slog.Warn(
+			"Unable to decode contract event",
+			"chain", indexer.chain,
+			"txHash", log.TxHash,
+			"logIndex", log.Index,
+			"error", err,
+		);
+		return nil;
+	}
+
+	return indexer.store.Add(event);
+}
+
+/**
+ * Removes events whose block has been replaced. Scanning again after a
+ * reorg adds the events of the replacement blocks, but only this drops
+ * those of the blocks they replaced.
+ */
+func (indexer *Indexer) prune(ctx context.Context, head uint64) error {
+	from := uint64(0);
+
+	if head + 1 > indexer.rewind {
+		from = head + 1 - indexer.rewind;
+	}
+
+	blocks, err := indexer.store.Blocks(from);
+
+	if err != nil {
+		return err;
+	}
+
+	canonical := chainscan.NewCanonical(indexer.client);
+
+	for number, hashes := range blocks {
+		if number > head {
+			continue;
+		}
+
+		for _, hash := range hashes {
+			ok, err := canonical.Contains(ctx, number, hash);
+
+			if err != nil {
+				return err;
+			}
+
+			if ok {
+				continue;
+			}
+
+			removed, err := indexer.store.RemoveBlock(number, hash);
+
+			if err != nil {
+				return err;
+			}
+
+			slog.Warn(
+				"Removed contract events of orphaned block",
+				"chain", indexer.chain,
+				"block", number,
+				"blockHash", hash,
+				"events", removed,
+			);
+		}
+	}
+
+	return nil;
+}
+
+/**
+ * Decodes a log of the contract into an event.
+ */
+func NewEvent(chain string, log *types.Log) (*Event, error) {
+	name, args, err := contract.ParseEvent(log);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	event := &Event{
+		Chain: chain,
+		BlockNumber: log.BlockNumber,
+		BlockHash: log.BlockHash.Hex(),
+		TxHash: log.TxHash.Hex(),
+		LogIndex: log.Index,
+		Name: name,
+	};
+
+	if user, ok := args["user"].(common.Address); ok {
+		event.Wallet = user.Hex();
+	}
+
+	if coinId, ok := args["coinId"].(uint32); ok {
+		event.CoinId = &coinId;
+	}
+
+	if amount, ok := args["amount"].(*big.Int); ok {
+		value := decimal.NewFromBigInt(amount, 0);
+		event.Amount = &value;
+	}
+
+	// JSON numbers cannot hold uint256 values exactly.
+	for key, value := range args {
+		if number, ok := value.(*big.Int); ok {
+			args[key] = number.String();
+		}
+	}
+
+	if event.Args, err = json.Marshal(args); err != nil {
+		return nil, err;
+	}
+
+	return event, nil;
+}
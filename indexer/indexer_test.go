@@ -0,0 +1,385 @@
+package indexer;
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/samott/crash-backend/chainscan"
+	"github.com/samott/crash-backend/chaintest"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+	"github.com/samott/crash-backend/deposits"
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+var cfg *config.CrashConfig;
+var db *sql.DB;
+
+func init() {
+	var err error;
+
+	cfg, err = config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+
+	dbConfig := mysql.Config{
+		User: cfg.Database.User,
+		DBName: cfg.Database.DBName,
+		Addr: cfg.Database.Addr,
+		AllowNativePasswords: true,
+	};
+
+	db, err = sql.Open("mysql", dbConfig.FormatDSN());
+
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err);
+	}
+}
+
+/**
+ * Removes everything a previous run left for chain, which each test
+ * names after itself.
+ */
+func resetChain(t *testing.T, chain string) {
+	queries := []string{
+		"DELETE FROM contract_events WHERE chain = ?",
+		"DELETE FROM deposits WHERE chain = ?",
+		"DELETE FROM withdrawals WHERE chain = ?",
+	};
+
+	for _, query := range queries {
+		if _, err := db.Exec(query, chain); err != nil {
+			t.Fatal("Failed to reset chain: ", err);
+		}
+	}
+
+	_, err := db.Exec(
+		"DELETE FROM chain_cursors WHERE name IN (?, ?, ?)",
+		CURSOR_NAME + ":" + chain,
+		deposits.CURSOR_NAME + ":" + chain,
+		withdrawals.CURSOR_NAME + ":" + chain,
+	);
+
+	if err != nil {
+		t.Fatal("Failed to reset cursors: ", err);
+	}
+}
+
+func newTestIndexer(
+	t *testing.T,
+	chain *chaintest.Chain,
+	chainName string,
+	emitter common.Address,
+) *Indexer {
+	chainDef := cfg.Chains["ethereum"];
+	chainDef.Contract = emitter.Hex();
+	chainDef.StartBlock = 0;
+
+	indexerCfg := *cfg;
+	indexerCfg.Chains = map[string]config.ChainDef{ chainName: chainDef };
+
+	resetChain(t, chainName);
+
+	indexer, err := NewIndexer(chain.Client, &indexerCfg, chainName, NewSqlStore(db, chainName));
+
+	if err != nil {
+		t.Fatal("Failed to create indexer: ", err);
+	}
+
+	return indexer;
+}
+
+func emitBalanceEvent(
+	t *testing.T,
+	chain *chaintest.Chain,
+	emitter common.Address,
+	name string,
+	user common.Address,
+	amount int64,
+) {
+	crashAbi, err := contract.CrashMetaData.GetAbi();
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	event := crashAbi.Events[name];
+	data, err := event.Inputs.Pack(user, uint32(1), big.NewInt(amount), big.NewInt(amount));
+
+	if err != nil {
+		t.Fatal("Failed to pack event: ", err);
+	}
+
+	if _, err = chain.Emit(emitter, event.ID, data); err != nil {
+		t.Fatal("Failed to emit event: ", err);
+	}
+}
+
+func poll(t *testing.T, indexer *Indexer) {
+	if err := indexer.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+}
+
+func query(t *testing.T, filter Filter) []*Event {
+	events, err := Query(db, filter);
+
+	if err != nil {
+		t.Fatal("Query() failed: ", err);
+	}
+
+	return events;
+}
+
+func TestIndexerStoresEvents(t *testing.T) {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	defer chain.Close();
+
+	emitter, err := chain.DeployEmitter();
+
+	if err != nil {
+		t.Fatal("Failed to deploy emitter: ", err);
+	}
+
+	const chainName = "index-test";
+	indexer := newTestIndexer(t, chain, chainName, emitter);
+
+	alice := common.HexToAddress("0x1111111111111111111111111111111111111111");
+	bob := common.HexToAddress("0x2222222222222222222222222222222222222222");
+
+	emitBalanceEvent(t, chain, emitter, "BalanceIncreased", alice, 1000);
+	emitBalanceEvent(t, chain, emitter, "BalanceDecreased", alice, 400);
+	emitBalanceEvent(t, chain, emitter, "BalanceIncreased", bob, 7);
+
+	// Not an event of the contract; skipped rather than stalling the
+	// indexer.
+	if _, err = chain.Emit(emitter, common.HexToHash("0x1234"), nil); err != nil {
+		t.Fatal("Failed to emit event: ", err);
+	}
+
+	chain.Commit();
+	poll(t, indexer);
+
+	events := query(t, Filter{ Chain: chainName });
+
+	if len(events) != 3 {
+		t.Fatal("Expected 3 events, got ", len(events));
+	}
+
+	decreased := events[1];
+
+	if decreased.Name != "BalanceDecreased" || decreased.Wallet != alice.Hex() {
+		t.Fatal("Events out of order or misattributed: ", decreased.Name, " ", decreased.Wallet);
+	}
+
+	if decreased.Amount == nil || decreased.Amount.String() != "400" {
+		t.Fatal("Amount incorrect: ", decreased.Amount);
+	}
+
+	if decreased.CoinId == nil || *decreased.CoinId != 1 {
+		t.Fatal("Coin id not stored");
+	}
+
+	if string(decreased.Args) != fmt.Sprintf(`{"amount":"400","coinId":1,"newBalance":"400","user":"%s"}`, alice.Hex()) {
+		t.Fatal("Args incorrect: ", string(decreased.Args));
+	}
+
+	if events := query(t, Filter{ Chain: chainName, Wallet: bob.Hex() }); len(events) != 1 {
+		t.Fatal("Expected 1 event for bob, got ", len(events));
+	}
+
+	if events := query(t, Filter{ Chain: chainName, Event: "BalanceIncreased", Limit: 1 }); len(events) != 1 || events[0].Wallet != alice.Hex() {
+		t.Fatal("Limit not applied");
+	}
+
+	if events := query(t, Filter{ Chain: chainName, After: events[0].Id }); len(events) != 2 {
+		t.Fatal("Expected 2 events after the first, got ", len(events));
+	}
+
+	// Forget the cursor as if we had crashed before saving it; the same
+	// logs must not be stored twice.
+	if _, err = db.Exec("DELETE FROM chain_cursors WHERE name = ?", CURSOR_NAME + ":" + chainName); err != nil {
+		t.Fatal(err);
+	}
+
+	poll(t, indexer);
+
+	if events := query(t, Filter{ Chain: chainName }); len(events) != 3 {
+		t.Fatal("Events stored more than once: ", len(events));
+	}
+}
+
+func TestIndexerRemovesOrphanedEvents(t *testing.T) {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	defer chain.Close();
+
+	emitter, err := chain.DeployEmitter();
+
+	if err != nil {
+		t.Fatal("Failed to deploy emitter: ", err);
+	}
+
+	const chainName = "index-reorg-test";
+	indexer := newTestIndexer(t, chain, chainName, emitter);
+
+	parent, err := chain.Client.HeaderByNumber(context.Background(), nil);
+
+	if err != nil {
+		t.Fatal("Failed to get head: ", err);
+	}
+
+	user := common.HexToAddress("0x3333333333333333333333333333333333333333");
+
+	emitBalanceEvent(t, chain, emitter, "BalanceIncreased", user, 1000);
+	chain.Commit();
+	poll(t, indexer);
+
+	if events := query(t, Filter{ Chain: chainName }); len(events) != 1 {
+		t.Fatal("Expected 1 event, got ", len(events));
+	}
+
+	if err := chain.Backend.Fork(parent.Hash()); err != nil {
+		t.Fatal("Failed to fork chain: ", err);
+	}
+
+	chain.Commit();
+	emitBalanceEvent(t, chain, emitter, "BalanceIncreased", user, 2000);
+	chain.Commit();
+	poll(t, indexer);
+
+	events := query(t, Filter{ Chain: chainName });
+
+	if len(events) != 1 || events[0].Amount.String() != "2000" {
+		t.Fatal("Expected only the replacement event, got ", len(events));
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	const chainName = "reconcile-test";
+	resetChain(t, chainName);
+
+	store := NewSqlStore(db, chainName);
+	hash := func(n int) string { return common.BigToHash(big.NewInt(int64(n))).Hex() };
+
+	addEvent := func(block uint64, logIndex uint, name string, txHash string) *Event {
+		event := &Event{
+			Chain: chainName,
+			BlockNumber: block,
+			BlockHash: hash(int(block)),
+			TxHash: txHash,
+			LogIndex: logIndex,
+			Name: name,
+			Args: []byte("{}"),
+		};
+
+		if err := store.Add(event); err != nil {
+			t.Fatal("Add() failed: ", err);
+		}
+
+		return event;
+	};
+
+	addDeposit := func(block uint64, logIndex uint, status string) int64 {
+		result, err := db.Exec(`
+			INSERT INTO deposits
+			(chain, txHash, logIndex, wallet, currency, amount, blockNumber, blockHash, coinId, status)
+			VALUES
+			(?, ?, ?, '0x0000000000000000000000000000000000000001', 'eth', 1, ?, ?, 1, ?)
+		`, chainName, hash(100 + int(block)), logIndex, block, hash(int(block)), status);
+
+		if err != nil {
+			t.Fatal("Failed to add deposit: ", err);
+		}
+
+		id, _ := result.LastInsertId();
+		return id;
+	};
+
+	addWithdrawal := func(nonce int, txHash string, block uint64) int64 {
+		result, err := db.Exec(`
+			INSERT INTO withdrawals
+			(chain, nonce, wallet, amount, currency, txHash, blockNumber, blockHash, status, signature, request)
+			VALUES
+			(?, ?, '0x0000000000000000000000000000000000000001', 1, 'eth', ?, ?, ?, ?, '', '')
+		`, chainName, nonce, txHash, block, hash(int(block)), withdrawals.STATUS_CONFIRMED);
+
+		if err != nil {
+			t.Fatal("Failed to add withdrawal: ", err);
+		}
+
+		id, _ := result.LastInsertId();
+		return id;
+	};
+
+	addEvent(2, 0, "OwnershipTransferred", hash(202));
+
+	addEvent(3, 0, "BalanceIncreased", hash(203));
+	addDeposit(3, 0, deposits.STATUS_CREDITED);
+
+	unmatched := addEvent(4, 1, "BalanceIncreased", hash(204));
+
+	addEvent(5, 0, "BalanceDecreased", hash(205));
+	addWithdrawal(1, hash(205), 5);
+
+	unindexedDeposit := addDeposit(6, 0, deposits.STATUS_PENDING);
+	addDeposit(7, 0, deposits.STATUS_REVERTED);
+	unindexedWithdrawal := addWithdrawal(2, hash(208), 8);
+
+	// Beyond the deposit scanner, so not yet comparable.
+	addEvent(12, 0, "BalanceIncreased", hash(212));
+
+	cursors := map[string]uint64{
+		CURSOR_NAME: 15,
+		deposits.CURSOR_NAME: 10,
+		withdrawals.CURSOR_NAME: 20,
+	};
+
+	for name, block := range cursors {
+		cursor := chainscan.NewSqlCursor(db, name + ":" + chainName);
+
+		if err := cursor.SetLastBlock(block, common.HexToHash(hash(int(block)))); err != nil {
+			t.Fatal("Failed to set cursor: ", err);
+		}
+	}
+
+	result, err := Reconcile(db, chainName);
+
+	if err != nil {
+		t.Fatal("Reconcile() failed: ", err);
+	}
+
+	if result.ToBlock != 10 {
+		t.Fatal("Expected reconciliation up to block 10, got ", result.ToBlock);
+	}
+
+	if len(result.UnmatchedEvents) != 1 || result.UnmatchedEvents[0].TxHash != unmatched.TxHash {
+		t.Fatal("Expected 1 unmatched event, got ", len(result.UnmatchedEvents));
+	}
+
+	if len(result.UnindexedDeposits) != 1 || result.UnindexedDeposits[0] != unindexedDeposit {
+		t.Fatal("Unindexed deposits incorrect: ", result.UnindexedDeposits);
+	}
+
+	if len(result.UnindexedWithdrawals) != 1 || result.UnindexedWithdrawals[0] != unindexedWithdrawal {
+		t.Fatal("Unindexed withdrawals incorrect: ", result.UnindexedWithdrawals);
+	}
+}
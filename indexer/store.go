@@ -0,0 +1,364 @@
+package indexer;
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/chainscan"
+	"github.com/samott/crash-backend/deposits"
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+const CURSOR_NAME = "events";
+
+/**
+ * Events of a single chain; each chain's indexer has its own store and
+ * cursor.
+ */
+type SqlStore struct {
+	*chainscan.SqlCursor;
+	db *sql.DB;
+	chain string;
+}
+
+func NewSqlStore(db *sql.DB, chain string) *SqlStore {
+	return &SqlStore{
+		SqlCursor: chainscan.NewSqlCursor(db, CURSOR_NAME + ":" + chain),
+		db: db,
+		chain: chain,
+	};
+}
+
+func (store *SqlStore) Add(event *Event) error {
+	var amount *string;
+
+	if event.Amount != nil {
+		value := event.Amount.String();
+		amount = &value;
+	}
+
+	_, err := store.db.Exec(`
+		INSERT IGNORE INTO contract_events
+		(chain, blockNumber, blockHash, txHash, logIndex, event, wallet, coinId, amount, args)
+		VALUES
+		(?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, CAST(? AS Decimal(65, 0)), ?)
+	`,
+		store.chain,
+		event.BlockNumber,
+		event.BlockHash,
+		event.TxHash,
+		event.LogIndex,
+		event.Name,
+		event.Wallet,
+		event.CoinId,
+		amount,
+		string(event.Args),
+	);
+
+	return err;
+}
+
+/**
+ * The hashes of the blocks from the given number on that have events,
+ * by block number.
+ */
+func (store *SqlStore) Blocks(from uint64) (map[uint64][]common.Hash, error) {
+	rows, err := store.db.Query(`
+		SELECT DISTINCT blockNumber, blockHash
+		FROM contract_events
+		WHERE chain = ?
+		AND blockNumber >= ?
+	`, store.chain, from);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	blocks := make(map[uint64][]common.Hash);
+
+	for rows.Next() {
+		var number uint64;
+		var hash string;
+
+		if err := rows.Scan(&number, &hash); err != nil {
+			return nil, err;
+		}
+
+		blocks[number] = append(blocks[number], common.HexToHash(hash));
+	}
+
+	return blocks, rows.Err();
+}
+
+func (store *SqlStore) RemoveBlock(number uint64, hash common.Hash) (int64, error) {
+	result, err := store.db.Exec(`
+		DELETE FROM contract_events
+		WHERE chain = ?
+		AND blockNumber = ?
+		AND blockHash = ?
+	`, store.chain, number, hash.Hex());
+
+	if err != nil {
+		return 0, err;
+	}
+
+	return result.RowsAffected();
+}
+
+/**
+ * Narrows a Query; zero values match everything. Results are in the
+ * order the events were emitted within a chain, starting after the
+ * event with id After.
+ */
+type Filter struct {
+	Chain string;
+	Event string;
+	Wallet string;
+	TxHash string;
+	FromBlock uint64;
+	ToBlock uint64;
+	After int64;
+	Limit int;
+}
+
+const MAX_LIMIT = 1000;
+
+func Query(db *sql.DB, filter Filter) ([]*Event, error) {
+	where := "WHERE id > ?";
+	args := []any{ filter.After };
+
+	conditions := []struct {
+		set bool;
+		clause string;
+		value any;
+	}{
+		{ filter.Chain != "", "chain = ?", filter.Chain },
+		{ filter.Event != "", "event = ?", filter.Event },
+		{ filter.Wallet != "", "wallet = ?", filter.Wallet },
+		{ filter.TxHash != "", "txHash = ?", filter.TxHash },
+		{ filter.FromBlock > 0, "blockNumber >= ?", filter.FromBlock },
+		{ filter.ToBlock > 0, "blockNumber <= ?", filter.ToBlock },
+	};
+
+	for _, condition := range conditions {
+		if condition.set {
+			where += " AND " + condition.clause;
+			args = append(args, condition.value);
+		}
+	}
+
+	limit := filter.Limit;
+
+	if limit <= 0 || limit > MAX_LIMIT {
+		limit = MAX_LIMIT;
+	}
+
+	return queryEvents(db, where + `
+		ORDER BY chain, blockNumber, logIndex, id
+		LIMIT ` + strconv.Itoa(limit), args...);
+}
+
+/**
+ * Differences between the indexed events and our own records of one
+ * chain, up to the block that the indexer and the deposit and
+ * withdrawal scanners have all reached:
+ *
+ * - balance events that are neither a deposit we recorded nor part of
+ *   a withdrawal transaction we know of;
+ * - deposits we recorded, other than reverted ones, with no event;
+ * - withdrawals we saw mined with no BalanceDecreased event.
+ */
+type Reconciliation struct {
+	Chain string `json:"chain"`;
+	ToBlock uint64 `json:"toBlock"`;
+	UnmatchedEvents []*Event `json:"unmatchedEvents"`;
+	UnindexedDeposits []int64 `json:"unindexedDeposits"`;
+	UnindexedWithdrawals []int64 `json:"unindexedWithdrawals"`;
+}
+
+func Reconcile(db *sql.DB, chain string) (*Reconciliation, error) {
+	result := &Reconciliation{
+		Chain: chain,
+	};
+
+	var found bool;
+
+	err := db.QueryRow(`
+		SELECT COALESCE(MIN(block), 0), COUNT(*) = 3
+		FROM chain_cursors
+		WHERE name IN (?, ?, ?)
+	`,
+		CURSOR_NAME + ":" + chain,
+		deposits.CURSOR_NAME + ":" + chain,
+		withdrawals.CURSOR_NAME + ":" + chain,
+	).Scan(&result.ToBlock, &found);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	if !found {
+		result.UnmatchedEvents = []*Event{};
+		result.UnindexedDeposits = []int64{};
+		result.UnindexedWithdrawals = []int64{};
+		return result, nil;
+	}
+
+	result.UnmatchedEvents, err = queryEvents(db, `
+		WHERE chain = ?
+		AND blockNumber <= ?
+		AND event IN ('BalanceIncreased', 'BalanceDecreased')
+		AND NOT EXISTS (
+			SELECT 1
+			FROM withdrawals
+			WHERE withdrawals.chain = contract_events.chain
+			AND withdrawals.txHash = contract_events.txHash
+		)
+		AND NOT EXISTS (
+			SELECT 1
+			FROM deposits
+			WHERE deposits.chain = contract_events.chain
+			AND deposits.blockHash = contract_events.blockHash
+			AND deposits.logIndex = contract_events.logIndex
+			AND contract_events.event = 'BalanceIncreased'
+		)
+		ORDER BY blockNumber, logIndex
+		LIMIT ` + strconv.Itoa(MAX_LIMIT), chain, result.ToBlock);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	result.UnindexedDeposits, err = queryIds(db, `
+		SELECT id
+		FROM deposits
+		WHERE chain = ?
+		AND blockNumber <= ?
+		AND status != ?
+		AND NOT EXISTS (
+			SELECT 1
+			FROM contract_events
+			WHERE contract_events.chain = deposits.chain
+			AND contract_events.blockHash = deposits.blockHash
+			AND contract_events.logIndex = deposits.logIndex
+		)
+		ORDER BY id
+	`, chain, result.ToBlock, deposits.STATUS_REVERTED);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	result.UnindexedWithdrawals, err = queryIds(db, `
+		SELECT id
+		FROM withdrawals
+		WHERE chain = ?
+		AND blockNumber <= ?
+		AND blockHash IS NOT NULL
+		AND NOT EXISTS (
+			SELECT 1
+			FROM contract_events
+			WHERE contract_events.chain = withdrawals.chain
+			AND contract_events.blockHash = withdrawals.blockHash
+			AND contract_events.txHash = withdrawals.txHash
+			AND contract_events.event = 'BalanceDecreased'
+		)
+		ORDER BY id
+	`, chain, result.ToBlock);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return result, nil;
+}
+
+func queryEvents(db *sql.DB, where string, args ...any) ([]*Event, error) {
+	rows, err := db.Query(`
+		SELECT id, chain, blockNumber, blockHash, txHash, logIndex, event,
+		COALESCE(wallet, ''), coinId, amount, args
+		FROM contract_events
+	` + where, args...);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	events := make([]*Event, 0);
+
+	for rows.Next() {
+		var event Event;
+		var coinId sql.NullInt64;
+		var amount sql.NullString;
+		var eventArgs string;
+
+		err := rows.Scan(
+			&event.Id,
+			&event.Chain,
+			&event.BlockNumber,
+			&event.BlockHash,
+			&event.TxHash,
+			&event.LogIndex,
+			&event.Name,
+			&event.Wallet,
+			&coinId,
+			&amount,
+			&eventArgs,
+		);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if coinId.Valid {
+			value := uint32(coinId.Int64);
+			event.CoinId = &value;
+		}
+
+		if amount.Valid {
+			value, err := decimal.NewFromString(amount.String);
+
+			if err != nil {
+				return nil, err;
+			}
+
+			event.Amount = &value;
+		}
+
+		event.Args = []byte(eventArgs);
+		events = append(events, &event);
+	}
+
+	return events, rows.Err();
+}
+
+func queryIds(db *sql.DB, query string, args ...any) ([]int64, error) {
+	rows, err := db.Query(query, args...);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	ids := make([]int64, 0);
+
+	for rows.Next() {
+		var id int64;
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err;
+		}
+
+		ids = append(ids, id);
+	}
+
+	return ids, rows.Err();
+}
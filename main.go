@@ -10,35 +10,38 @@ import (
 	"log/slog"
 	"net/http"
 
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 
+	"github.com/samott/crash-backend/auth"
 	"github.com/samott/crash-backend/config"
 	"github.com/samott/crash-backend/bank"
 	"github.com/samott/crash-backend/game"
+	"github.com/samott/crash-backend/payouts"
 	"github.com/samott/crash-backend/rates"
+	"github.com/samott/crash-backend/signer"
+	"github.com/samott/crash-backend/solvency"
+	"github.com/samott/crash-backend/velocity"
 
 	"database/sql"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/spruceid/siwe-go"
-
 	"github.com/go-sql-driver/mysql"
 	engineTypes "github.com/zishang520/engine.io/v2/types"
 	"github.com/zishang520/socket.io/v2/socket"
 	"cloud.google.com/go/logging"
 	"github.com/shopspring/decimal"
+	"github.com/google/uuid"
 );
 
 var (
 	ErrInvalidParameters = errors.New("invalid parameters")
 	ErrInvalidDecimalValue = errors.New("invalid decimal value")
 	ErrInvalidCurrency = errors.New("invalid currency")
-	ErrInvalidSigningMEthod = errors.New("invalid signing method")
-	ErrInvalidJwtToken = errors.New("invalid JWT token")
+	ErrInvalidAddress = errors.New("invalid address")
+	ErrInvalidTxHash = errors.New("invalid transaction hash")
+	ErrInvalidChain = errors.New("invalid chain")
 )
 
-var JWT_SECRET = []byte("1_top_secret");
-
 type Log = map[string]any;
 
 type AuthParams struct {
@@ -52,81 +55,76 @@ type PlaceBetParams struct {
 	currency string;
 }
 
+type WithdrawItem struct {
+	amount decimal.Decimal;
+	currency string;
+}
+
 type WithdrawParams struct {
+	chain string;
+	items []WithdrawItem;
+}
+
+type TipParams struct {
+	recipient string;
 	amount decimal.Decimal;
 	currency string;
 }
 
+type SubmitWithdrawalParams struct {
+	chain string;
+	nonce int64;
+	txHash common.Hash;
+}
+
 type LoginParams struct {
 	token string;
+	deviceToken string;
+}
+
+type RefreshTokenParams struct {
+	refreshToken string;
 }
 
 type Session struct {
+	id uuid.UUID;
 	wallet string;
+	roles []string;
 }
 
-func validateToken(token string, session *Session) error {
-	tokenObj, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidSigningMEthod;
-		}
-
-		return JWT_SECRET, nil;
-	})
+/**
+ * Accepts an access token whose session has not been revoked.
+ */
+func validateToken(tokens *auth.Tokens, sessions *auth.SessionStore, token string, session *Session) error {
+	claims, err := tokens.Validate(token);
 
 	if err != nil {
 		return err;
 	}
 
-	claims, ok := tokenObj.Claims.(jwt.MapClaims);
-
-	if !ok || !tokenObj.Valid {
-		return ErrInvalidJwtToken;
+	if err := sessions.Check(claims.Session); err != nil {
+		return err;
 	}
 
-	wallet := claims["wallet"].(string);
-
-	session.wallet = wallet;
+	session.id = claims.Session;
+	session.wallet = claims.Wallet;
+	session.roles = claims.Roles;
 
 	return nil;
 }
 
-func authenticateUser(payload string, signature string) (string, error) {
-	message, err := siwe.ParseMessage(payload);
-
-	if err != nil {
-		return "", err;
-	}
-
-	publicKey, err := message.VerifyEIP191(signature);
-
-	if err != nil {
-		return "", err;
-	}
-
-	wallet := crypto.PubkeyToAddress(*publicKey).String();
-
-	return wallet, nil;
+/**
+ * Sockets logged in with a session join its room, so that revoking the
+ * session can close them.
+ */
+func sessionRoom(id uuid.UUID) socket.Room {
+	return socket.Room("session:" + id.String());
 }
 
-func generateToken(wallet string) (string, error) {
-	if len(wallet) == 0 {
-		return "", nil;
+func disconnectSessions(io *socket.Server, ids ...uuid.UUID) {
+	for _, id := range ids {
+		io.In(sessionRoom(id)).DisconnectSockets(true);
 	}
-
-	tokenObj := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"wallet": wallet,
-		"nbf": time.Now().Unix(),
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
-	});
-
-	token, err := tokenObj.SignedString(JWT_SECRET);
-
-	if err != nil {
-		return "", err;
-	}
-
-	return token, nil;
 }
 
 func validateAuthenticateParams(result *AuthParams, data ...any) (func([]any, error), error) {
@@ -174,8 +172,38 @@ func validateLoginParams(result *LoginParams, data ...any) (func([]any, error),
 		return nil, ErrInvalidParameters;
 	}
 
+	// Optional; sent back from a previous login on this device.
+	deviceToken, _ := params["deviceToken"].(string);
+
 	*result = LoginParams{
 		token: token,
+		deviceToken: deviceToken,
+	};
+
+	callback := extractCallback(1, data...);
+
+	return callback, nil;
+}
+
+func validateRefreshTokenParams(result *RefreshTokenParams, data ...any) (func([]any, error), error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidParameters;
+	}
+
+	params, ok := data[0].(map[string]any);
+
+	if !ok {
+		return nil, ErrInvalidParameters;
+	}
+
+	refreshToken, ok := params["refreshToken"].(string);
+
+	if !ok {
+		return nil, ErrInvalidParameters;
+	}
+
+	*result = RefreshTokenParams{
+		refreshToken: refreshToken,
 	};
 
 	callback := extractCallback(1, data...);
@@ -228,6 +256,75 @@ func validatePlaceBetParams(
 	return callback, nil;
 }
 
+/**
+ * Chain named in the params. It may be left out when only one chain is
+ * configured.
+ */
+func parseChain(
+	params map[string]any,
+	config *config.CrashConfig,
+) (string, error) {
+	chain, ok := params["chain"].(string);
+
+	if !ok {
+		if _, present := params["chain"]; present || len(config.Chains) != 1 {
+			return "", ErrInvalidChain;
+		}
+
+		for name := range config.Chains {
+			chain = name;
+		}
+	}
+
+	if _, ok := config.Chains[chain]; !ok {
+		return "", ErrInvalidChain;
+	}
+
+	return chain, nil;
+}
+
+func parseWithdrawItem(
+	params map[string]any,
+	chain string,
+	config *config.CrashConfig,
+) (WithdrawItem, error) {
+	amountStr, ok1 := params["amount"].(string);
+	currency, ok2 := params["currency"].(string);
+
+	// Older clients send the amount under the bet parameter's name.
+	if !ok1 {
+		amountStr, ok1 = params["betAmount"].(string);
+	}
+
+	if !ok1 || !ok2 {
+		return WithdrawItem{}, ErrInvalidParameters;
+	}
+
+	amount, err := decimal.NewFromString(amountStr);
+
+	if err != nil || !amount.IsPositive() {
+		return WithdrawItem{}, ErrInvalidDecimalValue;
+	}
+
+	if _, ok := config.Currencies[currency]; !ok {
+		return WithdrawItem{}, ErrInvalidCurrency;
+	}
+
+	if _, ok := config.Chains[chain].Coins[currency]; !ok {
+		return WithdrawItem{}, ErrInvalidCurrency;
+	}
+
+	return WithdrawItem{
+		amount: amount,
+		currency: currency,
+	}, nil;
+}
+
+/**
+ * Accepts either a single amount and currency, or a list of them under
+ * "items" to be paid out in one on-chain call. Every currency must be
+ * supported on the target chain.
+ */
 func validateWithdrawParams(
 	result *WithdrawParams,
 	config *config.CrashConfig,
@@ -243,13 +340,83 @@ func validateWithdrawParams(
 		return nil, ErrInvalidParameters;
 	}
 
-	amountStr, ok1 := params["betAmount"].(string);
-	currency, ok2 := params["currency"].(string);
+	chain, err := parseChain(params, config);
 
-	if !ok1 || !ok2 {
+	if err != nil {
+		return nil, err;
+	}
+
+	list, ok := params["items"].([]any);
+
+	if !ok {
+		list = []any{ params };
+	}
+
+	if len(list) == 0 || len(list) > 1 + config.Withdrawals.MaxTasks {
+		return nil, ErrInvalidParameters;
+	}
+
+	items := make([]WithdrawItem, 0, len(list));
+	seen := make(map[string]bool);
+
+	for _, entry := range list {
+		itemParams, ok := entry.(map[string]any);
+
+		if !ok {
+			return nil, ErrInvalidParameters;
+		}
+
+		item, err := parseWithdrawItem(itemParams, chain, config);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if seen[item.currency] {
+			return nil, ErrInvalidParameters;
+		}
+
+		seen[item.currency] = true;
+		items = append(items, item);
+	}
+
+	*result = WithdrawParams{
+		chain: chain,
+		items: items,
+	};
+
+	callback := extractCallback(1, data...);
+
+	return callback, nil;
+}
+
+func validateTipParams(
+	result *TipParams,
+	config *config.CrashConfig,
+	data ...any,
+) (func([]any, error), error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidParameters;
+	}
+
+	params, ok := data[0].(map[string]any);
+
+	if !ok {
 		return nil, ErrInvalidParameters;
 	}
 
+	recipient, ok1 := params["recipient"].(string);
+	amountStr, ok2 := params["amount"].(string);
+	currency, ok3 := params["currency"].(string);
+
+	if !ok1 || !ok2 || !ok3 {
+		return nil, ErrInvalidParameters;
+	}
+
+	if !common.IsHexAddress(recipient) {
+		return nil, ErrInvalidAddress;
+	}
+
 	amount, err := decimal.NewFromString(amountStr);
 
 	if err != nil {
@@ -260,7 +427,8 @@ func validateWithdrawParams(
 		return nil, ErrInvalidCurrency;
 	}
 
-	*result = WithdrawParams{
+	*result = TipParams{
+		recipient: common.HexToAddress(recipient).String(),
 		amount: amount,
 		currency: currency,
 	};
@@ -270,6 +438,51 @@ func validateWithdrawParams(
 	return callback, nil;
 }
 
+func validateSubmitWithdrawalParams(
+	result *SubmitWithdrawalParams,
+	config *config.CrashConfig,
+	data ...any,
+) (func([]any, error), error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidParameters;
+	}
+
+	params, ok := data[0].(map[string]any);
+
+	if !ok {
+		return nil, ErrInvalidParameters;
+	}
+
+	chain, err := parseChain(params, config);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	nonce, ok1 := params["nonce"].(float64);
+	txHash, ok2 := params["txHash"].(string);
+
+	if !ok1 || !ok2 || nonce < 0 || nonce != float64(int64(nonce)) {
+		return nil, ErrInvalidParameters;
+	}
+
+	hashBytes, err := hexutil.Decode(txHash);
+
+	if err != nil || len(hashBytes) != common.HashLength {
+		return nil, ErrInvalidTxHash;
+	}
+
+	*result = SubmitWithdrawalParams{
+		chain: chain,
+		nonce: int64(nonce),
+		txHash: common.BytesToHash(hashBytes),
+	};
+
+	callback := extractCallback(1, data...);
+
+	return callback, nil;
+}
+
 func extractCallback(index int, data ...any) func([]any, error) {
 	if len(data) != index + 1 {
 		return nil;
@@ -398,13 +611,25 @@ func main() {
 	});
 
 	io := socket.NewServer(nil, options);
-	bankObj, err := bank.NewBank(db);
+	bankObj, err := bank.NewBank(db, config);
 
 	if err != nil {
 		slog.Error("Failed to init bank");
 		return;
 	}
 
+	for currency := range config.Currencies {
+		if _, funded, err := bankObj.GetBankroll(currency); err == nil && !funded {
+			logger.Log(logging.Entry{
+				Payload: Log{
+					"msg"     : "Bankroll not funded; bet limits disabled",
+					"currency": currency,
+				},
+				Severity: logging.Warning,
+			});
+		}
+	}
+
 	gameObj, err := game.NewGame(io, db, config, logger, game.Bank(bankObj));
 
 	if err != nil {
@@ -412,11 +637,222 @@ func main() {
 		return;
 	}
 
-	http.HandleFunc("/nonce", corsWrapper(nonceHttpHandler, config));
+	payoutWorker := payouts.NewWorker(
+		db,
+		bankObj,
+		payouts.WorkerConfig{
+			MaxAttempts: config.Payouts.MaxAttempts,
+			BaseDelay: time.Duration(config.Payouts.BaseDelaySecs) * time.Second,
+			MaxDelay: time.Duration(config.Payouts.MaxDelaySecs) * time.Second,
+		},
+		gameObj.HandlePayoutCompleted,
+	);
+
+	if (config.Timers.PayoutRetryFrequencySecs > 0) {
+		payoutTicker := time.NewTicker(time.Duration(config.Timers.PayoutRetryFrequencySecs) * time.Second);
+
+		defer payoutTicker.Stop();
+
+		go func() {
+			for range payoutTicker.C {
+				if _, err := payoutWorker.ProcessDue(); err != nil {
+					logger.Log(logging.Entry{
+						Payload: Log{
+							"msg"  : "Failed to process pending payouts",
+							"error": err,
+						},
+						Severity: logging.Error,
+					});
+				}
+			}
+		}();
+	}
+
+	signers := make([]signer.Signer, 0, len(config.Signers));
+
+	for _, def := range config.Signers {
+		agentSigner, err := signer.New(def);
+
+		if err != nil {
+			slog.Error("Failed to load withdrawal signer", "type", def.Type, "error", err);
+			return;
+		}
+
+		signers = append(signers, agentSigner);
+	}
+
+	chains := make(map[string]*Chain);
+
+	for name := range config.Chains {
+		chain, err := openChain(name, config, db, bankObj, gameObj, logger, signers);
+
+		if err != nil {
+			slog.Error("Failed to init chain", "chain", name, "error", err);
+			return;
+		}
+
+		defer chain.Close();
+
+		chain.Start(config, logger);
+		chains[name] = chain;
+	}
+
+	limits := velocity.NewChecker(db, config);
+
+	sources := make(map[string]solvency.Source);
+	currencies := make([]string, 0, len(config.Currencies));
+
+	for currency := range config.Currencies {
+		currencies = append(currencies, currency);
+	}
+
+	for name, chain := range chains {
+		sources[name] = chain.coins;
+	}
+
+	solvencyMonitor := solvency.NewMonitor(
+		db,
+		sources,
+		currencies,
+		config.Solvency.MinCoverage,
+		func(coverage solvency.Coverage) {
+			if coverage.Short {
+				logger.Log(logging.Entry{
+					Payload: Log{
+						"msg"     : "Contract holdings below minimum coverage; withdrawals paused",
+						"currency": coverage.Currency,
+						"holdings": coverage.Holdings,
+						"balances": coverage.Balances,
+						"inFlight": coverage.InFlight,
+						"ratio"   : coverage.Ratio,
+					},
+					Severity: logging.Alert,
+				});
+			} else {
+				logger.Log(logging.Entry{
+					Payload: Log{
+						"msg"     : "Contract holdings coverage restored; withdrawals resumed",
+						"currency": coverage.Currency,
+						"ratio"   : coverage.Ratio,
+					},
+					Severity: logging.Notice,
+				});
+			}
+		},
+	);
+
+	if err = solvencyMonitor.Check(context.Background()); err != nil {
+		slog.Error("Failed to check solvency", "error", err);
+		return;
+	}
+
+	if (config.Timers.SolvencyCheckFrequencySecs > 0) {
+		solvencyTicker := time.NewTicker(time.Duration(config.Timers.SolvencyCheckFrequencySecs) * time.Second);
+
+		defer solvencyTicker.Stop();
+
+		go func() {
+			for range solvencyTicker.C {
+				if err := solvencyMonitor.Check(context.Background()); err != nil {
+					logger.Log(logging.Entry{
+						Payload: Log{
+							"msg"  : "Failed to check solvency",
+							"error": err,
+						},
+						Severity: logging.Error,
+					});
+				}
+			}
+		}();
+	}
+
+	nonces := auth.NewNonceStore(db, time.Duration(config.Auth.NonceTtlSecs) * time.Second);
+	verifier, err := auth.NewVerifier(nonces, config);
+
+	if err != nil {
+		slog.Error("Invalid sign-in configuration", "error", err);
+		return;
+	}
+
+	tokens, err := auth.NewTokens(config);
+
+	if err != nil {
+		slog.Error("Failed to load token keys", "error", err);
+		return;
+	}
 
+	sessions := auth.NewSessionStore(db, time.Duration(config.Tokens.RefreshTtlSecs) * time.Second);
+
+	http.HandleFunc("/nonce", corsWrapper(nonceHttpHandler(nonces), config));
+	http.HandleFunc("/logout-all", corsWrapper(logoutEverywhereHttpHandler(tokens, sessions, io, logger), config));
+	http.HandleFunc("/rounds/proof", corsWrapper(roundProofHttpHandler(db), config));
 	http.Handle("/socket.io/", io.ServeHandler(nil));
 	go http.ListenAndServe(":4000", nil);
 
+	adminWallets := make([]string, 0, len(config.Admin.Wallets));
+
+	for _, wallet := range config.Admin.Wallets {
+		if !common.IsHexAddress(wallet) {
+			slog.Error("Invalid admin wallet", "wallet", wallet);
+			return;
+		}
+
+		adminWallets = append(adminWallets, common.HexToAddress(wallet).Hex());
+	}
+
+	// Wallets taken out of the config lose the admin role and are
+	// signed out, since their tokens still carry it.
+	removedAdmins, err := auth.SyncConfigAdmins(db, adminWallets);
+
+	if err != nil {
+		slog.Error("Failed to sync admin wallets", "error", err);
+		return;
+	}
+
+	for _, wallet := range removedAdmins {
+		if _, err := sessions.RevokeWallet(wallet, REVOKED_BY_ROLES); err != nil {
+			slog.Error("Failed to revoke sessions of former admin", "wallet", wallet, "error", err);
+			return;
+		}
+
+		slog.Warn("Admin role removed", "wallet", wallet);
+	}
+
+	// The admin API listens separately, so that it can be kept off the
+	// public network; it is disabled if no address is configured.
+	if config.Admin.Listen != "" {
+		access := NewAdminAccess(tokens, sessions, db, logger);
+		adminMux := http.NewServeMux();
+
+		adminMux.HandleFunc("/admin/nonce", adminSignInWrapper(nonceHttpHandler(nonces), access));
+		adminMux.HandleFunc("/admin/login", adminSignInWrapper(adminLoginHttpHandler(verifier, sessions, tokens), access));
+		adminMux.HandleFunc("/admin/refresh", adminSignInWrapper(adminRefreshHttpHandler(sessions, tokens), access));
+		adminMux.HandleFunc("/admin/game", adminWrapper(gameStatusHttpHandler(gameObj), auth.PERM_GAME_VIEW, access));
+		adminMux.HandleFunc("/admin/game/pause", adminWrapper(gameControlHttpHandler(gameObj, true, logger), auth.PERM_GAME_CONTROL, access));
+		adminMux.HandleFunc("/admin/game/resume", adminWrapper(gameControlHttpHandler(gameObj, false, logger), auth.PERM_GAME_CONTROL, access));
+		adminMux.HandleFunc("/admin/balances", adminWrapper(balancesHttpHandler(bankObj), auth.PERM_BALANCES_VIEW, access));
+		adminMux.HandleFunc("/admin/ledger", adminWrapper(ledgerHttpHandler(bankObj), auth.PERM_LEDGER_VIEW, access));
+		adminMux.HandleFunc("/admin/bankroll", adminWrapper(bankrollHttpHandler(bankObj, gameObj), auth.PERM_TREASURY_VIEW, access));
+		adminMux.HandleFunc("/admin/bankroll/fund", adminWrapper(fundBankrollHttpHandler(bankObj, logger), auth.PERM_TREASURY_MANAGE, access));
+		adminMux.HandleFunc("/admin/events", adminWrapper(eventsHttpHandler(db), auth.PERM_TREASURY_VIEW, access));
+		adminMux.HandleFunc("/admin/events/reconcile", adminWrapper(reconcileEventsHttpHandler(db, chains), auth.PERM_TREASURY_VIEW, access));
+		adminMux.HandleFunc("/admin/payouts/dead", adminWrapper(deadPayoutsHttpHandler(db), auth.PERM_TREASURY_VIEW, access));
+		adminMux.HandleFunc("/admin/payouts/retry", adminWrapper(deadPayoutActionHttpHandler(db, false, logger), auth.PERM_TREASURY_MANAGE, access));
+		adminMux.HandleFunc("/admin/payouts/resolve", adminWrapper(deadPayoutActionHttpHandler(db, true, logger), auth.PERM_TREASURY_MANAGE, access));
+		adminMux.HandleFunc("/admin/solvency", adminWrapper(solvencyHttpHandler(solvencyMonitor), auth.PERM_TREASURY_VIEW, access));
+		adminMux.HandleFunc("/admin/withdrawals/review", adminWrapper(reviewWithdrawalsHttpHandler(db), auth.PERM_WITHDRAWALS_VIEW, access));
+		adminMux.HandleFunc("/admin/withdrawals/approve", adminWrapper(approveWithdrawalHttpHandler(db, chains, solvencyMonitor, gameObj, config, logger), auth.PERM_WITHDRAWALS_REVIEW, access));
+		adminMux.HandleFunc("/admin/withdrawals/reject", adminWrapper(rejectWithdrawalHttpHandler(db, bankObj, gameObj, logger), auth.PERM_WITHDRAWALS_REVIEW, access));
+		adminMux.HandleFunc("/admin/withdrawals/limits", adminWrapper(withdrawalLimitsHttpHandler(limits), auth.PERM_LIMITS_MANAGE, access));
+		adminMux.HandleFunc("/admin/bans", adminWrapper(bansHttpHandler(db, sessions, io, logger), auth.PERM_USERS_BAN, access));
+		adminMux.HandleFunc("/admin/sessions", adminWrapper(sessionsHttpHandler(sessions), auth.PERM_SESSIONS_MANAGE, access));
+		adminMux.HandleFunc("/admin/sessions/revoke", adminWrapper(revokeSessionsHttpHandler(db, sessions, io, logger), auth.PERM_SESSIONS_MANAGE, access));
+		adminMux.HandleFunc("/admin/roles", adminWrapper(rolesHttpHandler(db, sessions, io, logger), auth.PERM_ROLES_MANAGE, access));
+		adminMux.HandleFunc("/admin/audit", adminWrapper(auditHttpHandler(db), auth.PERM_AUDIT_VIEW, access));
+
+		go http.ListenAndServe(config.Admin.Listen, adminMux);
+	}
+
 	io.On("connection", func(clients ...any) {
 		client := clients[0].(*socket.Socket);
 
@@ -430,8 +866,16 @@ func main() {
 
 		gameObj.HandleConnect(client);
 
+		client.On("nonce", func(data ...any) {
+			nonceHandler(client, nonces, logger, data...);
+		});
+
 		client.On("authenticate", func(data ...any) {
-			authenticateHandler(client, logger, gameObj, data...);
+			authenticateHandler(client, verifier, tokens, sessions, logger, gameObj, data...);
+		});
+
+		client.On("refreshToken", func(data ...any) {
+			refreshTokenHandler(client, sessions, tokens, logger, data...);
 		});
 
 		client.On("disconnected", func(...any) {
@@ -453,13 +897,14 @@ func main() {
 			var params LoginParams;
 			callback, err := validateLoginParams(&params, data...);
 
-			if err := validateToken(params.token, &session); err != nil {
-				slog.Warn("Invalid session");
+			if err := validateToken(tokens, sessions, params.token, &session); err != nil {
+				slog.Warn("Invalid session", "error", err);
 
 				if callback != nil {
 					callback(
 						[]any{ map[string]any{
 							"success": false,
+							"errorCode": auth.ErrorCode(err),
 						} },
 						nil,
 					);
@@ -468,8 +913,15 @@ func main() {
 				return;
 			}
 
+			client.Join(sessionRoom(session.id));
 			gameObj.HandleLogin(client, session.wallet);
 
+			deviceToken, err := velocity.RecordDevice(db, session.wallet, params.deviceToken);
+
+			if err != nil {
+				slog.Error("Failed to record device", "wallet", session.wallet, "error", err);
+			}
+
 			logger.Log(logging.Entry{
 				Payload: Log{
 					"msg"   : "User logged in",
@@ -478,8 +930,8 @@ func main() {
 				Severity: logging.Info,
 			});
 
-			client.On("refreshToken", func(data ...any) {
-				refreshTokenHandler(client, session, logger, gameObj, data...);
+			client.On("logout", func(data ...any) {
+				logoutHandler(client, session, sessions, io, logger, data...);
 			});
 
 			client.On("placeBet", func(data ...any) {
@@ -494,14 +946,27 @@ func main() {
 				cashOutHandler(client, session, logger, gameObj, data...);
 			});
 
+			client.On("tip", func(data ...any) {
+				tipHandler(client, session, logger, gameObj, data...);
+			});
+
 			client.On("withdraw", func(data ...any) {
-				withdrawHandler(client, session, logger, bankObj, config, db, data...);
+				withdrawHandler(client, session, logger, bankObj, chains, limits, solvencyMonitor, config, db, data...);
+			});
+
+			client.On("submitWithdrawal", func(data ...any) {
+				submitWithdrawalHandler(client, session, logger, chains, config, data...);
+			});
+
+			client.On("listWithdrawals", func(data ...any) {
+				listWithdrawalsHandler(client, session, logger, db, data...);
 			});
 
 			if callback != nil {
 				callback(
 					[]any{ map[string]any{
-						"success": err == nil,
+						"success": true,
+						"deviceToken": deviceToken,
 					} },
 					nil,
 				);
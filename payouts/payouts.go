@@ -0,0 +1,407 @@
+package payouts;
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/bank"
+);
+
+var (
+	ErrPayoutNotClaimed = errors.New("payout already claimed or settled")
+	ErrPayoutNotDead = errors.New("payout is not in the dead-letter queue")
+)
+
+/**
+ * A dead payout has used up its attempts and waits for an admin, who
+ * either retries it or marks it resolved once the player has been
+ * made whole some other way.
+ */
+const (
+	STATUS_PENDING  = "pending";
+	STATUS_PAID     = "paid";
+	STATUS_DEAD     = "dead";
+	STATUS_RESOLVED = "resolved";
+);
+
+/**
+ * How long a worker may hold a claimed payout before another worker
+ * is allowed to pick it up again.
+ */
+const CLAIM_LEASE = 5 * time.Minute;
+
+const BATCH_SIZE = 100;
+
+type Payer interface {
+	PayWinnings(
+		string,
+		string,
+		decimal.Decimal,
+		string,
+		uuid.UUID,
+		bank.TxCallback,
+	) (decimal.Decimal, error);
+}
+
+type Payout struct {
+	Id int64 `json:"id"`;
+	Wallet string `json:"wallet"`;
+	Currency string `json:"currency"`;
+	Amount decimal.Decimal `json:"amount"`;
+	Reason string `json:"reason"`;
+	GameId uuid.UUID `json:"gameId"`;
+	Status string `json:"status"`;
+	Attempts int `json:"attempts"`;
+	LastError string `json:"lastError"`;
+	NextAttempt time.Time `json:"nextAttempt"`;
+	Created time.Time `json:"created"`;
+}
+
+type PaidCallback func(*Payout, decimal.Decimal);
+
+type WorkerConfig struct {
+	MaxAttempts int;
+	BaseDelay time.Duration;
+	MaxDelay time.Duration;
+}
+
+type Worker struct {
+	db *sql.DB;
+	payer Payer;
+	config WorkerConfig;
+	onPaid PaidCallback;
+}
+
+/**
+ * Records a credit that could not be made so that the worker can
+ * retry it later. The first retry is due immediately.
+ */
+func Enqueue(
+	db *sql.DB,
+	wallet string,
+	currency string,
+	amount decimal.Decimal,
+	reason string,
+	gameId uuid.UUID,
+	cause error,
+) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO pending_payouts
+		(wallet, currency, amount, reason, gameId, lastError)
+		VALUES
+		(?, ?, CAST(? AS Decimal(32, 18)), ?, ?, ?)
+	`, wallet, currency, amount.String(), reason, gameId.String(), cause.Error());
+
+	if err != nil {
+		return 0, err;
+	}
+
+	return result.LastInsertId();
+}
+
+func NewWorker(
+	db *sql.DB,
+	payer Payer,
+	config WorkerConfig,
+	onPaid PaidCallback,
+) *Worker {
+	return &Worker{
+		db: db,
+		payer: payer,
+		config: config,
+		onPaid: onPaid,
+	};
+}
+
+/**
+ * Exponential backoff: BaseDelay after the first failure, doubling
+ * with each further failure up to MaxDelay.
+ */
+func (worker *Worker) backoff(attempts int) time.Duration {
+	delay := worker.config.BaseDelay;
+
+	for i := 1; i < attempts; i++ {
+		delay *= 2;
+
+		if delay >= worker.config.MaxDelay {
+			return worker.config.MaxDelay;
+		}
+	}
+
+	return delay;
+}
+
+/**
+ * Attempts every payout that is due. Returns the number that were
+ * paid successfully.
+ */
+func (worker *Worker) ProcessDue() (int, error) {
+	due, err := queryPayouts(worker.db, `
+		WHERE status = ?
+		AND nextAttempt <= NOW(3)
+		ORDER BY nextAttempt
+		LIMIT ?
+	`, STATUS_PENDING, BATCH_SIZE);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	paid := 0;
+
+	for _, payout := range due {
+		if worker.process(payout) {
+			paid++;
+		}
+	}
+
+	return paid, nil;
+}
+
+func (worker *Worker) process(payout *Payout) bool {
+	// Push the next attempt out by the lease first, so that a second
+	// worker polling at the same time skips this payout.
+	result, err := worker.db.Exec(`
+		UPDATE pending_payouts
+		SET nextAttempt = NOW(3) + INTERVAL ? SECOND
+		WHERE id = ?
+		AND status = ?
+		AND nextAttempt <= NOW(3)
+	`, int(CLAIM_LEASE.Seconds()), payout.Id, STATUS_PENDING);
+
+	if err != nil {
+		slog.Error("Failed to claim payout", "payout", payout.Id, "error", err);
+		return false;
+	}
+
+	if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+		return false;
+	}
+
+	markPaid := func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE pending_payouts
+			SET status = ?, attempts = attempts + 1, updated = NOW(3)
+			WHERE id = ?
+			AND status = ?
+		`, STATUS_PAID, payout.Id, STATUS_PENDING);
+
+		if err != nil {
+			return err;
+		}
+
+		if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+			return ErrPayoutNotClaimed;
+		}
+
+		return nil;
+	};
+
+	newBalance, err := worker.payer.PayWinnings(
+		payout.Wallet,
+		payout.Currency,
+		payout.Amount,
+		payout.Reason,
+		payout.GameId,
+		markPaid,
+	);
+
+	if err == nil {
+		slog.Info(
+			"Pending payout credited",
+			"payout", payout.Id,
+			"wallet", payout.Wallet,
+			"attempts", payout.Attempts + 1,
+		);
+
+		payout.Status = STATUS_PAID;
+		payout.Attempts++;
+
+		if worker.onPaid != nil {
+			worker.onPaid(payout, newBalance);
+		}
+
+		return true;
+	}
+
+	worker.recordFailure(payout, err);
+
+	return false;
+}
+
+func (worker *Worker) recordFailure(payout *Payout, cause error) {
+	attempts := payout.Attempts + 1;
+	status := STATUS_PENDING;
+
+	if attempts >= worker.config.MaxAttempts {
+		status = STATUS_DEAD;
+	}
+
+	delay := worker.backoff(attempts);
+
+	_, err := worker.db.Exec(`
+		UPDATE pending_payouts
+		SET status = ?, attempts = ?, lastError = ?,
+		nextAttempt = NOW(3) + INTERVAL ? SECOND, updated = NOW(3)
+		WHERE id = ?
+		AND status = ?
+	`, status, attempts, cause.Error(), int(delay.Seconds()), payout.Id, STATUS_PENDING);
+
+	if err != nil {
+		slog.Error("Failed to record payout failure", "payout", payout.Id, "error", err);
+		return;
+	}
+
+	if status == STATUS_DEAD {
+		slog.Error(
+			"Payout moved to dead-letter queue",
+			"payout", payout.Id,
+			"wallet", payout.Wallet,
+			"amount", payout.Amount,
+			"currency", payout.Currency,
+			"error", cause,
+		);
+		return;
+	}
+
+	slog.Warn(
+		"Payout retry failed",
+		"payout", payout.Id,
+		"attempts", attempts,
+		"retryIn", delay,
+		"error", cause,
+	);
+}
+
+/**
+ * Payouts for the wallet that have not been credited yet, including
+ * those that have been given up on and await manual attention.
+ */
+func ListPending(db *sql.DB, wallet string) ([]*Payout, error) {
+	return queryPayouts(db, `
+		WHERE wallet = ?
+		AND status IN (?, ?)
+		ORDER BY created
+	`, wallet, STATUS_PENDING, STATUS_DEAD);
+}
+
+func ListDead(db *sql.DB) ([]*Payout, error) {
+	return queryPayouts(db, `
+		WHERE status = ?
+		ORDER BY created
+	`, STATUS_DEAD);
+}
+
+func GetById(db *sql.DB, id int64) (*Payout, error) {
+	payouts, err := queryPayouts(db, `
+		WHERE id = ?
+	`, id);
+
+	if err != nil || len(payouts) == 0 {
+		return nil, err;
+	}
+
+	return payouts[0], nil;
+}
+
+/**
+ * Puts a dead payout back in the queue with its attempts reset. The
+ * first retry is due immediately.
+ */
+func Retry(db *sql.DB, id int64) error {
+	return moveDead(db, id, `
+		status = ?, attempts = 0, nextAttempt = NOW(3), updated = NOW(3)
+	`, STATUS_PENDING);
+}
+
+/**
+ * Closes a dead payout without crediting it.
+ */
+func Resolve(db *sql.DB, id int64) error {
+	return moveDead(db, id, `
+		status = ?, updated = NOW(3)
+	`, STATUS_RESOLVED);
+}
+
+func moveDead(db *sql.DB, id int64, set string, status string) error {
+	result, err := db.Exec(`
+		UPDATE pending_payouts
+		SET ` + set + `
+		WHERE id = ?
+		AND status = ?
+	`, status, id, STATUS_DEAD);
+
+	if err != nil {
+		return err;
+	}
+
+	if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+		return ErrPayoutNotDead;
+	}
+
+	return nil;
+}
+
+func queryPayouts(db *sql.DB, where string, args ...any) ([]*Payout, error) {
+	rows, err := db.Query(`
+		SELECT id, wallet, currency, amount, reason, gameId, status,
+		attempts, COALESCE(lastError, ''),
+		FLOOR(1000 * UNIX_TIMESTAMP(nextAttempt)) AS nextAttempt,
+		FLOOR(1000 * UNIX_TIMESTAMP(created)) AS created
+		FROM pending_payouts
+	` + where, args...);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	payouts := make([]*Payout, 0);
+
+	for rows.Next() {
+		var payout Payout;
+		var amountStr string;
+		var gameIdStr string;
+		var nextAttempt int64;
+		var created int64;
+
+		err := rows.Scan(
+			&payout.Id,
+			&payout.Wallet,
+			&payout.Currency,
+			&amountStr,
+			&payout.Reason,
+			&gameIdStr,
+			&payout.Status,
+			&payout.Attempts,
+			&payout.LastError,
+			&nextAttempt,
+			&created,
+		);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if payout.Amount, err = decimal.NewFromString(amountStr); err != nil {
+			return nil, err;
+		}
+
+		if payout.GameId, err = uuid.Parse(gameIdStr); err != nil {
+			return nil, err;
+		}
+
+		payout.NextAttempt = time.UnixMilli(nextAttempt);
+		payout.Created = time.UnixMilli(created);
+
+		payouts = append(payouts, &payout);
+	}
+
+	return payouts, rows.Err();
+}
@@ -0,0 +1,269 @@
+package payouts;
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/config"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"database/sql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var db *sql.DB;
+var bankObj *bank.Bank;
+
+var errTest = errors.New("test failure");
+
+type flakyPayer struct {
+	failures int;
+}
+
+func (payer *flakyPayer) PayWinnings(
+	wallet string,
+	currency string,
+	amount decimal.Decimal,
+	reason string,
+	gameId uuid.UUID,
+	txCallback bank.TxCallback,
+) (decimal.Decimal, error) {
+	if payer.failures > 0 {
+		payer.failures--;
+		return decimal.Zero, errTest;
+	}
+
+	return bankObj.PayWinnings(wallet, currency, amount, reason, gameId, txCallback);
+}
+
+func init() {
+	config, err := config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+
+	dbConfig := mysql.Config{
+		User: config.Database.User,
+		DBName: config.Database.DBName,
+		Addr: config.Database.Addr,
+		AllowNativePasswords: true,
+	};
+
+	db, err = sql.Open("mysql", dbConfig.FormatDSN());
+
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err)
+	}
+
+	bankObj, err = bank.NewBank(db, config);
+
+	if err != nil {
+		log.Fatal("Bank construction failed: ", err);
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	worker := NewWorker(nil, nil, WorkerConfig{
+		MaxAttempts: 10,
+		BaseDelay: 5 * time.Second,
+		MaxDelay: time.Minute,
+	}, nil);
+
+	expected := []time.Duration{
+		5 * time.Second,
+		10 * time.Second,
+		20 * time.Second,
+		40 * time.Second,
+		time.Minute,
+		time.Minute,
+	};
+
+	for i, delay := range expected {
+		if actual := worker.backoff(i + 1); actual != delay {
+			t.Fatal("backoff() incorrect for attempt ", i + 1, ": ", actual);
+		}
+	}
+}
+
+func TestRetryPayout(t *testing.T) {
+	randomUser, err := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	gameId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	payoutId, err := Enqueue(db, wallet, "eth", decimal.NewFromInt(3), "Cashout", gameId, errTest);
+
+	if err != nil {
+		t.Fatal("Failed to enqueue payout: ", err);
+	}
+
+	var paid []int64;
+
+	worker := NewWorker(db, &flakyPayer{ failures: 1 }, WorkerConfig{
+		MaxAttempts: 5,
+	}, func(payout *Payout, balance decimal.Decimal) {
+		paid = append(paid, payout.Id);
+	});
+
+	if _, err := worker.ProcessDue(); err != nil {
+		t.Fatal("Failed to process payouts: ", err);
+	}
+
+	if slices.Contains(paid, payoutId) {
+		t.Fatal("Payout reported paid despite failure");
+	}
+
+	if _, err := worker.ProcessDue(); err != nil {
+		t.Fatal("Failed to process payouts: ", err);
+	}
+
+	if !slices.Contains(paid, payoutId) {
+		t.Fatal("Payout not paid on retry");
+	}
+
+	if _, err := worker.ProcessDue(); err != nil {
+		t.Fatal("Failed to process payouts: ", err);
+	}
+
+	balance, err := bankObj.GetBalance(wallet, "eth");
+
+	if err != nil || !balance.Equal(decimal.NewFromInt(3)) {
+		t.Fatal("Payout credited incorrectly: ", balance);
+	}
+
+	pending, err := ListPending(db, wallet);
+
+	if err != nil || len(pending) != 0 {
+		t.Fatal("Paid payout still listed as pending");
+	}
+}
+
+func TestDeadPayout(t *testing.T) {
+	randomUser, err := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	gameId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	payoutId, err := Enqueue(db, wallet, "eth", decimal.NewFromInt(3), "Cashout", gameId, errTest);
+
+	if err != nil {
+		t.Fatal("Failed to enqueue payout: ", err);
+	}
+
+	worker := NewWorker(db, &flakyPayer{ failures: 1 }, WorkerConfig{
+		MaxAttempts: 1,
+	}, nil);
+
+	if _, err := worker.ProcessDue(); err != nil {
+		t.Fatal("Failed to process payouts: ", err);
+	}
+
+	dead, err := ListDead(db);
+
+	if err != nil {
+		t.Fatal("Failed to list dead payouts: ", err);
+	}
+
+	found := slices.ContainsFunc(dead, func(payout *Payout) bool {
+		return payout.Id == payoutId && payout.Attempts == 1;
+	});
+
+	if !found {
+		t.Fatal("Failed payout not moved to dead-letter queue");
+	}
+
+	pending, err := ListPending(db, wallet);
+
+	if err != nil || len(pending) != 1 || pending[0].Status != STATUS_DEAD {
+		t.Fatal("Dead payout not listed for player");
+	}
+}
+
+func TestRetryAndResolveDeadPayouts(t *testing.T) {
+	randomUser, err := crypto.GenerateKey();
+	wallet := crypto.PubkeyToAddress(randomUser.PublicKey).String();
+
+	gameId, err := uuid.NewV7();
+
+	if err != nil {
+		t.Fatal("Failed to create uuid");
+	}
+
+	retried, err := Enqueue(db, wallet, "eth", decimal.NewFromInt(2), "Cashout", gameId, errTest);
+
+	if err != nil {
+		t.Fatal("Failed to enqueue payout: ", err);
+	}
+
+	resolved, err := Enqueue(db, wallet, "eth", decimal.NewFromInt(5), "Cashout", gameId, errTest);
+
+	if err != nil {
+		t.Fatal("Failed to enqueue payout: ", err);
+	}
+
+	if err := Retry(db, retried); err != ErrPayoutNotDead {
+		t.Fatal("Retried a payout that was not dead: ", err);
+	}
+
+	failing := NewWorker(db, &flakyPayer{ failures: BATCH_SIZE }, WorkerConfig{
+		MaxAttempts: 1,
+	}, nil);
+
+	if _, err := failing.ProcessDue(); err != nil {
+		t.Fatal("Failed to process payouts: ", err);
+	}
+
+	if err := Retry(db, retried); err != nil {
+		t.Fatal("Failed to retry dead payout: ", err);
+	}
+
+	if err := Resolve(db, resolved); err != nil {
+		t.Fatal("Failed to resolve dead payout: ", err);
+	}
+
+	if err := Retry(db, resolved); err != ErrPayoutNotDead {
+		t.Fatal("Retried a resolved payout: ", err);
+	}
+
+	payout, err := GetById(db, retried);
+
+	if err != nil || payout == nil || payout.Status != STATUS_PENDING || payout.Attempts != 0 {
+		t.Fatal("Retried payout not back in the queue: ", payout, err);
+	}
+
+	worker := NewWorker(db, &flakyPayer{}, WorkerConfig{
+		MaxAttempts: 1,
+	}, nil);
+
+	if _, err := worker.ProcessDue(); err != nil {
+		t.Fatal("Failed to process payouts: ", err);
+	}
+
+	balance, err := bankObj.GetBalance(wallet, "eth");
+
+	if err != nil || !balance.Equal(decimal.NewFromInt(2)) {
+		t.Fatal("Retried payout credited incorrectly: ", balance);
+	}
+
+	pending, err := ListPending(db, wallet);
+
+	if err != nil || len(pending) != 0 {
+		t.Fatal("Settled payouts still listed for player: ", pending);
+	}
+}
@@ -2,6 +2,8 @@ package rates
 
 import (
 	"database/sql"
+
+	"github.com/shopspring/decimal"
 );
 
 func (rates *Rates) SaveRates(prices RatesResult, db *sql.DB) (error) {
@@ -21,3 +23,41 @@ func (rates *Rates) SaveRates(prices RatesResult, db *sql.DB) (error) {
 
 	return nil;
 }
+
+/**
+ * The last saved rate of every crypto against the given fiat.
+ */
+func LoadRates(db *sql.DB, fiatId string) (map[string]decimal.Decimal, error) {
+	rows, err := db.Query(`
+		SELECT base, ratio
+		FROM rates
+		WHERE target = ?
+	`, fiatId);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	result := make(map[string]decimal.Decimal);
+
+	for rows.Next() {
+		var cryptoId string;
+		var ratioStr string;
+
+		if err := rows.Scan(&cryptoId, &ratioStr); err != nil {
+			return nil, err;
+		}
+
+		ratio, err := decimal.NewFromString(ratioStr);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		result[cryptoId] = ratio;
+	}
+
+	return result, rows.Err();
+}
@@ -0,0 +1,175 @@
+package signer;
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	"github.com/samott/crash-backend/contract"
+);
+
+var (
+	ErrAgentKeyMismatch = errors.New("no signer for the on-chain agent address")
+	ErrAgentUnknown = errors.New("on-chain agent address not checked yet")
+)
+
+/**
+ * Called when the contract's agent address differs from the one seen
+ * on the previous check. usable reports whether one of our signers
+ * holds the key for the new address.
+ */
+type AgentChangeHandler func(previous common.Address, current common.Address, usable bool);
+
+/**
+ * Signs with whichever configured signer matches the contract's
+ * current agentAddress, and refuses to sign when none does, since the
+ * contract would reject the voucher anyway.
+ *
+ * During a key rotation both the old and the new key are configured.
+ * Until setAgentAddress is mined the old key keeps signing; from the
+ * next check after that the new one takes over. The contract has no
+ * event for setAgentAddress, so changes are found by polling Refresh.
+ */
+type Agent struct {
+	contract *contract.CrashCaller;
+	signers map[common.Address]Signer;
+	onChange AgentChangeHandler;
+	lock sync.RWMutex;
+	current common.Address;
+	checked bool;
+}
+
+func NewAgent(
+	caller bind.ContractCaller,
+	address common.Address,
+	signers []Signer,
+	onChange AgentChangeHandler,
+) (*Agent, error) {
+	crash, err := contract.NewCrashCaller(address, caller);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	byAddress := make(map[common.Address]Signer);
+
+	for _, signer := range signers {
+		byAddress[signer.Address()] = signer;
+	}
+
+	return &Agent{
+		contract: crash,
+		signers: byAddress,
+		onChange: onChange,
+	}, nil;
+}
+
+/**
+ * Reads agentAddress from the contract and switches to the matching
+ * signer. Returns ErrAgentKeyMismatch if we hold no key for it; the
+ * address is still recorded so that signing stays refused.
+ */
+func (agent *Agent) Refresh(ctx context.Context) error {
+	current, err := agent.contract.AgentAddress(&bind.CallOpts{ Context: ctx });
+
+	if err != nil {
+		return err;
+	}
+
+	agent.lock.Lock();
+	previous, checked := agent.current, agent.checked;
+	agent.current, agent.checked = current, true;
+	agent.lock.Unlock();
+
+	_, usable := agent.signers[current];
+
+	if checked && previous != current {
+		slog.Warn(
+			"Agent address changed on-chain",
+			"previous", previous,
+			"current", current,
+			"usable", usable,
+		);
+
+		if agent.onChange != nil {
+			agent.onChange(previous, current, usable);
+		}
+	}
+
+	if !usable {
+		return ErrAgentKeyMismatch;
+	}
+
+	return nil;
+}
+
+/**
+ * The agent address last read from the contract.
+ */
+func (agent *Agent) Address() common.Address {
+	agent.lock.RLock();
+	defer agent.lock.RUnlock();
+
+	return agent.current;
+}
+
+/**
+ * Addresses of all configured signers, for logging at startup.
+ */
+func (agent *Agent) Addresses() []common.Address {
+	addresses := make([]common.Address, 0, len(agent.signers));
+
+	for address := range agent.signers {
+		addresses = append(addresses, address);
+	}
+
+	return addresses;
+}
+
+func (agent *Agent) SignTypedData(data apitypes.TypedData) ([]byte, error) {
+	signer, err := agent.signer();
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return signer.SignTypedData(data);
+}
+
+func (agent *Agent) SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	signer, err := agent.signer();
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return signer.SignTx(tx, chainId);
+}
+
+/**
+ * The signer for the agent address last read from the contract.
+ */
+func (agent *Agent) signer() (Signer, error) {
+	agent.lock.RLock();
+	current, checked := agent.current, agent.checked;
+	agent.lock.RUnlock();
+
+	if !checked {
+		return nil, ErrAgentUnknown;
+	}
+
+	signer, ok := agent.signers[current];
+
+	if !ok {
+		return nil, ErrAgentKeyMismatch;
+	}
+
+	return signer, nil;
+}
@@ -0,0 +1,133 @@
+package signer;
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+);
+
+const EXTERNAL_TIMEOUT = 30 * time.Second;
+
+/**
+ * Delegates signing to a separate process listening on a local socket
+ * and speaking the clef external API (account_signTypedData), so the
+ * key never enters this process. Every signature is recovered and
+ * checked against the configured address before it is returned.
+ */
+type ExternalSigner struct {
+	client *rpc.Client;
+	address common.Address;
+}
+
+func NewExternalSigner(socket string, address common.Address) (*ExternalSigner, error) {
+	client, err := rpc.Dial(socket);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return &ExternalSigner{
+		client: client,
+		address: address,
+	}, nil;
+}
+
+func (signer *ExternalSigner) Address() common.Address {
+	return signer.address;
+}
+
+func (signer *ExternalSigner) SignTypedData(data apitypes.TypedData) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), EXTERNAL_TIMEOUT);
+	defer cancel();
+
+	var signature hexutil.Bytes;
+
+	err := signer.client.CallContext(
+		ctx,
+		&signature,
+		"account_signTypedData",
+		common.NewMixedcaseAddress(signer.address),
+		data,
+	);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	if len(signature) != 65 {
+		return nil, ErrInvalidSignature;
+	}
+
+	if signature[64] == 0 || signature[64] == 1 {
+		signature[64] += 27;
+	}
+
+	recovered, err := Recover(data, signature);
+
+	if err != nil || recovered != signer.address {
+		return nil, ErrInvalidSignature;
+	}
+
+	return signature, nil;
+}
+
+/**
+ * Signs a legacy transaction with account_signTransaction. The result
+ * is only accepted if it is the transaction we asked for, signed by
+ * the configured address.
+ */
+func (signer *ExternalSigner) SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), EXTERNAL_TIMEOUT);
+	defer cancel();
+
+	from := common.NewMixedcaseAddress(signer.address);
+	input := hexutil.Bytes(tx.Data());
+
+	args := apitypes.SendTxArgs{
+		From: from,
+		Gas: hexutil.Uint64(tx.Gas()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Value: hexutil.Big(*tx.Value()),
+		Nonce: hexutil.Uint64(tx.Nonce()),
+		Input: &input,
+		ChainID: (*hexutil.Big)(chainId),
+	};
+
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To());
+		args.To = &to;
+	}
+
+	var result struct {
+		Raw hexutil.Bytes `json:"raw"`;
+	};
+
+	if err := signer.client.CallContext(ctx, &result, "account_signTransaction", args); err != nil {
+		return nil, err;
+	}
+
+	var signed types.Transaction;
+
+	if err := signed.UnmarshalBinary(result.Raw); err != nil {
+		return nil, err;
+	}
+
+	txSigner := types.LatestSignerForChainID(chainId);
+	sender, err := types.Sender(txSigner, &signed);
+
+	if err != nil || sender != signer.address || txSigner.Hash(&signed) != txSigner.Hash(tx) {
+		return nil, ErrInvalidSignature;
+	}
+
+	return &signed, nil;
+}
+
+func (signer *ExternalSigner) Close() {
+	signer.client.Close();
+}
@@ -0,0 +1,35 @@
+package signer;
+
+import (
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+);
+
+/**
+ * Unlocks a go-ethereum encrypted JSON key file with the password in
+ * passwordFile. Trailing newlines in the password file are ignored.
+ * Neither the password nor the key is kept beyond what signing needs.
+ */
+func NewKeystoreSigner(keyFile string, passwordFile string) (*KeySigner, error) {
+	keyJson, err := os.ReadFile(keyFile);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	password, err := os.ReadFile(passwordFile);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	key, err := keystore.DecryptKey(keyJson, strings.TrimRight(string(password), "\r\n"));
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return NewKeySigner(key.PrivateKey), nil;
+}
@@ -0,0 +1,133 @@
+package signer;
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	"github.com/samott/crash-backend/config"
+);
+
+var (
+	ErrUnknownSignerType = errors.New("unknown signer type")
+	ErrInvalidAddress = errors.New("invalid signer address")
+	ErrInvalidSignature = errors.New("invalid signature from signer")
+)
+
+const (
+	TYPE_KEYSTORE = "keystore";
+	TYPE_EXTERNAL = "external";
+);
+
+/**
+ * Produces EIP-712 signatures for the agent account. Signatures are
+ * 65 bytes with V in {27, 28}, as expected by the contract. SignTx
+ * signs transactions sent from the agent account itself, such as
+ * round anchors.
+ */
+type Signer interface {
+	Address() common.Address;
+	SignTypedData(apitypes.TypedData) ([]byte, error);
+	SignTx(*types.Transaction, *big.Int) (*types.Transaction, error);
+}
+
+/**
+ * Creates the signer described by a configuration entry. The keystore is
+ * decrypted here, once, rather than on every signature.
+ */
+func New(def config.SignerDef) (Signer, error) {
+	switch def.Type {
+	case TYPE_KEYSTORE:
+		return NewKeystoreSigner(def.KeystoreFile, def.PasswordFile);
+	case TYPE_EXTERNAL:
+		if !common.IsHexAddress(def.Address) {
+			return nil, ErrInvalidAddress;
+		}
+
+		return NewExternalSigner(def.Socket, common.HexToAddress(def.Address));
+	default:
+		return nil, ErrUnknownSignerType;
+	}
+}
+
+/**
+ * Signs with a private key held in memory. The key is unexported and
+ * String is overridden, so that printing the signer cannot reveal it.
+ */
+type KeySigner struct {
+	key *ecdsa.PrivateKey;
+	address common.Address;
+}
+
+func NewKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{
+		key: key,
+		address: crypto.PubkeyToAddress(key.PublicKey),
+	};
+}
+
+func (signer *KeySigner) Address() common.Address {
+	return signer.address;
+}
+
+func (signer *KeySigner) String() string {
+	return "KeySigner(" + signer.address.Hex() + ")";
+}
+
+func (signer *KeySigner) SignTypedData(data apitypes.TypedData) ([]byte, error) {
+	sighash, _, err := apitypes.TypedDataAndHash(data);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	signature, err := crypto.Sign(sighash, signer.key);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	signature[64] += 27;
+
+	return signature, nil;
+}
+
+func (signer *KeySigner) SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainId), signer.key);
+}
+
+/**
+ * Returns the address that produced a signature over the typed data.
+ * Used to check signers that are not under our control.
+ */
+func Recover(data apitypes.TypedData, signature []byte) (common.Address, error) {
+	if len(signature) != 65 {
+		return common.Address{}, ErrInvalidSignature;
+	}
+
+	sighash, _, err := apitypes.TypedDataAndHash(data);
+
+	if err != nil {
+		return common.Address{}, err;
+	}
+
+	sig := make([]byte, 65);
+	copy(sig, signature);
+
+	if sig[64] >= 27 {
+		sig[64] -= 27;
+	}
+
+	pubKey, err := crypto.SigToPub(sighash, sig);
+
+	if err != nil {
+		return common.Address{}, err;
+	}
+
+	return crypto.PubkeyToAddress(*pubKey), nil;
+}
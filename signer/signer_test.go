@@ -0,0 +1,344 @@
+package signer;
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/google/uuid"
+
+	"github.com/samott/crash-backend/chaintest"
+	"github.com/samott/crash-backend/contract"
+);
+
+func testTypedData() apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{ Name: "name", Type: "string" },
+				{ Name: "chainId", Type: "uint256" },
+			},
+			"Mail": {
+				{ Name: "to", Type: "address" },
+				{ Name: "amount", Type: "uint256" },
+			},
+		},
+		PrimaryType: "Mail",
+		Domain: apitypes.TypedDataDomain{
+			Name: "Test",
+			ChainId: math.NewHexOrDecimal256(1),
+		},
+		Message: apitypes.TypedDataMessage{
+			"to": "0x1111111111111111111111111111111111111111",
+			"amount": "1000",
+		},
+	};
+}
+
+func checkSignature(t *testing.T, signer Signer, want common.Address) {
+	data := testTypedData();
+
+	sig, err := signer.SignTypedData(data);
+
+	if err != nil {
+		t.Fatal("Failed to sign: ", err);
+	}
+
+	if len(sig) != 65 || (sig[64] != 27 && sig[64] != 28) {
+		t.Fatal("Malformed signature: ", hexutil.Encode(sig));
+	}
+
+	recovered, err := Recover(data, sig);
+
+	if err != nil || recovered != want {
+		t.Fatal("Signature recovers to wrong address: ", recovered, err);
+	}
+
+	chainId := big.NewInt(5);
+	signed, err := signer.SignTx(testTx(), chainId);
+
+	if err != nil {
+		t.Fatal("Failed to sign transaction: ", err);
+	}
+
+	sender, err := types.Sender(types.LatestSignerForChainID(chainId), signed);
+
+	if err != nil || sender != want {
+		t.Fatal("Transaction signed by wrong address: ", sender, err);
+	}
+}
+
+func testTx() *types.Transaction {
+	to := common.HexToAddress("0x1111111111111111111111111111111111111111");
+
+	return types.NewTx(&types.LegacyTx{
+		Nonce: 3,
+		GasPrice: big.NewInt(1000000000),
+		Gas: 21000,
+		To: &to,
+		Data: []byte{ 1, 2, 3 },
+	});
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	dir := t.TempDir();
+
+	key := &keystore.Key{
+		Id: uuid.New(),
+	};
+
+	key.PrivateKey, _ = crypto.GenerateKey();
+	key.Address = crypto.PubkeyToAddress(key.PrivateKey.PublicKey);
+
+	keyJson, err := keystore.EncryptKey(key, "secret", keystore.LightScryptN, keystore.LightScryptP);
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	keyFile := filepath.Join(dir, "agent.json");
+	passwordFile := filepath.Join(dir, "agent.password");
+
+	os.WriteFile(keyFile, keyJson, 0600);
+	os.WriteFile(passwordFile, []byte("secret\n"), 0600);
+
+	signer, err := NewKeystoreSigner(keyFile, passwordFile);
+
+	if err != nil {
+		t.Fatal("Failed to unlock keystore: ", err);
+	}
+
+	if signer.Address() != key.Address {
+		t.Fatal("Wrong address: ", signer.Address());
+	}
+
+	checkSignature(t, signer, key.Address);
+
+	hexKey := hexutil.Encode(crypto.FromECDSA(key.PrivateKey))[2:];
+
+	if printed := fmt.Sprintf("%v %+v %s", signer, signer, signer); strings.Contains(printed, hexKey) {
+		t.Fatal("Printing the signer reveals the key");
+	}
+
+	os.WriteFile(passwordFile, []byte("wrong\n"), 0600);
+
+	if _, err := NewKeystoreSigner(keyFile, passwordFile); err == nil {
+		t.Fatal("Keystore unlocked with wrong password");
+	}
+}
+
+type fakeClef struct {
+	key *ecdsa.PrivateKey;
+}
+
+func (clef *fakeClef) SignTypedData(
+	ctx context.Context,
+	addr common.MixedcaseAddress,
+	data apitypes.TypedData,
+) (hexutil.Bytes, error) {
+	return NewKeySigner(clef.key).SignTypedData(data);
+}
+
+func (clef *fakeClef) SignTransaction(
+	ctx context.Context,
+	args apitypes.SendTxArgs,
+) (map[string]hexutil.Bytes, error) {
+	to := args.To.Address();
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce: uint64(args.Nonce),
+		GasPrice: args.GasPrice.ToInt(),
+		Gas: uint64(args.Gas),
+		To: &to,
+		Value: args.Value.ToInt(),
+		Data: *args.Input,
+	});
+
+	signed, err := NewKeySigner(clef.key).SignTx(tx, args.ChainID.ToInt());
+
+	if err != nil {
+		return nil, err;
+	}
+
+	raw, err := signed.MarshalBinary();
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return map[string]hexutil.Bytes{ "raw": raw }, nil;
+}
+
+func startFakeClef(t *testing.T, key *ecdsa.PrivateKey) string {
+	socket := filepath.Join(t.TempDir(), "clef.ipc");
+
+	listener, err := net.Listen("unix", socket);
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	server := rpc.NewServer();
+	server.RegisterName("account", &fakeClef{ key: key });
+
+	go server.ServeListener(listener);
+
+	t.Cleanup(func() {
+		server.Stop();
+		listener.Close();
+	});
+
+	return socket;
+}
+
+func TestExternalSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey();
+	address := crypto.PubkeyToAddress(key.PublicKey);
+
+	signer, err := NewExternalSigner(startFakeClef(t, key), address);
+
+	if err != nil {
+		t.Fatal("Failed to connect to signer: ", err);
+	}
+
+	defer signer.Close();
+
+	checkSignature(t, signer, address);
+
+	// A signer answering with a different key must be rejected.
+	other, _ := crypto.GenerateKey();
+
+	signer, err = NewExternalSigner(startFakeClef(t, other), address);
+
+	if err != nil {
+		t.Fatal("Failed to connect to signer: ", err);
+	}
+
+	defer signer.Close();
+
+	if _, err := signer.SignTypedData(testTypedData()); err != ErrInvalidSignature {
+		t.Fatal("Expected ErrInvalidSignature, got: ", err);
+	}
+
+	if _, err := signer.SignTx(testTx(), big.NewInt(5)); err != ErrInvalidSignature {
+		t.Fatal("Expected ErrInvalidSignature for transaction, got: ", err);
+	}
+}
+
+func TestAgentFollowsRotation(t *testing.T) {
+	crashAbi, err := contract.CrashMetaData.GetAbi();
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	defer chain.Close();
+
+	register, err := chain.DeployRegister();
+
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	setAgentAddress := func(address common.Address) {
+		input, err := crashAbi.Pack("setAgentAddress", address);
+
+		if err != nil {
+			t.Fatal(err);
+		}
+
+		if _, err := chain.SendTx(&register, input); err != nil {
+			t.Fatal(err);
+		}
+
+		chain.Commit();
+	};
+
+	oldKey, _ := crypto.GenerateKey();
+	newKey, _ := crypto.GenerateKey();
+	unknownKey, _ := crypto.GenerateKey();
+
+	oldSigner := NewKeySigner(oldKey);
+	newSigner := NewKeySigner(newKey);
+
+	type change struct {
+		previous common.Address;
+		current common.Address;
+		usable bool;
+	}
+
+	changes := make([]change, 0);
+
+	agent, err := NewAgent(
+		chain.Client,
+		register,
+		[]Signer{ oldSigner, newSigner },
+		func(previous common.Address, current common.Address, usable bool) {
+			changes = append(changes, change{ previous, current, usable });
+		},
+	);
+
+	if err != nil {
+		t.Fatal("Failed to create agent: ", err);
+	}
+
+	ctx := context.Background();
+
+	if _, err := agent.SignTypedData(testTypedData()); err != ErrAgentUnknown {
+		t.Fatal("Signed before checking the agent address: ", err);
+	}
+
+	setAgentAddress(oldSigner.Address());
+
+	if err := agent.Refresh(ctx); err != nil {
+		t.Fatal("Refresh failed: ", err);
+	}
+
+	checkSignature(t, agent, oldSigner.Address());
+
+	setAgentAddress(newSigner.Address());
+
+	if err := agent.Refresh(ctx); err != nil {
+		t.Fatal("Refresh failed after rotation: ", err);
+	}
+
+	checkSignature(t, agent, newSigner.Address());
+
+	setAgentAddress(crypto.PubkeyToAddress(unknownKey.PublicKey));
+
+	if err := agent.Refresh(ctx); err != ErrAgentKeyMismatch {
+		t.Fatal("Expected ErrAgentKeyMismatch, got: ", err);
+	}
+
+	if _, err := agent.SignTypedData(testTypedData()); err != ErrAgentKeyMismatch {
+		t.Fatal("Signed with a key the contract does not accept: ", err);
+	}
+
+	if len(changes) != 2 || !changes[0].usable || changes[1].usable {
+		t.Fatal("Unexpected change notifications: ", changes);
+	}
+
+	if changes[0].previous != oldSigner.Address() || changes[0].current != newSigner.Address() {
+		t.Fatal("Wrong rotation reported: ", changes[0]);
+	}
+}
@@ -0,0 +1,278 @@
+package solvency;
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+/**
+ * Something holding funds for players, i.e. one chain's contract.
+ */
+type Source interface {
+	Holdings(ctx context.Context) (map[string]decimal.Decimal, error);
+}
+
+/**
+ * Called when a currency's coverage falls below the minimum or
+ * recovers.
+ */
+type ChangeHandler func(coverage Coverage);
+
+/**
+ * How well the funds held across every chain cover what is owed in one
+ * currency. Liabilities are the players' balances plus withdrawals that
+ * have been debited but whose funds are still in a contract. Ratio is
+ * nil if nothing is owed.
+ */
+type Coverage struct {
+	Currency string `json:"currency"`;
+	Holdings decimal.Decimal `json:"holdings"`;
+	Balances decimal.Decimal `json:"balances"`;
+	InFlight decimal.Decimal `json:"inFlight"`;
+	Ratio *decimal.Decimal `json:"ratio"`;
+	Short bool `json:"short"`;
+}
+
+type Report struct {
+	Checked time.Time `json:"checked"`;
+	MinCoverage decimal.Decimal `json:"minCoverage"`;
+	Currencies map[string]Coverage `json:"currencies"`;
+}
+
+/**
+ * Periodically compares contract holdings with liabilities. While a
+ * currency is short, Paused reports it so that no new vouchers are
+ * signed for it; a failed check leaves the previous state in place.
+ */
+type Monitor struct {
+	db *sql.DB;
+	sources map[string]Source;
+	currencies []string;
+	minCoverage decimal.Decimal;
+	onChange ChangeHandler;
+	lock sync.RWMutex;
+	report *Report;
+}
+
+func NewMonitor(
+	db *sql.DB,
+	sources map[string]Source,
+	currencies []string,
+	minCoverage decimal.Decimal,
+	onChange ChangeHandler,
+) *Monitor {
+	return &Monitor{
+		db: db,
+		sources: sources,
+		currencies: currencies,
+		minCoverage: minCoverage,
+		onChange: onChange,
+	};
+}
+
+func (monitor *Monitor) Check(ctx context.Context) error {
+	holdings := make(map[string]decimal.Decimal);
+
+	for _, source := range monitor.sources {
+		held, err := source.Holdings(ctx);
+
+		if err != nil {
+			return err;
+		}
+
+		for currency, amount := range held {
+			holdings[currency] = holdings[currency].Add(amount);
+		}
+	}
+
+	balances, err := monitor.balances();
+
+	if err != nil {
+		return err;
+	}
+
+	inFlight, err := monitor.inFlight();
+
+	if err != nil {
+		return err;
+	}
+
+	report := &Report{
+		Checked: time.Now(),
+		MinCoverage: monitor.minCoverage,
+		Currencies: make(map[string]Coverage),
+	};
+
+	for _, currency := range monitor.currencies {
+		report.Currencies[currency] = Evaluate(
+			currency,
+			holdings[currency],
+			balances[currency],
+			inFlight[currency],
+			monitor.minCoverage,
+		);
+	}
+
+	monitor.lock.Lock();
+	previous := monitor.report;
+	monitor.report = report;
+	monitor.lock.Unlock();
+
+	if monitor.onChange == nil {
+		return nil;
+	}
+
+	for _, currency := range monitor.currencies {
+		coverage := report.Currencies[currency];
+		wasShort := previous != nil && previous.Currencies[currency].Short;
+
+		if coverage.Short != wasShort {
+			monitor.onChange(coverage);
+		}
+	}
+
+	return nil;
+}
+
+/**
+ * The result of the last successful check, or nil before the first.
+ */
+func (monitor *Monitor) Report() *Report {
+	monitor.lock.RLock();
+	defer monitor.lock.RUnlock();
+
+	return monitor.report;
+}
+
+/**
+ * Whether withdrawals of currency must wait for its coverage to
+ * recover.
+ */
+func (monitor *Monitor) Paused(currency string) bool {
+	monitor.lock.RLock();
+	defer monitor.lock.RUnlock();
+
+	if monitor.report == nil {
+		return false;
+	}
+
+	return monitor.report.Currencies[currency].Short;
+}
+
+func (monitor *Monitor) balances() (map[string]decimal.Decimal, error) {
+	rows, err := monitor.db.Query(`
+		SELECT currency, SUM(balance)
+		FROM balances
+		GROUP BY currency
+	`);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return scanAmounts(rows);
+}
+
+/**
+ * Debited withdrawals whose funds have not yet left the contract:
+ * those held for review, those with a voucher not yet used and those
+ * whose transaction is known but not yet mined. Expired vouchers count,
+ * since the contract would still honour them.
+ */
+func (monitor *Monitor) inFlight() (map[string]decimal.Decimal, error) {
+	pending := `
+		(withdrawals.status IN (?, ?)
+		OR (withdrawals.status = ? AND withdrawals.blockHash IS NULL))
+	`;
+
+	rows, err := monitor.db.Query(`
+		SELECT currency, SUM(amount)
+		FROM (
+			SELECT currency, amount
+			FROM withdrawals
+			WHERE ` + pending + `
+			UNION ALL
+			SELECT tasks.currency, tasks.amount
+			FROM withdrawal_tasks AS tasks
+			JOIN withdrawals ON withdrawals.id = tasks.withdrawalId
+			WHERE ` + pending + `
+			AND tasks.taskType = ?
+		) AS pending
+		GROUP BY currency
+	`,
+		withdrawals.STATUS_REVIEW,
+		withdrawals.STATUS_ISSUED,
+		withdrawals.STATUS_SUBMITTED,
+		withdrawals.STATUS_REVIEW,
+		withdrawals.STATUS_ISSUED,
+		withdrawals.STATUS_SUBMITTED,
+		withdrawals.TASK_WITHDRAW,
+	);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return scanAmounts(rows);
+}
+
+func scanAmounts(rows *sql.Rows) (map[string]decimal.Decimal, error) {
+	defer rows.Close();
+
+	amounts := make(map[string]decimal.Decimal);
+
+	for rows.Next() {
+		var currency string;
+		var amountStr string;
+
+		if err := rows.Scan(&currency, &amountStr); err != nil {
+			return nil, err;
+		}
+
+		amount, err := decimal.NewFromString(amountStr);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		amounts[currency] = amount;
+	}
+
+	return amounts, rows.Err();
+}
+
+/**
+ * Coverage of one currency. A currency is short if its holdings are
+ * below minCoverage times its liabilities.
+ */
+func Evaluate(
+	currency string,
+	holdings decimal.Decimal,
+	balances decimal.Decimal,
+	inFlight decimal.Decimal,
+	minCoverage decimal.Decimal,
+) Coverage {
+	coverage := Coverage{
+		Currency: currency,
+		Holdings: holdings,
+		Balances: balances,
+		InFlight: inFlight,
+	};
+
+	liabilities := balances.Add(inFlight);
+
+	if liabilities.IsPositive() {
+		ratio := holdings.DivRound(liabilities, 4);
+		coverage.Ratio = &ratio;
+	}
+
+	coverage.Short = holdings.LessThan(liabilities.Mul(minCoverage));
+
+	return coverage;
+}
@@ -0,0 +1,212 @@
+package solvency;
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+var db *sql.DB;
+
+func init() {
+	cfg, err := config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+
+	dbConfig := mysql.Config{
+		User: cfg.Database.User,
+		DBName: cfg.Database.DBName,
+		Addr: cfg.Database.Addr,
+		AllowNativePasswords: true,
+	};
+
+	db, err = sql.Open("mysql", dbConfig.FormatDSN());
+
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err);
+	}
+}
+
+type fixedSource map[string]decimal.Decimal;
+
+func (source fixedSource) Holdings(ctx context.Context) (map[string]decimal.Decimal, error) {
+	return source, nil;
+}
+
+/**
+ * A currency of its own, so that other tests' balances do not count.
+ */
+func newCurrency(t *testing.T) (string, string) {
+	key, err := crypto.GenerateKey();
+
+	if err != nil {
+		t.Fatal("Failed to generate key: ", err);
+	}
+
+	wallet := crypto.PubkeyToAddress(key.PublicKey).String();
+
+	return "t" + wallet[2:12], wallet;
+}
+
+func TestEvaluate(t *testing.T) {
+	one := decimal.RequireFromString("1");
+
+	coverage := Evaluate("eth", decimal.RequireFromString("9"), decimal.RequireFromString("8"), one, one);
+
+	if coverage.Short || coverage.Ratio == nil || coverage.Ratio.String() != "1" {
+		t.Fatal("Exact coverage reported short: ", coverage);
+	}
+
+	coverage = Evaluate("eth", decimal.RequireFromString("8.9"), decimal.RequireFromString("8"), one, one);
+
+	if !coverage.Short || coverage.Ratio.String() != "0.9889" {
+		t.Fatal("Shortfall not reported: ", coverage);
+	}
+
+	coverage = Evaluate("eth", decimal.RequireFromString("9"), decimal.RequireFromString("8"), decimal.Zero, decimal.RequireFromString("1.2"));
+
+	if !coverage.Short {
+		t.Fatal("Minimum coverage above one not applied: ", coverage);
+	}
+
+	coverage = Evaluate("eth", decimal.Zero, decimal.Zero, decimal.Zero, one);
+
+	if coverage.Short || coverage.Ratio != nil {
+		t.Fatal("Currency owing nothing reported short: ", coverage);
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	currency, wallet := newCurrency(t);
+
+	_, err := db.Exec(`
+		INSERT INTO balances
+		(wallet, currency, balance)
+		VALUES
+		(?, ?, 10)
+	`, wallet, currency);
+
+	if err != nil {
+		t.Fatal("Failed to create balance: ", err);
+	}
+
+	// Only the review and issued withdrawals and the unmined submitted
+	// one still have their funds in the contract.
+	_, err = db.Exec(`
+		INSERT INTO withdrawals
+		(chain, wallet, nonce, amount, currency, status, blockHash, signature, request)
+		VALUES
+		('ethereum', ?, 0, 1, ?, ?, NULL, '', ''),
+		('ethereum', ?, 1, 2, ?, ?, NULL, '', ''),
+		('ethereum', ?, 2, 4, ?, ?, NULL, '', ''),
+		('ethereum', ?, 3, 8, ?, ?, '0x01', '', ''),
+		('ethereum', ?, 4, 16, ?, ?, '0x01', '', ''),
+		('ethereum', ?, 5, 32, ?, ?, NULL, '', '')
+	`,
+		wallet, currency, withdrawals.STATUS_REVIEW,
+		wallet, currency, withdrawals.STATUS_ISSUED,
+		wallet, currency, withdrawals.STATUS_SUBMITTED,
+		wallet, currency, withdrawals.STATUS_SUBMITTED,
+		wallet, currency, withdrawals.STATUS_CONFIRMED,
+		wallet, currency, withdrawals.STATUS_REFUNDED,
+	);
+
+	if err != nil {
+		t.Fatal("Failed to create withdrawals: ", err);
+	}
+
+	var issuedId int64;
+
+	err = db.QueryRow(`
+		SELECT id
+		FROM withdrawals
+		WHERE wallet = ?
+		AND nonce = 1
+	`, wallet).Scan(&issuedId);
+
+	if err != nil {
+		t.Fatal("Failed to find withdrawal: ", err);
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO withdrawal_tasks
+		(withdrawalId, position, taskType, wallet, currency, amount)
+		VALUES
+		(?, 0, ?, ?, ?, 0.5),
+		(?, 1, ?, ?, ?, 64)
+	`,
+		issuedId, withdrawals.TASK_WITHDRAW, wallet, currency,
+		issuedId, withdrawals.TASK_DECREASE_BALANCE, wallet, currency,
+	);
+
+	if err != nil {
+		t.Fatal("Failed to create tasks: ", err);
+	}
+
+	source := fixedSource{ currency: decimal.RequireFromString("10") };
+	changes := make([]Coverage, 0);
+
+	monitor := NewMonitor(
+		db,
+		map[string]Source{ "a": source, "b": fixedSource{ currency: decimal.RequireFromString("7.5") } },
+		[]string{ currency },
+		decimal.RequireFromString("1"),
+		func(coverage Coverage) {
+			changes = append(changes, coverage);
+		},
+	);
+
+	if monitor.Paused(currency) {
+		t.Fatal("Paused before first check");
+	}
+
+	if err = monitor.Check(context.Background()); err != nil {
+		t.Fatal("Failed to check: ", err);
+	}
+
+	coverage := monitor.Report().Currencies[currency];
+
+	if !coverage.Holdings.Equal(decimal.RequireFromString("17.5")) ||
+		!coverage.InFlight.Equal(decimal.RequireFromString("7.5")) ||
+		coverage.Short || len(changes) != 0 {
+		t.Fatal("Wrong coverage: ", coverage, changes);
+	}
+
+	source[currency] = decimal.RequireFromString("9.9");
+
+	if err = monitor.Check(context.Background()); err != nil {
+		t.Fatal("Failed to check: ", err);
+	}
+
+	if !monitor.Paused(currency) || len(changes) != 1 || !changes[0].Short {
+		t.Fatal("Shortfall did not pause withdrawals: ", changes);
+	}
+
+	if err = monitor.Check(context.Background()); err != nil {
+		t.Fatal("Failed to check: ", err);
+	}
+
+	if len(changes) != 1 {
+		t.Fatal("Persisting shortfall reported again: ", changes);
+	}
+
+	source[currency] = decimal.RequireFromString("10");
+
+	if err = monitor.Check(context.Background()); err != nil {
+		t.Fatal("Failed to check: ", err);
+	}
+
+	if monitor.Paused(currency) || len(changes) != 2 || changes[1].Short {
+		t.Fatal("Recovery did not resume withdrawals: ", changes);
+	}
+}
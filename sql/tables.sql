@@ -5,6 +5,21 @@ DROP TABLE IF EXISTS `bets`;
 DROP TABLE IF EXISTS `games`;
 DROP TABLE IF EXISTS `balances`;
 DROP TABLE IF EXISTS `withdrawals`;
+DROP TABLE IF EXISTS `withdrawal_tasks`;
+DROP TABLE IF EXISTS `tips`;
+DROP TABLE IF EXISTS `bankroll`;
+DROP TABLE IF EXISTS `pending_payouts`;
+DROP TABLE IF EXISTS `deposits`;
+DROP TABLE IF EXISTS `chain_cursors`;
+DROP TABLE IF EXISTS `withdrawal_limits`;
+DROP TABLE IF EXISTS `devices`;
+DROP TABLE IF EXISTS `contract_events`;
+DROP TABLE IF EXISTS `anchors`;
+DROP TABLE IF EXISTS `auth_nonces`;
+DROP TABLE IF EXISTS `sessions`;
+DROP TABLE IF EXISTS `roles`;
+DROP TABLE IF EXISTS `bans`;
+DROP TABLE IF EXISTS `admin_audit`;
 
 CREATE TABLE `games` (
 	`id` uuid PRIMARY KEY NOT NULL,
@@ -12,7 +27,11 @@ CREATE TABLE `games` (
 	`endTime` datetime(3) NOT NULL,
 	`multiplier` Decimal(6, 2) NOT NULL DEFAULT 0,
 	`playerCount` integer NOT NULL DEFAULT 0,
-	`winnerCount` integer NOT NULL DEFAULT 0
+	`winnerCount` integer NOT NULL DEFAULT 0,
+	`hash` char(64),
+	`anchorId` bigint,
+	`leafIndex` integer,
+	INDEX (`anchorId`, `leafIndex`)
 );
 
 CREATE TABLE `bets` (
@@ -45,8 +64,12 @@ CREATE TABLE `ledger` (
 	`wallet` char(42) NOT NULL,
 	`currency` varchar(32) NOT NULL,
 	`change` Decimal(32, 18) NOT NULL,
-	`gameId` uuid NOT NULL,
-	FOREIGN KEY(`gameId`) REFERENCES `bets`(`id`)
+	`reason` varchar(64) NOT NULL,
+	`gameId` uuid,
+	`transferId` uuid,
+	`chain` varchar(32),
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	INDEX (`wallet`, `currency`)
 );
 
 CREATE TABLE `rates` (
@@ -58,13 +81,194 @@ CREATE TABLE `rates` (
 
 CREATE TABLE `withdrawals` (
 	`id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+	`chain` varchar(32) NOT NULL,
 	`nonce` integer NOT NULL,
 	`wallet` char(42) NOT NULL,
 	`amount` Decimal(32, 18) unsigned NOT NULL,
 	`currency` varchar(32) NOT NULL,
 	`txHash` char(66),
+	`blockNumber` bigint unsigned,
+	`blockHash` char(66),
+	`status` varchar(16) NOT NULL DEFAULT 'issued',
 	`signature` text NOT NULL,
 	`request` text NOT NULL,
+	`expires` datetime(3),
+	`unmatchedTxHash` char(66),
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	`updated` datetime(3),
+	UNIQUE(`chain`, `wallet`, `nonce`),
+	INDEX (`wallet`),
+	INDEX (`chain`, `status`)
+);
+
+CREATE TABLE `withdrawal_tasks` (
+	`withdrawalId` bigint NOT NULL,
+	`position` integer NOT NULL,
+	`taskType` tinyint unsigned NOT NULL,
+	`wallet` char(42) NOT NULL,
+	`currency` varchar(32) NOT NULL,
+	`amount` Decimal(32, 18) unsigned NOT NULL,
+	PRIMARY KEY (`withdrawalId`, `position`)
+);
+
+CREATE TABLE `tips` (
+	`id` uuid PRIMARY KEY NOT NULL,
+	`sender` char(42) NOT NULL,
+	`recipient` char(42) NOT NULL,
+	`currency` varchar(32) NOT NULL,
+	`amount` Decimal(32, 18) unsigned NOT NULL,
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	INDEX (`sender`, `currency`, `created`)
+);
+
+CREATE TABLE `bankroll` (
+	`currency` varchar(32) PRIMARY KEY NOT NULL,
+	`balance` Decimal(32, 18) NOT NULL DEFAULT 0,
+	`funded` Decimal(32, 18) NOT NULL DEFAULT 0
+);
+
+CREATE TABLE `pending_payouts` (
+	`id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+	`wallet` char(42) NOT NULL,
+	`currency` varchar(32) NOT NULL,
+	`amount` Decimal(32, 18) unsigned NOT NULL,
+	`reason` varchar(64) NOT NULL,
+	`gameId` uuid NOT NULL,
+	`status` varchar(16) NOT NULL DEFAULT 'pending',
+	`attempts` integer NOT NULL DEFAULT 0,
+	`lastError` text,
+	`nextAttempt` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	`updated` datetime(3),
+	INDEX (`status`, `nextAttempt`),
+	INDEX (`wallet`, `status`)
+);
+
+CREATE TABLE `deposits` (
+	`id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+	`chain` varchar(32) NOT NULL,
+	`txHash` char(66) NOT NULL,
+	`logIndex` integer unsigned NOT NULL,
+	`wallet` char(42) NOT NULL,
+	`currency` varchar(32) NOT NULL,
+	`amount` Decimal(32, 18) unsigned NOT NULL,
+	`blockNumber` bigint unsigned NOT NULL,
+	`blockHash` char(66) NOT NULL,
+	`coinId` integer unsigned NOT NULL,
+	`status` varchar(16) NOT NULL DEFAULT 'pending',
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	`updated` datetime(3),
+	UNIQUE (`chain`, `blockHash`, `logIndex`),
+	INDEX (`chain`, `status`, `blockNumber`),
+	INDEX (`txHash`)
+);
+
+CREATE TABLE `chain_cursors` (
+	`name` varchar(64) PRIMARY KEY NOT NULL,
+	`block` bigint unsigned NOT NULL,
+	`blockHash` char(66) NOT NULL
+);
+
+CREATE TABLE `withdrawal_limits` (
+	`wallet` char(42) PRIMARY KEY NOT NULL,
+	`limits` text NOT NULL,
+	`updated` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3)
+);
+
+CREATE TABLE `devices` (
+	`wallet` char(42) NOT NULL,
+	`device` char(64) NOT NULL,
+	`firstSeen` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	`lastSeen` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	PRIMARY KEY (`wallet`, `device`),
+	INDEX (`device`)
+);
+
+CREATE TABLE `contract_events` (
+	`id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+	`chain` varchar(32) NOT NULL,
+	`blockNumber` bigint unsigned NOT NULL,
+	`blockHash` char(66) NOT NULL,
+	`txHash` char(66) NOT NULL,
+	`logIndex` integer unsigned NOT NULL,
+	`event` varchar(64) NOT NULL,
+	`wallet` char(42),
+	`coinId` integer unsigned,
+	`amount` Decimal(65, 0) unsigned,
+	`args` text NOT NULL,
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	UNIQUE (`chain`, `blockHash`, `logIndex`),
+	INDEX (`chain`, `blockNumber`),
+	INDEX (`chain`, `event`, `blockNumber`),
+	INDEX (`wallet`),
+	INDEX (`txHash`)
+);
+
+CREATE TABLE `anchors` (
+	`id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+	`chain` varchar(32) NOT NULL,
+	`root` char(66) NOT NULL,
+	`roundCount` integer NOT NULL,
+	`status` varchar(16) NOT NULL DEFAULT 'pending',
+	`sender` char(42),
+	`accountNonce` bigint unsigned,
+	`gasPrice` Decimal(65, 0) unsigned,
+	`txHash` char(66),
+	`blockNumber` bigint unsigned,
+	`blockHash` char(66),
+	`sent` datetime(3),
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	`updated` datetime(3),
+	INDEX (`chain`, `status`)
+);
+
+CREATE TABLE `auth_nonces` (
+	`nonce` varchar(64) CHARACTER SET ascii COLLATE ascii_bin PRIMARY KEY NOT NULL,
+	`socketId` varchar(64),
+	`expires` datetime(3) NOT NULL,
+	`used` datetime(3),
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	INDEX (`expires`)
+);
+
+CREATE TABLE `sessions` (
+	`id` uuid PRIMARY KEY NOT NULL,
+	`wallet` char(42) NOT NULL,
+	`refreshHash` char(64) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+	`expires` datetime(3) NOT NULL,
+	`refreshed` datetime(3),
+	`revoked` datetime(3),
+	`revokedBy` varchar(64),
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	INDEX (`wallet`, `revoked`)
+);
+
+CREATE TABLE `roles` (
+	`wallet` char(42) NOT NULL,
+	`role` varchar(16) NOT NULL,
+	`grantedBy` varchar(64) NOT NULL,
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	PRIMARY KEY (`wallet`, `role`)
+);
+
+CREATE TABLE `bans` (
+	`wallet` char(42) PRIMARY KEY NOT NULL,
+	`reason` varchar(255) NOT NULL,
+	`bannedBy` varchar(64) NOT NULL,
+	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3)
+);
+
+CREATE TABLE `admin_audit` (
+	`id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+	`wallet` char(42),
+	`session` uuid,
+	`permission` varchar(32) NOT NULL,
+	`method` varchar(8) NOT NULL,
+	`path` varchar(255) NOT NULL,
+	`query` text NOT NULL,
+	`status` smallint NOT NULL,
+	`remoteAddr` varchar(64) NOT NULL,
 	`created` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
-	UNIQUE(`wallet`, `nonce`)
+	INDEX (`wallet`),
+	INDEX (`path`)
 );
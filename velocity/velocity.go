@@ -0,0 +1,427 @@
+package velocity;
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"maps"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/withdrawals"
+);
+
+var (
+	ErrDailyCapExceeded = errors.New("withdrawal exceeds daily cap")
+	ErrWeeklyCapExceeded = errors.New("withdrawal exceeds weekly cap")
+	ErrTooSoon = errors.New("too soon after previous withdrawal")
+	ErrLargeWinCooldown = errors.New("withdrawals paused after a large win")
+	ErrNewDeviceCooldown = errors.New("withdrawals paused after login from a new device")
+)
+
+const (
+	DAY_SECS  = 24 * 60 * 60;
+	WEEK_SECS = 7 * DAY_SECS;
+);
+
+/**
+ * What a wallet has done recently, as far as the limits are concerned.
+ * Withdrawals that were refunded or rejected do not count.
+ */
+type Usage struct {
+	Day map[string]decimal.Decimal;
+	Week map[string]decimal.Decimal;
+	RecentWithdrawal bool;
+	Wins map[string]decimal.Decimal;
+	NewDevice bool;
+}
+
+/**
+ * Enforces the withdrawal limits from the config, as overridden for
+ * individual wallets in the withdrawal_limits table.
+ */
+type Checker struct {
+	db *sql.DB;
+	limits config.WithdrawalLimits;
+}
+
+func NewChecker(db *sql.DB, cfg *config.CrashConfig) *Checker {
+	return &Checker{
+		db: db,
+		limits: cfg.Withdrawals.Limits,
+	};
+}
+
+/**
+ * The limits applying to wallet: the global ones with any fields the
+ * wallet's override sets replaced. Caps in an override are merged per
+ * currency.
+ */
+func (checker *Checker) Limits(wallet string) (config.WithdrawalLimits, error) {
+	limits := checker.limits;
+	limits.DailyCaps = maps.Clone(limits.DailyCaps);
+	limits.WeeklyCaps = maps.Clone(limits.WeeklyCaps);
+	limits.LargeWins = maps.Clone(limits.LargeWins);
+
+	var override string;
+
+	err := checker.db.QueryRow(`
+		SELECT limits
+		FROM withdrawal_limits
+		WHERE wallet = ?
+	`, wallet).Scan(&override);
+
+	if err == sql.ErrNoRows {
+		return limits, nil;
+	}
+
+	if err != nil {
+		return limits, err;
+	}
+
+	err = json.Unmarshal([]byte(override), &limits);
+
+	return limits, err;
+}
+
+/**
+ * Replaces the wallet's override. It uses the field names of the
+ * limits in the config, e.g. {"dailyCaps": {"eth": "50"}}.
+ */
+func (checker *Checker) SetOverride(wallet string, override []byte) error {
+	var limits config.WithdrawalLimits;
+
+	if err := json.Unmarshal(override, &limits); err != nil {
+		return err;
+	}
+
+	_, err := checker.db.Exec(`
+		INSERT INTO withdrawal_limits
+		(wallet, limits)
+		VALUES
+		(?, ?)
+		ON DUPLICATE KEY UPDATE limits = VALUES(limits), updated = NOW(3)
+	`, wallet, string(override));
+
+	return err;
+}
+
+func (checker *Checker) ClearOverride(wallet string) error {
+	_, err := checker.db.Exec(`
+		DELETE FROM withdrawal_limits
+		WHERE wallet = ?
+	`, wallet);
+
+	return err;
+}
+
+/**
+ * Whether wallet may withdraw amounts now. usdRates values the
+ * amounts against the USD caps; a currency without a rate cannot be
+ * checked against them and is refused.
+ *
+ * The check reads the wallet's history through tx, which should be
+ * the transaction debiting the withdrawal and holding the wallet's
+ * balance rows locked. Concurrent withdrawals then each see the ones
+ * before them, and cannot all pass the same cap or interval.
+ */
+func (checker *Checker) Check(
+	tx *sql.Tx,
+	wallet string,
+	amounts []bank.Amount,
+	usdRates map[string]decimal.Decimal,
+) error {
+	limits, err := checker.Limits(wallet);
+
+	if err != nil {
+		return err;
+	}
+
+	usage, err := loadUsage(tx, wallet, limits);
+
+	if err != nil {
+		return err;
+	}
+
+	return Evaluate(limits, usage, amounts, usdRates);
+}
+
+func loadUsage(tx *sql.Tx, wallet string, limits config.WithdrawalLimits) (*Usage, error) {
+	var usage Usage;
+	var err error;
+
+	if usage.Day, err = withdrawn(tx, wallet, DAY_SECS); err != nil {
+		return nil, err;
+	}
+
+	if usage.Week, err = withdrawn(tx, wallet, WEEK_SECS); err != nil {
+		return nil, err;
+	}
+
+	if limits.MinIntervalSecs > 0 {
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1
+				FROM withdrawals
+				WHERE wallet = ?
+				AND created > NOW(3) - INTERVAL ? SECOND
+			)
+		`, wallet, limits.MinIntervalSecs).Scan(&usage.RecentWithdrawal);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	usage.Wins = make(map[string]decimal.Decimal);
+
+	// Winnings are credited to the ledger under the cashout reasons.
+	if limits.LargeWinCooldownSecs > 0 {
+		rows, err := tx.Query(`
+			SELECT currency, MAX(ledger.change)
+			FROM ledger
+			WHERE wallet = ?
+			AND reason IN (?, ?)
+			AND created > NOW(3) - INTERVAL ? SECOND
+			GROUP BY currency
+		`, wallet, "Cashout", "Auto cashout", limits.LargeWinCooldownSecs);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if usage.Wins, err = scanAmounts(rows); err != nil {
+			return nil, err;
+		}
+	}
+
+	// The first device a wallet is seen on is not new.
+	if limits.NewDeviceCooldownSecs > 0 {
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1
+				FROM devices
+				WHERE wallet = ?
+				AND firstSeen > NOW(3) - INTERVAL ? SECOND
+				AND firstSeen > (
+					SELECT MIN(firstSeen)
+					FROM devices
+					WHERE wallet = ?
+				)
+			)
+		`, wallet, limits.NewDeviceCooldownSecs, wallet).Scan(&usage.NewDevice);
+
+		if err != nil {
+			return nil, err;
+		}
+	}
+
+	return &usage, nil;
+}
+
+/**
+ * Amounts withdrawn per currency over the trailing secs, counting the
+ * withdraw tasks paid to the same wallet.
+ */
+func withdrawn(tx *sql.Tx, wallet string, secs int) (map[string]decimal.Decimal, error) {
+	rows, err := tx.Query(`
+		SELECT currency, SUM(amount)
+		FROM (
+			SELECT currency, amount
+			FROM withdrawals
+			WHERE wallet = ?
+			AND created > NOW(3) - INTERVAL ? SECOND
+			AND status NOT IN (?, ?)
+			UNION ALL
+			SELECT tasks.currency, tasks.amount
+			FROM withdrawal_tasks AS tasks
+			JOIN withdrawals ON withdrawals.id = tasks.withdrawalId
+			WHERE withdrawals.wallet = ?
+			AND withdrawals.created > NOW(3) - INTERVAL ? SECOND
+			AND withdrawals.status NOT IN (?, ?)
+			AND tasks.wallet = withdrawals.wallet
+			AND tasks.taskType = ?
+		) AS recent
+		GROUP BY currency
+	`,
+		wallet,
+		secs,
+		withdrawals.STATUS_REFUNDED,
+		withdrawals.STATUS_REJECTED,
+		wallet,
+		secs,
+		withdrawals.STATUS_REFUNDED,
+		withdrawals.STATUS_REJECTED,
+		withdrawals.TASK_WITHDRAW,
+	);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	return scanAmounts(rows);
+}
+
+func scanAmounts(rows *sql.Rows) (map[string]decimal.Decimal, error) {
+	defer rows.Close();
+
+	amounts := make(map[string]decimal.Decimal);
+
+	for rows.Next() {
+		var currency string;
+		var amountStr string;
+
+		if err := rows.Scan(&currency, &amountStr); err != nil {
+			return nil, err;
+		}
+
+		amount, err := decimal.NewFromString(amountStr);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		amounts[currency] = amount;
+	}
+
+	return amounts, rows.Err();
+}
+
+/**
+ * Records a login from the device holding token, which we issued on an
+ * earlier login to any wallet. A missing or unknown token is replaced
+ * by a new one for a new device, so a client cannot claim to be a
+ * device the wallet has used before. Returns the token, which the
+ * client keeps and sends with its next login. Devices are stored as a
+ * hash of it.
+ */
+func RecordDevice(db *sql.DB, wallet string, token string) (string, error) {
+	known := false;
+
+	if token != "" {
+		err := db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1
+				FROM devices
+				WHERE device = ?
+			)
+		`, hashDevice(token)).Scan(&known);
+
+		if err != nil {
+			return "", err;
+		}
+	}
+
+	if !known {
+		secret := make([]byte, 32);
+
+		if _, err := rand.Read(secret); err != nil {
+			return "", err;
+		}
+
+		token = hex.EncodeToString(secret);
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO devices
+		(wallet, device)
+		VALUES
+		(?, ?)
+		ON DUPLICATE KEY UPDATE lastSeen = NOW(3)
+	`, wallet, hashDevice(token));
+
+	if err != nil {
+		return "", err;
+	}
+
+	return token, nil;
+}
+
+func hashDevice(token string) string {
+	hash := sha256.Sum256([]byte(token));
+	return hex.EncodeToString(hash[:]);
+}
+
+/**
+ * Applies limits to a withdrawal of amounts given the wallet's usage.
+ * Cooldowns are checked first, since they refuse any amount.
+ */
+func Evaluate(
+	limits config.WithdrawalLimits,
+	usage *Usage,
+	amounts []bank.Amount,
+	usdRates map[string]decimal.Decimal,
+) error {
+	if usage.NewDevice && limits.NewDeviceCooldownSecs > 0 {
+		return ErrNewDeviceCooldown;
+	}
+
+	if limits.LargeWinCooldownSecs > 0 {
+		for currency, win := range usage.Wins {
+			threshold, ok := limits.LargeWins[currency];
+
+			if ok && threshold.IsPositive() && win.GreaterThanOrEqual(threshold) {
+				return ErrLargeWinCooldown;
+			}
+		}
+	}
+
+	if usage.RecentWithdrawal && limits.MinIntervalSecs > 0 {
+		return ErrTooSoon;
+	}
+
+	if exceeds(limits.DailyCaps, limits.DailyUsdCap, usage.Day, amounts, usdRates) {
+		return ErrDailyCapExceeded;
+	}
+
+	if exceeds(limits.WeeklyCaps, limits.WeeklyUsdCap, usage.Week, amounts, usdRates) {
+		return ErrWeeklyCapExceeded;
+	}
+
+	return nil;
+}
+
+func exceeds(
+	caps map[string]decimal.Decimal,
+	usdCap decimal.Decimal,
+	withdrawn map[string]decimal.Decimal,
+	amounts []bank.Amount,
+	usdRates map[string]decimal.Decimal,
+) bool {
+	totals := maps.Clone(withdrawn);
+
+	if totals == nil {
+		totals = make(map[string]decimal.Decimal);
+	}
+
+	for _, amount := range amounts {
+		totals[amount.Currency] = totals[amount.Currency].Add(amount.Amount);
+	}
+
+	usdTotal := decimal.Zero;
+
+	for currency, total := range totals {
+		if cap, ok := caps[currency]; ok && cap.IsPositive() && total.GreaterThan(cap) {
+			return true;
+		}
+
+		if !usdCap.IsPositive() || total.IsZero() {
+			continue;
+		}
+
+		rate, ok := usdRates[currency];
+
+		if !ok {
+			return true;
+		}
+
+		usdTotal = usdTotal.Add(total.Mul(rate));
+	}
+
+	return usdCap.IsPositive() && usdTotal.GreaterThan(usdCap);
+}
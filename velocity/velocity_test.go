@@ -0,0 +1,347 @@
+package velocity;
+
+import (
+	"database/sql"
+	"log"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/config"
+);
+
+var cfg *config.CrashConfig;
+var db *sql.DB;
+
+func init() {
+	var err error;
+
+	cfg, err = config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+
+	dbConfig := mysql.Config{
+		User: cfg.Database.User,
+		DBName: cfg.Database.DBName,
+		Addr: cfg.Database.Addr,
+		AllowNativePasswords: true,
+	};
+
+	db, err = sql.Open("mysql", dbConfig.FormatDSN());
+
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err);
+	}
+}
+
+func newWallet(t *testing.T) string {
+	key, err := crypto.GenerateKey();
+
+	if err != nil {
+		t.Fatal("Failed to generate key: ", err);
+	}
+
+	return crypto.PubkeyToAddress(key.PublicKey).String();
+}
+
+func check(
+	t *testing.T,
+	checker *Checker,
+	wallet string,
+	amounts []bank.Amount,
+	usdRates map[string]decimal.Decimal,
+) error {
+	tx, err := db.Begin();
+
+	if err != nil {
+		t.Fatal("Failed to begin transaction: ", err);
+	}
+
+	defer tx.Rollback();
+
+	return checker.Check(tx, wallet, amounts, usdRates);
+}
+
+func eth(amount string) []bank.Amount {
+	return []bank.Amount{ { Currency: "eth", Amount: decimal.RequireFromString(amount) } };
+}
+
+func TestEvaluate(t *testing.T) {
+	limits := cfg.Withdrawals.Limits;
+	usdRates := map[string]decimal.Decimal{
+		"eth": decimal.RequireFromString("2000"),
+		"btc": decimal.RequireFromString("60000"),
+	};
+
+	usage := &Usage{
+		Day: map[string]decimal.Decimal{ "eth": decimal.RequireFromString("15") },
+		Week: map[string]decimal.Decimal{ "eth": decimal.RequireFromString("45") },
+	};
+
+	if err := Evaluate(limits, usage, eth("4"), usdRates); err != nil {
+		t.Fatal("Withdrawal within limits refused: ", err);
+	}
+
+	if err := Evaluate(limits, usage, eth("6"), usdRates); err != ErrDailyCapExceeded {
+		t.Fatal("Daily cap not enforced: ", err);
+	}
+
+	usage.Day = map[string]decimal.Decimal{};
+
+	if err := Evaluate(limits, usage, eth("6"), usdRates); err != ErrWeeklyCapExceeded {
+		t.Fatal("Weekly cap not enforced: ", err);
+	}
+
+	// 15 eth and 0.9 btc are each within their own caps but together
+	// worth more than the daily USD cap.
+	usage.Week = map[string]decimal.Decimal{};
+	mixed := []bank.Amount{
+		{ Currency: "eth", Amount: decimal.RequireFromString("15") },
+		{ Currency: "btc", Amount: decimal.RequireFromString("0.9") },
+	};
+
+	if err := Evaluate(limits, usage, mixed, usdRates); err != ErrDailyCapExceeded {
+		t.Fatal("Daily USD cap not enforced: ", err);
+	}
+
+	if err := Evaluate(limits, usage, eth("1"), map[string]decimal.Decimal{}); err != ErrDailyCapExceeded {
+		t.Fatal("Withdrawal without a USD rate allowed: ", err);
+	}
+
+	usage.RecentWithdrawal = true;
+
+	if err := Evaluate(limits, usage, eth("1"), usdRates); err != ErrTooSoon {
+		t.Fatal("Minimum interval not enforced: ", err);
+	}
+
+	usage.Wins = map[string]decimal.Decimal{ "eth": decimal.RequireFromString("5") };
+
+	if err := Evaluate(limits, usage, eth("1"), usdRates); err != ErrLargeWinCooldown {
+		t.Fatal("Large win cooldown not enforced: ", err);
+	}
+
+	usage.NewDevice = true;
+
+	if err := Evaluate(limits, usage, eth("1"), usdRates); err != ErrNewDeviceCooldown {
+		t.Fatal("New device cooldown not enforced: ", err);
+	}
+}
+
+func TestCheckerUsage(t *testing.T) {
+	checker := NewChecker(db, cfg);
+	wallet := newWallet(t);
+	usdRates := map[string]decimal.Decimal{ "eth": decimal.RequireFromString("2000") };
+
+	laptop, err := RecordDevice(db, wallet, "");
+
+	if err != nil {
+		t.Fatal("Failed to record device: ", err);
+	}
+
+	if err := check(t, checker, wallet, eth("1"), usdRates); err != nil {
+		t.Fatal("Withdrawal from first device refused: ", err);
+	}
+
+	// Refunded withdrawals do not count towards the caps.
+	_, err = db.Exec(`
+		INSERT INTO withdrawals
+		(chain, wallet, nonce, amount, currency, status, signature, request, created)
+		VALUES
+		('ethereum', ?, 0, 19, 'eth', 'refunded', '', '', NOW(3) - INTERVAL 2 HOUR),
+		('ethereum', ?, 1, 18, 'eth', 'confirmed', '', '', NOW(3) - INTERVAL 2 HOUR)
+	`, wallet, wallet);
+
+	if err != nil {
+		t.Fatal("Failed to create withdrawals: ", err);
+	}
+
+	if err = check(t, checker, wallet, eth("2"), usdRates); err != nil {
+		t.Fatal("Withdrawal within daily cap refused: ", err);
+	}
+
+	if err = check(t, checker, wallet, eth("3"), usdRates); err != ErrDailyCapExceeded {
+		t.Fatal("Daily cap not enforced from history: ", err);
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO withdrawals
+		(chain, wallet, nonce, amount, currency, status, signature, request)
+		VALUES
+		('ethereum', ?, 2, 0.1, 'eth', 'issued', '', '')
+	`, wallet);
+
+	if err != nil {
+		t.Fatal("Failed to create withdrawal: ", err);
+	}
+
+	if err = check(t, checker, wallet, eth("1"), usdRates); err != ErrTooSoon {
+		t.Fatal("Minimum interval not enforced from history: ", err);
+	}
+
+	if _, err = RecordDevice(db, wallet, ""); err != nil {
+		t.Fatal("Failed to record device: ", err);
+	}
+
+	// The second device's firstSeen must differ from the first's.
+	_, err = db.Exec(`
+		UPDATE devices
+		SET firstSeen = NOW(3) - INTERVAL 30 DAY
+		WHERE wallet = ?
+		AND device = ?
+	`, wallet, hashDevice(laptop));
+
+	if err != nil {
+		t.Fatal("Failed to age device: ", err);
+	}
+
+	if err = check(t, checker, wallet, eth("1"), usdRates); err != ErrNewDeviceCooldown {
+		t.Fatal("New device cooldown not enforced: ", err);
+	}
+}
+
+func TestRecordDeviceAgain(t *testing.T) {
+	checker := NewChecker(db, cfg);
+	wallet := newWallet(t);
+	usdRates := map[string]decimal.Decimal{ "eth": decimal.RequireFromString("2000") };
+
+	laptop, err := RecordDevice(db, wallet, "");
+
+	if err != nil {
+		t.Fatal("Failed to record device: ", err);
+	}
+
+	if _, err = RecordDevice(db, wallet, ""); err != nil {
+		t.Fatal("Failed to record device: ", err);
+	}
+
+	_, err = db.Exec(`
+		UPDATE devices
+		SET firstSeen = NOW(3) - INTERVAL 30 DAY
+		WHERE wallet = ?
+	`, wallet);
+
+	if err != nil {
+		t.Fatal("Failed to age devices: ", err);
+	}
+
+	// Two more logins from the laptop.
+	for range 2 {
+		token, err := RecordDevice(db, wallet, laptop);
+
+		if err != nil {
+			t.Fatal("Failed to record device: ", err);
+		}
+
+		if token != laptop {
+			t.Fatal("Known device given a new token");
+		}
+	}
+
+	if err = check(t, checker, wallet, eth("1"), usdRates); err != nil {
+		t.Fatal("Login from a known device started the cooldown: ", err);
+	}
+
+	// A token we never issued is not taken as a device.
+	token, err := RecordDevice(db, wallet, "laptop");
+
+	if err != nil {
+		t.Fatal("Failed to record device: ", err);
+	}
+
+	if token == "laptop" || len(token) != 64 {
+		t.Fatal("Unknown device token accepted: ", token);
+	}
+
+	if err = check(t, checker, wallet, eth("1"), usdRates); err != ErrNewDeviceCooldown {
+		t.Fatal("New device cooldown not enforced: ", err);
+	}
+}
+
+func TestCheckerLargeWin(t *testing.T) {
+	checker := NewChecker(db, cfg);
+	wallet := newWallet(t);
+	usdRates := map[string]decimal.Decimal{ "eth": decimal.RequireFromString("2000") };
+
+	_, err := db.Exec(`
+		INSERT INTO ledger
+		(wallet, currency, change, reason)
+		VALUES
+		(?, 'eth', 4, 'Cashout'),
+		(?, 'eth', 50, 'Deposit')
+	`, wallet, wallet);
+
+	if err != nil {
+		t.Fatal("Failed to create ledger entries: ", err);
+	}
+
+	if err = check(t, checker, wallet, eth("1"), usdRates); err != nil {
+		t.Fatal("Withdrawal after small win refused: ", err);
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO ledger
+		(wallet, currency, change, reason)
+		VALUES
+		(?, 'eth', 6, 'Auto cashout')
+	`, wallet);
+
+	if err != nil {
+		t.Fatal("Failed to create ledger entry: ", err);
+	}
+
+	if err = check(t, checker, wallet, eth("1"), usdRates); err != ErrLargeWinCooldown {
+		t.Fatal("Large win cooldown not enforced: ", err);
+	}
+}
+
+func TestOverride(t *testing.T) {
+	checker := NewChecker(db, cfg);
+	wallet := newWallet(t);
+
+	err := checker.SetOverride(wallet, []byte(`{"dailyCaps": {"eth": "100"}, "newDeviceCooldownSecs": 0}`));
+
+	if err != nil {
+		t.Fatal("Failed to set override: ", err);
+	}
+
+	limits, err := checker.Limits(wallet);
+
+	if err != nil {
+		t.Fatal("Failed to load limits: ", err);
+	}
+
+	if !limits.DailyCaps["eth"].Equal(decimal.RequireFromString("100")) {
+		t.Fatal("Override not applied: ", limits.DailyCaps);
+	}
+
+	if !limits.DailyCaps["btc"].Equal(cfg.Withdrawals.Limits.DailyCaps["btc"]) {
+		t.Fatal("Caps not in the override were lost: ", limits.DailyCaps);
+	}
+
+	if limits.NewDeviceCooldownSecs != 0 || limits.MinIntervalSecs != cfg.Withdrawals.Limits.MinIntervalSecs {
+		t.Fatal("Override applied to wrong fields: ", limits);
+	}
+
+	if !cfg.Withdrawals.Limits.DailyCaps["eth"].Equal(decimal.RequireFromString("20")) {
+		t.Fatal("Override changed the global limits");
+	}
+
+	if err = checker.SetOverride(wallet, []byte(`{"dailyCaps": 5}`)); err == nil {
+		t.Fatal("Accepted malformed override");
+	}
+
+	if err = checker.ClearOverride(wallet); err != nil {
+		t.Fatal("Failed to clear override: ", err);
+	}
+
+	limits, err = checker.Limits(wallet);
+
+	if err != nil || !limits.DailyCaps["eth"].Equal(decimal.RequireFromString("20")) {
+		t.Fatal("Override not cleared: ", limits.DailyCaps, err);
+	}
+}
@@ -1,21 +1,18 @@
 package main
 
 import (
-	"crypto/ecdsa"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
-	"log"
-	"strings"
-	"os"
+	"strconv"
 
 	"github.com/shopspring/decimal"
 
 	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/signer"
+	"github.com/samott/crash-backend/withdrawals"
 
 	"github.com/ethereum/go-ethereum/common/math"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
 
@@ -42,65 +39,110 @@ var types = apitypes.Types{
 	},
 }
 
-var privateKey = "";
-
 type Task struct {
-	taskType int8;
-	user string;
-	coinId string;
-	amount string;
-	nonce string;
+	TaskType uint8 `json:"taskType"`;
+	User string `json:"user"`;
+	CoinId string `json:"coinId"`;
+	Amount string `json:"amount"`;
+	Nonce string `json:"nonce"`;
 }
 
+/**
+ * The request exactly as signed, with the amount in the coin's base
+ * units, so that it can be passed to the contract unchanged.
+ */
 type WithdrawalRequest struct {
-	user string;
-	coinId string;
-	amount string;
-	nonce string;
-	tasks []Task;
+	User string `json:"user"`;
+	CoinId string `json:"coinId"`;
+	Amount string `json:"amount"`;
+	Nonce string `json:"nonce"`;
+	Tasks []Task `json:"tasks"`;
+}
+
+func toUnits(amount decimal.Decimal, currency string, cfg *config.CrashConfig) decimal.Decimal {
+	decimals := int64(cfg.Currencies[currency].Decimals);
+	scale := decimal.NewFromInt(10).Pow(decimal.NewFromInt(decimals));
+
+	return amount.Mul(scale);
 }
 
-func init() {
-	privateKey = os.Getenv("AGENT_PRIVATE_KEY");
+/**
+ * The EIP-712 domain of a chain's contract. Chains that do not set a
+ * name or version use those of the original deployment.
+ */
+func withdrawalDomain(chainDef config.ChainDef) apitypes.TypedDataDomain {
+	name, version := chainDef.DomainName, chainDef.DomainVersion;
 
-	if privateKey == "" {
-		log.Fatal("AGENT_PRIVATE_KEY not defined")
+	if name == "" {
+		name = "Crash";
 	}
 
-	if strings.HasPrefix(privateKey, "0x") {
-		privateKey = privateKey[2:];
+	if version == "" {
+		version = "1.0";
 	}
 
-	log.Fatal(privateKey);
+	return apitypes.TypedDataDomain{
+		Name:              name,
+		Version:           version,
+		ChainId:           math.NewHexOrDecimal256(chainDef.ChainId),
+		VerifyingContract: chainDef.Contract,
+	};
 }
 
+/**
+ * Signs a request paying out the first item on the given chain; any
+ * further items are added as withdraw tasks so that they are paid in
+ * the same call. Coin ids are those of the chain's contract.
+ */
 func createWithdrawalRequest(
+	agent signer.Signer,
 	wallet string,
-	amount decimal.Decimal,
-	currency string,
-	chainId int64,
+	items []WithdrawItem,
+	chain string,
 	nonce int64,
 	cfg *config.CrashConfig,
 ) (*WithdrawalRequest, string, error) {
-	domain := apitypes.TypedDataDomain{
-		Name:              "Crash",
-		Version:           "1.0",
-		ChainId:           math.NewHexOrDecimal256(chainId),
-		VerifyingContract: cfg.OnChain.Contract,
-	};
+	chainDef := cfg.Chains[chain];
+	domain := withdrawalDomain(chainDef);
 
-	coinId := decimal.NewFromInt(int64(cfg.Currencies[currency].CoinId));
 	decNonce := decimal.NewFromInt(int64(nonce));
-	decimals := int64(cfg.Currencies[currency].Decimals);
 
-	scale := decimal.NewFromInt(10).Pow(decimal.NewFromInt(decimals));
+	req := WithdrawalRequest{
+		User: wallet,
+		CoinId: strconv.FormatUint(uint64(chainDef.Coins[items[0].currency].CoinId), 10),
+		Amount: toUnits(items[0].amount, items[0].currency, cfg).String(),
+		Nonce: decNonce.String(),
+		Tasks: []Task{},
+	};
+
+	tasks := make([]map[string]any, 0, len(items) - 1);
+
+	for _, item := range items[1:] {
+		task := Task{
+			TaskType: withdrawals.TASK_WITHDRAW,
+			User: wallet,
+			CoinId: strconv.FormatUint(uint64(chainDef.Coins[item.currency].CoinId), 10),
+			Amount: toUnits(item.amount, item.currency, cfg).String(),
+			Nonce: decNonce.String(),
+		};
+
+		req.Tasks = append(req.Tasks, task);
+
+		tasks = append(tasks, map[string]any{
+			"taskType": strconv.Itoa(int(task.TaskType)),
+			"user":     task.User,
+			"coinId":   task.CoinId,
+			"amount":   task.Amount,
+			"nonce":    task.Nonce,
+		});
+	}
 
 	message := apitypes.TypedDataMessage{
-		"user":   wallet,
-		"coinId": coinId.String(),
-		"amount": amount.Mul(scale).String(),
-		"nonce":  decNonce.String(),
-		"tasks":  []map[string]any{},
+		"user":   req.User,
+		"coinId": req.CoinId,
+		"amount": req.Amount,
+		"nonce":  req.Nonce,
+		"tasks":  tasks,
 	};
 
 	typedData := apitypes.TypedData{
@@ -110,13 +152,7 @@ func createWithdrawalRequest(
 		Message:     message,
 	}
 
-	privateKey, err := crypto.HexToECDSA(privateKey);
-
-	if err != nil {
-		log.Fatal("Error loading private key: ", err);
-	}
-
-	sig, err := signTypedData(typedData, privateKey);
+	sig, err := agent.SignTypedData(typedData);
 
 	if err != nil {
 		return nil, "", err;
@@ -124,93 +160,196 @@ func createWithdrawalRequest(
 
 	sigStr := "0x" + hex.EncodeToString(sig);
 
-	req := WithdrawalRequest{
-		user: wallet,
-		coinId: coinId.String(),
-		amount: amount.String(),
-		nonce: decNonce.String(),
-		tasks: []Task{},
-	};
-
 	return &req, sigStr, nil;
 }
 
-func signTypedData(data apitypes.TypedData, privateKey *ecdsa.PrivateKey) ([]byte, error) {
-	domainSeparator, err := data.HashStruct("EIP712Domain", data.Domain.Map());
+func saveWithdrawalRequest(
+	req *WithdrawalRequest,
+	chain string,
+	items []WithdrawItem,
+	sig string,
+	ttlSecs int,
+	tx *sql.Tx,
+) (error) {
+	reqStr, err := json.Marshal(req);
 
 	if err != nil {
-		return nil, err;
+		return err;
 	}
 
-	typedDataHash, err := data.HashStruct(data.PrimaryType, data.Message);
+	result, err := tx.Exec(`
+		INSERT INTO withdrawals
+		(chain, wallet, nonce, amount, currency, signature, request, expires)
+		VALUES
+		(?, ?, ?, CAST(? AS Decimal(32, 18)), ?, ?, ?, CASE WHEN ? > 0 THEN NOW(3) + INTERVAL ? SECOND END)
+	`,
+		chain,
+		req.User,
+		req.Nonce,
+		items[0].amount.String(),
+		items[0].currency,
+		sig,
+		reqStr,
+		ttlSecs,
+		ttlSecs,
+	);
 
 	if err != nil {
-		return nil, err;
+		return err;
 	}
 
-	rawData := []byte(fmt.Sprintf("\x19\x01%s%s", string(domainSeparator), string(typedDataHash)));
-
-	sighash := crypto.Keccak256(rawData);
-
-	signature, err := crypto.Sign(sighash, privateKey);
+	withdrawalId, err := result.LastInsertId();
 
 	if err != nil {
-		return nil, err;
-	}
-
-	if signature[64] == 0 || signature[64] == 1 {
-		signature[64] += 27;
+		return err;
 	}
 
-	return signature, nil;
+	return saveWithdrawalTasks(withdrawalId, req.User, items, tx);
 }
 
-func saveWithdrawalRequest(
-	req *WithdrawalRequest,
-	sig string,
+/**
+ * Records a withdrawal that is held for review. Nothing is signed yet;
+ * the nonce only keeps the row unique and is replaced on approval.
+ */
+func holdWithdrawalRequest(
+	wallet string,
+	chain string,
+	items []WithdrawItem,
+	nonce int64,
 	tx *sql.Tx,
-) (error) {
-	reqStr, err := json.Marshal(req);
+) (int64, error) {
+	result, err := tx.Exec(`
+		INSERT INTO withdrawals
+		(chain, wallet, nonce, amount, currency, status, signature, request)
+		VALUES
+		(?, ?, ?, CAST(? AS Decimal(32, 18)), ?, ?, '', '')
+	`,
+		chain,
+		wallet,
+		nonce,
+		items[0].amount.String(),
+		items[0].currency,
+		withdrawals.STATUS_REVIEW,
+	);
 
 	if err != nil {
-		return err;
+		return 0, err;
 	}
 
-	_, err = tx.Exec(`
-		INSERT INTO withdrawals
-		(wallet, nonce, amount, currency, signature, request)
-		VALUES
-		(?, ?, ?, ?, ?, ?)
-	`, req.user, req.nonce, req.amount, sig, reqStr);
+	withdrawalId, err := result.LastInsertId();
 
-	return err;
+	if err != nil {
+		return 0, err;
+	}
+
+	return withdrawalId, saveWithdrawalTasks(withdrawalId, wallet, items, tx);
 }
 
-func getNextNonce(
-	db *sql.DB,
+/**
+ * Items after the first are paid out as withdraw tasks to the same
+ * wallet.
+ */
+func saveWithdrawalTasks(
+	withdrawalId int64,
 	wallet string,
-) (int64, error) {
-	var nonce int64;
+	items []WithdrawItem,
+	tx *sql.Tx,
+) error {
+	for i, item := range items[1:] {
+		_, err := tx.Exec(`
+			INSERT INTO withdrawal_tasks
+			(withdrawalId, position, taskType, wallet, currency, amount)
+			VALUES
+			(?, ?, ?, ?, ?, CAST(? AS Decimal(32, 18)))
+		`,
+			withdrawalId,
+			i,
+			withdrawals.TASK_WITHDRAW,
+			wallet,
+			item.currency,
+			item.amount.String(),
+		);
+
+		if err != nil {
+			return err;
+		}
+	}
 
-	rows, err := db.Query(`
-		SELECT MAX(nonce)
-		FROM withdrawals
-		WHERE wallet = ?
-		GROUP BY wallet
-		LIMIT 1
-	`, wallet);
+	return nil;
+}
 
-	if err != nil {
-		return 0, err;
+/**
+ * Whether any item is above its currency's review threshold, either
+ * in its own units or in USD. An item with a USD threshold but no
+ * known rate is held, since its value cannot be checked.
+ */
+func needsReview(
+	items []WithdrawItem,
+	usdRates map[string]decimal.Decimal,
+	cfg *config.CrashConfig,
+) bool {
+	for _, item := range items {
+		threshold, ok := cfg.Withdrawals.ReviewThresholds[item.currency];
+
+		if !ok {
+			continue;
+		}
+
+		if threshold.Amount.IsPositive() && item.amount.GreaterThan(threshold.Amount) {
+			return true;
+		}
+
+		if !threshold.Usd.IsPositive() {
+			continue;
+		}
+
+		rate, ok := usdRates[item.currency];
+
+		if !ok || item.amount.Mul(rate).GreaterThan(threshold.Usd) {
+			return true;
+		}
 	}
 
-	defer rows.Close();
+	return false;
+}
 
-	if !rows.Next() {
-		return 0, nil;
+/**
+ * The items a held withdrawal was requested with, in order, for
+ * signing once it is approved.
+ */
+func heldWithdrawalItems(withdrawal *withdrawals.Withdrawal) []WithdrawItem {
+	amounts := withdrawal.Amounts();
+	items := make([]WithdrawItem, 0, len(amounts));
+
+	for _, amount := range amounts {
+		items = append(items, WithdrawItem{
+			amount: amount.Amount,
+			currency: amount.Currency,
+		});
 	}
 
-	rows.Scan(&nonce);
+	return items;
+}
+
+/**
+ * The next nonce for wallet on chain. Each chain's contract keeps its
+ * own record of used nonces, so nonces are counted per chain.
+ *
+ * Called in a transaction holding a lock on the wallet's balances,
+ * either debiting them or approving a held withdrawal, so concurrent
+ * withdrawals by the same wallet wait for each other rather than being
+ * given the same nonce.
+ */
+func nextNonce(tx *sql.Tx, wallet string, chain string) (int64, error) {
+	var nonce int64;
+
+	err := tx.QueryRow(`
+		SELECT COALESCE(MAX(nonce) + 1, 0)
+		FROM withdrawals
+		WHERE chain = ?
+		AND wallet = ?
+		FOR UPDATE
+	`, chain, wallet).Scan(&nonce);
 
-	return nonce, nil;
+	return nonce, err;
 }
@@ -0,0 +1,162 @@
+package withdrawals;
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/shopspring/decimal"
+);
+
+var (
+	ErrNotInReview = errors.New("withdrawal is not awaiting review")
+)
+
+func GetById(db *sql.DB, id int64) (*Withdrawal, error) {
+	withdrawals, err := queryWithdrawals(db, `
+		WHERE id = ?
+	`, id);
+
+	if err != nil || len(withdrawals) == 0 {
+		return nil, err;
+	}
+
+	return withdrawals[0], nil;
+}
+
+/**
+ * Withdrawals awaiting review on every chain, oldest first.
+ */
+func ListForReview(db *sql.DB) ([]*Withdrawal, error) {
+	return queryWithdrawals(db, `
+		WHERE status = ?
+		ORDER BY id
+	`, STATUS_REVIEW);
+}
+
+/**
+ * Attaches a signed voucher to a held withdrawal, returning its nonce.
+ * The nonce is chosen on approval rather than kept from when the
+ * request was held, since later withdrawals may have used up the
+ * earlier one in the meantime.
+ *
+ * sign chooses the nonce and signs the voucher inside the approving
+ * transaction. The wallet's balances are locked first, as they are for
+ * a withdrawal, so the two cannot be given the same nonce.
+ */
+func Approve(
+	db *sql.DB,
+	withdrawal *Withdrawal,
+	ttlSecs int,
+	sign func(*sql.Tx) (int64, []byte, string, error),
+) (int64, error) {
+	tx, err := db.BeginTx(context.Background(), nil);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	defer tx.Rollback();
+
+	rows, err := tx.Query(`
+		SELECT currency
+		FROM balances
+		WHERE wallet = ?
+		FOR UPDATE
+	`, withdrawal.Wallet);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	rows.Close();
+
+	var status string;
+
+	err = tx.QueryRow(`
+		SELECT status
+		FROM withdrawals
+		WHERE id = ?
+		FOR UPDATE
+	`, withdrawal.Id).Scan(&status);
+
+	if err == sql.ErrNoRows || (err == nil && status != STATUS_REVIEW) {
+		return 0, ErrNotInReview;
+	}
+
+	if err != nil {
+		return 0, err;
+	}
+
+	nonce, request, signature, err := sign(tx);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	result, err := tx.Exec(`
+		UPDATE withdrawals
+		SET status = ?, nonce = ?, request = ?, signature = ?, updated = NOW(3),
+		expires = CASE WHEN ? > 0 THEN NOW(3) + INTERVAL ? SECOND END
+		WHERE id = ?
+		AND status = ?
+	`,
+		STATUS_ISSUED,
+		nonce,
+		request,
+		signature,
+		ttlSecs,
+		ttlSecs,
+		withdrawal.Id,
+		STATUS_REVIEW,
+	);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+		if err == nil {
+			err = ErrNotInReview;
+		}
+
+		return 0, err;
+	}
+
+	return nonce, tx.Commit();
+}
+
+/**
+ * Returns the funds of a held withdrawal. As with Refund, the status
+ * change is made in the same transaction as the balance refund.
+ */
+func Reject(
+	refunder Refunder,
+	withdrawal *Withdrawal,
+) (map[string]decimal.Decimal, error) {
+	markRejected := func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE withdrawals
+			SET status = ?, updated = NOW(3)
+			WHERE id = ?
+			AND status = ?
+		`, STATUS_REJECTED, withdrawal.Id, STATUS_REVIEW);
+
+		if err != nil {
+			return err;
+		}
+
+		if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+			return ErrNotInReview;
+		}
+
+		return nil;
+	};
+
+	return refunder.RefundWithdrawal(
+		withdrawal.Wallet,
+		withdrawal.Amounts(),
+		withdrawal.Chain,
+		markRejected,
+	);
+}
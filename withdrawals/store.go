@@ -0,0 +1,413 @@
+package withdrawals;
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/chainscan"
+);
+
+var (
+	errAlreadySettled = errors.New("withdrawal already settled")
+)
+
+const CURSOR_NAME = "withdrawals";
+
+type Refunder interface {
+	RefundWithdrawal(string, []bank.Amount, string, bank.TxCallback) (map[string]decimal.Decimal, error);
+}
+
+/**
+ * Withdrawals of a single chain.
+ */
+type SqlStore struct {
+	*chainscan.SqlCursor;
+	db *sql.DB;
+	bank Refunder;
+	chain string;
+}
+
+func NewSqlStore(db *sql.DB, bank Refunder, chain string) *SqlStore {
+	return &SqlStore{
+		SqlCursor: chainscan.NewSqlCursor(db, CURSOR_NAME + ":" + chain),
+		db: db,
+		bank: bank,
+		chain: chain,
+	};
+}
+
+func (store *SqlStore) MarkSubmitted(
+	wallet string,
+	nonce int64,
+	txHash common.Hash,
+) (*Withdrawal, error) {
+	result, err := store.db.Exec(`
+		UPDATE withdrawals
+		SET status = ?, txHash = ?, updated = NOW(3)
+		WHERE chain = ?
+		AND wallet = ?
+		AND nonce = ?
+		AND status IN (?, ?)
+		AND blockHash IS NULL
+		AND (txHash IS NULL OR txHash != ?)
+	`,
+		STATUS_SUBMITTED,
+		txHash.Hex(),
+		store.chain,
+		wallet,
+		nonce,
+		STATUS_ISSUED,
+		STATUS_SUBMITTED,
+		txHash.Hex(),
+	);
+
+	return store.changed(result, err, wallet, nonce);
+}
+
+func (store *SqlStore) MarkMined(
+	wallet string,
+	nonce int64,
+	txHash common.Hash,
+	block uint64,
+	blockHash common.Hash,
+) (*Withdrawal, error) {
+	result, err := store.db.Exec(`
+		UPDATE withdrawals
+		SET status = ?, txHash = ?, blockNumber = ?, blockHash = ?, updated = NOW(3)
+		WHERE chain = ?
+		AND wallet = ?
+		AND nonce = ?
+		AND status IN (?, ?)
+		AND (blockHash IS NULL OR blockHash != ?)
+	`,
+		STATUS_SUBMITTED,
+		txHash.Hex(),
+		block,
+		blockHash.Hex(),
+		store.chain,
+		wallet,
+		nonce,
+		STATUS_ISSUED,
+		STATUS_SUBMITTED,
+		blockHash.Hex(),
+	);
+
+	return store.changed(result, err, wallet, nonce);
+}
+
+/**
+ * Keeps the wallet's unused vouchers from being refunded after a
+ * transaction we could not match to one of them. Returns how many were
+ * held.
+ */
+func (store *SqlStore) MarkUnmatched(wallet string, txHash common.Hash) (int64, error) {
+	result, err := store.db.Exec(`
+		UPDATE withdrawals
+		SET unmatchedTxHash = ?, updated = NOW(3)
+		WHERE chain = ?
+		AND wallet = ?
+		AND status IN (?, ?)
+		AND blockHash IS NULL
+		AND unmatchedTxHash IS NULL
+	`, txHash.Hex(), store.chain, wallet, STATUS_ISSUED, STATUS_SUBMITTED);
+
+	if err != nil {
+		return 0, err;
+	}
+
+	return result.RowsAffected();
+}
+
+func (store *SqlStore) changed(
+	result sql.Result,
+	err error,
+	wallet string,
+	nonce int64,
+) (*Withdrawal, error) {
+	if err != nil {
+		return nil, err;
+	}
+
+	if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+		return nil, err;
+	}
+
+	return Get(store.db, store.chain, wallet, nonce);
+}
+
+func (store *SqlStore) Mined() ([]*Withdrawal, error) {
+	return queryWithdrawals(store.db, `
+		WHERE chain = ?
+		AND status = ?
+		AND blockHash IS NOT NULL
+		ORDER BY blockNumber
+	`, store.chain, STATUS_SUBMITTED);
+}
+
+func (store *SqlStore) Confirm(withdrawal *Withdrawal) (bool, error) {
+	result, err := store.db.Exec(`
+		UPDATE withdrawals
+		SET status = ?, updated = NOW(3)
+		WHERE id = ?
+		AND status = ?
+		AND blockHash = ?
+	`, STATUS_CONFIRMED, withdrawal.Id, STATUS_SUBMITTED, withdrawal.BlockHash);
+
+	if err != nil {
+		return false, err;
+	}
+
+	rows, err := result.RowsAffected();
+
+	return rows > 0, err;
+}
+
+func (store *SqlStore) Unmine(withdrawal *Withdrawal) (bool, error) {
+	result, err := store.db.Exec(`
+		UPDATE withdrawals
+		SET blockNumber = NULL, blockHash = NULL, updated = NOW(3)
+		WHERE id = ?
+		AND status = ?
+		AND blockHash = ?
+	`, withdrawal.Id, STATUS_SUBMITTED, withdrawal.BlockHash);
+
+	if err != nil {
+		return false, err;
+	}
+
+	rows, err := result.RowsAffected();
+
+	return rows > 0, err;
+}
+
+/**
+ * Vouchers that were never seen on-chain but are superseded by a
+ * confirmed withdrawal with a higher nonce, unless held by
+ * MarkUnmatched.
+ */
+func (store *SqlStore) Unusable() ([]*Withdrawal, error) {
+	return queryWithdrawals(store.db, `
+		WHERE chain = ?
+		AND status IN (?, ?)
+		AND blockHash IS NULL
+		AND unmatchedTxHash IS NULL
+		AND EXISTS (
+			SELECT 1
+			FROM withdrawals AS later
+			WHERE later.chain = withdrawals.chain
+			AND later.wallet = withdrawals.wallet
+			AND later.nonce > withdrawals.nonce
+			AND later.status = ?
+		)
+		ORDER BY id
+	`, store.chain, STATUS_ISSUED, STATUS_SUBMITTED, STATUS_CONFIRMED);
+}
+
+/**
+ * The status change is made in the same transaction as the balance
+ * refund, so a voucher is refunded at most once.
+ */
+func (store *SqlStore) Refund(withdrawal *Withdrawal) (bool, map[string]decimal.Decimal, error) {
+	markRefunded := func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE withdrawals
+			SET status = ?, updated = NOW(3)
+			WHERE id = ?
+			AND status IN (?, ?)
+			AND blockHash IS NULL
+		`, STATUS_REFUNDED, withdrawal.Id, STATUS_ISSUED, STATUS_SUBMITTED);
+
+		if err != nil {
+			return err;
+		}
+
+		if rows, err := result.RowsAffected(); rows == 0 || err != nil {
+			return errAlreadySettled;
+		}
+
+		return nil;
+	};
+
+	balances, err := store.bank.RefundWithdrawal(
+		withdrawal.Wallet,
+		withdrawal.Amounts(),
+		store.chain,
+		markRefunded,
+	);
+
+	if err == errAlreadySettled {
+		return false, nil, nil;
+	}
+
+	if err != nil {
+		return false, nil, err;
+	}
+
+	return true, balances, nil;
+}
+
+func Get(db *sql.DB, chain string, wallet string, nonce int64) (*Withdrawal, error) {
+	withdrawals, err := queryWithdrawals(db, `
+		WHERE chain = ?
+		AND wallet = ?
+		AND nonce = ?
+	`, chain, wallet, nonce);
+
+	if err != nil || len(withdrawals) == 0 {
+		return nil, err;
+	}
+
+	return withdrawals[0], nil;
+}
+
+/**
+ * All of a wallet's withdrawals on every chain, newest first. The
+ * voucher is included so that the player can still submit one that
+ * has not been used, unless it has expired.
+ */
+func List(db *sql.DB, wallet string) ([]*Withdrawal, error) {
+	withdrawals, err := queryWithdrawals(db, `
+		WHERE wallet = ?
+		ORDER BY id DESC
+	`, wallet);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	for _, withdrawal := range withdrawals {
+		if withdrawal.Expired {
+			withdrawal.Request = nil;
+			withdrawal.Signature = "";
+		}
+	}
+
+	return withdrawals, nil;
+}
+
+func queryWithdrawals(db *sql.DB, where string, args ...any) ([]*Withdrawal, error) {
+	rows, err := db.Query(`
+		SELECT id, chain, wallet, nonce, currency, amount, status,
+		COALESCE(txHash, ''), COALESCE(blockNumber, 0), COALESCE(blockHash, ''),
+		request, signature,
+		COALESCE(FLOOR(1000 * UNIX_TIMESTAMP(expires)), 0) AS expires,
+		COALESCE(status IN (?, ?) AND blockHash IS NULL AND expires <= NOW(3), FALSE) AS expired,
+		FLOOR(1000 * UNIX_TIMESTAMP(created)) AS created
+		FROM withdrawals
+	` + where, append([]any{ STATUS_ISSUED, STATUS_SUBMITTED }, args...)...);
+
+	if err != nil {
+		return nil, err;
+	}
+
+	defer rows.Close();
+
+	withdrawals := make([]*Withdrawal, 0);
+
+	for rows.Next() {
+		var withdrawal Withdrawal;
+		var amountStr string;
+		var request string;
+		var expires int64;
+		var created int64;
+
+		err := rows.Scan(
+			&withdrawal.Id,
+			&withdrawal.Chain,
+			&withdrawal.Wallet,
+			&withdrawal.Nonce,
+			&withdrawal.Currency,
+			&amountStr,
+			&withdrawal.Status,
+			&withdrawal.TxHash,
+			&withdrawal.BlockNumber,
+			&withdrawal.BlockHash,
+			&request,
+			&withdrawal.Signature,
+			&expires,
+			&withdrawal.Expired,
+			&created,
+		);
+
+		if err != nil {
+			return nil, err;
+		}
+
+		if withdrawal.Amount, err = decimal.NewFromString(amountStr); err != nil {
+			return nil, err;
+		}
+
+		// Held withdrawals have no voucher yet.
+		if request != "" {
+			withdrawal.Request = []byte(request);
+		}
+
+		if expires > 0 {
+			expiresAt := time.UnixMilli(expires);
+			withdrawal.Expires = &expiresAt;
+		}
+		withdrawal.Created = time.UnixMilli(created);
+
+		withdrawals = append(withdrawals, &withdrawal);
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err;
+	}
+
+	return withdrawals, loadTasks(db, withdrawals);
+}
+
+func loadTasks(db *sql.DB, withdrawals []*Withdrawal) error {
+	if len(withdrawals) == 0 {
+		return nil;
+	}
+
+	byId := make(map[int64]*Withdrawal);
+	ids := make([]any, 0, len(withdrawals));
+
+	for _, withdrawal := range withdrawals {
+		byId[withdrawal.Id] = withdrawal;
+		ids = append(ids, withdrawal.Id);
+	}
+
+	rows, err := db.Query(`
+		SELECT withdrawalId, taskType, wallet, currency, amount
+		FROM withdrawal_tasks
+		WHERE withdrawalId IN (` + strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + `)
+		ORDER BY withdrawalId, position
+	`, ids...);
+
+	if err != nil {
+		return err;
+	}
+
+	defer rows.Close();
+
+	for rows.Next() {
+		var task Task;
+		var withdrawalId int64;
+		var amountStr string;
+
+		err := rows.Scan(&withdrawalId, &task.TaskType, &task.Wallet, &task.Currency, &amountStr);
+
+		if err != nil {
+			return err;
+		}
+
+		if task.Amount, err = decimal.NewFromString(amountStr); err != nil {
+			return err;
+		}
+
+		withdrawal := byId[withdrawalId];
+		withdrawal.Tasks = append(withdrawal.Tasks, task);
+	}
+
+	return rows.Err();
+}
@@ -0,0 +1,432 @@
+package withdrawals;
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/bank"
+	"github.com/samott/crash-backend/chainscan"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+);
+
+var (
+	ErrInvalidContract = errors.New("invalid contract address")
+	ErrUnknownChain = errors.New("unknown chain")
+	ErrNotWithdrawCall = errors.New("transaction is not a withdraw call")
+)
+
+/**
+ * A withdrawal is issued when its voucher is signed, submitted once we
+ * know of a transaction for it and confirmed when that transaction's
+ * block is deep enough. A voucher that can no longer be used is
+ * refunded.
+ *
+ * Vouchers carry no on-chain expiry: the deployed contract's
+ * WithdrawalRequest has no field for one, and adding it to the typed
+ * data alone would make every signature invalid. Expiry is therefore
+ * only enforced here, by no longer handing out the voucher; the funds
+ * are returned once it is provably unusable, which is when a voucher
+ * with a higher nonce for the same wallet has been confirmed, since
+ * the contract only accepts nonces above the last one used.
+ *
+ * Large withdrawals are first held for review, with the funds already
+ * debited but no voucher signed. Approval signs one and moves it to
+ * issued; rejection refunds it.
+ */
+const (
+	STATUS_REVIEW    = "review";
+	STATUS_ISSUED    = "issued";
+	STATUS_SUBMITTED = "submitted";
+	STATUS_CONFIRMED = "confirmed";
+	STATUS_REFUNDED  = "refunded";
+	STATUS_REJECTED  = "rejected";
+);
+
+/**
+ * Values of the contract's Crash.TaskType enum. Withdraw tasks pay out
+ * a further currency in the same call and are debited like the main
+ * request; the balance tasks only adjust the contract's own records.
+ */
+const (
+	TASK_WITHDRAW         = 0;
+	TASK_INCREASE_BALANCE = 1;
+	TASK_DECREASE_BALANCE = 2;
+);
+
+type Client interface {
+	chainscan.Client;
+	TransactionByHash(context.Context, common.Hash) (*types.Transaction, bool, error);
+}
+
+type Task struct {
+	TaskType uint8 `json:"taskType"`;
+	Wallet string `json:"wallet"`;
+	Currency string `json:"currency"`;
+	Amount decimal.Decimal `json:"amount"`;
+}
+
+type Withdrawal struct {
+	Id int64 `json:"id"`;
+	Chain string `json:"chain"`;
+	Wallet string `json:"wallet"`;
+	Nonce int64 `json:"nonce"`;
+	Currency string `json:"currency"`;
+	Amount decimal.Decimal `json:"amount"`;
+	Tasks []Task `json:"tasks,omitempty"`;
+	Status string `json:"status"`;
+	TxHash string `json:"txHash,omitempty"`;
+	BlockNumber uint64 `json:"blockNumber,omitempty"`;
+	BlockHash string `json:"-"`;
+	Request json.RawMessage `json:"request,omitempty"`;
+	Signature string `json:"signature,omitempty"`;
+	Expires *time.Time `json:"expires,omitempty"`;
+	Expired bool `json:"expired"`;
+	Created time.Time `json:"created"`;
+}
+
+/**
+ * Everything the withdrawal debited from the player: the main amount
+ * and any withdraw tasks paying out to the same wallet.
+ */
+func (withdrawal *Withdrawal) Amounts() []bank.Amount {
+	amounts := []bank.Amount{ { Currency: withdrawal.Currency, Amount: withdrawal.Amount } };
+
+	for _, task := range withdrawal.Tasks {
+		if task.TaskType == TASK_WITHDRAW && task.Wallet == withdrawal.Wallet {
+			amounts = append(amounts, bank.Amount{ Currency: task.Currency, Amount: task.Amount });
+		}
+	}
+
+	return amounts;
+}
+
+/**
+ * Persistence for the tracker. The Mark methods return the updated
+ * withdrawal, or nil if nothing changed because it is unknown or has
+ * already moved past that point.
+ */
+type Store interface {
+	chainscan.Cursor;
+	MarkSubmitted(string, int64, common.Hash) (*Withdrawal, error);
+	MarkMined(string, int64, common.Hash, uint64, common.Hash) (*Withdrawal, error);
+	Mined() ([]*Withdrawal, error);
+	Confirm(*Withdrawal) (bool, error);
+	Unmine(*Withdrawal) (bool, error);
+	MarkUnmatched(string, common.Hash) (int64, error);
+	Unusable() ([]*Withdrawal, error);
+	Refund(*Withdrawal) (bool, map[string]decimal.Decimal, error);
+}
+
+type Listener interface {
+	WithdrawalStatusChanged(*Withdrawal);
+	WithdrawalRefunded(*Withdrawal, map[string]decimal.Decimal);
+}
+
+/**
+ * Matches on-chain withdraw calls to the vouchers we issued on one
+ * chain. Nonces are only unique per chain, so each chain needs its own
+ * tracker and store.
+ */
+type Tracker struct {
+	chain string;
+	client Client;
+	scanner *chainscan.Scanner;
+	contract common.Address;
+	store Store;
+	listener Listener;
+	confirmations map[string]uint64;
+	maxConfirmations uint64;
+}
+
+func NewTracker(
+	client Client,
+	cfg *config.CrashConfig,
+	chain string,
+	store Store,
+	listener Listener,
+) (*Tracker, error) {
+	chainDef, ok := cfg.Chains[chain];
+
+	if !ok {
+		return nil, ErrUnknownChain;
+	}
+
+	if !common.IsHexAddress(chainDef.Contract) {
+		return nil, ErrInvalidContract;
+	}
+
+	address := common.HexToAddress(chainDef.Contract);
+	confirmations := make(map[string]uint64);
+	maxConfirmations := uint64(1);
+
+	for currency, def := range chainDef.Coins {
+		confirmations[currency] = max(def.Confirmations, 1);
+		maxConfirmations = max(maxConfirmations, confirmations[currency]);
+	}
+
+	scanner := chainscan.NewScanner(
+		client,
+		store,
+		[]common.Address{ address },
+		[][]common.Hash{ { contract.BalanceDecreasedTopic() } },
+		chainDef.StartBlock,
+		maxConfirmations,
+	);
+
+	return &Tracker{
+		chain: chain,
+		client: client,
+		scanner: scanner,
+		contract: address,
+		store: store,
+		listener: listener,
+		confirmations: confirmations,
+		maxConfirmations: maxConfirmations,
+	}, nil;
+}
+
+/**
+ * Records a transaction hash reported by the player before it has been
+ * seen on-chain.
+ */
+func (tracker *Tracker) Submit(wallet string, nonce int64, txHash common.Hash) (bool, error) {
+	withdrawal, err := tracker.store.MarkSubmitted(wallet, nonce, txHash);
+
+	if err != nil || withdrawal == nil {
+		return false, err;
+	}
+
+	tracker.notify(withdrawal);
+
+	return true, nil;
+}
+
+func (tracker *Tracker) Poll(ctx context.Context) error {
+	head, err := tracker.scanner.Scan(ctx, func(log *types.Log) error {
+		return tracker.handleLog(ctx, log);
+	});
+
+	if err != nil {
+		return err;
+	}
+
+	if err := tracker.settle(ctx, head); err != nil {
+		return err;
+	}
+
+	return tracker.refundUnusable();
+}
+
+/**
+ * BalanceDecreased does not carry the nonce, so the withdraw call that
+ * emitted it is decoded to find which voucher was used. Calls made
+ * through another contract cannot be decoded this way, so the wallet's
+ * unused vouchers are held back from refund, as one of them may have
+ * been spent.
+ */
+func (tracker *Tracker) handleLog(ctx context.Context, log *types.Log) error {
+	tx, _, err := tracker.client.TransactionByHash(ctx, log.TxHash);
+
+	if err != nil {
+		return err;
+	}
+
+	call, err := tracker.decodeWithdraw(tx);
+
+	if err != nil {
+		return tracker.handleUnmatched(log, err);
+	}
+
+	if !call.Nonce.IsInt64() {
+		return nil;
+	}
+
+	withdrawal, err := tracker.store.MarkMined(
+		call.User.String(),
+		call.Nonce.Int64(),
+		log.TxHash,
+		log.BlockNumber,
+		log.BlockHash,
+	);
+
+	if err != nil || withdrawal == nil {
+		return err;
+	}
+
+	slog.Info(
+		"Withdrawal mined",
+		"chain", tracker.chain,
+		"wallet", withdrawal.Wallet,
+		"nonce", withdrawal.Nonce,
+		"txHash", log.TxHash,
+		"block", log.BlockNumber,
+	);
+
+	tracker.notify(withdrawal);
+
+	return nil;
+}
+
+func (tracker *Tracker) handleUnmatched(log *types.Log, cause error) error {
+	event, err := contract.ParseBalanceDecreased(log);
+
+	if err != nil {
+		return err;
+	}
+
+	held, err := tracker.store.MarkUnmatched(event.User.String(), log.TxHash);
+
+	if err != nil {
+		return err;
+	}
+
+	slog.Error(
+		"Unable to match withdrawal log; vouchers held",
+		"chain", tracker.chain,
+		"wallet", event.User,
+		"txHash", log.TxHash,
+		"logIndex", log.Index,
+		"held", held,
+		"error", cause,
+	);
+
+	return nil;
+}
+
+func (tracker *Tracker) decodeWithdraw(tx *types.Transaction) (*contract.CrashWithdrawalRequest, error) {
+	if tx.To() == nil || *tx.To() != tracker.contract {
+		return nil, ErrNotWithdrawCall;
+	}
+
+	req, _, err := contract.DecodeWithdraw(tx.Data());
+
+	return req, err;
+}
+
+/**
+ * Confirms mined withdrawals once deep enough. If the block has been
+ * replaced, the withdrawal goes back to waiting for its transaction to
+ * be mined again.
+ */
+func (tracker *Tracker) settle(ctx context.Context, head uint64) error {
+	mined, err := tracker.store.Mined();
+
+	if err != nil {
+		return err;
+	}
+
+	canonical := chainscan.NewCanonical(tracker.client);
+
+	for _, withdrawal := range mined {
+		if withdrawal.BlockNumber > head {
+			continue;
+		}
+
+		ok, err := canonical.Contains(ctx, withdrawal.BlockNumber, common.HexToHash(withdrawal.BlockHash));
+
+		if err != nil {
+			return err;
+		}
+
+		if !ok {
+			if unmined, err := tracker.store.Unmine(withdrawal); err != nil || !unmined {
+				return err;
+			}
+
+			slog.Warn(
+				"Withdrawal block orphaned",
+				"chain", tracker.chain,
+				"wallet", withdrawal.Wallet,
+				"nonce", withdrawal.Nonce,
+				"blockHash", withdrawal.BlockHash,
+			);
+
+			withdrawal.BlockNumber = 0;
+			withdrawal.BlockHash = "";
+			tracker.notify(withdrawal);
+			continue;
+		}
+
+		required, ok := tracker.confirmations[withdrawal.Currency];
+
+		if !ok {
+			required = tracker.maxConfirmations;
+		}
+
+		if head - withdrawal.BlockNumber + 1 < required {
+			continue;
+		}
+
+		if confirmed, err := tracker.store.Confirm(withdrawal); err != nil || !confirmed {
+			return err;
+		}
+
+		slog.Info(
+			"Withdrawal confirmed",
+			"chain", tracker.chain,
+			"wallet", withdrawal.Wallet,
+			"nonce", withdrawal.Nonce,
+			"txHash", withdrawal.TxHash,
+		);
+
+		withdrawal.Status = STATUS_CONFIRMED;
+		tracker.notify(withdrawal);
+	}
+
+	return nil;
+}
+
+/**
+ * Runs after settle, so that any withdrawal confirmed in this poll can
+ * release the vouchers it has made unusable straight away.
+ */
+func (tracker *Tracker) refundUnusable() error {
+	unusable, err := tracker.store.Unusable();
+
+	if err != nil {
+		return err;
+	}
+
+	for _, withdrawal := range unusable {
+		refunded, balances, err := tracker.store.Refund(withdrawal);
+
+		if err != nil {
+			return err;
+		}
+
+		if !refunded {
+			continue;
+		}
+
+		slog.Info(
+			"Unusable withdrawal refunded",
+			"chain", tracker.chain,
+			"wallet", withdrawal.Wallet,
+			"nonce", withdrawal.Nonce,
+			"currency", withdrawal.Currency,
+			"amount", withdrawal.Amount,
+		);
+
+		withdrawal.Status = STATUS_REFUNDED;
+
+		if tracker.listener != nil {
+			tracker.listener.WithdrawalRefunded(withdrawal, balances);
+		}
+	}
+
+	return nil;
+}
+
+func (tracker *Tracker) notify(withdrawal *Withdrawal) {
+	if tracker.listener != nil {
+		tracker.listener.WithdrawalStatusChanged(withdrawal);
+	}
+}
@@ -0,0 +1,450 @@
+package withdrawals;
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/samott/crash-backend/chaintest"
+	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/contract"
+);
+
+var cfg *config.CrashConfig;
+
+type memStore struct {
+	lastBlock uint64;
+	lastHash common.Hash;
+	hasLastBlock bool;
+	withdrawals []*Withdrawal;
+	unmatched map[int64]common.Hash;
+}
+
+func (store *memStore) LastBlock() (uint64, common.Hash, bool, error) {
+	return store.lastBlock, store.lastHash, store.hasLastBlock, nil;
+}
+
+func (store *memStore) SetLastBlock(block uint64, hash common.Hash) error {
+	store.lastBlock = block;
+	store.lastHash = hash;
+	store.hasLastBlock = true;
+	return nil;
+}
+
+func (store *memStore) find(wallet string, nonce int64) *Withdrawal {
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.Wallet == wallet && withdrawal.Nonce == nonce {
+			return withdrawal;
+		}
+	}
+
+	return nil;
+}
+
+func (store *memStore) MarkSubmitted(
+	wallet string,
+	nonce int64,
+	txHash common.Hash,
+) (*Withdrawal, error) {
+	withdrawal := store.find(wallet, nonce);
+
+	if withdrawal == nil || withdrawal.Status == STATUS_CONFIRMED || withdrawal.BlockHash != "" {
+		return nil, nil;
+	}
+
+	withdrawal.Status = STATUS_SUBMITTED;
+	withdrawal.TxHash = txHash.Hex();
+
+	copy := *withdrawal;
+	return &copy, nil;
+}
+
+func (store *memStore) MarkMined(
+	wallet string,
+	nonce int64,
+	txHash common.Hash,
+	block uint64,
+	blockHash common.Hash,
+) (*Withdrawal, error) {
+	withdrawal := store.find(wallet, nonce);
+
+	if withdrawal == nil || withdrawal.Status == STATUS_CONFIRMED || withdrawal.BlockHash == blockHash.Hex() {
+		return nil, nil;
+	}
+
+	withdrawal.Status = STATUS_SUBMITTED;
+	withdrawal.TxHash = txHash.Hex();
+	withdrawal.BlockNumber = block;
+	withdrawal.BlockHash = blockHash.Hex();
+
+	copy := *withdrawal;
+	return &copy, nil;
+}
+
+func (store *memStore) Mined() ([]*Withdrawal, error) {
+	mined := make([]*Withdrawal, 0);
+
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.Status == STATUS_SUBMITTED && withdrawal.BlockHash != "" {
+			copy := *withdrawal;
+			mined = append(mined, &copy);
+		}
+	}
+
+	return mined, nil;
+}
+
+func (store *memStore) Confirm(mined *Withdrawal) (bool, error) {
+	withdrawal := store.find(mined.Wallet, mined.Nonce);
+
+	if withdrawal.Status != STATUS_SUBMITTED || withdrawal.BlockHash != mined.BlockHash {
+		return false, nil;
+	}
+
+	withdrawal.Status = STATUS_CONFIRMED;
+
+	return true, nil;
+}
+
+func (store *memStore) Unmine(mined *Withdrawal) (bool, error) {
+	withdrawal := store.find(mined.Wallet, mined.Nonce);
+
+	if withdrawal.Status != STATUS_SUBMITTED || withdrawal.BlockHash != mined.BlockHash {
+		return false, nil;
+	}
+
+	withdrawal.BlockNumber = 0;
+	withdrawal.BlockHash = "";
+
+	return true, nil;
+}
+
+func (store *memStore) MarkUnmatched(wallet string, txHash common.Hash) (int64, error) {
+	var held int64;
+
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.Wallet != wallet || withdrawal.BlockHash != "" {
+			continue;
+		}
+
+		if withdrawal.Status != STATUS_ISSUED && withdrawal.Status != STATUS_SUBMITTED {
+			continue;
+		}
+
+		if _, ok := store.unmatched[withdrawal.Id]; !ok {
+			store.unmatched[withdrawal.Id] = txHash;
+			held++;
+		}
+	}
+
+	return held, nil;
+}
+
+func (store *memStore) Unusable() ([]*Withdrawal, error) {
+	unusable := make([]*Withdrawal, 0);
+
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.Status == STATUS_CONFIRMED || withdrawal.Status == STATUS_REFUNDED || withdrawal.BlockHash != "" {
+			continue;
+		}
+
+		if _, ok := store.unmatched[withdrawal.Id]; ok {
+			continue;
+		}
+
+		for _, later := range store.withdrawals {
+			if later.Wallet == withdrawal.Wallet && later.Nonce > withdrawal.Nonce && later.Status == STATUS_CONFIRMED {
+				copy := *withdrawal;
+				unusable = append(unusable, &copy);
+				break;
+			}
+		}
+	}
+
+	return unusable, nil;
+}
+
+func (store *memStore) Refund(unusable *Withdrawal) (bool, map[string]decimal.Decimal, error) {
+	withdrawal := store.find(unusable.Wallet, unusable.Nonce);
+
+	if withdrawal.Status == STATUS_CONFIRMED || withdrawal.Status == STATUS_REFUNDED || withdrawal.BlockHash != "" {
+		return false, nil, nil;
+	}
+
+	withdrawal.Status = STATUS_REFUNDED;
+	balances := make(map[string]decimal.Decimal);
+
+	for _, amount := range withdrawal.Amounts() {
+		balances[amount.Currency] = balances[amount.Currency].Add(amount.Amount);
+	}
+
+	return true, balances, nil;
+}
+
+type recordingListener struct {
+	updates []Withdrawal;
+	refunded []Withdrawal;
+}
+
+func (listener *recordingListener) WithdrawalStatusChanged(withdrawal *Withdrawal) {
+	listener.updates = append(listener.updates, *withdrawal);
+}
+
+func (listener *recordingListener) WithdrawalRefunded(withdrawal *Withdrawal, _ map[string]decimal.Decimal) {
+	listener.refunded = append(listener.refunded, *withdrawal);
+}
+
+func init() {
+	var err error;
+
+	cfg, err = config.LoadConfig("../crash_test.yaml");
+
+	if err != nil {
+		log.Fatal("Failed to load config: ", err);
+	}
+}
+
+func sendWithdraw(
+	t *testing.T,
+	chain *chaintest.Chain,
+	logger common.Address,
+	user common.Address,
+	nonce int64,
+) common.Hash {
+	crashAbi, err := contract.CrashMetaData.GetAbi();
+
+	if err != nil {
+		t.Fatal("Failed to parse contract ABI: ", err);
+	}
+
+	data, err := crashAbi.Pack("withdraw", contract.CrashWithdrawalRequest{
+		User: user,
+		CoinId: cfg.Chains["ethereum"].Coins["eth"].CoinId,
+		Amount: big.NewInt(1000),
+		Nonce: big.NewInt(nonce),
+		Tasks: []contract.CrashTask{},
+	}, []byte{ 1, 2, 3 });
+
+	if err != nil {
+		t.Fatal("Failed to pack withdraw call: ", err);
+	}
+
+	tx, err := chain.SendTx(&logger, data);
+
+	if err != nil {
+		t.Fatal("Failed to send withdraw call: ", err);
+	}
+
+	return tx.Hash();
+}
+
+/**
+ * Starts a chain with a stand-in contract and a tracker for it, with
+ * two vouchers issued to user.
+ */
+func newTestTracker(
+	t *testing.T,
+	user common.Address,
+) (*chaintest.Chain, common.Address, *Tracker, *memStore, *recordingListener) {
+	chain, err := chaintest.NewChain();
+
+	if err != nil {
+		t.Fatal("Failed to start simulated chain: ", err);
+	}
+
+	// The user, coinId, amount and nonce of the request, standing in
+	// for the user, coinId, amount and newBalance of the real event.
+	logger, err := chain.DeployLogger(contract.BalanceDecreasedTopic(), 0x44, 0x80);
+
+	if err != nil {
+		chain.Close();
+		t.Fatal("Failed to deploy logger: ", err);
+	}
+
+	chainDef := cfg.Chains["ethereum"];
+	chainDef.Contract = logger.Hex();
+
+	trackerCfg := *cfg;
+	trackerCfg.Chains = map[string]config.ChainDef{ "ethereum": chainDef };
+
+	store := &memStore{
+		withdrawals: []*Withdrawal{
+			{
+				Id: 1,
+				Wallet: user.String(),
+				Nonce: 0,
+				Currency: "eth",
+				Amount: decimal.New(1, -15),
+				Tasks: []Task{ { TaskType: TASK_WITHDRAW, Wallet: user.String(), Currency: "btc", Amount: decimal.New(5, -1) } },
+				Status: STATUS_ISSUED,
+			},
+			{ Id: 2, Wallet: user.String(), Nonce: 1, Currency: "eth", Amount: decimal.New(1, -15), Status: STATUS_ISSUED },
+		},
+		unmatched: make(map[int64]common.Hash),
+	};
+
+	listener := &recordingListener{};
+
+	tracker, err := NewTracker(chain.Client, &trackerCfg, "ethereum", store, listener);
+
+	if err != nil {
+		chain.Close();
+		t.Fatal("Failed to create tracker: ", err);
+	}
+
+	return chain, logger, tracker, store, listener;
+}
+
+func TestTrackerFollowsWithdrawal(t *testing.T) {
+	user := common.HexToAddress("0x3333333333333333333333333333333333333333");
+	chain, logger, tracker, store, listener := newTestTracker(t, user);
+
+	defer chain.Close();
+
+	// The player reports a transaction for the second voucher.
+	submitted, err := tracker.Submit(user.String(), 1, common.HexToHash("0x01"));
+
+	if err != nil || !submitted {
+		t.Fatal("Submit() failed: ", err);
+	}
+
+	txHash := sendWithdraw(t, chain, logger, user, 0);
+	sendWithdraw(t, chain, logger, user, 7);
+	chain.Commit();
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	if len(listener.updates) != 2 {
+		t.Fatal("Expected 2 status updates, got ", len(listener.updates));
+	}
+
+	mined := listener.updates[1];
+
+	if mined.Nonce != 0 || mined.Status != STATUS_SUBMITTED || mined.TxHash != txHash.Hex() || mined.BlockNumber == 0 {
+		t.Fatal("Mined withdrawal not recorded correctly: ", mined);
+	}
+
+	chain.Commit();
+	chain.Commit();
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	if len(listener.updates) != 3 || listener.updates[2].Status != STATUS_CONFIRMED {
+		t.Fatal("Withdrawal not confirmed");
+	}
+
+	if store.withdrawals[1].Status != STATUS_SUBMITTED {
+		t.Fatal("Unmined withdrawal changed status: ", store.withdrawals[1].Status);
+	}
+}
+
+func TestTrackerRefundsSupersededVoucher(t *testing.T) {
+	user := common.HexToAddress("0x4444444444444444444444444444444444444444");
+	chain, logger, tracker, store, listener := newTestTracker(t, user);
+
+	defer chain.Close();
+
+	// Nonce 0 is never used; once nonce 1 is confirmed, the contract
+	// will no longer accept it.
+	sendWithdraw(t, chain, logger, user, 1);
+	chain.Commit();
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	if len(listener.refunded) != 0 {
+		t.Fatal("Voucher refunded before the later withdrawal was confirmed");
+	}
+
+	chain.Commit();
+	chain.Commit();
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	if len(listener.refunded) != 1 || listener.refunded[0].Nonce != 0 {
+		t.Fatal("Expected the nonce 0 voucher to be refunded");
+	}
+
+	if len(listener.refunded[0].Amounts()) != 2 {
+		t.Fatal("Refund did not cover the voucher's tasks");
+	}
+
+	if store.withdrawals[0].Status != STATUS_REFUNDED || store.withdrawals[1].Status != STATUS_CONFIRMED {
+		t.Fatal("Unexpected statuses: ", store.withdrawals[0].Status, store.withdrawals[1].Status);
+	}
+}
+
+func TestTrackerHoldsVouchersAfterUnmatchedLog(t *testing.T) {
+	user := common.HexToAddress("0x5555555555555555555555555555555555555555");
+	chain, logger, tracker, store, listener := newTestTracker(t, user);
+
+	defer chain.Close();
+
+	// A call through some other contract: the event names the user
+	// but the calldata is not a withdraw call.
+	data := make([]byte, 0x44 + 0x80);
+	copy(data[0x44 + 12:], user.Bytes());
+
+	if _, err := chain.SendTx(&logger, data); err != nil {
+		t.Fatal("Failed to send call: ", err);
+	}
+
+	chain.Commit();
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	if len(store.unmatched) != 2 {
+		t.Fatal("Expected both vouchers to be held, got ", len(store.unmatched));
+	}
+
+	// Nonce 1 would supersede nonce 0, but that one may be the voucher
+	// the unmatched call used.
+	sendWithdraw(t, chain, logger, user, 1);
+	chain.Commit();
+	chain.Commit();
+	chain.Commit();
+
+	if err := tracker.Poll(context.Background()); err != nil {
+		t.Fatal("Poll() failed: ", err);
+	}
+
+	if store.withdrawals[1].Status != STATUS_CONFIRMED {
+		t.Fatal("Later withdrawal not confirmed: ", store.withdrawals[1].Status);
+	}
+
+	if len(listener.refunded) != 0 {
+		t.Fatal("Held voucher refunded");
+	}
+}
+
+func TestWithdrawalAmounts(t *testing.T) {
+	withdrawal := Withdrawal{
+		Wallet: "0x5555555555555555555555555555555555555555",
+		Currency: "eth",
+		Amount: decimal.New(1, 0),
+		Tasks: []Task{
+			{ TaskType: TASK_WITHDRAW, Wallet: "0x5555555555555555555555555555555555555555", Currency: "btc", Amount: decimal.New(2, 0) },
+			{ TaskType: TASK_DECREASE_BALANCE, Wallet: "0x5555555555555555555555555555555555555555", Currency: "eth", Amount: decimal.New(3, 0) },
+			{ TaskType: TASK_WITHDRAW, Wallet: "0x6666666666666666666666666666666666666666", Currency: "eth", Amount: decimal.New(4, 0) },
+		},
+	};
+
+	amounts := withdrawal.Amounts();
+
+	if len(amounts) != 2 || amounts[1].Currency != "btc" || !amounts[1].Amount.Equal(decimal.New(2, 0)) {
+		t.Fatal("Amounts() should only include the player's own withdraw tasks: ", amounts);
+	}
+}
@@ -4,12 +4,24 @@ import (
 	"log"
 	"testing"
 
+	"github.com/samott/crash-backend/bank"
 	"github.com/samott/crash-backend/config"
+	"github.com/samott/crash-backend/signer"
+	"github.com/samott/crash-backend/withdrawals"
 
+	"database/sql"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-sql-driver/mysql"
 	"github.com/shopspring/decimal"
 )
 
 var cfg *config.CrashConfig;
+var testDb *sql.DB;
+
+// Well-known development key (first Hardhat/Anvil account); never
+// holds funds on any real network.
+var agent signer.Signer;
 
 func init() {
 	var err error;
@@ -20,13 +32,25 @@ func init() {
 		log.Fatal("failed to load config", err);
 	}
 
+	key, err := crypto.HexToECDSA("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80");
+
 	if err != nil {
-		log.Fatal("failed to connect to database", "error", err)
-		return;
+		log.Fatal("failed to load test key", err);
 	}
 
+	agent = signer.NewKeySigner(key);
+
+	dbConfig := mysql.Config{
+		User: cfg.Database.User,
+		DBName: cfg.Database.DBName,
+		Addr: cfg.Database.Addr,
+		AllowNativePasswords: true,
+	};
+
+	testDb, err = sql.Open("mysql", dbConfig.FormatDSN());
+
 	if err != nil {
-		log.Fatal("bank construction failed", err);
+		log.Fatal("failed to connect to database", err);
 	}
 }
 
@@ -34,10 +58,10 @@ func TestWithdrawal(t *testing.T) {
 	amount, _ := decimal.NewFromString("1");
 
 	_, sig, err := createWithdrawalRequest(
+		agent,
 		"0x1111111111111111111111111111111111111111",
-		amount,
-		"eth",
-		1,
+		[]WithdrawItem{ { amount: amount, currency: "eth" } },
+		"ethereum",
 		0,
 		cfg,
 	);
@@ -46,9 +70,288 @@ func TestWithdrawal(t *testing.T) {
 		log.Fatal("Failed to create withdrawal request: ", err);
 	}
 
-	expectedSig := "0x4aaa23c780b7c15b65bb33e283b7e3be3b364b61bfe1e02060d63cf2cfc6edf56f6e1f8312dcf9323239637b03bf5f89c9a80a6967e20da0a6b8e9a43fbaa0011b";
+	expectedSig := "0x2f00780d3de653c894158f1b7cdb0cadc8300b55cd115205a83d56025b0bd0ca1f3f1487e807943dc193f791e3a1ee82930eb4a8dbaf586df7287b087febca071c";
 
 	if sig != expectedSig {
 		log.Fatal("Incorrect signature for withdrawal request: ", sig, " vs. ", expectedSig);
 	}
 }
+
+func TestWithdrawalWithTasks(t *testing.T) {
+	req, _, err := createWithdrawalRequest(
+		agent,
+		"0x1111111111111111111111111111111111111111",
+		[]WithdrawItem{
+			{ amount: decimal.RequireFromString("1.5"), currency: "eth" },
+			{ amount: decimal.RequireFromString("0.25"), currency: "btc" },
+		},
+		"ethereum",
+		3,
+		cfg,
+	);
+
+	if err != nil {
+		t.Fatal("Failed to create withdrawal request: ", err);
+	}
+
+	if req.Amount != "1500000000000000000" || len(req.Tasks) != 1 {
+		t.Fatal("Incorrect main withdrawal: ", req.Amount, len(req.Tasks));
+	}
+
+	task := req.Tasks[0];
+
+	if task.TaskType != withdrawals.TASK_WITHDRAW || task.Amount != "25000000" || task.CoinId != "2" || task.Nonce != "3" {
+		t.Fatal("Incorrect withdraw task: ", task);
+	}
+}
+
+func TestWithdrawalOnOtherChain(t *testing.T) {
+	items := []WithdrawItem{ { amount: decimal.RequireFromString("1"), currency: "eth" } };
+
+	req, sig, err := createWithdrawalRequest(
+		agent,
+		"0x1111111111111111111111111111111111111111",
+		items,
+		"polygon",
+		0,
+		cfg,
+	);
+
+	if err != nil {
+		t.Fatal("Failed to create withdrawal request: ", err);
+	}
+
+	if req.CoinId != "7" {
+		t.Fatal("Request uses wrong chain's coin id: ", req.CoinId);
+	}
+
+	_, otherSig, _ := createWithdrawalRequest(
+		agent,
+		"0x1111111111111111111111111111111111111111",
+		[]WithdrawItem{ { amount: decimal.RequireFromString("1"), currency: "eth" } },
+		"ethereum",
+		0,
+		cfg,
+	);
+
+	if sig == otherSig {
+		t.Fatal("Signature not bound to the chain's domain");
+	}
+}
+
+func TestWithdrawalNonces(t *testing.T) {
+	key, err := crypto.GenerateKey();
+
+	if err != nil {
+		t.Fatal("Failed to generate key: ", err);
+	}
+
+	wallet := crypto.PubkeyToAddress(key.PublicKey).String();
+
+	_, err = testDb.Exec(`
+		INSERT INTO balances
+		(currency, balance, wallet)
+		VALUES
+		('eth', 10, ?)
+	`, wallet);
+
+	if err != nil {
+		t.Fatal("Failed to insert balance: ", err);
+	}
+
+	bankObj, err := bank.NewBank(testDb, cfg);
+
+	if err != nil {
+		t.Fatal("Failed to create bank: ", err);
+	}
+
+	amount := decimal.New(1, -1);
+	items := []WithdrawItem{ { amount: amount, currency: "eth" } };
+
+	for range 4 {
+		_, err := bankObj.WithdrawBalances(
+			wallet,
+			[]bank.Amount{ { Currency: "eth", Amount: amount } },
+			"ethereum",
+			func(tx *sql.Tx) error {
+				nonce, err := nextNonce(tx, wallet, "ethereum");
+
+				if err != nil {
+					return err;
+				}
+
+				req, sig, err := createWithdrawalRequest(agent, wallet, items, "ethereum", nonce, cfg);
+
+				if err != nil {
+					return err;
+				}
+
+				return saveWithdrawalRequest(req, "ethereum", items, sig, 0, tx);
+			},
+		);
+
+		if err != nil {
+			t.Fatal("Withdrawal failed: ", err);
+		}
+	}
+
+	var count, distinct, highest int64;
+
+	err = testDb.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT nonce), MAX(nonce)
+		FROM withdrawals
+		WHERE wallet = ?
+	`, wallet).Scan(&count, &distinct, &highest);
+
+	if err != nil {
+		t.Fatal("Failed to count withdrawals: ", err);
+	}
+
+	if count != 4 || distinct != 4 || highest != 3 {
+		t.Fatal("Unexpected nonces: ", count, distinct, highest);
+	}
+}
+
+func TestApproveHeldWithdrawal(t *testing.T) {
+	key, err := crypto.GenerateKey();
+
+	if err != nil {
+		t.Fatal("Failed to generate key: ", err);
+	}
+
+	wallet := crypto.PubkeyToAddress(key.PublicKey).String();
+	items := []WithdrawItem{ { amount: decimal.New(1, -1), currency: "eth" } };
+
+	tx, err := testDb.Begin();
+
+	if err != nil {
+		t.Fatal("Failed to begin transaction: ", err);
+	}
+
+	withdrawalId, err := holdWithdrawalRequest(wallet, "ethereum", items, 0, tx);
+
+	if err != nil {
+		tx.Rollback();
+		t.Fatal("Failed to hold withdrawal: ", err);
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal("Failed to commit held withdrawal: ", err);
+	}
+
+	withdrawal, err := withdrawals.GetById(testDb, withdrawalId);
+
+	if err != nil || withdrawal == nil {
+		t.Fatal("Failed to get held withdrawal: ", err);
+	}
+
+	sign := func(tx *sql.Tx) (int64, []byte, string, error) {
+		nonce, err := nextNonce(tx, wallet, "ethereum");
+
+		if err != nil {
+			return 0, nil, "", err;
+		}
+
+		_, sig, err := createWithdrawalRequest(agent, wallet, items, "ethereum", nonce, cfg);
+
+		return nonce, []byte("{}"), sig, err;
+	};
+
+	nonce, err := withdrawals.Approve(testDb, withdrawal, 0, sign);
+
+	if err != nil {
+		t.Fatal("Failed to approve withdrawal: ", err);
+	}
+
+	// The held row keeps nonce 0 until it is replaced.
+	if nonce != 1 {
+		t.Fatal("Unexpected nonce on approval: ", nonce);
+	}
+
+	signed := false;
+
+	_, err = withdrawals.Approve(testDb, withdrawal, 0, func(tx *sql.Tx) (int64, []byte, string, error) {
+		signed = true;
+		return sign(tx);
+	});
+
+	if err != withdrawals.ErrNotInReview || signed {
+		t.Fatal("Approved withdrawal approved again: ", err);
+	}
+}
+
+func TestValidateWithdrawParamsChain(t *testing.T) {
+	var params WithdrawParams;
+
+	_, err := validateWithdrawParams(&params, cfg, map[string]any{
+		"amount": "1",
+		"currency": "eth",
+	});
+
+	if err != ErrInvalidChain {
+		t.Fatal("Chain must be given when several are configured: ", err);
+	}
+
+	_, err = validateWithdrawParams(&params, cfg, map[string]any{
+		"chain": "polygon",
+		"amount": "1",
+		"currency": "btc",
+	});
+
+	if err != ErrInvalidCurrency {
+		t.Fatal("Accepted a currency the chain does not support: ", err);
+	}
+
+	_, err = validateWithdrawParams(&params, cfg, map[string]any{
+		"chain": "polygon",
+		"amount": "1",
+		"currency": "eth",
+	});
+
+	if err != nil || params.chain != "polygon" {
+		t.Fatal("Failed to validate withdrawal on polygon: ", err);
+	}
+}
+
+func TestNeedsReview(t *testing.T) {
+	usdRates := map[string]decimal.Decimal{
+		"eth": decimal.RequireFromString("3000"),
+	};
+
+	small := []WithdrawItem{ { amount: decimal.RequireFromString("1"), currency: "eth" } };
+
+	if needsReview(small, usdRates, cfg) {
+		t.Fatal("Small withdrawal held for review");
+	}
+
+	overAmount := []WithdrawItem{ { amount: decimal.RequireFromString("11"), currency: "eth" } };
+
+	if !needsReview(overAmount, usdRates, cfg) {
+		t.Fatal("Withdrawal above amount threshold not held");
+	}
+
+	// 9 eth is below the amount threshold but worth more than the USD
+	// threshold at this rate.
+	overUsd := []WithdrawItem{ { amount: decimal.RequireFromString("9"), currency: "eth" } };
+
+	if !needsReview(overUsd, usdRates, cfg) {
+		t.Fatal("Withdrawal above USD threshold not held");
+	}
+
+	// Any item over its threshold holds the whole request, and an
+	// item that cannot be valued in USD is held too.
+	withUnpriced := []WithdrawItem{
+		{ amount: decimal.RequireFromString("1"), currency: "eth" },
+		{ amount: decimal.RequireFromString("0.1"), currency: "btc" },
+	};
+
+	if !needsReview(withUnpriced, usdRates, cfg) {
+		t.Fatal("Withdrawal without a USD rate not held");
+	}
+
+	usdRates["btc"] = decimal.RequireFromString("60000");
+
+	if needsReview(withUnpriced, usdRates, cfg) {
+		t.Fatal("Priced withdrawal below thresholds held for review");
+	}
+}